@@ -78,7 +78,7 @@ import (
  	defer historyStore.Close()
  
  	natsAdapter := &NATSClientAdapter{nc: nc}
- 	memoryService := memory.NewMemoryService(natsAdapter, &memCfg, historyStore)
+ 	memoryService := memory.NewMemoryService(natsAdapter, &memCfg, historyStore, nil, nil)
  
  	// 4. Add Memory
  	addReq := memory.AddMemoryRequest{
@@ -0,0 +1,240 @@
+// Command gomem-graph exports knowledge graphs from a graph store to GraphML, JSON-LD or a
+// Cypher script, and imports them back.
+//
+//	gomem-graph export -config graph.json -user alice,bob -out graph.graphml
+//	gomem-graph import -embedded graph.db -in graph.graphml -dry-run
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/log"
+
+	"github.com/pnocera/gomem/pkg/graphs"
+)
+
+const usage = `usage: gomem-graph <export|import> [flags]
+
+Store flags (one of):
+  -config file    JSON graphs.GraphStoreConfig
+  -embedded path  SQLite file of the embedded graph store
+
+Run "gomem-graph export -h" or "gomem-graph import -h" for the other flags.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var err error
+	switch os.Args[1] {
+	case "export":
+		err = runExport(os.Args[2:])
+	case "import":
+		err = runImport(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// storeFlags are the flags selecting the graph store.
+type storeFlags struct {
+	config   string
+	embedded string
+}
+
+func (f *storeFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.config, "config", "", "JSON graphs.GraphStoreConfig file")
+	fs.StringVar(&f.embedded, "embedded", "", "SQLite file of the embedded graph store")
+}
+
+// load returns the configuration of the selected store.
+func (f *storeFlags) load() (*graphs.GraphStoreConfig, error) {
+	cfg := &graphs.GraphStoreConfig{}
+	switch {
+	case f.config != "" && f.embedded != "":
+		return nil, fmt.Errorf("-config and -embedded are mutually exclusive")
+	case f.config != "":
+		data, err := os.ReadFile(f.config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read graph store config: %w", err)
+		}
+		if err := json.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse graph store config: %w", err)
+		}
+	case f.embedded != "":
+		cfg.Provider = "embedded"
+		cfg.Config = &graphs.EmbeddedConfig{Path: f.embedded}
+	default:
+		return nil, fmt.Errorf("a graph store is required: pass -config or -embedded")
+	}
+	return cfg, nil
+}
+
+func (f *storeFlags) open(ctx context.Context) (graphs.GraphStore, error) {
+	cfg, err := f.load()
+	if err != nil {
+		return nil, err
+	}
+	return graphs.NewGraphStore(ctx, cfg)
+}
+
+// scopeFlags are the flags selecting graph scopes.
+type scopeFlags struct {
+	users string
+	agent string
+	run   string
+}
+
+func (f *scopeFlags) register(fs *flag.FlagSet, usersUsage string) {
+	fs.StringVar(&f.users, "user", "", usersUsage)
+	fs.StringVar(&f.agent, "agent", "", "agent_id of the scope")
+	fs.StringVar(&f.run, "run", "", "run_id of the scope")
+}
+
+func (f *scopeFlags) filters() []graphs.Filter {
+	var filters []graphs.Filter
+	for _, user := range strings.Split(f.users, ",") {
+		if user = strings.TrimSpace(user); user != "" {
+			filters = append(filters, graphs.Filter{UserID: user, AgentID: f.agent, RunID: f.run})
+		}
+	}
+	return filters
+}
+
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	var (
+		store  storeFlags
+		scopes scopeFlags
+	)
+	store.register(fs)
+	scopes.register(fs, "comma-separated user_ids to export (required)")
+	format := fs.String("format", "", "graphml, jsonld or cypher; defaults from the -out extension")
+	out := fs.String("out", "", "output file; defaults to stdout")
+	baseLabel := fs.Bool("base-label", false, "key Cypher nodes by the base label, for Memgraph or Neo4j with base_label; defaults to the exported store's schema")
+	fs.Parse(args)
+
+	filters := scopes.filters()
+	if len(filters) == 0 {
+		return fmt.Errorf("-user is required")
+	}
+	f, err := resolveFormat(*format, *out)
+	if err != nil {
+		return err
+	}
+	cfg, err := store.load()
+	if err != nil {
+		return err
+	}
+	opts := graphs.ExportOptions{BaseLabel: cfg.UsesBaseLabel()}
+	fs.Visit(func(fl *flag.Flag) {
+		if fl.Name == "base-label" {
+			opts.BaseLabel = *baseLabel
+		}
+	})
+	ctx := context.Background()
+	gs, err := graphs.NewGraphStore(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer gs.Close()
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", *out, err)
+		}
+		defer file.Close()
+		w = file
+	}
+	if err := graphs.ExportGraph(ctx, gs, w, f, opts, filters...); err != nil {
+		return err
+	}
+	log.Infof("Exported %d scope(s) as %s", len(filters), f)
+	return nil
+}
+
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	var (
+		store  storeFlags
+		scopes scopeFlags
+	)
+	store.register(fs)
+	scopes.register(fs, "user_id to load every graph into, instead of the exported ones")
+	format := fs.String("format", "", "graphml, jsonld or cypher; defaults from the -in extension")
+	in := fs.String("in", "", "input file; defaults to stdin")
+	replace := fs.Bool("replace", false, "reset each target scope before loading it")
+	dryRun := fs.Bool("dry-run", false, "validate the input without writing")
+	fs.Parse(args)
+
+	f, err := resolveFormat(*format, *in)
+	if err != nil {
+		return err
+	}
+	opts := graphs.ImportOptions{Replace: *replace, DryRun: *dryRun}
+	switch filters := scopes.filters(); len(filters) {
+	case 0:
+	case 1:
+		opts.Scope = &filters[0]
+	default:
+		return fmt.Errorf("-user takes a single user_id on import")
+	}
+
+	var r io.Reader = os.Stdin
+	if *in != "" {
+		file, err := os.Open(*in)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", *in, err)
+		}
+		defer file.Close()
+		r = file
+	}
+	ctx := context.Background()
+	gs, err := store.open(ctx)
+	if err != nil {
+		return err
+	}
+	defer gs.Close()
+
+	result, err := graphs.ImportGraph(ctx, gs, r, f, opts)
+	if err != nil {
+		return err
+	}
+	verb := "Imported"
+	if opts.DryRun {
+		verb = "Validated"
+	}
+	log.Infof("%s %d relation(s) in %d scope(s)", verb, result.Relations, len(result.Scopes))
+	return nil
+}
+
+// resolveFormat returns the format named by flag, or the one matching path's extension.
+func resolveFormat(flagValue string, path string) (graphs.ExportFormat, error) {
+	if flagValue != "" {
+		return graphs.ParseExportFormat(flagValue)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".graphml", ".xml":
+		return graphs.FormatGraphML, nil
+	case ".jsonld", ".json":
+		return graphs.FormatJSONLD, nil
+	case ".cypher", ".cql":
+		return graphs.FormatCypher, nil
+	}
+	return "", fmt.Errorf("-format is required when it cannot be inferred from the file name")
+}
@@ -0,0 +1,23 @@
+// Package vecmath holds the vector arithmetic shared by the memory, graph and vector store
+// packages.
+package vecmath
+
+import "math"
+
+// Cosine returns the cosine of the angle between a and b, or 0 when the lengths differ or
+// either vector is zero.
+func Cosine(a, b []float32) float32 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return float32(dot / (math.Sqrt(normA) * math.Sqrt(normB)))
+}
@@ -0,0 +1,493 @@
+// Package bolttest runs a scripted in-process Bolt server, for tests of code that talks to
+// Neo4j or Memgraph through boltclient without a database:
+//
+//	srv := bolttest.NewServer(t, func(run bolttest.Run) bolttest.Result {
+//		return bolttest.Result{Fields: []string{"n"}, Records: [][]interface{}{{int64(1)}}}
+//	})
+//	conn, err := boltclient.Dial(ctx, boltclient.Config{URL: srv.URL()})
+//
+// The server negotiates Bolt 5.0, accepts any HELLO, and answers every RUN with the result
+// of the script; BEGIN, COMMIT, ROLLBACK and RESET succeed. After a FAILURE it ignores
+// requests until RESET, like a real server. Its PackStream codec is written independently
+// of boltclient's, so that both sides of the wire are checked against each other.
+package bolttest
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sync"
+	"testing"
+)
+
+// Message tags, as in the Bolt specification.
+const (
+	TagHello    = 0x01
+	TagGoodbye  = 0x02
+	TagReset    = 0x0F
+	TagRun      = 0x10
+	TagBegin    = 0x11
+	TagCommit   = 0x12
+	TagRollback = 0x13
+	TagPull     = 0x3F
+
+	tagSuccess = 0x70
+	tagRecord  = 0x71
+	tagIgnored = 0x7E
+	tagFailure = 0x7F
+)
+
+// Agent is the server agent returned by HELLO.
+const Agent = "Neo4j/5.20.0"
+
+// Message is a request received by the server.
+type Message struct {
+	Tag    byte
+	Fields []interface{}
+}
+
+// Meta returns the map field at index i, or nil.
+func (m Message) Meta(i int) map[string]interface{} {
+	if i >= len(m.Fields) {
+		return nil
+	}
+	meta, _ := m.Fields[i].(map[string]interface{})
+	return meta
+}
+
+// Run is a RUN request handed to the script.
+type Run struct {
+	Query  string
+	Params map[string]interface{}
+	Extra  map[string]interface{} // Metadata such as "db"; empty inside a transaction
+	InTx   bool
+}
+
+// Result is the script's answer to a RUN. A non-empty FailureCode fails the query.
+type Result struct {
+	Fields         []string
+	Records        [][]interface{}
+	FailureCode    string
+	FailureMessage string
+}
+
+// Script answers the queries run against the server.
+type Script func(run Run) Result
+
+// Server is a scripted Bolt server listening on a local port.
+type Server struct {
+	t        testing.TB
+	script   Script
+	listener net.Listener
+
+	mu       sync.Mutex
+	requests []Message
+}
+
+// NewServer starts a server answering queries with script. It is stopped at cleanup.
+func NewServer(t testing.TB, script Script) *Server {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("bolttest: failed to listen: %v", err)
+	}
+	s := &Server{t: t, script: script, listener: listener}
+	go s.accept()
+	t.Cleanup(func() { listener.Close() })
+	return s
+}
+
+// URL returns the bolt:// URL of the server.
+func (s *Server) URL() string {
+	return "bolt://" + s.listener.Addr().String()
+}
+
+// Requests returns the requests received so far, on every connection, in order.
+func (s *Server) Requests() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.requests...)
+}
+
+// Count returns the number of requests received with tag.
+func (s *Server) Count(tag byte) int {
+	n := 0
+	for _, m := range s.Requests() {
+		if m.Tag == tag {
+			n++
+		}
+	}
+	return n
+}
+
+// Queries returns the queries of the RUN requests received so far.
+func (s *Server) Queries() []string {
+	var queries []string
+	for _, m := range s.Requests() {
+		if m.Tag == TagRun && len(m.Fields) > 0 {
+			q, _ := m.Fields[0].(string)
+			queries = append(queries, q)
+		}
+	}
+	return queries
+}
+
+func (s *Server) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.serve(conn)
+	}
+}
+
+// serve answers one connection until the client says GOODBYE or hangs up.
+func (s *Server) serve(conn net.Conn) {
+	defer conn.Close()
+	var preamble [20]byte
+	if _, err := io.ReadFull(conn, preamble[:]); err != nil {
+		return
+	}
+	if binary.BigEndian.Uint32(preamble[:4]) != 0x6060B017 {
+		s.t.Errorf("bolttest: bad handshake preamble % X", preamble[:4])
+		return
+	}
+	if _, err := conn.Write([]byte{0, 0, 0, 5}); err != nil {
+		return
+	}
+
+	var failed, inTx bool
+	var pending [][]interface{}
+	for {
+		msg, err := readMessage(conn)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				s.t.Errorf("bolttest: %v", err)
+			}
+			return
+		}
+		s.mu.Lock()
+		s.requests = append(s.requests, msg)
+		s.mu.Unlock()
+
+		var replies []Message
+		switch {
+		case msg.Tag == TagGoodbye:
+			return
+		case msg.Tag == TagReset:
+			failed, inTx, pending = false, false, nil
+			replies = []Message{success(nil)}
+		case failed:
+			replies = []Message{{Tag: tagIgnored}}
+		case msg.Tag == TagHello:
+			replies = []Message{success(map[string]interface{}{"server": Agent, "connection_id": "bolt-1"})}
+		case msg.Tag == TagBegin:
+			inTx = true
+			replies = []Message{success(nil)}
+		case msg.Tag == TagCommit || msg.Tag == TagRollback:
+			inTx = false
+			replies = []Message{success(nil)}
+		case msg.Tag == TagRun:
+			run := Run{Params: msg.Meta(1), Extra: msg.Meta(2), InTx: inTx}
+			if len(msg.Fields) > 0 {
+				run.Query, _ = msg.Fields[0].(string)
+			}
+			result := s.script(run)
+			if result.FailureCode != "" {
+				failed = true
+				replies = []Message{{Tag: tagFailure, Fields: []interface{}{map[string]interface{}{
+					"code": result.FailureCode, "message": result.FailureMessage,
+				}}}}
+				break
+			}
+			fields := make([]interface{}, len(result.Fields))
+			for i, f := range result.Fields {
+				fields[i] = f
+			}
+			pending = result.Records
+			replies = []Message{success(map[string]interface{}{"fields": fields})}
+		case msg.Tag == TagPull:
+			for _, record := range pending {
+				replies = append(replies, Message{Tag: tagRecord, Fields: []interface{}{record}})
+			}
+			pending = nil
+			replies = append(replies, success(map[string]interface{}{"type": "rw"}))
+		default:
+			s.t.Errorf("bolttest: unexpected request 0x%02X", msg.Tag)
+			return
+		}
+		for _, reply := range replies {
+			if err := writeMessage(conn, reply); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func success(meta map[string]interface{}) Message {
+	if meta == nil {
+		meta = map[string]interface{}{}
+	}
+	return Message{Tag: tagSuccess, Fields: []interface{}{meta}}
+}
+
+// readMessage reads one chunked message.
+func readMessage(r io.Reader) (Message, error) {
+	var data []byte
+	var header [2]byte
+	for {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return Message{}, err
+		}
+		size := int(binary.BigEndian.Uint16(header[:]))
+		if size == 0 {
+			if len(data) == 0 {
+				continue
+			}
+			break
+		}
+		start := len(data)
+		data = append(data, make([]byte, size)...)
+		if _, err := io.ReadFull(r, data[start:]); err != nil {
+			return Message{}, err
+		}
+	}
+	d := &decoder{buf: data}
+	v, err := d.value()
+	if err != nil {
+		return Message{}, err
+	}
+	msg, ok := v.(Message)
+	if !ok {
+		return Message{}, fmt.Errorf("request is %T, expected a structure", v)
+	}
+	return msg, nil
+}
+
+// writeMessage writes msg as a single chunk.
+func writeMessage(w io.Writer, msg Message) error {
+	e := &encoder{}
+	if err := e.value(msg); err != nil {
+		return err
+	}
+	out := binary.BigEndian.AppendUint16(nil, uint16(len(e.buf)))
+	out = append(out, e.buf...)
+	out = append(out, 0, 0)
+	_, err := w.Write(out)
+	return err
+}
+
+// encoder writes the PackStream values used in replies.
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) size(n int, tiny, m8, m16 byte) {
+	switch {
+	case n < 16:
+		e.buf = append(e.buf, tiny|byte(n))
+	case n <= math.MaxUint8:
+		e.buf = append(e.buf, m8, byte(n))
+	default:
+		e.buf = append(e.buf, m16)
+		e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(n))
+	}
+}
+
+func (e *encoder) value(v interface{}) error {
+	switch x := v.(type) {
+	case nil:
+		e.buf = append(e.buf, 0xC0)
+	case bool:
+		if x {
+			e.buf = append(e.buf, 0xC3)
+		} else {
+			e.buf = append(e.buf, 0xC2)
+		}
+	case int:
+		return e.value(int64(x))
+	case int64:
+		e.buf = append(e.buf, 0xCB)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, uint64(x))
+	case float64:
+		e.buf = append(e.buf, 0xC1)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, math.Float64bits(x))
+	case string:
+		e.size(len(x), 0x80, 0xD0, 0xD1)
+		e.buf = append(e.buf, x...)
+	case []string:
+		e.size(len(x), 0x90, 0xD4, 0xD5)
+		for _, s := range x {
+			e.value(s)
+		}
+	case []interface{}:
+		e.size(len(x), 0x90, 0xD4, 0xD5)
+		for _, item := range x {
+			if err := e.value(item); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		e.size(len(x), 0xA0, 0xD8, 0xD9)
+		for k, item := range x {
+			e.value(k)
+			if err := e.value(item); err != nil {
+				return err
+			}
+		}
+	case Message:
+		e.buf = append(e.buf, 0xB0|byte(len(x.Fields)), x.Tag)
+		for _, f := range x.Fields {
+			if err := e.value(f); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("bolttest: cannot encode %T", v)
+	}
+	return nil
+}
+
+// decoder reads the PackStream values used in requests. Structures decode as Message.
+type decoder struct {
+	buf []byte
+}
+
+func (d *decoder) take(n int) ([]byte, error) {
+	if n > len(d.buf) {
+		return nil, fmt.Errorf("bolttest: truncated value")
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b, nil
+}
+
+// length reads the size following a sized marker of 1, 2 or 4 bytes.
+func (d *decoder) length(bytes int) (int, error) {
+	b, err := d.take(bytes)
+	if err != nil {
+		return 0, err
+	}
+	switch bytes {
+	case 1:
+		return int(b[0]), nil
+	case 2:
+		return int(binary.BigEndian.Uint16(b)), nil
+	default:
+		return int(binary.BigEndian.Uint32(b)), nil
+	}
+}
+
+func (d *decoder) value() (interface{}, error) {
+	b, err := d.take(1)
+	if err != nil {
+		return nil, err
+	}
+	marker := b[0]
+	switch {
+	case marker < 0x80:
+		return int64(marker), nil
+	case marker >= 0xF0:
+		return int64(int8(marker)), nil
+	case marker&0xF0 == 0x80:
+		return d.str(int(marker & 0x0F))
+	case marker&0xF0 == 0x90:
+		return d.list(int(marker & 0x0F))
+	case marker&0xF0 == 0xA0:
+		return d.dict(int(marker & 0x0F))
+	case marker&0xF0 == 0xB0:
+		tag, err := d.take(1)
+		if err != nil {
+			return nil, err
+		}
+		fields, err := d.list(int(marker & 0x0F))
+		if err != nil {
+			return nil, err
+		}
+		return Message{Tag: tag[0], Fields: fields}, nil
+	}
+	switch marker {
+	case 0xC0:
+		return nil, nil
+	case 0xC2:
+		return false, nil
+	case 0xC3:
+		return true, nil
+	case 0xC1:
+		b, err := d.take(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	case 0xC8, 0xC9, 0xCA, 0xCB:
+		size := 1 << (marker - 0xC8)
+		b, err := d.take(size)
+		if err != nil {
+			return nil, err
+		}
+		var n uint64
+		for _, x := range b {
+			n = n<<8 | uint64(x)
+		}
+		shift := 64 - 8*size
+		return int64(n<<shift) >> shift, nil
+	case 0xD0, 0xD1, 0xD2:
+		n, err := d.length(1 << (marker - 0xD0))
+		if err != nil {
+			return nil, err
+		}
+		return d.str(n)
+	case 0xD4, 0xD5, 0xD6:
+		n, err := d.length(1 << (marker - 0xD4))
+		if err != nil {
+			return nil, err
+		}
+		return d.list(n)
+	case 0xD8, 0xD9, 0xDA:
+		n, err := d.length(1 << (marker - 0xD8))
+		if err != nil {
+			return nil, err
+		}
+		return d.dict(n)
+	}
+	return nil, fmt.Errorf("bolttest: unsupported marker 0x%02X", marker)
+}
+
+func (d *decoder) str(n int) (string, error) {
+	b, err := d.take(n)
+	return string(b), err
+}
+
+func (d *decoder) list(n int) ([]interface{}, error) {
+	items := make([]interface{}, n)
+	for i := range items {
+		v, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		items[i] = v
+	}
+	return items, nil
+}
+
+func (d *decoder) dict(n int) (map[string]interface{}, error) {
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		k, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("bolttest: map key is %T", k)
+		}
+		if m[key], err = d.value(); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,488 @@
+// Package boltclient implements a minimal client for the Bolt protocol (versions 4.0 to 5.0)
+// spoken by Neo4j and Memgraph. It supports auto-commit queries and explicit transactions
+// over a single connection; routing and connection pooling are left to the caller.
+package boltclient
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Request and response message tags.
+const (
+	msgHello    = 0x01
+	msgGoodbye  = 0x02
+	msgReset    = 0x0F
+	msgRun      = 0x10
+	msgBegin    = 0x11
+	msgCommit   = 0x12
+	msgRollback = 0x13
+	msgPull     = 0x3F
+
+	msgSuccess = 0x70
+	msgRecord  = 0x71
+	msgIgnored = 0x7E
+	msgFailure = 0x7F
+)
+
+const (
+	defaultPort      = "7687"
+	defaultUserAgent = "gomem-boltclient/1.0"
+	maxChunkSize     = 0xFFFF
+)
+
+// handshake is the Bolt preamble followed by four proposed versions, in preference order:
+// 5.0, 4.4 down to 4.2, 4.1 and 4.0. Each version is [reserved, range, minor, major].
+var handshake = []byte{
+	0x60, 0x60, 0xB0, 0x17,
+	0x00, 0x00, 0x00, 0x05,
+	0x00, 0x02, 0x04, 0x04,
+	0x00, 0x00, 0x01, 0x04,
+	0x00, 0x00, 0x00, 0x04,
+}
+
+// ErrConnectionBroken is returned for requests on a connection that failed mid-exchange.
+var ErrConnectionBroken = errors.New("bolt connection is broken")
+
+// Error is a FAILURE reported by the server.
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// Config holds the settings used to open a connection.
+type Config struct {
+	URL         string // bolt://, neo4j://, bolt+s://, neo4j+s://, bolt+ssc:// or neo4j+ssc://
+	Username    string
+	Password    string
+	UserAgent   string
+	DialTimeout time.Duration
+}
+
+// Result holds the records of a query.
+type Result struct {
+	Keys    []string
+	Records [][]interface{}
+	Summary map[string]interface{} // Metadata of the final SUCCESS message
+}
+
+// Rows returns the records as maps keyed by column name.
+func (r *Result) Rows() []map[string]interface{} {
+	rows := make([]map[string]interface{}, len(r.Records))
+	for i, rec := range r.Records {
+		row := make(map[string]interface{}, len(r.Keys))
+		for j, k := range r.Keys {
+			if j < len(rec) {
+				row[k] = rec[j]
+			}
+		}
+		rows[i] = row
+	}
+	return rows
+}
+
+// Conn is a single Bolt connection. It is safe for concurrent use; requests are serialized.
+type Conn struct {
+	mu      sync.Mutex
+	conn    net.Conn
+	r       *bufio.Reader
+	major   byte
+	minor   byte
+	server  string
+	broken  bool
+	inTx    bool
+	scratch packer
+}
+
+// Dial opens a connection, negotiates the protocol version and authenticates with HELLO.
+func Dial(ctx context.Context, cfg Config) (*Conn, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bolt URL %q: %w", cfg.URL, err)
+	}
+	var tlsCfg *tls.Config
+	switch u.Scheme {
+	case "bolt", "neo4j":
+	case "bolt+s", "neo4j+s":
+		tlsCfg = &tls.Config{ServerName: u.Hostname()}
+	case "bolt+ssc", "neo4j+ssc":
+		tlsCfg = &tls.Config{ServerName: u.Hostname(), InsecureSkipVerify: true}
+	default:
+		return nil, fmt.Errorf("unsupported bolt URL scheme %q", u.Scheme)
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), defaultPort)
+	}
+
+	dialer := &net.Dialer{Timeout: cfg.DialTimeout}
+	var nc net.Conn
+	if tlsCfg != nil {
+		nc, err = (&tls.Dialer{NetDialer: dialer, Config: tlsCfg}).DialContext(ctx, "tcp", addr)
+	} else {
+		nc, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+
+	c := &Conn{conn: nc, r: bufio.NewReader(nc)}
+	if err := c.open(ctx, cfg); err != nil {
+		nc.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// NewConn performs the handshake and HELLO over an existing transport, e.g. an in-process pipe.
+func NewConn(ctx context.Context, nc net.Conn, cfg Config) (*Conn, error) {
+	c := &Conn{conn: nc, r: bufio.NewReader(nc)}
+	if err := c.open(ctx, cfg); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Conn) open(ctx context.Context, cfg Config) error {
+	stop := c.watch(ctx)
+	defer stop()
+
+	if _, err := c.conn.Write(handshake); err != nil {
+		return fmt.Errorf("bolt handshake failed: %w", err)
+	}
+	var version [4]byte
+	if _, err := io.ReadFull(c.r, version[:]); err != nil {
+		return fmt.Errorf("bolt handshake failed: %w", err)
+	}
+	c.minor, c.major = version[2], version[3]
+	if c.major == 0 {
+		return fmt.Errorf("server does not support any proposed bolt version")
+	}
+
+	userAgent := cfg.UserAgent
+	if userAgent == "" {
+		userAgent = defaultUserAgent
+	}
+	extra := map[string]interface{}{"user_agent": userAgent}
+	if cfg.Username != "" {
+		extra["scheme"] = "basic"
+		extra["principal"] = cfg.Username
+		extra["credentials"] = cfg.Password
+	} else {
+		extra["scheme"] = "none"
+	}
+	if err := c.send(msgHello, extra); err != nil {
+		return err
+	}
+	meta, err := c.expectSuccess()
+	if err != nil {
+		return fmt.Errorf("bolt authentication failed: %w", err)
+	}
+	c.server, _ = meta["server"].(string)
+	return nil
+}
+
+// Version returns the negotiated protocol version, e.g. "5.0".
+func (c *Conn) Version() string {
+	return fmt.Sprintf("%d.%d", c.major, c.minor)
+}
+
+// Server returns the server agent reported in the HELLO response, e.g. "Neo4j/5.20.0".
+func (c *Conn) Server() string {
+	return c.server
+}
+
+// Run executes a query and pulls all of its records. extra carries RUN metadata such as
+// "db" and "mode"; it must be nil inside an explicit transaction.
+func (c *Conn) Run(ctx context.Context, query string, params map[string]interface{}, extra map[string]interface{}) (*Result, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.ready(ctx); err != nil {
+		return nil, err
+	}
+	stop := c.watch(ctx)
+	defer stop()
+
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	if extra == nil {
+		extra = map[string]interface{}{}
+	}
+	// RUN and PULL are pipelined; a failed RUN makes the server ignore the PULL.
+	if err := c.send(msgRun, query, params, extra); err != nil {
+		return nil, err
+	}
+	if err := c.send(msgPull, map[string]interface{}{"n": int64(-1)}); err != nil {
+		return nil, err
+	}
+
+	meta, runErr := c.expectSuccess()
+	result := &Result{}
+	if runErr == nil {
+		result.Keys = asStrings(meta["fields"])
+	}
+	for {
+		tag, fields, err := c.receive()
+		if err != nil {
+			return nil, err
+		}
+		switch tag {
+		case msgRecord:
+			if len(fields) > 0 {
+				rec, _ := fields[0].([]interface{})
+				result.Records = append(result.Records, rec)
+			}
+			continue
+		case msgSuccess:
+			result.Summary = fieldMap(fields)
+		case msgFailure:
+			if runErr == nil {
+				runErr = failure(fields)
+			}
+		case msgIgnored:
+		default:
+			c.broken = true
+			return nil, fmt.Errorf("unexpected bolt message 0x%02X", tag)
+		}
+		break
+	}
+	if runErr != nil {
+		return nil, c.recover(runErr)
+	}
+	return result, nil
+}
+
+// Begin starts an explicit transaction. extra carries BEGIN metadata such as "db".
+func (c *Conn) Begin(ctx context.Context, extra map[string]interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.ready(ctx); err != nil {
+		return err
+	}
+	if c.inTx {
+		return fmt.Errorf("a transaction is already open")
+	}
+	if extra == nil {
+		extra = map[string]interface{}{}
+	}
+	if err := c.request(ctx, msgBegin, extra); err != nil {
+		return err
+	}
+	c.inTx = true
+	return nil
+}
+
+// Commit commits the open transaction.
+func (c *Conn) Commit(ctx context.Context) error {
+	return c.endTx(ctx, msgCommit)
+}
+
+// Rollback rolls back the open transaction. It is a no-op without one.
+func (c *Conn) Rollback(ctx context.Context) error {
+	c.mu.Lock()
+	open := c.inTx
+	c.mu.Unlock()
+	if !open {
+		return nil
+	}
+	return c.endTx(ctx, msgRollback)
+}
+
+func (c *Conn) endTx(ctx context.Context, tag byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.ready(ctx); err != nil {
+		return err
+	}
+	if !c.inTx {
+		return fmt.Errorf("no transaction is open")
+	}
+	c.inTx = false
+	return c.request(ctx, tag)
+}
+
+// Close sends GOODBYE and closes the connection.
+func (c *Conn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.broken {
+		_ = c.send(msgGoodbye)
+	}
+	c.broken = true
+	return c.conn.Close()
+}
+
+// request sends a message and waits for its SUCCESS. Callers must hold c.mu.
+func (c *Conn) request(ctx context.Context, tag byte, fields ...interface{}) error {
+	stop := c.watch(ctx)
+	defer stop()
+	if err := c.send(tag, fields...); err != nil {
+		return err
+	}
+	if _, err := c.expectSuccess(); err != nil {
+		return c.recover(err)
+	}
+	return nil
+}
+
+func (c *Conn) ready(ctx context.Context) error {
+	if c.broken {
+		return ErrConnectionBroken
+	}
+	return ctx.Err()
+}
+
+// watch interrupts blocking I/O when ctx is done. The returned function stops watching.
+func (c *Conn) watch(ctx context.Context) func() {
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = c.conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		_ = c.conn.SetDeadline(time.Now())
+	})
+	return func() {
+		stop()
+		_ = c.conn.SetDeadline(time.Time{})
+	}
+}
+
+// recover resets the connection after a server FAILURE so it can be reused, and returns err.
+// Transport errors mark the connection broken.
+func (c *Conn) recover(err error) error {
+	var boltErr *Error
+	if !errors.As(err, &boltErr) {
+		c.broken = true
+		return err
+	}
+	c.inTx = false
+	if sendErr := c.send(msgReset); sendErr != nil {
+		return err
+	}
+	for {
+		tag, _, recvErr := c.receive()
+		if recvErr != nil {
+			return err
+		}
+		if tag == msgSuccess || tag == msgFailure {
+			if tag == msgFailure {
+				c.broken = true
+			}
+			return err
+		}
+	}
+}
+
+// expectSuccess reads one response and returns its metadata, or the server error.
+func (c *Conn) expectSuccess() (map[string]interface{}, error) {
+	tag, fields, err := c.receive()
+	if err != nil {
+		return nil, err
+	}
+	switch tag {
+	case msgSuccess:
+		return fieldMap(fields), nil
+	case msgFailure:
+		return nil, failure(fields)
+	case msgIgnored:
+		return nil, &Error{Code: "Gomem.ClientError.Ignored", Message: "request was ignored by the server"}
+	default:
+		c.broken = true
+		return nil, fmt.Errorf("unexpected bolt message 0x%02X", tag)
+	}
+}
+
+// send writes a message as chunks followed by the end-of-message marker. Callers must hold c.mu.
+func (c *Conn) send(tag byte, fields ...interface{}) error {
+	p := &c.scratch
+	p.buf = p.buf[:0]
+	p.structHeader(tag, len(fields))
+	for _, f := range fields {
+		if err := p.pack(f); err != nil {
+			return err
+		}
+	}
+
+	out := make([]byte, 0, len(p.buf)+4+2*(len(p.buf)/maxChunkSize))
+	for data := p.buf; len(data) > 0; {
+		n := len(data)
+		if n > maxChunkSize {
+			n = maxChunkSize
+		}
+		out = binary.BigEndian.AppendUint16(out, uint16(n))
+		out = append(out, data[:n]...)
+		data = data[n:]
+	}
+	out = append(out, 0, 0)
+	if _, err := c.conn.Write(out); err != nil {
+		c.broken = true
+		return fmt.Errorf("bolt write failed: %w", err)
+	}
+	return nil
+}
+
+// receive reads one message and returns its tag and fields. Callers must hold c.mu.
+func (c *Conn) receive() (byte, []interface{}, error) {
+	var msg []byte
+	var header [2]byte
+	for {
+		if _, err := io.ReadFull(c.r, header[:]); err != nil {
+			c.broken = true
+			return 0, nil, fmt.Errorf("bolt read failed: %w", err)
+		}
+		size := int(binary.BigEndian.Uint16(header[:]))
+		if size == 0 {
+			if len(msg) == 0 {
+				continue // NOOP keep-alive chunk
+			}
+			break
+		}
+		start := len(msg)
+		msg = append(msg, make([]byte, size)...)
+		if _, err := io.ReadFull(c.r, msg[start:]); err != nil {
+			c.broken = true
+			return 0, nil, fmt.Errorf("bolt read failed: %w", err)
+		}
+	}
+
+	u := &unpacker{buf: msg}
+	v, err := u.unpack()
+	if err != nil {
+		c.broken = true
+		return 0, nil, err
+	}
+	s, ok := v.(*Structure)
+	if !ok {
+		c.broken = true
+		return 0, nil, fmt.Errorf("bolt message is %T, expected a structure", v)
+	}
+	return s.Tag, s.Fields, nil
+}
+
+func fieldMap(fields []interface{}) map[string]interface{} {
+	if len(fields) == 0 {
+		return map[string]interface{}{}
+	}
+	return asMap(fields[0])
+}
+
+func failure(fields []interface{}) *Error {
+	meta := fieldMap(fields)
+	e := &Error{}
+	e.Code, _ = meta["code"].(string)
+	e.Message, _ = meta["message"].(string)
+	return e
+}
@@ -0,0 +1,154 @@
+package boltclient
+
+import (
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pnocera/gomem/pkg/boltclient/bolttest"
+)
+
+func dialTest(t *testing.T, srv *bolttest.Server) *Conn {
+	t.Helper()
+	conn, err := Dial(context.Background(), Config{URL: srv.URL(), Username: "neo4j", Password: "secret"})
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestConnHelloRunPull(t *testing.T) {
+	srv := bolttest.NewServer(t, func(run bolttest.Run) bolttest.Result {
+		return bolttest.Result{
+			Fields:  []string{"name", "age"},
+			Records: [][]interface{}{{"alice", int64(30)}, {"bob", nil}},
+		}
+	})
+	conn := dialTest(t, srv)
+	if conn.Version() != "5.0" || conn.Server() != bolttest.Agent {
+		t.Errorf("negotiated %s with %q, want 5.0 with %q", conn.Version(), conn.Server(), bolttest.Agent)
+	}
+
+	res, err := conn.Run(context.Background(), "MATCH (n) WHERE n.age > $age RETURN n.name AS name, n.age AS age",
+		map[string]interface{}{"age": 18}, map[string]interface{}{"db": "graph"})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	want := []map[string]interface{}{{"name": "alice", "age": int64(30)}, {"name": "bob", "age": nil}}
+	if !reflect.DeepEqual(res.Rows(), want) {
+		t.Errorf("rows = %v, want %v", res.Rows(), want)
+	}
+
+	requests := srv.Requests()
+	if len(requests) != 3 {
+		t.Fatalf("server received %d requests, want HELLO, RUN and PULL", len(requests))
+	}
+	hello := requests[0].Meta(0)
+	if requests[0].Tag != bolttest.TagHello || hello["scheme"] != "basic" || hello["principal"] != "neo4j" ||
+		hello["credentials"] != "secret" || hello["user_agent"] != defaultUserAgent {
+		t.Errorf("HELLO = %v", hello)
+	}
+	run := requests[1]
+	if run.Tag != bolttest.TagRun || run.Meta(1)["age"] != int64(18) || run.Meta(2)["db"] != "graph" {
+		t.Errorf("RUN = %v", run.Fields)
+	}
+	if pull := requests[2]; pull.Tag != bolttest.TagPull || pull.Meta(0)["n"] != int64(-1) {
+		t.Errorf("PULL = %v", pull.Fields)
+	}
+}
+
+func TestConnFailureResetsConnection(t *testing.T) {
+	srv := bolttest.NewServer(t, func(run bolttest.Run) bolttest.Result {
+		if strings.HasPrefix(run.Query, "BAD") {
+			return bolttest.Result{FailureCode: "Neo.ClientError.Statement.SyntaxError", FailureMessage: "invalid input"}
+		}
+		return bolttest.Result{Fields: []string{"x"}, Records: [][]interface{}{{int64(1)}}}
+	})
+	conn := dialTest(t, srv)
+	ctx := context.Background()
+
+	_, err := conn.Run(ctx, "BAD QUERY", nil, nil)
+	var boltErr *Error
+	if !errors.As(err, &boltErr) || boltErr.Code != "Neo.ClientError.Statement.SyntaxError" || boltErr.Message != "invalid input" {
+		t.Fatalf("Run of a bad query returned %v, want the server's FAILURE", err)
+	}
+	if srv.Count(bolttest.TagReset) != 1 {
+		t.Errorf("client sent %d RESET requests after a FAILURE, want 1", srv.Count(bolttest.TagReset))
+	}
+
+	res, err := conn.Run(ctx, "RETURN 1 AS x", nil, nil)
+	if err != nil {
+		t.Fatalf("Run after a FAILURE: %v", err)
+	}
+	if len(res.Records) != 1 || res.Records[0][0] != int64(1) {
+		t.Errorf("records = %v, want [[1]]", res.Records)
+	}
+}
+
+func TestConnTransaction(t *testing.T) {
+	srv := bolttest.NewServer(t, func(run bolttest.Run) bolttest.Result {
+		if !run.InTx {
+			t.Errorf("query %q ran outside the transaction", run.Query)
+		}
+		return bolttest.Result{}
+	})
+	conn := dialTest(t, srv)
+	ctx := context.Background()
+
+	if err := conn.Begin(ctx, map[string]interface{}{"db": "graph"}); err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	if err := conn.Begin(ctx, nil); err == nil {
+		t.Error("Begin inside a transaction succeeded")
+	}
+	if _, err := conn.Run(ctx, "CREATE (n)", nil, nil); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if err := conn.Commit(ctx); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	if err := conn.Rollback(ctx); err != nil {
+		t.Errorf("Rollback without a transaction: %v", err)
+	}
+
+	var tags []byte
+	for _, m := range srv.Requests() {
+		tags = append(tags, m.Tag)
+	}
+	want := []byte{bolttest.TagHello, bolttest.TagBegin, bolttest.TagRun, bolttest.TagPull, bolttest.TagCommit}
+	if !reflect.DeepEqual(tags, want) {
+		t.Errorf("requests = % X, want % X", tags, want)
+	}
+	if begin := srv.Requests()[1]; begin.Meta(0)["db"] != "graph" {
+		t.Errorf("BEGIN = %v, want db graph", begin.Fields)
+	}
+}
+
+func TestPackStreamRoundTrip(t *testing.T) {
+	long := strings.Repeat("x", 300)
+	values := []interface{}{
+		nil, true, false,
+		int64(0), int64(-16), int64(-17), int64(127), int64(128), int64(-129), int64(40000), int64(-3000000000), int64(math.MaxInt64),
+		1.5, "", "short", long,
+		[]interface{}{int64(1), "two", []interface{}{3.0}},
+		map[string]interface{}{"name": "alice", "tags": []interface{}{"a", "b"}, "nested": map[string]interface{}{"ok": true}},
+	}
+	for _, v := range values {
+		p := &packer{}
+		if err := p.pack(v); err != nil {
+			t.Fatalf("pack(%v): %v", v, err)
+		}
+		u := &unpacker{buf: p.buf}
+		got, err := u.unpack()
+		if err != nil {
+			t.Fatalf("unpack(%v): %v", v, err)
+		}
+		if !reflect.DeepEqual(got, v) {
+			t.Errorf("round trip of %v gave %v", v, got)
+		}
+	}
+}
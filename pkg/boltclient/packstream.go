@@ -0,0 +1,437 @@
+package boltclient
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+)
+
+// PackStream markers.
+const (
+	markerNull    = 0xC0
+	markerFloat   = 0xC1
+	markerFalse   = 0xC2
+	markerTrue    = 0xC3
+	markerInt8    = 0xC8
+	markerInt16   = 0xC9
+	markerInt32   = 0xCA
+	markerInt64   = 0xCB
+	markerBytes8  = 0xCC
+	markerBytes16 = 0xCD
+	markerBytes32 = 0xCE
+	markerString8 = 0xD0
+	markerStr16   = 0xD1
+	markerStr32   = 0xD2
+	markerList8   = 0xD4
+	markerList16  = 0xD5
+	markerList32  = 0xD6
+	markerMap8    = 0xD8
+	markerMap16   = 0xD9
+	markerMap32   = 0xDA
+)
+
+// Structure tags of the graph types returned in records.
+const (
+	tagNode         = 0x4E
+	tagRelationship = 0x52
+)
+
+// Structure is a PackStream structure the client does not map to a Go type, e.g. temporal values.
+type Structure struct {
+	Tag    byte
+	Fields []interface{}
+}
+
+// Node is a graph node returned in a record.
+type Node struct {
+	ID        int64
+	ElementID string // Bolt 5 only
+	Labels    []string
+	Props     map[string]interface{}
+}
+
+// Relationship is a graph relationship returned in a record.
+type Relationship struct {
+	ID        int64
+	StartID   int64
+	EndID     int64
+	Type      string
+	Props     map[string]interface{}
+	ElementID string // Bolt 5 only
+}
+
+// packer appends PackStream-encoded values to buf.
+type packer struct {
+	buf []byte
+}
+
+func (p *packer) structHeader(tag byte, fields int) {
+	p.buf = append(p.buf, 0xB0|byte(fields), tag)
+}
+
+func (p *packer) int(i int64) {
+	switch {
+	case i >= -16 && i <= 127:
+		p.buf = append(p.buf, byte(int8(i)))
+	case i >= math.MinInt8 && i <= math.MaxInt8:
+		p.buf = append(p.buf, markerInt8, byte(int8(i)))
+	case i >= math.MinInt16 && i <= math.MaxInt16:
+		p.buf = append(p.buf, markerInt16)
+		p.buf = binary.BigEndian.AppendUint16(p.buf, uint16(int16(i)))
+	case i >= math.MinInt32 && i <= math.MaxInt32:
+		p.buf = append(p.buf, markerInt32)
+		p.buf = binary.BigEndian.AppendUint32(p.buf, uint32(int32(i)))
+	default:
+		p.buf = append(p.buf, markerInt64)
+		p.buf = binary.BigEndian.AppendUint64(p.buf, uint64(i))
+	}
+}
+
+func (p *packer) float(f float64) {
+	p.buf = append(p.buf, markerFloat)
+	p.buf = binary.BigEndian.AppendUint64(p.buf, math.Float64bits(f))
+}
+
+func (p *packer) sizeHeader(n int, tiny byte, m8, m16, m32 byte) {
+	switch {
+	case tiny != 0 && n < 16:
+		p.buf = append(p.buf, tiny|byte(n))
+	case n <= math.MaxUint8:
+		p.buf = append(p.buf, m8, byte(n))
+	case n <= math.MaxUint16:
+		p.buf = append(p.buf, m16)
+		p.buf = binary.BigEndian.AppendUint16(p.buf, uint16(n))
+	default:
+		p.buf = append(p.buf, m32)
+		p.buf = binary.BigEndian.AppendUint32(p.buf, uint32(n))
+	}
+}
+
+func (p *packer) string(s string) {
+	p.sizeHeader(len(s), 0x80, markerString8, markerStr16, markerStr32)
+	p.buf = append(p.buf, s...)
+}
+
+func (p *packer) listHeader(n int) {
+	p.sizeHeader(n, 0x90, markerList8, markerList16, markerList32)
+}
+
+func (p *packer) mapHeader(n int) {
+	p.sizeHeader(n, 0xA0, markerMap8, markerMap16, markerMap32)
+}
+
+// pack encodes v. Supported types are nil, bool, integers, floats, string, []byte,
+// time.Time (sent as an RFC 3339 string), slices of those and maps with string keys.
+func (p *packer) pack(v interface{}) error {
+	switch x := v.(type) {
+	case nil:
+		p.buf = append(p.buf, markerNull)
+	case bool:
+		if x {
+			p.buf = append(p.buf, markerTrue)
+		} else {
+			p.buf = append(p.buf, markerFalse)
+		}
+	case int:
+		p.int(int64(x))
+	case int8:
+		p.int(int64(x))
+	case int16:
+		p.int(int64(x))
+	case int32:
+		p.int(int64(x))
+	case int64:
+		p.int(x)
+	case uint8:
+		p.int(int64(x))
+	case uint16:
+		p.int(int64(x))
+	case uint32:
+		p.int(int64(x))
+	case uint64:
+		if x > math.MaxInt64 {
+			return fmt.Errorf("packstream: uint64 %d overflows int64", x)
+		}
+		p.int(int64(x))
+	case float32:
+		p.float(float64(x))
+	case float64:
+		p.float(x)
+	case string:
+		p.string(x)
+	case []byte:
+		p.sizeHeader(len(x), 0, markerBytes8, markerBytes16, markerBytes32)
+		p.buf = append(p.buf, x...)
+	case time.Time:
+		p.string(x.UTC().Format(time.RFC3339Nano))
+	case []string:
+		p.listHeader(len(x))
+		for _, s := range x {
+			p.string(s)
+		}
+	case []float32:
+		p.listHeader(len(x))
+		for _, f := range x {
+			p.float(float64(f))
+		}
+	case []float64:
+		p.listHeader(len(x))
+		for _, f := range x {
+			p.float(f)
+		}
+	case []int64:
+		p.listHeader(len(x))
+		for _, i := range x {
+			p.int(i)
+		}
+	case []interface{}:
+		p.listHeader(len(x))
+		for _, e := range x {
+			if err := p.pack(e); err != nil {
+				return err
+			}
+		}
+	case []map[string]interface{}:
+		p.listHeader(len(x))
+		for _, m := range x {
+			if err := p.pack(m); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		p.mapHeader(len(x))
+		for k, e := range x {
+			p.string(k)
+			if err := p.pack(e); err != nil {
+				return fmt.Errorf("packstream: key %s: %w", k, err)
+			}
+		}
+	case map[string]string:
+		p.mapHeader(len(x))
+		for k, e := range x {
+			p.string(k)
+			p.string(e)
+		}
+	default:
+		return fmt.Errorf("packstream: unsupported type %T", v)
+	}
+	return nil
+}
+
+// unpacker decodes PackStream values from buf.
+type unpacker struct {
+	buf []byte
+	pos int
+}
+
+func (u *unpacker) next(n int) ([]byte, error) {
+	if n < 0 || u.pos+n > len(u.buf) {
+		return nil, fmt.Errorf("packstream: unexpected end of data")
+	}
+	b := u.buf[u.pos : u.pos+n]
+	u.pos += n
+	return b, nil
+}
+
+func (u *unpacker) size(marker byte, m8, m16, m32 byte) (int, error) {
+	var b []byte
+	var err error
+	switch marker {
+	case m8:
+		if b, err = u.next(1); err != nil {
+			return 0, err
+		}
+		return int(b[0]), nil
+	case m16:
+		if b, err = u.next(2); err != nil {
+			return 0, err
+		}
+		return int(binary.BigEndian.Uint16(b)), nil
+	default:
+		if b, err = u.next(4); err != nil {
+			return 0, err
+		}
+		return int(binary.BigEndian.Uint32(b)), nil
+	}
+}
+
+func (u *unpacker) unpack() (interface{}, error) {
+	b, err := u.next(1)
+	if err != nil {
+		return nil, err
+	}
+	marker := b[0]
+	hi := marker & 0xF0
+
+	switch {
+	case marker < 0x80 || marker >= 0xF0: // Tiny int
+		return int64(int8(marker)), nil
+	case hi == 0x80:
+		return u.stringOf(int(marker & 0x0F))
+	case hi == 0x90:
+		return u.list(int(marker & 0x0F))
+	case hi == 0xA0:
+		return u.dict(int(marker & 0x0F))
+	case hi == 0xB0:
+		return u.structure(int(marker & 0x0F))
+	}
+
+	switch marker {
+	case markerNull:
+		return nil, nil
+	case markerTrue:
+		return true, nil
+	case markerFalse:
+		return false, nil
+	case markerFloat:
+		if b, err = u.next(8); err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	case markerInt8:
+		if b, err = u.next(1); err != nil {
+			return nil, err
+		}
+		return int64(int8(b[0])), nil
+	case markerInt16:
+		if b, err = u.next(2); err != nil {
+			return nil, err
+		}
+		return int64(int16(binary.BigEndian.Uint16(b))), nil
+	case markerInt32:
+		if b, err = u.next(4); err != nil {
+			return nil, err
+		}
+		return int64(int32(binary.BigEndian.Uint32(b))), nil
+	case markerInt64:
+		if b, err = u.next(8); err != nil {
+			return nil, err
+		}
+		return int64(binary.BigEndian.Uint64(b)), nil
+	case markerBytes8, markerBytes16, markerBytes32:
+		n, err := u.size(marker, markerBytes8, markerBytes16, markerBytes32)
+		if err != nil {
+			return nil, err
+		}
+		if b, err = u.next(n); err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), b...), nil
+	case markerString8, markerStr16, markerStr32:
+		n, err := u.size(marker, markerString8, markerStr16, markerStr32)
+		if err != nil {
+			return nil, err
+		}
+		return u.stringOf(n)
+	case markerList8, markerList16, markerList32:
+		n, err := u.size(marker, markerList8, markerList16, markerList32)
+		if err != nil {
+			return nil, err
+		}
+		return u.list(n)
+	case markerMap8, markerMap16, markerMap32:
+		n, err := u.size(marker, markerMap8, markerMap16, markerMap32)
+		if err != nil {
+			return nil, err
+		}
+		return u.dict(n)
+	}
+	return nil, fmt.Errorf("packstream: unknown marker 0x%02X", marker)
+}
+
+func (u *unpacker) stringOf(n int) (string, error) {
+	b, err := u.next(n)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func (u *unpacker) list(n int) ([]interface{}, error) {
+	out := make([]interface{}, n)
+	for i := range out {
+		v, err := u.unpack()
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+func (u *unpacker) dict(n int) (map[string]interface{}, error) {
+	out := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		k, err := u.unpack()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("packstream: map key is %T, expected string", k)
+		}
+		v, err := u.unpack()
+		if err != nil {
+			return nil, err
+		}
+		out[key] = v
+	}
+	return out, nil
+}
+
+func (u *unpacker) structure(n int) (interface{}, error) {
+	b, err := u.next(1)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := u.list(n)
+	if err != nil {
+		return nil, err
+	}
+	s := &Structure{Tag: b[0], Fields: fields}
+
+	switch s.Tag {
+	case tagNode:
+		if n < 3 {
+			break
+		}
+		node := &Node{ID: asInt(fields[0]), Labels: asStrings(fields[1]), Props: asMap(fields[2])}
+		if n > 3 {
+			node.ElementID, _ = fields[3].(string)
+		}
+		return node, nil
+	case tagRelationship:
+		if n < 5 {
+			break
+		}
+		rel := &Relationship{ID: asInt(fields[0]), StartID: asInt(fields[1]), EndID: asInt(fields[2]), Props: asMap(fields[4])}
+		rel.Type, _ = fields[3].(string)
+		if n > 5 {
+			rel.ElementID, _ = fields[5].(string)
+		}
+		return rel, nil
+	}
+	return s, nil
+}
+
+func asInt(v interface{}) int64 {
+	i, _ := v.(int64)
+	return i
+}
+
+func asMap(v interface{}) map[string]interface{} {
+	m, _ := v.(map[string]interface{})
+	return m
+}
+
+func asStrings(v interface{}) []string {
+	list, _ := v.([]interface{})
+	out := make([]string, 0, len(list))
+	for _, e := range list {
+		if s, ok := e.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -16,6 +16,8 @@ type Neo4jConfig struct {
 	Password  string `json:"password" validate:"required"`
 	Database  string `json:"database"`
 	BaseLabel bool   `json:"base_label"`
+
+	EmbeddingDimensions int `json:"embedding_dimensions,omitempty" validate:"omitempty,gt=0"` // Creates a vector index over entity embeddings when set
 }
 
 // Validate validates the Neo4jConfig struct.
@@ -29,6 +31,8 @@ type MemgraphConfig struct {
 	URL      string `json:"url" validate:"required"`
 	Username string `json:"username" validate:"required"`
 	Password string `json:"password" validate:"required"`
+
+	EmbeddingDimensions int `json:"embedding_dimensions,omitempty" validate:"omitempty,gt=0"` // Creates a vector index over entity embeddings when set
 }
 
 // Validate validates the MemgraphConfig struct.
@@ -37,19 +41,106 @@ func (c *MemgraphConfig) Validate() error {
 	return validate.Struct(c)
 }
 
+// EmbeddedConfig holds the configuration for the in-process EmbeddedGraphStore.
+type EmbeddedConfig struct {
+	Path string `json:"path" validate:"required"` // SQLite file, or ":memory:" for a non-persistent graph
+}
+
+// Validate validates the EmbeddedConfig struct.
+func (c *EmbeddedConfig) Validate() error {
+	validate := validator.New()
+	return validate.Struct(c)
+}
+
+// DgraphConfig holds the configuration for Dgraph, reached over the HTTP API of an Alpha.
+type DgraphConfig struct {
+	URL       string `json:"url" validate:"required,url"` // e.g. http://localhost:8080
+	Username  string `json:"username,omitempty"`          // ACL user; logs in when set
+	Password  string `json:"password,omitempty" validate:"required_with=Username"`
+	Namespace uint64 `json:"namespace,omitempty"`  // ACL namespace of the user
+	AuthToken string `json:"auth_token,omitempty"` // Alpha --security token, sent as X-Dgraph-AuthToken
+	APIKey    string `json:"api_key,omitempty"`    // Dgraph Cloud API key, sent as Dg-Auth
+}
+
+// Validate validates the DgraphConfig struct.
+func (c *DgraphConfig) Validate() error {
+	validate := validator.New()
+	return validate.Struct(c)
+}
+
+// EntityResolutionConfig enables merging extracted entities into similar existing nodes.
+type EntityResolutionConfig struct {
+	Threshold float32 `json:"threshold" validate:"omitempty,gt=0,lte=1"` // Minimum cosine similarity of the names; defaults to 0.9
+}
+
+// OntologyConfig constrains the entity types and relationships written to the graph. Names
+// are compared after the normalization applied by the stores, e.g. "person" matches "Person".
+type OntologyConfig struct {
+	EntityTypes   []string             `json:"entity_types,omitempty" validate:"omitempty,dive,required"` // Any type is allowed when empty
+	RelationTypes []RelationTypeConfig `json:"relation_types,omitempty" validate:"omitempty,dive"`        // Any relationship is allowed when empty
+	// Synonyms maps alternative entity types and relationships to their ontology names,
+	// e.g. "company" to "Organization" or "employed_by" to "works_at".
+	Synonyms map[string]string `json:"synonyms,omitempty"`
+	// Violations selects what happens to out-of-schema data: "normalize" (default) untypes
+	// entities of unknown types and reverses relations whose inverse fits their domain and
+	// range, "reject" drops them and "quarantine" drops them and reports them for review.
+	// Relations that cannot be normalized are rejected.
+	Violations string `json:"violations,omitempty" validate:"omitempty,oneof=normalize reject quarantine"`
+}
+
+// RelationTypeConfig is a relationship allowed by an OntologyConfig.
+type RelationTypeConfig struct {
+	Name   string   `json:"name" validate:"required"`
+	Domain []string `json:"domain,omitempty"` // Allowed source entity types; any when empty
+	Range  []string `json:"range,omitempty"`  // Allowed destination entity types; any when empty
+}
+
+// Validate validates the OntologyConfig struct, and that domains, ranges and synonyms refer
+// to declared names.
+func (c *OntologyConfig) Validate() error {
+	validate := validator.New()
+	if err := validate.Struct(c); err != nil {
+		return err
+	}
+	types := make(map[string]bool, len(c.EntityTypes))
+	for _, t := range c.EntityTypes {
+		types[normalizeLabel(t)] = true
+	}
+	relations := make(map[string]bool, len(c.RelationTypes))
+	for _, r := range c.RelationTypes {
+		relations[NormalizeRelationship(r.Name)] = true
+		if len(types) == 0 {
+			continue
+		}
+		for _, t := range append(append([]string{}, r.Domain...), r.Range...) {
+			if !types[normalizeLabel(t)] {
+				return fmt.Errorf("relation type %q refers to undeclared entity type %q", r.Name, t)
+			}
+		}
+	}
+	for alias, name := range c.Synonyms {
+		if !types[normalizeLabel(name)] && !relations[NormalizeRelationship(name)] {
+			return fmt.Errorf("synonym %q refers to undeclared entity type or relationship %q", alias, name)
+		}
+	}
+	return nil
+}
+
 // GraphStoreConfig holds the configuration for the graph store.
 type GraphStoreConfig struct {
-	Provider     string      `json:"provider" validate:"required,oneof=neo4j memgraph"`
-	Config       interface{} `json:"config"` // Placeholder for Neo4jConfig or MemgraphConfig
-	LLM          interface{} `json:"llm"`    // Placeholder for a potential LLM config struct
-	CustomPrompt string      `json:"custom_prompt"`
+	Provider         string                  `json:"provider" validate:"required,oneof=neo4j memgraph embedded dgraph"`
+	Config           interface{}             `json:"config"` // *Neo4jConfig, *MemgraphConfig, *EmbeddedConfig or *DgraphConfig
+	LLM              interface{}             `json:"llm"`    // Placeholder for a potential LLM config struct
+	CustomPrompt     string                  `json:"custom_prompt"`
+	EntityResolution *EntityResolutionConfig `json:"entity_resolution,omitempty"` // Disabled when nil
+	Ontology         *OntologyConfig         `json:"ontology,omitempty"`          // Unconstrained when nil
 }
 
 // Validate validates the GraphStoreConfig struct.
 func (c *GraphStoreConfig) Validate() error {
 	validate := validator.New()
 	// This initial validation will check:
-	// 1. Provider is present and is one of "neo4j" or "memgraph".
+	// 1. Provider is present and is one of "neo4j", "memgraph", "embedded" or "dgraph".
 	// 2. Config is not nil (due to `validate:"required"` on the Config field).
 	// 3. If Config holds a struct with its own validation tags (like *Neo4jConfig/*MemgraphConfig),
 	//    the validator appears to dive and validate those fields. Error paths
@@ -75,14 +166,42 @@ func (c *GraphStoreConfig) Validate() error {
 			return fmt.Errorf("config for provider 'memgraph' must be of type *MemgraphConfig, got %T", c.Config)
 		}
 		// Individual MemgraphConfig fields already validated by validate.Struct(c) if it dives.
+	case "embedded":
+		if _, ok := c.Config.(*EmbeddedConfig); !ok {
+			return fmt.Errorf("config for provider 'embedded' must be of type *EmbeddedConfig, got %T", c.Config)
+		}
+	case "dgraph":
+		if _, ok := c.Config.(*DgraphConfig); !ok {
+			return fmt.Errorf("config for provider 'dgraph' must be of type *DgraphConfig, got %T", c.Config)
+		}
 	default:
 		// This case should ideally not be reached due to the 'oneof' validation on Provider
 		// in validate.Struct(c). If it is, it indicates an unexpected state.
 		return fmt.Errorf("provider '%s' is valid but has an unexpected config type: %T", c.Provider, c.Config)
 	}
+	if c.Ontology != nil {
+		if err := c.Ontology.Validate(); err != nil {
+			return fmt.Errorf("ontology validation failed: %w", err)
+		}
+	}
 	return nil
 }
 
+// UsesBaseLabel reports whether the configured store keys nodes by a base label rather than
+// by their type: always for Memgraph, and for Neo4j when BaseLabel is set.
+func (c *GraphStoreConfig) UsesBaseLabel() bool {
+	if c == nil {
+		return false
+	}
+	switch cfg := c.Config.(type) {
+	case *Neo4jConfig:
+		return cfg.BaseLabel
+	case *MemgraphConfig:
+		return true
+	}
+	return false
+}
+
 // UnmarshalJSON custom unmarshaler for GraphStoreConfig.
 func (c *GraphStoreConfig) UnmarshalJSON(data []byte) error {
 	type Alias GraphStoreConfig
@@ -110,6 +229,18 @@ func (c *GraphStoreConfig) UnmarshalJSON(data []byte) error {
 			return fmt.Errorf("failed to unmarshal memgraph config: %w", err)
 		}
 		c.Config = &memgraphCfg
+	case "embedded":
+		var embeddedCfg EmbeddedConfig
+		if err := json.Unmarshal(aux.Config, &embeddedCfg); err != nil {
+			return fmt.Errorf("failed to unmarshal embedded config: %w", err)
+		}
+		c.Config = &embeddedCfg
+	case "dgraph":
+		var dgraphCfg DgraphConfig
+		if err := json.Unmarshal(aux.Config, &dgraphCfg); err != nil {
+			return fmt.Errorf("failed to unmarshal dgraph config: %w", err)
+		}
+		c.Config = &dgraphCfg
 	default:
 		return fmt.Errorf("unknown graph store provider: %s", c.Provider)
 	}
@@ -0,0 +1,576 @@
+package graphs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// encodeCypher writes one statement per relation: MERGE of both endpoints, SET of their
+// attributes and MERGE of the edge. The properties follow the schema of the Bolt stores:
+// with useBaseLabel, nodes are keyed by the base label and carry their type as a second label,
+// as in Memgraph or Neo4j with base_label; otherwise the type is the node's only label. Times
+// are epoch milliseconds. Edges are merged on their validity interval, valid_from alone for
+// current edges, so that replaying a script does not duplicate the relations it restores.
+func encodeCypher(w io.Writer, snapshots []GraphSnapshot, useBaseLabel bool) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "// gomem graph export, %d scope(s)\n", len(snapshots))
+	for _, s := range snapshots {
+		fmt.Fprintf(bw, "\n// user_id=%q agent_id=%q run_id=%q\n", s.Filter.UserID, s.Filter.AgentID, s.Filter.RunID)
+		nodes := make(map[string]exportNode)
+		for _, n := range snapshotNodes(s.Relations) {
+			nodes[n.Name] = n
+		}
+		for _, r := range s.Relations {
+			source, destination := nodes[r.Source], nodes[r.Destination]
+			sourceAttrs, err := cypherAttributes(source.Attributes)
+			if err != nil {
+				return err
+			}
+			destinationAttrs, err := cypherAttributes(destination.Attributes)
+			if err != nil {
+				return err
+			}
+			edgeAttrs, err := cypherAttributes(r.Attributes)
+			if err != nil {
+				return err
+			}
+			var key []cypherEntry
+			if !r.ValidFrom.IsZero() {
+				key = append(key, cypherEntry{"valid_from", r.ValidFrom.UnixMilli()})
+			}
+			edge := []cypherEntry{{"valid_to", nil}, {"recorded_at", timeLiteral(r.RecordedAt)}}
+			if r.ValidTo != nil {
+				key = append(key, cypherEntry{"valid_to", r.ValidTo.UnixMilli()})
+				edge = edge[1:]
+			}
+			edge = append(edge, edgeAttrs...)
+
+			fmt.Fprintf(bw, "MERGE %s\n", cypherNodeStatement("s", source, s.Filter, r.Source, sourceAttrs, useBaseLabel))
+			fmt.Fprintf(bw, "MERGE %s\n", cypherNodeStatement("d", destination, s.Filter, r.Destination, destinationAttrs, useBaseLabel))
+			fmt.Fprintf(bw, "MERGE (s)-[r:%s %s]->(d) SET r += %s;\n", quoteIdentifier(r.Relationship), cypherMap(key), cypherMap(edge))
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write cypher script: %w", err)
+	}
+	return nil
+}
+
+// decodeCypher reads a script written by encodeCypher. Other Cypher is rejected.
+func decodeCypher(r io.Reader) ([]GraphSnapshot, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	p := &cypherParser{src: string(data)}
+	var snapshots []GraphSnapshot
+	index := make(map[Filter]int)
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.src) {
+			break
+		}
+		filter, rel, err := p.statement()
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", p.line(), err)
+		}
+		i, ok := index[filter]
+		if !ok {
+			i = len(snapshots)
+			index[filter] = i
+			snapshots = append(snapshots, GraphSnapshot{Filter: filter})
+		}
+		snapshots[i].Relations = append(snapshots[i].Relations, rel)
+	}
+	return snapshots, nil
+}
+
+// cypherNodeStatement renders the pattern and SET clause merging node n into the scope of
+// filter, e.g. (s:`__Entity__` {name: 'alice', user_id: 'u1'}) SET s:`Person`, s += {...}.
+func cypherNodeStatement(variable string, n exportNode, filter Filter, name string, attrs []cypherEntry, useBaseLabel bool) string {
+	label, typeLabel := cypherLabel(n.Type), ""
+	if useBaseLabel {
+		label = cypherLabel(baseLabel)
+		if n.Type != "" {
+			typeLabel = variable + cypherLabel(n.Type) + ", "
+		}
+	}
+	return fmt.Sprintf("(%s%s %s) SET %s%s += %s", variable, label, cypherMap(nodeKey(filter, name)), typeLabel, variable, cypherMap(attrs))
+}
+
+// cypherEntry is an entry of a map literal; entries keep their order when rendered.
+type cypherEntry struct {
+	key   string
+	value interface{}
+}
+
+// nodeKey returns the properties a node is merged on.
+func nodeKey(filter Filter, name string) []cypherEntry {
+	key := []cypherEntry{{"name", name}, {"user_id", filter.UserID}}
+	if filter.AgentID != "" {
+		key = append(key, cypherEntry{"agent_id", filter.AgentID})
+	}
+	if filter.RunID != "" {
+		key = append(key, cypherEntry{"run_id", filter.RunID})
+	}
+	return key
+}
+
+// cypherAttributes returns the attribute properties of a, omitting unset times.
+func cypherAttributes(a Attributes) ([]cypherEntry, error) {
+	params, err := attributeParams(a)
+	if err != nil {
+		return nil, err
+	}
+	params[propCreatedAt] = timeLiteral(a.CreatedAt)
+	params[propUpdatedAt] = timeLiteral(a.UpdatedAt)
+	entries := make([]cypherEntry, 0, len(attributeProps))
+	for _, p := range attributeProps {
+		if params[p] != nil {
+			entries = append(entries, cypherEntry{p, params[p]})
+		}
+	}
+	return entries, nil
+}
+
+// timeLiteral returns t in epoch milliseconds, or nil for the zero time.
+func timeLiteral(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UnixMilli()
+}
+
+func cypherLabel(entityType string) string {
+	if entityType == "" {
+		return ""
+	}
+	return ":" + quoteIdentifier(entityType)
+}
+
+func quoteIdentifier(s string) string {
+	return "`" + strings.ReplaceAll(s, "`", "``") + "`"
+}
+
+func cypherMap(entries []cypherEntry) string {
+	parts := make([]string, 0, len(entries))
+	for _, e := range entries {
+		parts = append(parts, e.key+": "+cypherLiteral(e.value))
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+func cypherLiteral(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return quoteString(x)
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case float64:
+		// float32 precision, since that is what Attributes hold; always with a decimal
+		// point or exponent so that the value reads back as a float.
+		s := strconv.FormatFloat(x, 'g', -1, 32)
+		if !strings.ContainsAny(s, ".eEIN") {
+			s += ".0"
+		}
+		return s
+	case []string:
+		items := make([]string, len(x))
+		for i, s := range x {
+			items[i] = quoteString(s)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	default:
+		return quoteString(fmt.Sprint(x))
+	}
+}
+
+func quoteString(s string) string {
+	var b strings.Builder
+	b.WriteByte('\'')
+	for _, r := range s {
+		switch r {
+		case '\\':
+			b.WriteString(`\\`)
+		case '\'':
+			b.WriteString(`\'`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('\'')
+	return b.String()
+}
+
+// cypherParser reads the statements written by encodeCypher, with or without a base label:
+//
+//	MERGE (s:`__Entity__` {name: ..., user_id: ...}) SET s:`Type`, s += {...}
+//	MERGE (d:`Type` {name: ..., user_id: ...}) SET d += {...}
+//	MERGE (s)-[r:`relationship` {valid_from: ...}]->(d) SET r += {...};
+type cypherParser struct {
+	src string
+	pos int
+}
+
+func (p *cypherParser) statement() (Filter, Relation, error) {
+	var rel Relation
+	source, err := p.mergeNode("s")
+	if err != nil {
+		return Filter{}, rel, err
+	}
+	destination, err := p.mergeNode("d")
+	if err != nil {
+		return Filter{}, rel, err
+	}
+	if err := p.expectWord("MERGE"); err != nil {
+		return Filter{}, rel, err
+	}
+	for _, tok := range []string{"(", "s", ")", "-", "[", "r", ":"} {
+		if err := p.expect(tok); err != nil {
+			return Filter{}, rel, err
+		}
+	}
+	if rel.Relationship, err = p.identifier(); err != nil {
+		return Filter{}, rel, err
+	}
+	edge, err := p.mapLiteral()
+	if err != nil {
+		return Filter{}, rel, err
+	}
+	for _, tok := range []string{"]", "-", ">", "(", "d", ")", "SET", "r", "+", "="} {
+		if err := p.expect(tok); err != nil {
+			return Filter{}, rel, err
+		}
+	}
+	props, err := p.mapLiteral()
+	if err != nil {
+		return Filter{}, rel, err
+	}
+	if err := p.expect(";"); err != nil {
+		return Filter{}, rel, err
+	}
+	for k, v := range props {
+		edge[k] = v
+	}
+
+	if source.filter != destination.filter {
+		return Filter{}, rel, fmt.Errorf("relation %s -[%s]-> %s spans two scopes", source.Name, rel.Relationship, destination.Name)
+	}
+	rel.Source, rel.Destination = source.Name, destination.Name
+	rel.Attributes = attributesFromRow(edge, "")
+	rel.Validity = validityFromRow(edge)
+	rel, err = withEndpoints(rel, map[string]exportNode{source.Name: source.exportNode, destination.Name: destination.exportNode})
+	return source.filter, rel, err
+}
+
+type cypherNode struct {
+	exportNode
+	filter Filter
+}
+
+// mergeNode reads MERGE (v:`Label` {...}) SET [v:`Type`, ]v += {...}. A node keyed by the
+// base label takes its type from the SET clause.
+func (p *cypherParser) mergeNode(variable string) (cypherNode, error) {
+	var n cypherNode
+	if err := p.expectWord("MERGE"); err != nil {
+		return n, err
+	}
+	if err := p.expect("("); err != nil {
+		return n, err
+	}
+	if err := p.expect(variable); err != nil {
+		return n, err
+	}
+	if p.peek(":") {
+		p.pos++
+		label, err := p.identifier()
+		if err != nil {
+			return n, err
+		}
+		if label != baseLabel {
+			n.Type = label
+		}
+	}
+	key, err := p.mapLiteral()
+	if err != nil {
+		return n, err
+	}
+	if err := p.expect(")"); err != nil {
+		return n, err
+	}
+	if err := p.expectWord("SET"); err != nil {
+		return n, err
+	}
+	if err := p.expect(variable); err != nil {
+		return n, err
+	}
+	if p.peek(":") {
+		p.pos++
+		label, err := p.identifier()
+		if err != nil {
+			return n, err
+		}
+		n.Type = label
+		if err := p.expect(","); err != nil {
+			return n, err
+		}
+		if err := p.expect(variable); err != nil {
+			return n, err
+		}
+	}
+	for _, tok := range []string{"+", "="} {
+		if err := p.expect(tok); err != nil {
+			return n, err
+		}
+	}
+	attrs, err := p.mapLiteral()
+	if err != nil {
+		return n, err
+	}
+	n.Name, _ = key["name"].(string)
+	n.filter.UserID, _ = key["user_id"].(string)
+	n.filter.AgentID, _ = key["agent_id"].(string)
+	n.filter.RunID, _ = key["run_id"].(string)
+	if n.Name == "" {
+		return n, fmt.Errorf("node %s has no name", variable)
+	}
+	n.Attributes = attributesFromRow(attrs, "")
+	return n, nil
+}
+
+// skipSpace skips whitespace and // comments.
+func (p *cypherParser) skipSpace() {
+	for p.pos < len(p.src) {
+		if strings.HasPrefix(p.src[p.pos:], "//") {
+			if end := strings.IndexByte(p.src[p.pos:], '\n'); end >= 0 {
+				p.pos += end + 1
+			} else {
+				p.pos = len(p.src)
+			}
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		if !unicode.IsSpace(r) {
+			return
+		}
+		p.pos += size
+	}
+}
+
+func (p *cypherParser) line() int {
+	return strings.Count(p.src[:p.pos], "\n") + 1
+}
+
+func (p *cypherParser) peek(tok string) bool {
+	p.skipSpace()
+	return strings.HasPrefix(p.src[p.pos:], tok)
+}
+
+func (p *cypherParser) expect(tok string) error {
+	if !p.peek(tok) {
+		return fmt.Errorf("expected %q at %q", tok, p.excerpt())
+	}
+	p.pos += len(tok)
+	return nil
+}
+
+// expectWord matches a keyword case-insensitively.
+func (p *cypherParser) expectWord(word string) error {
+	p.skipSpace()
+	if len(p.src)-p.pos < len(word) || !strings.EqualFold(p.src[p.pos:p.pos+len(word)], word) {
+		return fmt.Errorf("expected %s at %q", word, p.excerpt())
+	}
+	p.pos += len(word)
+	return nil
+}
+
+func (p *cypherParser) excerpt() string {
+	end := p.pos + 20
+	if end > len(p.src) {
+		end = len(p.src)
+	}
+	return p.src[p.pos:end]
+}
+
+// identifier reads a plain or backquoted identifier.
+func (p *cypherParser) identifier() (string, error) {
+	p.skipSpace()
+	if p.peek("`") {
+		var b strings.Builder
+		for i := p.pos + 1; i < len(p.src); i++ {
+			if p.src[i] != '`' {
+				b.WriteByte(p.src[i])
+				continue
+			}
+			if i+1 < len(p.src) && p.src[i+1] == '`' {
+				b.WriteByte('`')
+				i++
+				continue
+			}
+			p.pos = i + 1
+			return b.String(), nil
+		}
+		return "", fmt.Errorf("unterminated identifier")
+	}
+	start := p.pos
+	for p.pos < len(p.src) {
+		r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			break
+		}
+		p.pos += size
+	}
+	if p.pos == start {
+		return "", fmt.Errorf("expected an identifier at %q", p.excerpt())
+	}
+	return p.src[start:p.pos], nil
+}
+
+func (p *cypherParser) mapLiteral() (map[string]interface{}, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	m := make(map[string]interface{})
+	if p.peek("}") {
+		p.pos++
+		return m, nil
+	}
+	for {
+		key, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		if m[key], err = p.value(); err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		if p.peek("}") {
+			p.pos++
+			return m, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// value reads a literal: string, number, boolean, null, list or map. Integers are
+// returned as int64 and other numbers as float64, as over Bolt.
+func (p *cypherParser) value() (interface{}, error) {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	switch c := p.src[p.pos]; {
+	case c == '\'' || c == '"':
+		return p.stringLiteral()
+	case c == '{':
+		return p.mapLiteral()
+	case c == '[':
+		p.pos++
+		list := []interface{}{}
+		if p.peek("]") {
+			p.pos++
+			return list, nil
+		}
+		for {
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+			if p.peek("]") {
+				p.pos++
+				return list, nil
+			}
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+	case c == '-' || (c >= '0' && c <= '9'):
+		start := p.pos
+		p.pos++
+		for p.pos < len(p.src) && strings.IndexByte("0123456789.eE+-", p.src[p.pos]) >= 0 {
+			p.pos++
+		}
+		text := p.src[start:p.pos]
+		if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return n, nil
+		}
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", text)
+		}
+		return f, nil
+	}
+	word, err := p.identifier()
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(word) {
+	case "null":
+		return nil, nil
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return nil, fmt.Errorf("unsupported value %q", word)
+}
+
+func (p *cypherParser) stringLiteral() (string, error) {
+	quote := p.src[p.pos]
+	var b strings.Builder
+	for i := p.pos + 1; i < len(p.src); i++ {
+		c := p.src[i]
+		if c == quote {
+			p.pos = i + 1
+			return b.String(), nil
+		}
+		if c != '\\' {
+			b.WriteByte(c)
+			continue
+		}
+		if i+1 >= len(p.src) {
+			break
+		}
+		i++
+		switch p.src[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'u':
+			if i+4 >= len(p.src) {
+				return "", fmt.Errorf("invalid unicode escape")
+			}
+			r, err := strconv.ParseUint(p.src[i+1:i+5], 16, 32)
+			if err != nil {
+				return "", fmt.Errorf("invalid unicode escape: %w", err)
+			}
+			b.WriteRune(rune(r))
+			i += 4
+		default:
+			b.WriteByte(p.src[i])
+		}
+	}
+	return "", fmt.Errorf("unterminated string")
+}
@@ -0,0 +1,804 @@
+package graphs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pnocera/gomem/internal/vecmath"
+	"github.com/pnocera/gomem/pkg/boltclient"
+)
+
+// baseLabel is added to every node when the store uses a base label, so that all
+// entities share one label that can be indexed regardless of their type.
+const baseLabel = "__Entity__"
+
+// maxTxAttempts bounds the retries of transactions that fail with a transient error,
+// e.g. concurrent MERGEs of the same node conflicting on Memgraph.
+const maxTxAttempts = 3
+
+// cypherDialect captures the differences between the Cypher servers reached over Bolt.
+type cypherDialect interface {
+	// indexQueries returns the statements creating the entity indexes on the base label.
+	indexQueries() []string
+	// vectorIndexQuery returns the statement creating a vector index over node embeddings.
+	vectorIndexQuery(dimensions int) string
+	// runExtra returns the RUN/BEGIN metadata, e.g. the target database.
+	runExtra() map[string]interface{}
+	// useBaseLabel reports whether nodes carry baseLabel and are keyed by it rather than by their type.
+	useBaseLabel() bool
+}
+
+// cypherGraphStore implements GraphStore for any Bolt server speaking Cypher.
+type cypherGraphStore struct {
+	mu      sync.Mutex // Serializes operations, which may span several requests on the connection
+	name    string
+	dialect cypherDialect
+	conn    *boltclient.Conn
+	dial    func(ctx context.Context) (*boltclient.Conn, error)
+}
+
+// newCypherGraphStore connects with dial, which is also used to reconnect whenever the
+// current connection is broken, and creates the dialect's indexes.
+func newCypherGraphStore(ctx context.Context, name string, dialect cypherDialect, embeddingDimensions int, dial func(ctx context.Context) (*boltclient.Conn, error)) (*cypherGraphStore, error) {
+	s := &cypherGraphStore{name: name, dialect: dialect, dial: dial}
+	conn, err := dial(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", name, err)
+	}
+	s.conn = conn
+
+	var queries []string
+	if dialect.useBaseLabel() {
+		queries = dialect.indexQueries()
+		if embeddingDimensions > 0 {
+			queries = append(queries, dialect.vectorIndexQuery(embeddingDimensions))
+		}
+	}
+	for _, q := range queries {
+		if _, err := s.run(ctx, q, nil); err != nil {
+			// Index creation can fail on editions without support for it; queries still work without it.
+			fmt.Printf("GraphStore(%s): Could not create index (%s): %v\n", name, q, err)
+		}
+	}
+	return s, nil
+}
+
+func (s *cypherGraphStore) AddRelations(ctx context.Context, filter Filter, relations []Relation) error {
+	if err := filter.validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inTx(ctx, func() error {
+		for _, rel := range relations {
+			if err := s.mergeRelation(ctx, filter, rel); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *cypherGraphStore) UpdateRelation(ctx context.Context, filter Filter, relation Relation) error {
+	if err := filter.validate(); err != nil {
+		return err
+	}
+	rel := normalizeRelation(relation)
+	if err := checkRelation(rel); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inTx(ctx, func() error {
+		params := scopeParams(filter)
+		params["source"] = rel.Source
+		params["destination"] = rel.Destination
+		params["relationship"] = rel.Relationship
+		params["now"] = time.Now().UnixMilli()
+		query := fmt.Sprintf("MATCH %s-[r]->%s WHERE r.valid_to IS NULL AND type(r) <> $relationship SET r.valid_to = $now",
+			s.nodePattern("s", "", filter, "source"), s.nodePattern("d", "", filter, "destination"))
+		if _, err := s.conn.Run(ctx, query, params, nil); err != nil {
+			return fmt.Errorf("failed to close previous relations: %w", err)
+		}
+		return s.mergeRelation(ctx, filter, rel)
+	})
+}
+
+func (s *cypherGraphStore) CloseRelations(ctx context.Context, filter Filter, relations []Relation) error {
+	if err := filter.validate(); err != nil {
+		return err
+	}
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inTx(ctx, func() error {
+		for _, relation := range relations {
+			rel := normalizeRelation(relation)
+			if err := checkRelation(rel); err != nil {
+				return err
+			}
+			params := scopeParams(filter)
+			params["source"] = rel.Source
+			params["destination"] = rel.Destination
+			params["valid_to"] = rel.closedAt(now).UnixMilli()
+			query := fmt.Sprintf("MATCH %s-[r:`%s`]->%s WHERE r.valid_to IS NULL SET r.valid_to = $valid_to",
+				s.nodePattern("s", "", filter, "source"), rel.Relationship, s.nodePattern("d", "", filter, "destination"))
+			if _, err := s.conn.Run(ctx, query, params, nil); err != nil {
+				return fmt.Errorf("failed to close relation %s -[%s]-> %s: %w", rel.Source, rel.Relationship, rel.Destination, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (s *cypherGraphStore) DeleteRelations(ctx context.Context, filter Filter, relations []Relation) error {
+	if err := filter.validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inTx(ctx, func() error {
+		for _, relation := range relations {
+			rel := normalizeRelation(relation)
+			if err := checkRelation(rel); err != nil {
+				return err
+			}
+			params := scopeParams(filter)
+			params["source"] = rel.Source
+			params["destination"] = rel.Destination
+			query := fmt.Sprintf("MATCH %s-[r:`%s`]->%s DELETE r",
+				s.nodePattern("s", "", filter, "source"), rel.Relationship, s.nodePattern("d", "", filter, "destination"))
+			if _, err := s.conn.Run(ctx, query, params, nil); err != nil {
+				return fmt.Errorf("failed to delete relation %s -[%s]-> %s: %w", rel.Source, rel.Relationship, rel.Destination, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (s *cypherGraphStore) SearchByEntity(ctx context.Context, filter Filter, entities []string, opts QueryOptions) ([]Relation, error) {
+	return s.Traverse(ctx, filter, entities, 1, opts)
+}
+
+func (s *cypherGraphStore) Traverse(ctx context.Context, filter Filter, entities []string, hops int, opts QueryOptions) ([]Relation, error) {
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+	if hops <= 0 {
+		hops = 1
+	}
+	if hops > maxTraverseHops {
+		return nil, fmt.Errorf("traversal depth %d exceeds the maximum of %d", hops, maxTraverseHops)
+	}
+	names := make([]string, 0, len(entities))
+	for _, e := range entities {
+		if n := NormalizeEntity(e); n != "" {
+			names = append(names, n)
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	params := scopeParams(filter)
+	params["names"] = names
+	params["limit"] = int64(opts.limit())
+	params["as_of"] = opts.asOf().UnixMilli()
+	// Entities merged into a node are found through its aliases.
+	query := fmt.Sprintf("MATCH %s WHERE n.name IN $names OR any(a IN coalesce(n.aliases, []) WHERE a IN $names) MATCH p = (n)-[*1..%d]-%s WHERE all(x IN relationships(p) WHERE %s) UNWIND relationships(p) AS r WITH DISTINCT r %s LIMIT $limit",
+		s.nodePattern("n", "", filter, ""), hops, s.nodePattern("m", "", filter, ""), validAt("x", opts), relationReturn)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res, err := s.run(ctx, query, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to traverse relations: %w", err)
+	}
+	return relationsFromResult(res), nil
+}
+
+func (s *cypherGraphStore) GetAll(ctx context.Context, filter Filter, opts QueryOptions) ([]Relation, error) {
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+	params := scopeParams(filter)
+	params["limit"] = int64(opts.limit())
+	params["as_of"] = opts.asOf().UnixMilli()
+	query := fmt.Sprintf("MATCH %s-[r]->%s WHERE %s %s LIMIT $limit",
+		s.nodePattern("s", "", filter, ""), s.nodePattern("d", "", filter, ""), validAt("r", opts), relationReturn)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res, err := s.run(ctx, query, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get relations: %w", err)
+	}
+	return relationsFromResult(res), nil
+}
+
+func (s *cypherGraphStore) Reset(ctx context.Context, filter Filter) error {
+	if err := filter.validate(); err != nil {
+		return err
+	}
+	query := fmt.Sprintf("MATCH %s DETACH DELETE n", s.nodePattern("n", "", filter, ""))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.run(ctx, query, scopeParams(filter)); err != nil {
+		return fmt.Errorf("failed to reset graph for user %s: %w", filter.UserID, err)
+	}
+	return nil
+}
+
+func (s *cypherGraphStore) SetNodeEmbedding(ctx context.Context, filter Filter, name string, nodeType string, embedding []float32) error {
+	if err := filter.validate(); err != nil {
+		return err
+	}
+	name, nodeType = NormalizeEntity(name), normalizeLabel(nodeType)
+	if name == "" {
+		return fmt.Errorf("entity name is empty")
+	}
+	params := scopeParams(filter)
+	params["name"] = name
+	params["embedding"] = embedding
+	params["now"] = time.Now().UnixMilli()
+
+	var q strings.Builder
+	fmt.Fprintf(&q, "MERGE %s ON CREATE SET n.created_at = $now ", s.nodePattern("n", nodeType, filter, "name"))
+	if s.dialect.useBaseLabel() && nodeType != "" {
+		fmt.Fprintf(&q, "SET n:`%s` ", nodeType)
+	}
+	q.WriteString("SET n.embedding = $embedding")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.run(ctx, q.String(), params); err != nil {
+		return fmt.Errorf("failed to set embedding of %s: %w", name, err)
+	}
+	return nil
+}
+
+// SearchSimilarNodes scores the scope's node embeddings client-side, which works on every
+// server and edition whether or not a vector index exists.
+func (s *cypherGraphStore) SearchSimilarNodes(ctx context.Context, filter Filter, embedding []float32, threshold float32, limit int) ([]NodeMatch, error) {
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+	query := fmt.Sprintf("MATCH %s WHERE n.embedding IS NOT NULL RETURN n.name AS name, labels(n) AS labels, n.aliases AS aliases, n.embedding AS embedding",
+		s.nodePattern("n", "", filter, ""))
+
+	s.mu.Lock()
+	res, err := s.run(ctx, query, scopeParams(filter))
+	s.mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to search similar nodes: %w", err)
+	}
+	best := make(map[string]NodeMatch)
+	for _, row := range res.Rows() {
+		name, _ := row["name"].(string)
+		score := vecmath.Cosine(embedding, floatList(row["embedding"]))
+		if score < threshold {
+			continue
+		}
+		if prev, ok := best[name]; ok && prev.Score >= score {
+			continue
+		}
+		best[name] = NodeMatch{Name: name, Type: entityType(row["labels"]), Aliases: stringList(row["aliases"]), Score: score}
+	}
+	matches := make([]NodeMatch, 0, len(best))
+	for _, m := range best {
+		matches = append(matches, m)
+	}
+	return sortMatches(matches, limit), nil
+}
+
+func (s *cypherGraphStore) MergeNodes(ctx context.Context, filter Filter, canonical string, alias string) (*MergeResult, error) {
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+	canonical, alias = NormalizeEntity(canonical), NormalizeEntity(alias)
+	if canonical == "" || alias == "" || canonical == alias {
+		return nil, fmt.Errorf("cannot merge %q into %q", alias, canonical)
+	}
+	params := scopeParams(filter)
+	params["canonical"] = canonical
+	params["alias"] = alias
+	canonicalNode := s.nodePattern("c", "", filter, "canonical")
+	aliasNode := s.nodePattern("a", "", filter, "alias")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := &MergeResult{}
+	err := s.inTx(ctx, func() error {
+		res, err := s.conn.Run(ctx, fmt.Sprintf("MATCH %s RETURN labels(c) AS labels, c.aliases AS aliases", canonicalNode), params, nil)
+		if err != nil {
+			return fmt.Errorf("failed to find %s: %w", canonical, err)
+		}
+		rows := res.Rows()
+		if len(rows) == 0 {
+			return fmt.Errorf("canonical entity %q not found", canonical)
+		}
+		canonicalType := entityType(rows[0]["labels"])
+		var aliases []string
+		for _, row := range rows {
+			aliases = mergeAliases(aliases, canonical, stringList(row["aliases"])...)
+		}
+
+		res, err = s.conn.Run(ctx, fmt.Sprintf("MATCH %s RETURN a.aliases AS aliases", aliasNode), params, nil)
+		if err != nil {
+			return fmt.Errorf("failed to find %s: %w", alias, err)
+		}
+		var aliasAliases []string
+		for _, row := range res.Rows() {
+			aliasAliases = append(aliasAliases, stringList(row["aliases"])...)
+		}
+		aliases = mergeAliases(aliases, canonical, append([]string{alias}, aliasAliases...)...)
+
+		res, err = s.conn.Run(ctx, fmt.Sprintf("MATCH %s-[r]-() WITH DISTINCT r %s", aliasNode, relationReturn), params, nil)
+		if err != nil {
+			return fmt.Errorf("failed to get relations of %s: %w", alias, err)
+		}
+		result.Moved = relationsFromResult(res)
+
+		res, err = s.conn.Run(ctx, fmt.Sprintf("MATCH %s-[r]-() WHERE r.valid_to IS NULL WITH DISTINCT r %s", canonicalNode, relationReturn), params, nil)
+		if err != nil {
+			return fmt.Errorf("failed to get relations of %s: %w", canonical, err)
+		}
+		existing := make(map[string]bool)
+		for _, r := range relationsFromResult(res) {
+			existing[relationKey(r)] = true
+		}
+
+		result.Created = repointRelations(result.Moved, alias, canonical, canonicalType, existing)
+		if _, err := s.conn.Run(ctx, fmt.Sprintf("MATCH %s DETACH DELETE a", aliasNode), params, nil); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", alias, err)
+		}
+		for _, rel := range result.Created {
+			if err := s.mergeRelation(ctx, filter, rel); err != nil {
+				return err
+			}
+		}
+		params["aliases"] = aliases
+		if _, err := s.conn.Run(ctx, fmt.Sprintf("MATCH %s SET c.aliases = $aliases", canonicalNode), params, nil); err != nil {
+			return fmt.Errorf("failed to set aliases of %s: %w", canonical, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *cypherGraphStore) RemoveAlias(ctx context.Context, filter Filter, canonical string, alias string) error {
+	if err := filter.validate(); err != nil {
+		return err
+	}
+	params := scopeParams(filter)
+	params["canonical"] = NormalizeEntity(canonical)
+	alias = NormalizeEntity(alias)
+	canonicalNode := s.nodePattern("c", "", filter, "canonical")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inTx(ctx, func() error {
+		res, err := s.conn.Run(ctx, fmt.Sprintf("MATCH %s RETURN c.aliases AS aliases", canonicalNode), params, nil)
+		if err != nil {
+			return fmt.Errorf("failed to find %s: %w", canonical, err)
+		}
+		var aliases []string
+		for _, row := range res.Rows() {
+			aliases = mergeAliases(aliases, "", stringList(row["aliases"])...)
+		}
+		params["aliases"] = removeString(aliases, alias)
+		if _, err := s.conn.Run(ctx, fmt.Sprintf("MATCH %s SET c.aliases = $aliases", canonicalNode), params, nil); err != nil {
+			return fmt.Errorf("failed to remove alias %s: %w", alias, err)
+		}
+		return nil
+	})
+}
+
+func (s *cypherGraphStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// mergeRelation merges both nodes and the current edge of one relation, then records the mention in
+// their attributes. Attributes are merged client-side, as in the embedded store, so that the
+// rules do not depend on each server's list functions. Timestamps are passed in milliseconds
+// rather than using timestamp(), whose unit differs between servers. Callers must hold s.mu
+// and run it inside a transaction.
+func (s *cypherGraphStore) mergeRelation(ctx context.Context, filter Filter, relation Relation) error {
+	rel := normalizeRelation(relation)
+	if err := checkRelation(rel); err != nil {
+		return err
+	}
+	now := time.Now()
+	params := scopeParams(filter)
+	params["source"] = rel.Source
+	params["destination"] = rel.Destination
+	params["now"] = now.UnixMilli()
+
+	var q strings.Builder
+	fmt.Fprintf(&q, "MERGE %s ON CREATE SET s.created_at = $now ", s.nodePattern("s", rel.SourceType, filter, "source"))
+	if s.dialect.useBaseLabel() && rel.SourceType != "" {
+		fmt.Fprintf(&q, "SET s:`%s` ", rel.SourceType)
+	}
+	fmt.Fprintf(&q, "MERGE %s ON CREATE SET d.created_at = $now ", s.nodePattern("d", rel.DestinationType, filter, "destination"))
+	if s.dialect.useBaseLabel() && rel.DestinationType != "" {
+		fmt.Fprintf(&q, "SET d:`%s` ", rel.DestinationType)
+	}
+	fmt.Fprintf(&q, "RETURN %s, %s", attributeProjection("s", "source_"), attributeProjection("d", "destination_"))
+
+	res, err := s.conn.Run(ctx, q.String(), params, nil)
+	if err != nil {
+		return fmt.Errorf("failed to add relation %s -[%s]-> %s: %w", rel.Source, rel.Relationship, rel.Destination, err)
+	}
+	rows := res.Rows()
+	if len(rows) == 0 {
+		return fmt.Errorf("failed to add relation %s -[%s]-> %s: no row returned", rel.Source, rel.Relationship, rel.Destination)
+	}
+	sourceAttrs := mergeAttributes(attributesFromRow(rows[0], "source_"), rel.endpointAttributes(rel.SourceAttributes), now)
+	destinationAttrs := mergeAttributes(attributesFromRow(rows[0], "destination_"), rel.endpointAttributes(rel.DestinationAttributes), now)
+	if rel.Source == rel.Destination {
+		destinationAttrs = sourceAttrs
+	}
+	if params["source_attrs"], err = attributeParams(sourceAttrs); err != nil {
+		return err
+	}
+	if params["destination_attrs"], err = attributeParams(destinationAttrs); err != nil {
+		return err
+	}
+	sourceNode := s.nodePattern("s", rel.SourceType, filter, "source")
+	destinationNode := s.nodePattern("d", rel.DestinationType, filter, "destination")
+	if _, err := s.conn.Run(ctx, fmt.Sprintf("MATCH %s MATCH %s SET s += $source_attrs, d += $destination_attrs", sourceNode, destinationNode), params, nil); err != nil {
+		return fmt.Errorf("failed to update attributes of %s and %s: %w", rel.Source, rel.Destination, err)
+	}
+
+	// The current edge, if any, takes the mention. A closed relation, e.g. restored history,
+	// takes the edge closed over the same interval so that importing it twice adds nothing,
+	// and is otherwise recorded as a new interval.
+	existingEdge := fmt.Sprintf("MATCH %s-[r:`%s`]->%s WHERE r.valid_to IS NULL", sourceNode, rel.Relationship, destinationNode)
+	lookup := rel.ValidTo == nil
+	if rel.ValidTo != nil && !rel.ValidFrom.IsZero() {
+		existingEdge = fmt.Sprintf("MATCH %s-[r:`%s`]->%s WHERE r.valid_from = $interval_from AND r.valid_to = $interval_to", sourceNode, rel.Relationship, destinationNode)
+		params["interval_from"] = rel.ValidFrom.UnixMilli()
+		params["interval_to"] = rel.ValidTo.UnixMilli()
+		lookup = true
+	}
+	var stored Attributes
+	exists := false
+	if lookup {
+		res, err := s.conn.Run(ctx, existingEdge+" RETURN "+attributeProjection("r", "edge_"), params, nil)
+		if err != nil {
+			return fmt.Errorf("failed to find relation %s -[%s]-> %s: %w", rel.Source, rel.Relationship, rel.Destination, err)
+		}
+		if rows := res.Rows(); len(rows) > 0 {
+			stored, exists = attributesFromRow(rows[0], "edge_"), true
+		}
+	}
+	if params["edge_attrs"], err = attributeParams(mergeAttributes(stored, rel.Attributes, now)); err != nil {
+		return err
+	}
+	var query string
+	if exists {
+		query = existingEdge + " SET r += $edge_attrs"
+	} else {
+		validFrom := rel.ValidFrom
+		if validFrom.IsZero() {
+			validFrom = now
+		}
+		params["valid_from"] = validFrom.UnixMilli()
+		params["valid_to"] = nil
+		if rel.ValidTo != nil {
+			params["valid_to"] = rel.ValidTo.UnixMilli()
+		}
+		query = fmt.Sprintf("MATCH %s MATCH %s CREATE (s)-[r:`%s` {created_at: $now, valid_from: $valid_from, valid_to: $valid_to, recorded_at: $now}]->(d) SET r += $edge_attrs",
+			sourceNode, destinationNode, rel.Relationship)
+	}
+	if _, err := s.conn.Run(ctx, query, params, nil); err != nil {
+		return fmt.Errorf("failed to add relation %s -[%s]-> %s: %w", rel.Source, rel.Relationship, rel.Destination, err)
+	}
+	return nil
+}
+
+// validAt renders the condition that relationship variable x is valid at $as_of, or is
+// always true when opts.History is set. Edges recorded before temporal relations have no
+// valid_from and hold from any time.
+func validAt(x string, opts QueryOptions) string {
+	if opts.History {
+		return "true"
+	}
+	return fmt.Sprintf("coalesce(%[1]s.valid_from, 0) <= $as_of AND (%[1]s.valid_to IS NULL OR %[1]s.valid_to > $as_of)", x)
+}
+
+// nodePattern renders a node pattern matching the filter's scope, e.g. (s:`__Entity__` {name: $source, user_id: $user_id}).
+// The type label is only used without a base label, because nodes are then keyed by their type.
+func (s *cypherGraphStore) nodePattern(variable string, typeLabel string, filter Filter, nameParam string) string {
+	label := ""
+	if s.dialect.useBaseLabel() {
+		label = ":`" + baseLabel + "`"
+	} else if typeLabel != "" {
+		label = ":`" + typeLabel + "`"
+	}
+	props := scopeProps(filter)
+	if nameParam != "" {
+		props = "name: $" + nameParam + ", " + props
+	}
+	return fmt.Sprintf("(%s%s {%s})", variable, label, props)
+}
+
+// run executes an auto-commit query, reconnecting once if the connection was lost. Callers must hold s.mu.
+func (s *cypherGraphStore) run(ctx context.Context, query string, params map[string]interface{}) (*boltclient.Result, error) {
+	if err := s.ensureConn(ctx); err != nil {
+		return nil, err
+	}
+	res, err := s.conn.Run(ctx, query, params, s.dialect.runExtra())
+	if errors.Is(err, boltclient.ErrConnectionBroken) {
+		s.dropConn()
+		if err := s.ensureConn(ctx); err != nil {
+			return nil, err
+		}
+		res, err = s.conn.Run(ctx, query, params, s.dialect.runExtra())
+	}
+	return res, err
+}
+
+// inTx runs fn inside an explicit transaction, committing on success. Transactions that fail
+// with a transient error are retried. Callers must hold s.mu.
+func (s *cypherGraphStore) inTx(ctx context.Context, fn func() error) error {
+	var err error
+	for attempt := 1; attempt <= maxTxAttempts; attempt++ {
+		err = s.tryTx(ctx, fn)
+		if err == nil || !isTransient(err) {
+			return err
+		}
+		fmt.Printf("GraphStore(%s): Transient error on attempt %d, retrying: %v\n", s.name, attempt, err)
+	}
+	return err
+}
+
+func (s *cypherGraphStore) tryTx(ctx context.Context, fn func() error) error {
+	if err := s.ensureConn(ctx); err != nil {
+		return err
+	}
+	if err := s.conn.Begin(ctx, s.dialect.runExtra()); err != nil {
+		if !errors.Is(err, boltclient.ErrConnectionBroken) {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		s.dropConn()
+		if err := s.ensureConn(ctx); err != nil {
+			return err
+		}
+		if err := s.conn.Begin(ctx, s.dialect.runExtra()); err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+	}
+	if err := fn(); err != nil {
+		_ = s.conn.Rollback(ctx)
+		return err
+	}
+	if err := s.conn.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (s *cypherGraphStore) ensureConn(ctx context.Context) error {
+	if s.conn != nil {
+		return nil
+	}
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to reconnect to %s: %w", s.name, err)
+	}
+	s.conn = conn
+	return nil
+}
+
+func (s *cypherGraphStore) dropConn() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// isTransient reports whether err is a server error that may succeed when retried.
+func isTransient(err error) bool {
+	var boltErr *boltclient.Error
+	return errors.As(err, &boltErr) && strings.Contains(boltErr.Code, "TransientError")
+}
+
+// relationReturn projects each matched edge r as a Relation row. Node labels are returned
+// whole and the type is picked client-side, since list comprehension support varies by server.
+var relationReturn = "RETURN startNode(r).name AS source, labels(startNode(r)) AS source_labels, " +
+	"type(r) AS relationship, endNode(r).name AS destination, labels(endNode(r)) AS destination_labels, " +
+	attributeProjection("startNode(r)", "source_") + ", " + attributeProjection("r", "edge_") + ", " +
+	attributeProjection("endNode(r)", "destination_") + ", r.valid_from AS valid_from, r.valid_to AS valid_to, r.recorded_at AS recorded_at"
+
+func relationsFromResult(res *boltclient.Result) []Relation {
+	rows := res.Rows()
+	relations := make([]Relation, 0, len(rows))
+	for _, row := range rows {
+		var r Relation
+		r.Source, _ = row["source"].(string)
+		r.SourceType = entityType(row["source_labels"])
+		r.Relationship, _ = row["relationship"].(string)
+		r.Destination, _ = row["destination"].(string)
+		r.DestinationType = entityType(row["destination_labels"])
+		r.Attributes = attributesFromRow(row, "edge_")
+		r.Validity = validityFromRow(row)
+		sourceAttrs, destinationAttrs := attributesFromRow(row, "source_"), attributesFromRow(row, "destination_")
+		r.SourceAttributes, r.DestinationAttributes = &sourceAttrs, &destinationAttrs
+		relations = append(relations, r)
+	}
+	return relations
+}
+
+// validityFromRow reads the validity columns of relationReturn. Edges recorded before
+// temporal relations have no valid_from, and use their creation time as recorded_at.
+func validityFromRow(row map[string]interface{}) Validity {
+	var v Validity
+	if ms, ok := row["valid_from"].(int64); ok {
+		v.ValidFrom = time.UnixMilli(ms).UTC()
+	}
+	if ms, ok := row["valid_to"].(int64); ok {
+		t := time.UnixMilli(ms).UTC()
+		v.ValidTo = &t
+	}
+	if ms, ok := row["recorded_at"].(int64); ok {
+		v.RecordedAt = time.UnixMilli(ms).UTC()
+	} else if ms, ok := row["edge_"+propCreatedAt].(int64); ok {
+		v.RecordedAt = time.UnixMilli(ms).UTC()
+	}
+	return v
+}
+
+// Attributes are stored as plain properties because Cypher property values cannot be maps;
+// Properties is kept as a JSON string.
+const (
+	propProperties      = "properties_json"
+	propSourceMemoryIDs = "source_memory_ids"
+	propExtractionModel = "extraction_model"
+	propConfidence      = "confidence"
+	propCreatedAt       = "created_at"
+	propUpdatedAt       = "updated_at"
+	propMentionCount    = "mention_count"
+)
+
+var attributeProps = []string{propProperties, propSourceMemoryIDs, propExtractionModel, propConfidence, propCreatedAt, propUpdatedAt, propMentionCount}
+
+// attributeProjection returns the columns of the attribute properties of element, named with prefix.
+func attributeProjection(element string, prefix string) string {
+	cols := make([]string, len(attributeProps))
+	for i, p := range attributeProps {
+		cols[i] = fmt.Sprintf("%s.%s AS %s%s", element, p, prefix, p)
+	}
+	return strings.Join(cols, ", ")
+}
+
+// attributesFromRow reads the columns written by attributeProjection.
+func attributesFromRow(row map[string]interface{}, prefix string) Attributes {
+	var a Attributes
+	if s, ok := row[prefix+propProperties].(string); ok && s != "" {
+		if err := json.Unmarshal([]byte(s), &a.Properties); err != nil {
+			fmt.Printf("GraphStore: Ignoring invalid properties: %v\n", err)
+		}
+	}
+	a.SourceMemoryIDs = stringList(row[prefix+propSourceMemoryIDs])
+	a.ExtractionModel, _ = row[prefix+propExtractionModel].(string)
+	if f, ok := row[prefix+propConfidence].(float64); ok {
+		a.Confidence = float32(f)
+	}
+	if ms, ok := row[prefix+propCreatedAt].(int64); ok {
+		a.CreatedAt = time.UnixMilli(ms).UTC()
+	}
+	if ms, ok := row[prefix+propUpdatedAt].(int64); ok {
+		a.UpdatedAt = time.UnixMilli(ms).UTC()
+	}
+	if n, ok := row[prefix+propMentionCount].(int64); ok {
+		a.MentionCount = int(n)
+	}
+	return a
+}
+
+// attributeParams converts attributes to the properties set by mergeRelation.
+func attributeParams(a Attributes) (map[string]interface{}, error) {
+	props := map[string]interface{}{
+		propSourceMemoryIDs: a.SourceMemoryIDs,
+		propExtractionModel: a.ExtractionModel,
+		propConfidence:      float64(a.Confidence),
+		propUpdatedAt:       a.UpdatedAt.UnixMilli(),
+		propMentionCount:    int64(a.MentionCount),
+	}
+	if a.SourceMemoryIDs == nil {
+		props[propSourceMemoryIDs] = []string{}
+	}
+	data, err := json.Marshal(a.Properties)
+	if err != nil {
+		return nil, fmt.Errorf("invalid properties: %w", err)
+	}
+	if a.Properties == nil {
+		data = []byte("{}")
+	}
+	props[propProperties] = string(data)
+	return props, nil
+}
+
+// entityType returns the first label other than the base label.
+func entityType(labels interface{}) string {
+	list, _ := labels.([]interface{})
+	for _, l := range list {
+		if s, ok := l.(string); ok && s != baseLabel {
+			return s
+		}
+	}
+	return ""
+}
+
+// floatList converts a list property returned over Bolt to a []float32.
+func floatList(v interface{}) []float32 {
+	list, _ := v.([]interface{})
+	out := make([]float32, 0, len(list))
+	for _, x := range list {
+		switch f := x.(type) {
+		case float64:
+			out = append(out, float32(f))
+		case int64:
+			out = append(out, float32(f))
+		}
+	}
+	return out
+}
+
+// stringList converts a list property returned over Bolt to a []string.
+func stringList(v interface{}) []string {
+	list, _ := v.([]interface{})
+	var out []string
+	for _, x := range list {
+		if s, ok := x.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// scopeParams returns the query parameters referenced by scopeProps.
+func scopeParams(filter Filter) map[string]interface{} {
+	params := map[string]interface{}{"user_id": filter.UserID}
+	if filter.AgentID != "" {
+		params["agent_id"] = filter.AgentID
+	}
+	if filter.RunID != "" {
+		params["run_id"] = filter.RunID
+	}
+	return params
+}
+
+// scopeProps renders the property map entries matching the filter's scope.
+func scopeProps(filter Filter) string {
+	props := "user_id: $user_id"
+	if filter.AgentID != "" {
+		props += ", agent_id: $agent_id"
+	}
+	if filter.RunID != "" {
+		props += ", run_id: $run_id"
+	}
+	return props
+}
+
+func checkRelation(r Relation) error {
+	if r.Source == "" || r.Destination == "" || r.Relationship == "" {
+		return fmt.Errorf("relation requires a source, destination and relationship, got %q -[%q]-> %q", r.Source, r.Relationship, r.Destination)
+	}
+	return nil
+}
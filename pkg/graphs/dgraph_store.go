@@ -0,0 +1,1180 @@
+package graphs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pnocera/gomem/internal/vecmath"
+)
+
+// dgraphSchema declares the predicates and types of the graph. Relations are nodes of their
+// own, pointing at their endpoints, rather than uid edges between entities: Dgraph keeps a
+// single edge per predicate between two nodes, which could hold neither the closed intervals
+// of a relation's history nor list-valued provenance. Names and users are @upsert so that
+// concurrent transactions creating the same entity conflict instead of duplicating it.
+const dgraphSchema = `
+entity.name: string @index(exact) @upsert .
+entity.user_id: string @index(exact) @upsert .
+entity.agent_id: string @index(exact) .
+entity.run_id: string @index(exact) .
+entity.type: string @index(exact) .
+entity.aliases: [string] @index(exact) .
+entity.embedding: string .
+relation.source: uid @reverse .
+relation.destination: uid @reverse .
+relation.type: string @index(exact) .
+relation.user_id: string @index(exact) .
+relation.valid_from: datetime .
+relation.valid_to: datetime .
+relation.recorded_at: datetime .
+attr.properties: string .
+attr.source_memory_ids: [string] .
+attr.extraction_model: string .
+attr.confidence: float .
+attr.created_at: datetime .
+attr.updated_at: datetime .
+attr.mention_count: int .
+
+type Entity {
+	entity.name
+	entity.user_id
+	entity.agent_id
+	entity.run_id
+	entity.type
+	entity.aliases
+	entity.embedding
+	attr.properties
+	attr.source_memory_ids
+	attr.extraction_model
+	attr.confidence
+	attr.created_at
+	attr.updated_at
+	attr.mention_count
+}
+
+type Relation {
+	relation.source
+	relation.destination
+	relation.type
+	relation.user_id
+	relation.valid_from
+	relation.valid_to
+	relation.recorded_at
+	attr.properties
+	attr.source_memory_ids
+	attr.extraction_model
+	attr.confidence
+	attr.created_at
+	attr.updated_at
+	attr.mention_count
+}
+`
+
+// DQL projections of the stored attributes, entities and relations.
+const (
+	dgraphAttributeFields = "attr.properties attr.source_memory_ids attr.extraction_model attr.confidence attr.created_at attr.updated_at attr.mention_count"
+	dgraphNodeFields      = "uid entity.name entity.type entity.agent_id entity.run_id entity.aliases " + dgraphAttributeFields
+	dgraphEdgeFields      = "uid relation.type relation.valid_from relation.valid_to relation.recorded_at " + dgraphAttributeFields +
+		" relation.source { " + dgraphNodeFields + " } relation.destination { " + dgraphNodeFields + " }"
+)
+
+// DgraphGraphStore implements the GraphStore interface for Dgraph over the HTTP API of an
+// Alpha. Entities are keyed by name, user, agent and run; every operation runs in a Dgraph
+// transaction, retried when it is aborted by a conflicting one.
+type DgraphGraphStore struct {
+	mu        sync.Mutex // Serializes operations, which span several requests of one transaction
+	cfg       *DgraphConfig
+	url       string
+	client    *http.Client
+	accessJWT string // ACL token from the last login
+}
+
+// Compile-time check to ensure *DgraphGraphStore satisfies the GraphStore interface.
+var _ GraphStore = (*DgraphGraphStore)(nil)
+
+type dgraphAttributes struct {
+	Properties      string    `json:"attr.properties"`
+	SourceMemoryIDs []string  `json:"attr.source_memory_ids"`
+	ExtractionModel string    `json:"attr.extraction_model"`
+	Confidence      float64   `json:"attr.confidence"`
+	CreatedAt       time.Time `json:"attr.created_at"`
+	UpdatedAt       time.Time `json:"attr.updated_at"`
+	MentionCount    int       `json:"attr.mention_count"`
+}
+
+type dgraphNode struct {
+	UID       string   `json:"uid"`
+	Name      string   `json:"entity.name"`
+	Type      string   `json:"entity.type"`
+	AgentID   string   `json:"entity.agent_id"`
+	RunID     string   `json:"entity.run_id"`
+	Aliases   []string `json:"entity.aliases"`
+	Embedding string   `json:"entity.embedding"` // JSON array of the name's embedding
+	dgraphAttributes
+}
+
+type dgraphEdge struct {
+	UID          string      `json:"uid"`
+	Relationship string      `json:"relation.type"`
+	Source       *dgraphNode `json:"relation.source"`
+	Destination  *dgraphNode `json:"relation.destination"`
+	ValidFrom    time.Time   `json:"relation.valid_from"`
+	ValidTo      *time.Time  `json:"relation.valid_to"`
+	RecordedAt   time.Time   `json:"relation.recorded_at"`
+	dgraphAttributes
+}
+
+// NewDgraphGraphStore logs in when cfg has a username, and sets up the schema.
+func NewDgraphGraphStore(ctx context.Context, cfg *DgraphConfig) (*DgraphGraphStore, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("dgraph config is nil")
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid dgraph config: %w", err)
+	}
+	s := &DgraphGraphStore{cfg: cfg, url: strings.TrimRight(cfg.URL, "/"), client: &http.Client{}}
+	if cfg.Username != "" {
+		if err := s.login(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := s.post(ctx, "/alter", "application/dql", []byte(dgraphSchema)); err != nil {
+		return nil, fmt.Errorf("failed to set up dgraph schema: %w", err)
+	}
+	return s, nil
+}
+
+func (s *DgraphGraphStore) AddRelations(ctx context.Context, filter Filter, relations []Relation) error {
+	if err := filter.validate(); err != nil {
+		return err
+	}
+	normalized := make([]Relation, 0, len(relations))
+	for _, r := range relations {
+		rel := normalizeRelation(r)
+		if err := checkRelation(rel); err != nil {
+			return err
+		}
+		normalized = append(normalized, rel)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inTx(ctx, func(tx *dgraphTxn) error {
+		for _, rel := range normalized {
+			if err := s.mergeRelation(ctx, tx, filter, rel); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *DgraphGraphStore) UpdateRelation(ctx context.Context, filter Filter, relation Relation) error {
+	if err := filter.validate(); err != nil {
+		return err
+	}
+	rel := normalizeRelation(relation)
+	if err := checkRelation(rel); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inTx(ctx, func(tx *dgraphTxn) error {
+		edges, err := s.matchingEdges(ctx, tx, filter, rel.Source, rel.Destination, "")
+		if err != nil {
+			return err
+		}
+		var previous []dgraphEdge
+		for _, e := range edges {
+			if e.ValidTo == nil && e.Relationship != rel.Relationship {
+				previous = append(previous, e)
+			}
+		}
+		if err := closeDgraphEdges(ctx, tx, previous, time.Now()); err != nil {
+			return err
+		}
+		return s.mergeRelation(ctx, tx, filter, rel)
+	})
+}
+
+func (s *DgraphGraphStore) CloseRelations(ctx context.Context, filter Filter, relations []Relation) error {
+	if err := filter.validate(); err != nil {
+		return err
+	}
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inTx(ctx, func(tx *dgraphTxn) error {
+		for _, relation := range relations {
+			rel := normalizeRelation(relation)
+			if err := checkRelation(rel); err != nil {
+				return err
+			}
+			edges, err := s.matchingEdges(ctx, tx, filter, rel.Source, rel.Destination, rel.Relationship)
+			if err != nil {
+				return err
+			}
+			var current []dgraphEdge
+			for _, e := range edges {
+				if e.ValidTo == nil {
+					current = append(current, e)
+				}
+			}
+			if err := closeDgraphEdges(ctx, tx, current, rel.closedAt(now)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *DgraphGraphStore) DeleteRelations(ctx context.Context, filter Filter, relations []Relation) error {
+	if err := filter.validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inTx(ctx, func(tx *dgraphTxn) error {
+		for _, relation := range relations {
+			rel := normalizeRelation(relation)
+			if err := checkRelation(rel); err != nil {
+				return err
+			}
+			edges, err := s.matchingEdges(ctx, tx, filter, rel.Source, rel.Destination, rel.Relationship)
+			if err != nil {
+				return err
+			}
+			if err := deleteDgraphNodes(ctx, tx, edgeUIDs(edges)); err != nil {
+				return fmt.Errorf("failed to delete relation %s -[%s]-> %s: %w", rel.Source, rel.Relationship, rel.Destination, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (s *DgraphGraphStore) SearchByEntity(ctx context.Context, filter Filter, entities []string, opts QueryOptions) ([]Relation, error) {
+	return s.Traverse(ctx, filter, entities, 1, opts)
+}
+
+// Traverse walks up to hops edges away from the named entities, in either direction, one
+// query per hop, and returns the edges visited in breadth-first order.
+func (s *DgraphGraphStore) Traverse(ctx context.Context, filter Filter, entities []string, hops int, opts QueryOptions) ([]Relation, error) {
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+	if hops <= 0 {
+		hops = 1
+	}
+	if hops > maxTraverseHops {
+		return nil, fmt.Errorf("traversal depth %d exceeds the maximum of %d", hops, maxTraverseHops)
+	}
+	names := make([]string, 0, len(entities))
+	for _, e := range entities {
+		if n := NormalizeEntity(e); n != "" {
+			names = append(names, n)
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx := s.newTxn()
+	start, err := s.nodesMatching(ctx, tx, filter, names...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to traverse relations: %w", err)
+	}
+	limit := opts.limit()
+	asOf := opts.asOf()
+	visitedNodes := make(map[string]bool)
+	var frontier []string
+	for _, n := range start {
+		visitedNodes[n.UID] = true
+		frontier = append(frontier, n.UID)
+	}
+
+	var relations []Relation
+	seenEdges := make(map[string]bool)
+	for depth := 0; depth < hops && len(frontier) > 0; depth++ {
+		incident, err := s.incidentEdges(ctx, tx, frontier)
+		if err != nil {
+			return nil, fmt.Errorf("failed to traverse relations: %w", err)
+		}
+		var next []string
+		for _, nodeUID := range frontier {
+			for _, e := range incident[nodeUID] {
+				if seenEdges[e.UID] {
+					continue
+				}
+				other := e.Destination
+				if other.UID == nodeUID {
+					other = e.Source
+				}
+				if !other.inScope(filter) || !opts.includes(e.validity(), asOf) {
+					continue
+				}
+				seenEdges[e.UID] = true
+				relations = append(relations, e.relation())
+				if len(relations) >= limit {
+					return relations, nil
+				}
+				if !visitedNodes[other.UID] {
+					visitedNodes[other.UID] = true
+					next = append(next, other.UID)
+				}
+			}
+		}
+		frontier = next
+	}
+	return relations, nil
+}
+
+func (s *DgraphGraphStore) GetAll(ctx context.Context, filter Filter, opts QueryOptions) ([]Relation, error) {
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+	query := fmt.Sprintf("{ r(func: eq(relation.user_id, %s)) @filter(type(Relation)) { %s } }", strconv.Quote(filter.UserID), dgraphEdgeFields)
+	var data struct {
+		R []dgraphEdge `json:"r"`
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.newTxn().query(ctx, query, &data); err != nil {
+		return nil, fmt.Errorf("failed to get relations: %w", err)
+	}
+	asOf := opts.asOf()
+	var edges []dgraphEdge
+	for _, e := range data.R {
+		if e.complete() && e.Source.inScope(filter) && e.Destination.inScope(filter) && opts.includes(e.validity(), asOf) {
+			edges = append(edges, e)
+		}
+	}
+	sortDgraphEdges(edges)
+	if limit := opts.limit(); len(edges) > limit {
+		edges = edges[:limit]
+	}
+	relations := make([]Relation, len(edges))
+	for i, e := range edges {
+		relations[i] = e.relation()
+	}
+	return relations, nil
+}
+
+func (s *DgraphGraphStore) Reset(ctx context.Context, filter Filter) error {
+	if err := filter.validate(); err != nil {
+		return err
+	}
+	query := fmt.Sprintf("{ n as var(func: eq(entity.user_id, %s)) @filter(%s) { o as ~relation.source i as ~relation.destination } }",
+		strconv.Quote(filter.UserID), dgraphScopeFilter(filter))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inTx(ctx, func(tx *dgraphTxn) error {
+		deletes := []map[string]string{{"uid": "uid(n)"}, {"uid": "uid(o)"}, {"uid": "uid(i)"}}
+		if _, err := tx.mutate(ctx, query, dgraphMutation{Delete: deletes}); err != nil {
+			return fmt.Errorf("failed to reset graph for user %s: %w", filter.UserID, err)
+		}
+		return nil
+	})
+}
+
+func (s *DgraphGraphStore) SetNodeEmbedding(ctx context.Context, filter Filter, name string, nodeType string, embedding []float32) error {
+	if err := filter.validate(); err != nil {
+		return err
+	}
+	name, nodeType = NormalizeEntity(name), normalizeLabel(nodeType)
+	if name == "" {
+		return fmt.Errorf("entity name is empty")
+	}
+	data, err := json.Marshal(embedding)
+	if err != nil {
+		return fmt.Errorf("invalid embedding: %w", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inTx(ctx, func(tx *dgraphTxn) error {
+		n, err := s.mergeNode(ctx, tx, filter, name, nodeType, time.Now())
+		if err != nil {
+			return err
+		}
+		if _, err := tx.mutate(ctx, "", dgraphMutation{Set: map[string]interface{}{"uid": n.UID, "entity.embedding": string(data)}}); err != nil {
+			return fmt.Errorf("failed to set embedding of %s: %w", name, err)
+		}
+		return nil
+	})
+}
+
+// SearchSimilarNodes scores the scope's node embeddings client-side, which needs neither a
+// vector index nor a Dgraph version with vector predicates.
+func (s *DgraphGraphStore) SearchSimilarNodes(ctx context.Context, filter Filter, embedding []float32, threshold float32, limit int) ([]NodeMatch, error) {
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+	query := fmt.Sprintf("{ n(func: eq(entity.user_id, %s)) @filter(%s AND has(entity.embedding)) { uid entity.name entity.type entity.aliases entity.embedding } }",
+		strconv.Quote(filter.UserID), dgraphScopeFilter(filter))
+	var data struct {
+		N []dgraphNode `json:"n"`
+	}
+	s.mu.Lock()
+	err := s.newTxn().query(ctx, query, &data)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to search similar nodes: %w", err)
+	}
+	best := make(map[string]NodeMatch)
+	for _, n := range data.N {
+		var stored []float32
+		if err := json.Unmarshal([]byte(n.Embedding), &stored); err != nil {
+			continue
+		}
+		score := vecmath.Cosine(embedding, stored)
+		if score < threshold {
+			continue
+		}
+		if prev, ok := best[n.Name]; ok && prev.Score >= score {
+			continue
+		}
+		best[n.Name] = NodeMatch{Name: n.Name, Type: n.Type, Aliases: n.Aliases, Score: score}
+	}
+	matches := make([]NodeMatch, 0, len(best))
+	for _, m := range best {
+		matches = append(matches, m)
+	}
+	return sortMatches(matches, limit), nil
+}
+
+func (s *DgraphGraphStore) MergeNodes(ctx context.Context, filter Filter, canonical string, alias string) (*MergeResult, error) {
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+	canonical, alias = NormalizeEntity(canonical), NormalizeEntity(alias)
+	if canonical == "" || alias == "" || canonical == alias {
+		return nil, fmt.Errorf("cannot merge %q into %q", alias, canonical)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var result *MergeResult
+	err := s.inTx(ctx, func(tx *dgraphTxn) error {
+		result = &MergeResult{}
+		canonicalNodes, err := s.nodesNamed(ctx, tx, filter, canonical)
+		if err != nil {
+			return fmt.Errorf("failed to find %s: %w", canonical, err)
+		}
+		if len(canonicalNodes) == 0 {
+			return fmt.Errorf("canonical entity %q not found", canonical)
+		}
+		aliasNodes, err := s.nodesNamed(ctx, tx, filter, alias)
+		if err != nil {
+			return fmt.Errorf("failed to find %s: %w", alias, err)
+		}
+
+		var aliases []string
+		existing := make(map[string]bool)
+		incident, err := s.incidentEdges(ctx, tx, nodeUIDs(canonicalNodes))
+		if err != nil {
+			return fmt.Errorf("failed to get relations of %s: %w", canonical, err)
+		}
+		for _, n := range canonicalNodes {
+			aliases = mergeAliases(aliases, canonical, n.Aliases...)
+			for _, e := range incident[n.UID] {
+				if e.ValidTo == nil {
+					existing[relationKey(e.relation())] = true
+				}
+			}
+		}
+		aliases = mergeAliases(aliases, canonical, alias)
+		incident, err = s.incidentEdges(ctx, tx, nodeUIDs(aliasNodes))
+		if err != nil {
+			return fmt.Errorf("failed to get relations of %s: %w", alias, err)
+		}
+		moved := make(map[string]bool)
+		var obsolete []string
+		for _, n := range aliasNodes {
+			aliases = mergeAliases(aliases, canonical, n.Aliases...)
+			for _, e := range incident[n.UID] {
+				if !moved[e.UID] {
+					moved[e.UID] = true
+					result.Moved = append(result.Moved, e.relation())
+					obsolete = append(obsolete, e.UID)
+				}
+			}
+		}
+		result.Created = repointRelations(result.Moved, alias, canonical, canonicalNodes[0].Type, existing)
+
+		if err := deleteDgraphNodes(ctx, tx, append(obsolete, nodeUIDs(aliasNodes)...)); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", alias, err)
+		}
+		for _, rel := range result.Created {
+			if err := s.mergeRelation(ctx, tx, filter, rel); err != nil {
+				return err
+			}
+		}
+		return setDgraphAliases(ctx, tx, canonicalNodes, aliases)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *DgraphGraphStore) RemoveAlias(ctx context.Context, filter Filter, canonical string, alias string) error {
+	if err := filter.validate(); err != nil {
+		return err
+	}
+	canonical, alias = NormalizeEntity(canonical), NormalizeEntity(alias)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inTx(ctx, func(tx *dgraphTxn) error {
+		nodes, err := s.nodesNamed(ctx, tx, filter, canonical)
+		if err != nil {
+			return fmt.Errorf("failed to find %s: %w", canonical, err)
+		}
+		var aliases []string
+		for _, n := range nodes {
+			aliases = mergeAliases(aliases, canonical, n.Aliases...)
+		}
+		return setDgraphAliases(ctx, tx, nodes, removeString(aliases, alias))
+	})
+}
+
+func (s *DgraphGraphStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// mergeRelation merges both nodes and the current edge of one relation, then records the
+// mention in their attributes. Callers must hold s.mu.
+func (s *DgraphGraphStore) mergeRelation(ctx context.Context, tx *dgraphTxn, filter Filter, relation Relation) error {
+	rel := normalizeRelation(relation)
+	if err := checkRelation(rel); err != nil {
+		return err
+	}
+	now := time.Now()
+	source, err := s.mergeNode(ctx, tx, filter, rel.Source, rel.SourceType, now)
+	if err != nil {
+		return err
+	}
+	target := source
+	if rel.Destination != rel.Source {
+		if target, err = s.mergeNode(ctx, tx, filter, rel.Destination, rel.DestinationType, now); err != nil {
+			return err
+		}
+	}
+	sourceAttrs := mergeAttributes(source.attributes(), rel.endpointAttributes(rel.SourceAttributes), now)
+	updates := []interface{}{dgraphAttributeValues(source.UID, sourceAttrs)}
+	if target.UID != source.UID {
+		targetAttrs := mergeAttributes(target.attributes(), rel.endpointAttributes(rel.DestinationAttributes), now)
+		updates = append(updates, dgraphAttributeValues(target.UID, targetAttrs))
+	}
+	if _, err := tx.mutate(ctx, "", dgraphMutation{Set: updates}); err != nil {
+		return fmt.Errorf("failed to update attributes of %s and %s: %w", rel.Source, rel.Destination, err)
+	}
+
+	// The current edge, if any, takes the mention. A closed relation, e.g. restored history,
+	// takes the edge closed over the same interval so that importing it twice adds nothing,
+	// and is otherwise recorded as a new interval. Validity predicates are not indexed, so
+	// closed edges are compared here.
+	var edge map[string]interface{}
+	if rel.ValidTo == nil || !rel.ValidFrom.IsZero() {
+		state := "NOT has(relation.valid_to)"
+		if rel.ValidTo != nil {
+			state = "has(relation.valid_to)"
+		}
+		query := fmt.Sprintf("{ r(func: uid(%s)) { ~relation.source @filter(eq(relation.type, %s) AND uid_in(relation.destination, %s) AND %s) { uid relation.valid_from relation.valid_to %s } } }",
+			source.UID, strconv.Quote(rel.Relationship), target.UID, state, dgraphAttributeFields)
+		var data struct {
+			R []struct {
+				Edges []dgraphEdge `json:"~relation.source"`
+			} `json:"r"`
+		}
+		if err := tx.query(ctx, query, &data); err != nil {
+			return fmt.Errorf("failed to find relation %s -[%s]-> %s: %w", rel.Source, rel.Relationship, rel.Destination, err)
+		}
+		if len(data.R) > 0 {
+			for _, stored := range data.R[0].Edges {
+				if rel.ValidTo == nil || rel.Validity.sameInterval(stored.validity()) {
+					edge = dgraphAttributeValues(stored.UID, mergeAttributes(stored.attributes(), rel.Attributes, now))
+					break
+				}
+			}
+		}
+	}
+	if edge == nil {
+		edge = dgraphAttributeValues("_:r", mergeAttributes(Attributes{CreatedAt: now}, rel.Attributes, now))
+		validFrom := rel.ValidFrom
+		if validFrom.IsZero() {
+			validFrom = now
+		}
+		edge["dgraph.type"] = "Relation"
+		edge["relation.source"] = map[string]string{"uid": source.UID}
+		edge["relation.destination"] = map[string]string{"uid": target.UID}
+		edge["relation.type"] = rel.Relationship
+		edge["relation.user_id"] = filter.UserID
+		edge["relation.valid_from"] = validFrom.UTC()
+		edge["relation.recorded_at"] = now.UTC()
+		if rel.ValidTo != nil {
+			edge["relation.valid_to"] = rel.ValidTo.UTC()
+		}
+	}
+	if _, err := tx.mutate(ctx, "", dgraphMutation{Set: edge}); err != nil {
+		return fmt.Errorf("failed to add relation %s -[%s]-> %s: %w", rel.Source, rel.Relationship, rel.Destination, err)
+	}
+	return nil
+}
+
+// mergeNode returns the node keyed by name and the filter's agent and run, creating it with
+// an upsert block if needed. A non-empty nodeType replaces the stored type.
+func (s *DgraphGraphStore) mergeNode(ctx context.Context, tx *dgraphTxn, filter Filter, name string, nodeType string, now time.Time) (*dgraphNode, error) {
+	key := fmt.Sprintf("type(Entity) AND eq(entity.user_id, %s)", strconv.Quote(filter.UserID))
+	for _, scope := range []struct{ predicate, value string }{{"entity.agent_id", filter.AgentID}, {"entity.run_id", filter.RunID}} {
+		if scope.value == "" {
+			key += fmt.Sprintf(" AND NOT has(%s)", scope.predicate)
+		} else {
+			key += fmt.Sprintf(" AND eq(%s, %s)", scope.predicate, strconv.Quote(scope.value))
+		}
+	}
+
+	create := map[string]interface{}{
+		"uid":             "_:n",
+		"dgraph.type":     "Entity",
+		"entity.name":     name,
+		"entity.user_id":  filter.UserID,
+		"attr.created_at": now.UTC(),
+	}
+	if filter.AgentID != "" {
+		create["entity.agent_id"] = filter.AgentID
+	}
+	if filter.RunID != "" {
+		create["entity.run_id"] = filter.RunID
+	}
+	if nodeType != "" {
+		create["entity.type"] = nodeType
+	}
+	mutations := []dgraphMutation{{Cond: "@if(eq(len(n), 0))", Set: create}}
+	if nodeType != "" {
+		mutations = append(mutations, dgraphMutation{Cond: "@if(gt(len(n), 0))", Set: map[string]interface{}{"uid": "uid(n)", "entity.type": nodeType}})
+	}
+	upsert := fmt.Sprintf("{ n as var(func: eq(entity.name, %s)) @filter(%s) }", strconv.Quote(name), key)
+	if _, err := tx.mutate(ctx, upsert, mutations...); err != nil {
+		return nil, fmt.Errorf("failed to add node %s: %w", name, err)
+	}
+
+	query := fmt.Sprintf("{ n(func: eq(entity.name, %s)) @filter(%s) { %s } }", strconv.Quote(name), key, dgraphNodeFields)
+	var data struct {
+		N []dgraphNode `json:"n"`
+	}
+	if err := tx.query(ctx, query, &data); err != nil {
+		return nil, fmt.Errorf("failed to read node %s: %w", name, err)
+	}
+	if len(data.N) == 0 {
+		return nil, fmt.Errorf("node %s was not created", name)
+	}
+	return &data.N[0], nil
+}
+
+// nodesNamed returns the nodes with one of names within the filter's scope, in UID order.
+func (s *DgraphGraphStore) nodesNamed(ctx context.Context, tx *dgraphTxn, filter Filter, names ...string) ([]dgraphNode, error) {
+	quoted := make([]string, len(names))
+	for i, n := range names {
+		quoted[i] = strconv.Quote(n)
+	}
+	query := fmt.Sprintf("{ n(func: eq(entity.name, [%s])) @filter(eq(entity.user_id, %s) AND %s) { %s } }",
+		strings.Join(quoted, ", "), strconv.Quote(filter.UserID), dgraphScopeFilter(filter), dgraphNodeFields)
+	var data struct {
+		N []dgraphNode `json:"n"`
+	}
+	if err := tx.query(ctx, query, &data); err != nil {
+		return nil, err
+	}
+	sort.Slice(data.N, func(i, j int) bool { return parseUID(data.N[i].UID) < parseUID(data.N[j].UID) })
+	return data.N, nil
+}
+
+// nodesMatching returns the nodes within the filter's scope named by one of names or having
+// one of them as an alias, in UID order.
+func (s *DgraphGraphStore) nodesMatching(ctx context.Context, tx *dgraphTxn, filter Filter, names ...string) ([]dgraphNode, error) {
+	quoted := make([]string, len(names))
+	for i, n := range names {
+		quoted[i] = strconv.Quote(n)
+	}
+	list := strings.Join(quoted, ", ")
+	query := fmt.Sprintf("{ var(func: eq(entity.name, [%s])) { named as uid } var(func: eq(entity.aliases, [%s])) { aliased as uid } n(func: uid(named, aliased)) @filter(eq(entity.user_id, %s) AND %s) { %s } }",
+		list, list, strconv.Quote(filter.UserID), dgraphScopeFilter(filter), dgraphNodeFields)
+	var data struct {
+		N []dgraphNode `json:"n"`
+	}
+	if err := tx.query(ctx, query, &data); err != nil {
+		return nil, err
+	}
+	sort.Slice(data.N, func(i, j int) bool { return parseUID(data.N[i].UID) < parseUID(data.N[j].UID) })
+	return data.N, nil
+}
+
+// matchingEdges returns the edges from source to destination within the filter's scope,
+// restricted to one relationship unless it is empty.
+func (s *DgraphGraphStore) matchingEdges(ctx context.Context, tx *dgraphTxn, filter Filter, source string, destination string, relationship string) ([]dgraphEdge, error) {
+	sources, err := s.nodesNamed(ctx, tx, filter, source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find %s: %w", source, err)
+	}
+	incident, err := s.incidentEdges(ctx, tx, nodeUIDs(sources))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get relations of %s: %w", source, err)
+	}
+	var matches []dgraphEdge
+	for _, n := range sources {
+		for _, e := range incident[n.UID] {
+			if e.Source.UID == n.UID && e.Destination.Name == destination && e.Destination.inScope(filter) &&
+				(relationship == "" || e.Relationship == relationship) {
+				matches = append(matches, e)
+			}
+		}
+	}
+	return matches, nil
+}
+
+// incidentEdges returns the edges leaving or entering each node, in UID order.
+func (s *DgraphGraphStore) incidentEdges(ctx context.Context, tx *dgraphTxn, uids []string) (map[string][]dgraphEdge, error) {
+	if len(uids) == 0 {
+		return nil, nil
+	}
+	query := fmt.Sprintf("{ n(func: uid(%s)) { uid ~relation.source { %[2]s } ~relation.destination { %[2]s } } }", strings.Join(uids, ", "), dgraphEdgeFields)
+	var data struct {
+		N []struct {
+			UID string       `json:"uid"`
+			Out []dgraphEdge `json:"~relation.source"`
+			In  []dgraphEdge `json:"~relation.destination"`
+		} `json:"n"`
+	}
+	if err := tx.query(ctx, query, &data); err != nil {
+		return nil, err
+	}
+	incident := make(map[string][]dgraphEdge, len(data.N))
+	for _, n := range data.N {
+		seen := make(map[string]bool)
+		var edges []dgraphEdge
+		for _, e := range append(n.Out, n.In...) {
+			if e.complete() && !seen[e.UID] { // Self-loops are listed twice
+				seen[e.UID] = true
+				edges = append(edges, e)
+			}
+		}
+		sortDgraphEdges(edges)
+		incident[n.UID] = edges
+	}
+	return incident, nil
+}
+
+// closeDgraphEdges ends the validity of edges at t.
+func closeDgraphEdges(ctx context.Context, tx *dgraphTxn, edges []dgraphEdge, t time.Time) error {
+	if len(edges) == 0 {
+		return nil
+	}
+	updates := make([]map[string]interface{}, len(edges))
+	for i, e := range edges {
+		updates[i] = map[string]interface{}{"uid": e.UID, "relation.valid_to": t.UTC()}
+	}
+	if _, err := tx.mutate(ctx, "", dgraphMutation{Set: updates}); err != nil {
+		return fmt.Errorf("failed to close relations: %w", err)
+	}
+	return nil
+}
+
+// deleteDgraphNodes deletes every predicate of the nodes with uids.
+func deleteDgraphNodes(ctx context.Context, tx *dgraphTxn, uids []string) error {
+	if len(uids) == 0 {
+		return nil
+	}
+	deletes := make([]map[string]string, len(uids))
+	for i, uid := range uids {
+		deletes[i] = map[string]string{"uid": uid}
+	}
+	_, err := tx.mutate(ctx, "", dgraphMutation{Delete: deletes})
+	return err
+}
+
+// setDgraphAliases replaces the aliases of nodes.
+func setDgraphAliases(ctx context.Context, tx *dgraphTxn, nodes []dgraphNode, aliases []string) error {
+	if len(nodes) == 0 {
+		return nil
+	}
+	deletes := make([]map[string]interface{}, len(nodes))
+	for i, n := range nodes {
+		deletes[i] = map[string]interface{}{"uid": n.UID, "entity.aliases": nil}
+	}
+	if _, err := tx.mutate(ctx, "", dgraphMutation{Delete: deletes}); err != nil {
+		return fmt.Errorf("failed to set aliases of %s: %w", nodes[0].Name, err)
+	}
+	if len(aliases) == 0 {
+		return nil
+	}
+	sets := make([]map[string]interface{}, len(nodes))
+	for i, n := range nodes {
+		sets[i] = map[string]interface{}{"uid": n.UID, "entity.aliases": aliases}
+	}
+	if _, err := tx.mutate(ctx, "", dgraphMutation{Set: sets}); err != nil {
+		return fmt.Errorf("failed to set aliases of %s: %w", nodes[0].Name, err)
+	}
+	return nil
+}
+
+// dgraphScopeFilter renders the DQL condition that an entity is within the filter's scope.
+// The user is matched by the caller's root function.
+func dgraphScopeFilter(filter Filter) string {
+	cond := "type(Entity)"
+	if filter.AgentID != "" {
+		cond += fmt.Sprintf(" AND eq(entity.agent_id, %s)", strconv.Quote(filter.AgentID))
+	}
+	if filter.RunID != "" {
+		cond += fmt.Sprintf(" AND eq(entity.run_id, %s)", strconv.Quote(filter.RunID))
+	}
+	return cond
+}
+
+// dgraphAttributeValues returns the mutation setting a's values on the node with uid.
+// Source memory IDs are a set, so setting the merged list only adds the new ones.
+func dgraphAttributeValues(uid string, a Attributes) map[string]interface{} {
+	values := map[string]interface{}{
+		"uid":                uid,
+		"attr.confidence":    float64(a.Confidence),
+		"attr.mention_count": a.MentionCount,
+		"attr.updated_at":    a.UpdatedAt.UTC(),
+	}
+	if !a.CreatedAt.IsZero() {
+		values["attr.created_at"] = a.CreatedAt.UTC()
+	}
+	if len(a.SourceMemoryIDs) > 0 {
+		values["attr.source_memory_ids"] = a.SourceMemoryIDs
+	}
+	if a.ExtractionModel != "" {
+		values["attr.extraction_model"] = a.ExtractionModel
+	}
+	if a.Properties != nil {
+		if data, err := json.Marshal(a.Properties); err == nil {
+			values["attr.properties"] = string(data)
+		} else {
+			fmt.Printf("GraphStore(dgraph): Ignoring invalid properties: %v\n", err)
+		}
+	}
+	return values
+}
+
+func (a dgraphAttributes) attributes() Attributes {
+	attrs := Attributes{
+		SourceMemoryIDs: a.SourceMemoryIDs,
+		ExtractionModel: a.ExtractionModel,
+		Confidence:      float32(a.Confidence),
+		MentionCount:    a.MentionCount,
+	}
+	if a.Properties != "" {
+		if err := json.Unmarshal([]byte(a.Properties), &attrs.Properties); err != nil {
+			fmt.Printf("GraphStore(dgraph): Ignoring invalid properties: %v\n", err)
+		}
+	}
+	if !a.CreatedAt.IsZero() {
+		attrs.CreatedAt = a.CreatedAt.UTC()
+	}
+	if !a.UpdatedAt.IsZero() {
+		attrs.UpdatedAt = a.UpdatedAt.UTC()
+	}
+	return attrs
+}
+
+func (n *dgraphNode) inScope(filter Filter) bool {
+	return (filter.AgentID == "" || n.AgentID == filter.AgentID) && (filter.RunID == "" || n.RunID == filter.RunID)
+}
+
+// complete reports whether both endpoints of the edge were returned.
+func (e dgraphEdge) complete() bool {
+	return e.Source != nil && e.Destination != nil
+}
+
+func (e dgraphEdge) validity() Validity {
+	v := Validity{ValidFrom: e.ValidFrom.UTC(), RecordedAt: e.RecordedAt.UTC()}
+	if e.ValidTo != nil {
+		t := e.ValidTo.UTC()
+		v.ValidTo = &t
+	}
+	return v
+}
+
+func (e dgraphEdge) relation() Relation {
+	sourceAttrs, destinationAttrs := e.Source.attributes(), e.Destination.attributes()
+	return Relation{
+		Source:                e.Source.Name,
+		SourceType:            e.Source.Type,
+		Relationship:          e.Relationship,
+		Destination:           e.Destination.Name,
+		DestinationType:       e.Destination.Type,
+		Attributes:            e.attributes(),
+		Validity:              e.validity(),
+		SourceAttributes:      &sourceAttrs,
+		DestinationAttributes: &destinationAttrs,
+	}
+}
+
+func sortDgraphEdges(edges []dgraphEdge) {
+	sort.Slice(edges, func(i, j int) bool { return parseUID(edges[i].UID) < parseUID(edges[j].UID) })
+}
+
+func nodeUIDs(nodes []dgraphNode) []string {
+	uids := make([]string, len(nodes))
+	for i, n := range nodes {
+		uids[i] = n.UID
+	}
+	return uids
+}
+
+func edgeUIDs(edges []dgraphEdge) []string {
+	uids := make([]string, len(edges))
+	for i, e := range edges {
+		uids[i] = e.UID
+	}
+	return uids
+}
+
+// parseUID returns the numeric value of a UID such as "0x2a", or 0.
+func parseUID(uid string) uint64 {
+	n, _ := strconv.ParseUint(strings.TrimPrefix(uid, "0x"), 16, 64)
+	return n
+}
+
+// dgraphError is an error returned by the Dgraph HTTP API.
+type dgraphError struct {
+	Path    string
+	Message string
+}
+
+func (e *dgraphError) Error() string {
+	return fmt.Sprintf("dgraph %s: %s", e.Path, e.Message)
+}
+
+// isDgraphAborted reports whether err is a transaction aborted by a conflict, which may succeed when retried.
+func isDgraphAborted(err error) bool {
+	var dgErr *dgraphError
+	return errors.As(err, &dgErr) && strings.Contains(dgErr.Message, "Transaction has been aborted")
+}
+
+// isDgraphTokenExpired reports whether err is an ACL token that needs a new login.
+func isDgraphTokenExpired(err error) bool {
+	var dgErr *dgraphError
+	return errors.As(err, &dgErr) && strings.Contains(dgErr.Message, "Token is expired")
+}
+
+type dgraphResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+	Extensions struct {
+		Txn dgraphTxnContext `json:"txn"`
+	} `json:"extensions"`
+}
+
+type dgraphTxnContext struct {
+	StartTs uint64   `json:"start_ts"`
+	Keys    []string `json:"keys"`
+	Preds   []string `json:"preds"`
+}
+
+// dgraphMutation is one mutation of a /mutate request, applied when Cond holds.
+type dgraphMutation struct {
+	Set    interface{} `json:"set,omitempty"`
+	Delete interface{} `json:"delete,omitempty"`
+	Cond   string      `json:"cond,omitempty"`
+}
+
+// dgraphTxn is a Dgraph transaction driven over HTTP. It starts with the first request,
+// whose timestamp the following ones reuse, and collects the conflict keys and predicates
+// of its mutations for the commit.
+type dgraphTxn struct {
+	s       *DgraphGraphStore
+	startTs uint64
+	keys    []string
+	preds   []string
+}
+
+func (s *DgraphGraphStore) newTxn() *dgraphTxn {
+	return &dgraphTxn{s: s}
+}
+
+// query runs a DQL query and decodes its data into out.
+func (t *dgraphTxn) query(ctx context.Context, query string, out interface{}) error {
+	body, err := json.Marshal(map[string]string{"query": query})
+	if err != nil {
+		return err
+	}
+	res, err := t.s.post(ctx, t.path("/query"), "application/json", body)
+	if err != nil {
+		return err
+	}
+	t.track(res.Extensions.Txn)
+	if err := json.Unmarshal(res.Data, out); err != nil {
+		return fmt.Errorf("failed to decode dgraph response: %w", err)
+	}
+	return nil
+}
+
+// mutate runs mutations, as an upsert block when query is set, and returns the UIDs assigned to blank nodes.
+func (t *dgraphTxn) mutate(ctx context.Context, query string, mutations ...dgraphMutation) (map[string]string, error) {
+	body, err := json.Marshal(struct {
+		Query     string           `json:"query,omitempty"`
+		Mutations []dgraphMutation `json:"mutations"`
+	}{query, mutations})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode mutation: %w", err)
+	}
+	res, err := t.s.post(ctx, t.path("/mutate"), "application/json", body)
+	if err != nil {
+		return nil, err
+	}
+	t.track(res.Extensions.Txn)
+	var data struct {
+		UIDs map[string]string `json:"uids"`
+	}
+	if err := json.Unmarshal(res.Data, &data); err != nil {
+		return nil, fmt.Errorf("failed to decode dgraph response: %w", err)
+	}
+	return data.UIDs, nil
+}
+
+func (t *dgraphTxn) commit(ctx context.Context) error {
+	if t.startTs == 0 || len(t.keys)+len(t.preds) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(map[string][]string{"keys": t.keys, "preds": t.preds})
+	if err != nil {
+		return err
+	}
+	_, err = t.s.post(ctx, t.path("/commit"), "application/json", body)
+	return err
+}
+
+func (t *dgraphTxn) discard(ctx context.Context) {
+	if t.startTs == 0 {
+		return
+	}
+	if _, err := t.s.post(ctx, t.path("/commit")+"&abort=true", "application/json", []byte("{}")); err != nil {
+		fmt.Printf("GraphStore(dgraph): Could not abort transaction %d: %v\n", t.startTs, err)
+	}
+}
+
+func (t *dgraphTxn) path(endpoint string) string {
+	if t.startTs == 0 {
+		return endpoint
+	}
+	return endpoint + "?startTs=" + strconv.FormatUint(t.startTs, 10)
+}
+
+func (t *dgraphTxn) track(txn dgraphTxnContext) {
+	if t.startTs == 0 {
+		t.startTs = txn.StartTs
+	}
+	t.keys = append(t.keys, txn.Keys...)
+	t.preds = append(t.preds, txn.Preds...)
+}
+
+// inTx runs fn inside a transaction, committing on success. Transactions aborted by a
+// conflicting one are retried. Callers must hold s.mu.
+func (s *DgraphGraphStore) inTx(ctx context.Context, fn func(tx *dgraphTxn) error) error {
+	var err error
+	for attempt := 1; attempt <= maxTxAttempts; attempt++ {
+		tx := s.newTxn()
+		if err = fn(tx); err == nil {
+			err = tx.commit(ctx)
+		} else {
+			tx.discard(ctx)
+		}
+		if err == nil || !isDgraphAborted(err) {
+			return err
+		}
+		fmt.Printf("GraphStore(dgraph): Transaction aborted on attempt %d, retrying: %v\n", attempt, err)
+	}
+	return err
+}
+
+// login exchanges the configured credentials for an ACL access token.
+func (s *DgraphGraphStore) login(ctx context.Context) error {
+	body, err := json.Marshal(map[string]interface{}{"userid": s.cfg.Username, "password": s.cfg.Password, "namespace": s.cfg.Namespace})
+	if err != nil {
+		return err
+	}
+	s.accessJWT = ""
+	res, err := s.send(ctx, "/login", "application/json", body)
+	if err != nil {
+		return fmt.Errorf("failed to log in to dgraph: %w", err)
+	}
+	var data struct {
+		AccessJWT string `json:"accessJWT"`
+	}
+	if err := json.Unmarshal(res.Data, &data); err != nil || data.AccessJWT == "" {
+		return fmt.Errorf("failed to log in to dgraph: no access token returned")
+	}
+	s.accessJWT = data.AccessJWT
+	return nil
+}
+
+// post sends a request, logging in again once if the ACL token has expired.
+func (s *DgraphGraphStore) post(ctx context.Context, path string, contentType string, body []byte) (*dgraphResponse, error) {
+	res, err := s.send(ctx, path, contentType, body)
+	if err != nil && s.cfg.Username != "" && isDgraphTokenExpired(err) {
+		if err := s.login(ctx); err != nil {
+			return nil, err
+		}
+		res, err = s.send(ctx, path, contentType, body)
+	}
+	return res, err
+}
+
+func (s *DgraphGraphStore) send(ctx context.Context, path string, contentType string, body []byte) (*dgraphResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dgraph request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	if s.accessJWT != "" {
+		req.Header.Set("X-Dgraph-AccessToken", s.accessJWT)
+	}
+	if s.cfg.AuthToken != "" {
+		req.Header.Set("X-Dgraph-AuthToken", s.cfg.AuthToken)
+	}
+	if s.cfg.APIKey != "" {
+		req.Header.Set("Dg-Auth", s.cfg.APIKey)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("dgraph request to %s failed: %w", path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dgraph response: %w", err)
+	}
+
+	var res dgraphResponse
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, &dgraphError{Path: path, Message: fmt.Sprintf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))}
+	}
+	if len(res.Errors) > 0 {
+		messages := make([]string, len(res.Errors))
+		for i, e := range res.Errors {
+			messages[i] = e.Message
+		}
+		return nil, &dgraphError{Path: path, Message: strings.Join(messages, "; ")}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &dgraphError{Path: path, Message: fmt.Sprintf("status %d", resp.StatusCode)}
+	}
+	return &res, nil
+}
@@ -0,0 +1,1113 @@
+package graphs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pnocera/gomem/internal/vecmath"
+
+	_ "github.com/mattn/go-sqlite3" // SQLite driver
+)
+
+// EmbeddedGraphStore implements the GraphStore interface in process. Each user's graph is
+// kept as adjacency lists in memory and written through to a SQLite file, from which it is
+// reloaded on start.
+type EmbeddedGraphStore struct {
+	mu         sync.RWMutex
+	db         *sql.DB
+	partitions map[string]*graphPartition // Keyed by user ID
+}
+
+// Compile-time check to ensure *EmbeddedGraphStore satisfies the GraphStore interface.
+var _ GraphStore = (*EmbeddedGraphStore)(nil)
+
+type embeddedNode struct {
+	id        int64
+	name      string
+	nodeType  string
+	agentID   string
+	runID     string
+	attrs     Attributes
+	embedding []float32 // Of the name, set by SetNodeEmbedding
+	aliases   []string  // Names merged into this node
+}
+
+type embeddedEdge struct {
+	id           int64
+	source       int64
+	target       int64
+	relationship string
+	attrs        Attributes
+	validity     Validity
+}
+
+// graphPartition holds the nodes and edges of one user.
+type graphPartition struct {
+	nodes   map[int64]*embeddedNode
+	byName  map[string][]int64 // Node IDs per name, across agents and runs
+	byAlias map[string][]int64 // Node IDs per alias, across agents and runs
+	edges   map[int64]*embeddedEdge
+	out     map[int64]map[int64]struct{} // Outgoing edge IDs per node
+	in      map[int64]map[int64]struct{} // Incoming edge IDs per node
+}
+
+func newGraphPartition() *graphPartition {
+	return &graphPartition{
+		nodes:   make(map[int64]*embeddedNode),
+		byName:  make(map[string][]int64),
+		byAlias: make(map[string][]int64),
+		edges:   make(map[int64]*embeddedEdge),
+		out:     make(map[int64]map[int64]struct{}),
+		in:      make(map[int64]map[int64]struct{}),
+	}
+}
+
+// NewEmbeddedGraphStore opens (or creates) the SQLite file at cfg.Path and loads its graph.
+// A path of ":memory:" keeps the graph for the lifetime of the store only.
+func NewEmbeddedGraphStore(cfg *EmbeddedConfig) (*EmbeddedGraphStore, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("embedded graph config is nil")
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid embedded graph config: %w", err)
+	}
+	db, err := sql.Open("sqlite3", cfg.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database: %w", err)
+	}
+	// A single connection keeps ":memory:" databases alive and serializes writers.
+	db.SetMaxOpenConns(1)
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping sqlite database: %w", err)
+	}
+
+	s := &EmbeddedGraphStore{db: db, partitions: make(map[string]*graphPartition)}
+	if err := s.createTables(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create graph tables: %w", err)
+	}
+	if err := s.load(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to load graph: %w", err)
+	}
+	return s, nil
+}
+
+func (s *EmbeddedGraphStore) createTables() error {
+	_, err := s.db.Exec(`
+	CREATE TABLE IF NOT EXISTS graph_nodes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id TEXT NOT NULL,
+		agent_id TEXT NOT NULL DEFAULT '',
+		run_id TEXT NOT NULL DEFAULT '',
+		name TEXT NOT NULL,
+		type TEXT NOT NULL DEFAULT '',
+		created_at INTEGER NOT NULL,
+		embedding BLOB,
+		aliases TEXT NOT NULL DEFAULT '[]',
+		UNIQUE(user_id, agent_id, run_id, name)
+	);
+	CREATE TABLE IF NOT EXISTS graph_edges (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id TEXT NOT NULL,
+		source_id INTEGER NOT NULL,
+		target_id INTEGER NOT NULL,
+		relationship TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		valid_from INTEGER NOT NULL DEFAULT 0,
+		valid_to INTEGER,
+		recorded_at INTEGER NOT NULL DEFAULT 0
+	);`)
+	if err != nil {
+		return err
+	}
+	// Files created before entity resolution lack the embedding and aliases columns.
+	if err := s.addColumnIfMissing("graph_nodes", "embedding", "BLOB"); err != nil {
+		return err
+	}
+	if err := s.addColumnIfMissing("graph_nodes", "aliases", "TEXT NOT NULL DEFAULT '[]'"); err != nil {
+		return err
+	}
+	// Files created before provenance tracking lack the attribute columns.
+	for _, table := range []string{"graph_nodes", "graph_edges"} {
+		for _, col := range attributeColumns {
+			if err := s.addColumnIfMissing(table, col.name, col.decl); err != nil {
+				return err
+			}
+		}
+	}
+	// Files created before temporal relations lack the validity columns, and allow a single
+	// edge per triple rather than one current edge plus its closed intervals.
+	for _, col := range validityColumns {
+		if err := s.addColumnIfMissing("graph_edges", col.name, col.decl); err != nil {
+			return err
+		}
+	}
+	if err := s.dropEdgeUniqueConstraint(); err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`
+	CREATE INDEX IF NOT EXISTS idx_graph_edges_user_id ON graph_edges(user_id);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_graph_edges_current ON graph_edges(source_id, target_id, relationship) WHERE valid_to IS NULL;`)
+	return err
+}
+
+var validityColumns = []struct{ name, decl string }{
+	{"valid_from", "INTEGER NOT NULL DEFAULT 0"},
+	{"valid_to", "INTEGER"},
+	{"recorded_at", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+// dropEdgeUniqueConstraint rebuilds a graph_edges table created with UNIQUE(source_id,
+// target_id, relationship), which SQLite cannot drop in place.
+func (s *EmbeddedGraphStore) dropEdgeUniqueConstraint() error {
+	var ddl string
+	if err := s.db.QueryRow(`SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'graph_edges'`).Scan(&ddl); err != nil {
+		return err
+	}
+	if !strings.Contains(ddl, "UNIQUE(source_id, target_id, relationship)") {
+		return nil
+	}
+	columns := []string{"id", "user_id", "source_id", "target_id", "relationship", "created_at"}
+	defs := []string{
+		"id INTEGER PRIMARY KEY AUTOINCREMENT",
+		"user_id TEXT NOT NULL",
+		"source_id INTEGER NOT NULL",
+		"target_id INTEGER NOT NULL",
+		"relationship TEXT NOT NULL",
+		"created_at INTEGER NOT NULL",
+	}
+	for _, col := range append(append([]struct{ name, decl string }(nil), validityColumns...), attributeColumns...) {
+		columns = append(columns, col.name)
+		defs = append(defs, col.name+" "+col.decl)
+	}
+	list := strings.Join(columns, ", ")
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmts := []string{
+		fmt.Sprintf("CREATE TABLE graph_edges_rebuilt (%s)", strings.Join(defs, ", ")),
+		fmt.Sprintf("INSERT INTO graph_edges_rebuilt (%s) SELECT %s FROM graph_edges", list, list),
+		"DROP TABLE graph_edges",
+		"ALTER TABLE graph_edges_rebuilt RENAME TO graph_edges",
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to rebuild graph_edges: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// attributeColumns store Attributes other than created_at, in both tables.
+var attributeColumns = []struct{ name, decl string }{
+	{"properties", "TEXT NOT NULL DEFAULT '{}'"},
+	{"source_memory_ids", "TEXT NOT NULL DEFAULT '[]'"},
+	{"extraction_model", "TEXT NOT NULL DEFAULT ''"},
+	{"confidence", "REAL NOT NULL DEFAULT 0"},
+	{"updated_at", "INTEGER NOT NULL DEFAULT 0"},
+	{"mention_count", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+// attributeRow scans the created_at and attribute columns of a row.
+type attributeRow struct {
+	createdAt       int64
+	properties      string
+	sourceMemoryIDs string
+	extractionModel string
+	confidence      float64
+	updatedAt       int64
+	mentionCount    int
+}
+
+// attributeSelect lists the columns read into an attributeRow.
+const attributeSelect = "created_at, properties, source_memory_ids, extraction_model, confidence, updated_at, mention_count"
+
+func (r *attributeRow) dest() []interface{} {
+	return []interface{}{&r.createdAt, &r.properties, &r.sourceMemoryIDs, &r.extractionModel, &r.confidence, &r.updatedAt, &r.mentionCount}
+}
+
+func (r *attributeRow) attributes() (Attributes, error) {
+	a := Attributes{
+		ExtractionModel: r.extractionModel,
+		Confidence:      float32(r.confidence),
+		CreatedAt:       time.UnixMilli(r.createdAt).UTC(),
+		MentionCount:    r.mentionCount,
+	}
+	if r.updatedAt > 0 {
+		a.UpdatedAt = time.UnixMilli(r.updatedAt).UTC()
+	}
+	if err := json.Unmarshal([]byte(r.properties), &a.Properties); err != nil {
+		return a, fmt.Errorf("invalid properties: %w", err)
+	}
+	if err := json.Unmarshal([]byte(r.sourceMemoryIDs), &a.SourceMemoryIDs); err != nil {
+		return a, fmt.Errorf("invalid source memory IDs: %w", err)
+	}
+	return a, nil
+}
+
+// updateAttributes writes the attribute columns of a row of table.
+func updateAttributes(ctx context.Context, tx *sql.Tx, table string, id int64, a Attributes) error {
+	properties, err := json.Marshal(a.Properties)
+	if err != nil {
+		return fmt.Errorf("invalid properties: %w", err)
+	}
+	if a.Properties == nil {
+		properties = []byte("{}")
+	}
+	ids, err := json.Marshal(a.SourceMemoryIDs)
+	if err != nil {
+		return err
+	}
+	if a.SourceMemoryIDs == nil {
+		ids = []byte("[]")
+	}
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET properties = ?, source_memory_ids = ?, extraction_model = ?, confidence = ?, updated_at = ?, mention_count = ? WHERE id = ?`, table),
+		string(properties), string(ids), a.ExtractionModel, a.Confidence, a.UpdatedAt.UnixMilli(), a.MentionCount, id)
+	return err
+}
+
+func (s *EmbeddedGraphStore) addColumnIfMissing(table string, column string, decl string) error {
+	rows, err := s.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	_, err = s.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, decl))
+	return err
+}
+
+func (s *EmbeddedGraphStore) load() error {
+	rows, err := s.db.Query(`SELECT id, user_id, agent_id, run_id, name, type, embedding, aliases, ` + attributeSelect + ` FROM graph_nodes`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			userID    string
+			embedding []byte
+			aliases   string
+			attrs     attributeRow
+		)
+		n := &embeddedNode{}
+		dest := append([]interface{}{&n.id, &userID, &n.agentID, &n.runID, &n.name, &n.nodeType, &embedding, &aliases}, attrs.dest()...)
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		if n.attrs, err = attrs.attributes(); err != nil {
+			return fmt.Errorf("node %s: %w", n.name, err)
+		}
+		n.embedding = decodeEmbedding(embedding)
+		if err := json.Unmarshal([]byte(aliases), &n.aliases); err != nil {
+			return fmt.Errorf("invalid aliases of node %s: %w", n.name, err)
+		}
+		s.partition(userID).addNode(n)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	edgeRows, err := s.db.Query(`SELECT id, user_id, source_id, target_id, relationship, valid_from, valid_to, recorded_at, ` + attributeSelect + ` FROM graph_edges`)
+	if err != nil {
+		return err
+	}
+	defer edgeRows.Close()
+	for edgeRows.Next() {
+		var (
+			userID     string
+			validFrom  int64
+			validTo    sql.NullInt64
+			recordedAt int64
+			attrs      attributeRow
+		)
+		e := &embeddedEdge{}
+		dest := append([]interface{}{&e.id, &userID, &e.source, &e.target, &e.relationship, &validFrom, &validTo, &recordedAt}, attrs.dest()...)
+		if err := edgeRows.Scan(dest...); err != nil {
+			return err
+		}
+		if e.attrs, err = attrs.attributes(); err != nil {
+			return fmt.Errorf("relation %d: %w", e.id, err)
+		}
+		// Edges recorded before temporal relations have no valid_from: they hold from any time.
+		if validFrom != 0 {
+			e.validity.ValidFrom = time.UnixMilli(validFrom).UTC()
+		}
+		if validTo.Valid {
+			t := time.UnixMilli(validTo.Int64).UTC()
+			e.validity.ValidTo = &t
+		}
+		e.validity.RecordedAt = e.attrs.CreatedAt
+		if recordedAt != 0 {
+			e.validity.RecordedAt = time.UnixMilli(recordedAt).UTC()
+		}
+		s.partition(userID).addEdge(e)
+	}
+	return edgeRows.Err()
+}
+
+// partition returns the user's partition, creating it if needed. Callers must hold s.mu for writing.
+func (s *EmbeddedGraphStore) partition(userID string) *graphPartition {
+	p, ok := s.partitions[userID]
+	if !ok {
+		p = newGraphPartition()
+		s.partitions[userID] = p
+	}
+	return p
+}
+
+func (s *EmbeddedGraphStore) AddRelations(ctx context.Context, filter Filter, relations []Relation) error {
+	if err := filter.validate(); err != nil {
+		return err
+	}
+	normalized := make([]Relation, 0, len(relations))
+	for _, r := range relations {
+		rel := normalizeRelation(r)
+		if err := checkRelation(rel); err != nil {
+			return err
+		}
+		normalized = append(normalized, rel)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.write(ctx, filter.UserID, func(tx *sql.Tx, staged *graphPartition) error {
+		for _, rel := range normalized {
+			if err := s.mergeRelation(ctx, tx, staged, filter, rel); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *EmbeddedGraphStore) UpdateRelation(ctx context.Context, filter Filter, relation Relation) error {
+	if err := filter.validate(); err != nil {
+		return err
+	}
+	rel := normalizeRelation(relation)
+	if err := checkRelation(rel); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	return s.write(ctx, filter.UserID, func(tx *sql.Tx, staged *graphPartition) error {
+		for _, e := range staged.matchingEdges(filter, rel.Source, rel.Destination, "") {
+			if e.validity.ValidTo != nil || e.relationship == rel.Relationship {
+				continue
+			}
+			if err := closeEdge(ctx, tx, staged, e, now); err != nil {
+				return err
+			}
+		}
+		return s.mergeRelation(ctx, tx, staged, filter, rel)
+	})
+}
+
+func (s *EmbeddedGraphStore) CloseRelations(ctx context.Context, filter Filter, relations []Relation) error {
+	if err := filter.validate(); err != nil {
+		return err
+	}
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.write(ctx, filter.UserID, func(tx *sql.Tx, staged *graphPartition) error {
+		for _, relation := range relations {
+			rel := normalizeRelation(relation)
+			if err := checkRelation(rel); err != nil {
+				return err
+			}
+			for _, e := range staged.matchingEdges(filter, rel.Source, rel.Destination, rel.Relationship) {
+				if e.validity.ValidTo != nil {
+					continue
+				}
+				if err := closeEdge(ctx, tx, staged, e, rel.closedAt(now)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (s *EmbeddedGraphStore) DeleteRelations(ctx context.Context, filter Filter, relations []Relation) error {
+	if err := filter.validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.write(ctx, filter.UserID, func(tx *sql.Tx, staged *graphPartition) error {
+		for _, relation := range relations {
+			rel := normalizeRelation(relation)
+			if err := checkRelation(rel); err != nil {
+				return err
+			}
+			for _, e := range staged.matchingEdges(filter, rel.Source, rel.Destination, rel.Relationship) {
+				if err := deleteEdge(ctx, tx, staged, e); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (s *EmbeddedGraphStore) SearchByEntity(ctx context.Context, filter Filter, entities []string, opts QueryOptions) ([]Relation, error) {
+	return s.Traverse(ctx, filter, entities, 1, opts)
+}
+
+// Traverse walks up to hops edges away from the named entities, in either direction, and
+// returns the edges visited in breadth-first order. Entities are matched by name or alias.
+func (s *EmbeddedGraphStore) Traverse(ctx context.Context, filter Filter, entities []string, hops int, opts QueryOptions) ([]Relation, error) {
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+	if hops <= 0 {
+		hops = 1
+	}
+	if hops > maxTraverseHops {
+		return nil, fmt.Errorf("traversal depth %d exceeds the maximum of %d", hops, maxTraverseHops)
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p, ok := s.partitions[filter.UserID]
+	if !ok {
+		return nil, nil
+	}
+
+	limit := opts.limit()
+	asOf := opts.asOf()
+	visitedNodes := make(map[int64]bool)
+	var frontier []int64
+	for _, e := range entities {
+		name := NormalizeEntity(e)
+		for _, id := range append(append([]int64(nil), p.byName[name]...), p.byAlias[name]...) {
+			if !visitedNodes[id] && p.nodes[id].inScope(filter) {
+				visitedNodes[id] = true
+				frontier = append(frontier, id)
+			}
+		}
+	}
+
+	var relations []Relation
+	seenEdges := make(map[int64]bool)
+	for depth := 0; depth < hops && len(frontier) > 0; depth++ {
+		var next []int64
+		for _, nodeID := range frontier {
+			for _, edgeID := range p.incidentEdges(nodeID) {
+				if seenEdges[edgeID] {
+					continue
+				}
+				e := p.edges[edgeID]
+				other := e.target
+				if other == nodeID {
+					other = e.source
+				}
+				if !p.nodes[other].inScope(filter) || !opts.includes(e.validity, asOf) {
+					continue
+				}
+				seenEdges[edgeID] = true
+				relations = append(relations, p.relation(e))
+				if len(relations) >= limit {
+					return relations, nil
+				}
+				if !visitedNodes[other] {
+					visitedNodes[other] = true
+					next = append(next, other)
+				}
+			}
+		}
+		frontier = next
+	}
+	return relations, nil
+}
+
+func (s *EmbeddedGraphStore) GetAll(ctx context.Context, filter Filter, opts QueryOptions) ([]Relation, error) {
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p, ok := s.partitions[filter.UserID]
+	if !ok {
+		return nil, nil
+	}
+	asOf := opts.asOf()
+	ids := make([]int64, 0, len(p.edges))
+	for id, e := range p.edges {
+		if p.nodes[e.source].inScope(filter) && p.nodes[e.target].inScope(filter) && opts.includes(e.validity, asOf) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	if limit := opts.limit(); len(ids) > limit {
+		ids = ids[:limit]
+	}
+	relations := make([]Relation, len(ids))
+	for i, id := range ids {
+		relations[i] = p.relation(p.edges[id])
+	}
+	return relations, nil
+}
+
+func (s *EmbeddedGraphStore) Reset(ctx context.Context, filter Filter) error {
+	if err := filter.validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.write(ctx, filter.UserID, func(tx *sql.Tx, staged *graphPartition) error {
+		for _, n := range staged.nodes {
+			if !n.inScope(filter) {
+				continue
+			}
+			if err := deleteNode(ctx, tx, staged, n); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *EmbeddedGraphStore) SetNodeEmbedding(ctx context.Context, filter Filter, name string, nodeType string, embedding []float32) error {
+	if err := filter.validate(); err != nil {
+		return err
+	}
+	name, nodeType = NormalizeEntity(name), normalizeLabel(nodeType)
+	if name == "" {
+		return fmt.Errorf("entity name is empty")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.write(ctx, filter.UserID, func(tx *sql.Tx, staged *graphPartition) error {
+		n, err := mergeNode(ctx, tx, staged, filter, name, nodeType, time.Now())
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE graph_nodes SET embedding = ? WHERE id = ?`, encodeEmbedding(embedding), n.id); err != nil {
+			return fmt.Errorf("failed to set embedding of %s: %w", name, err)
+		}
+		updated := *n
+		updated.embedding = append([]float32(nil), embedding...)
+		staged.nodes[n.id] = &updated
+		return nil
+	})
+}
+
+func (s *EmbeddedGraphStore) SearchSimilarNodes(ctx context.Context, filter Filter, embedding []float32, threshold float32, limit int) ([]NodeMatch, error) {
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p, ok := s.partitions[filter.UserID]
+	if !ok {
+		return nil, nil
+	}
+	best := make(map[string]NodeMatch)
+	for _, n := range p.nodes {
+		if n.embedding == nil || !n.inScope(filter) {
+			continue
+		}
+		score := vecmath.Cosine(embedding, n.embedding)
+		if score < threshold {
+			continue
+		}
+		if prev, ok := best[n.name]; ok && prev.Score >= score {
+			continue
+		}
+		best[n.name] = NodeMatch{Name: n.name, Type: n.nodeType, Aliases: append([]string(nil), n.aliases...), Score: score}
+	}
+	matches := make([]NodeMatch, 0, len(best))
+	for _, m := range best {
+		matches = append(matches, m)
+	}
+	return sortMatches(matches, limit), nil
+}
+
+func (s *EmbeddedGraphStore) MergeNodes(ctx context.Context, filter Filter, canonical string, alias string) (*MergeResult, error) {
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+	canonical, alias = NormalizeEntity(canonical), NormalizeEntity(alias)
+	if canonical == "" || alias == "" || canonical == alias {
+		return nil, fmt.Errorf("cannot merge %q into %q", alias, canonical)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := &MergeResult{}
+	err := s.write(ctx, filter.UserID, func(tx *sql.Tx, staged *graphPartition) error {
+		canonicalNodes := staged.nodesNamed(filter, canonical)
+		if len(canonicalNodes) == 0 {
+			return fmt.Errorf("canonical entity %q not found", canonical)
+		}
+		aliasNodes := staged.nodesNamed(filter, alias)
+
+		var aliases []string
+		existing := make(map[string]bool)
+		for _, n := range canonicalNodes {
+			aliases = mergeAliases(aliases, canonical, n.aliases...)
+			for _, edgeID := range staged.incidentEdges(n.id) {
+				if e := staged.edges[edgeID]; e.validity.ValidTo == nil {
+					existing[relationKey(staged.relation(e))] = true
+				}
+			}
+		}
+		aliases = mergeAliases(aliases, canonical, alias)
+		for _, n := range aliasNodes {
+			aliases = mergeAliases(aliases, canonical, n.aliases...)
+			for _, edgeID := range staged.incidentEdges(n.id) {
+				result.Moved = append(result.Moved, staged.relation(staged.edges[edgeID]))
+			}
+		}
+		result.Created = repointRelations(result.Moved, alias, canonical, canonicalNodes[0].nodeType, existing)
+
+		for _, n := range aliasNodes {
+			if err := deleteNode(ctx, tx, staged, n); err != nil {
+				return err
+			}
+		}
+		for _, rel := range result.Created {
+			if err := s.mergeRelation(ctx, tx, staged, filter, rel); err != nil {
+				return err
+			}
+		}
+		return setAliases(ctx, tx, staged, canonicalNodes, aliases)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *EmbeddedGraphStore) RemoveAlias(ctx context.Context, filter Filter, canonical string, alias string) error {
+	if err := filter.validate(); err != nil {
+		return err
+	}
+	canonical, alias = NormalizeEntity(canonical), NormalizeEntity(alias)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.write(ctx, filter.UserID, func(tx *sql.Tx, staged *graphPartition) error {
+		nodes := staged.nodesNamed(filter, canonical)
+		var aliases []string
+		for _, n := range nodes {
+			aliases = mergeAliases(aliases, canonical, n.aliases...)
+		}
+		return setAliases(ctx, tx, staged, nodes, removeString(aliases, alias))
+	})
+}
+
+func (s *EmbeddedGraphStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.db == nil {
+		return nil
+	}
+	err := s.db.Close()
+	s.db = nil
+	return err
+}
+
+// write runs fn in a SQL transaction against a copy of the user's partition, and replaces
+// the partition with the copy once the transaction commits. Callers must hold s.mu.
+func (s *EmbeddedGraphStore) write(ctx context.Context, userID string, fn func(tx *sql.Tx, staged *graphPartition) error) error {
+	if s.db == nil {
+		return fmt.Errorf("embedded graph store is closed")
+	}
+	staged := s.partition(userID).clone()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if err := fn(tx, staged); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	s.partitions[userID] = staged
+	return nil
+}
+
+// mergeRelation finds or creates both nodes in the filter's scope and the edge between them,
+// and records the mention in their attributes.
+func (s *EmbeddedGraphStore) mergeRelation(ctx context.Context, tx *sql.Tx, p *graphPartition, filter Filter, rel Relation) error {
+	now := time.Now()
+	source, err := mergeNode(ctx, tx, p, filter, rel.Source, rel.SourceType, now)
+	if err != nil {
+		return err
+	}
+	if err := touchNode(ctx, tx, p, source, rel.endpointAttributes(rel.SourceAttributes), now); err != nil {
+		return err
+	}
+	target, err := mergeNode(ctx, tx, p, filter, rel.Destination, rel.DestinationType, now)
+	if err != nil {
+		return err
+	}
+	if source.id != target.id {
+		if err := touchNode(ctx, tx, p, target, rel.endpointAttributes(rel.DestinationAttributes), now); err != nil {
+			return err
+		}
+	}
+
+	// The current edge, if any, takes the mention. A closed relation, e.g. restored history,
+	// takes the edge closed over the same interval so that importing it twice adds nothing,
+	// and is otherwise recorded as a new interval.
+	var edge *embeddedEdge
+	for edgeID := range p.out[source.id] {
+		e := p.edges[edgeID]
+		if e.target != target.id || e.relationship != rel.Relationship {
+			continue
+		}
+		if (rel.ValidTo == nil && e.validity.ValidTo == nil) || rel.Validity.sameInterval(e.validity) {
+			edge = e
+			break
+		}
+	}
+	if edge == nil {
+		validity := Validity{ValidFrom: rel.ValidFrom, ValidTo: rel.ValidTo, RecordedAt: now}
+		if validity.ValidFrom.IsZero() {
+			validity.ValidFrom = now
+		}
+		var validTo interface{}
+		if validity.ValidTo != nil {
+			validTo = validity.ValidTo.UnixMilli()
+		}
+		res, err := tx.ExecContext(ctx, `INSERT INTO graph_edges (user_id, source_id, target_id, relationship, created_at, valid_from, valid_to, recorded_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			filter.UserID, source.id, target.id, rel.Relationship, now.UnixMilli(), validity.ValidFrom.UnixMilli(), validTo, now.UnixMilli())
+		if err != nil {
+			return fmt.Errorf("failed to add relation %s -[%s]-> %s: %w", rel.Source, rel.Relationship, rel.Destination, err)
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		edge = &embeddedEdge{id: id, source: source.id, target: target.id, relationship: rel.Relationship, attrs: Attributes{CreatedAt: now}, validity: validity}
+	}
+	updated := *edge
+	updated.attrs = mergeAttributes(edge.attrs, rel.Attributes, now)
+	if err := updateAttributes(ctx, tx, "graph_edges", updated.id, updated.attrs); err != nil {
+		return fmt.Errorf("failed to update relation %s -[%s]-> %s: %w", rel.Source, rel.Relationship, rel.Destination, err)
+	}
+	p.removeEdge(updated.id)
+	p.addEdge(&updated)
+	return nil
+}
+
+// touchNode records one more mention of a node.
+func touchNode(ctx context.Context, tx *sql.Tx, p *graphPartition, n *embeddedNode, incoming Attributes, now time.Time) error {
+	updated := *p.nodes[n.id]
+	updated.attrs = mergeAttributes(updated.attrs, incoming, now)
+	if err := updateAttributes(ctx, tx, "graph_nodes", updated.id, updated.attrs); err != nil {
+		return fmt.Errorf("failed to update node %s: %w", n.name, err)
+	}
+	p.nodes[n.id] = &updated
+	return nil
+}
+
+// mergeNode returns the node keyed by name and the filter's agent and run, creating it if
+// needed. A non-empty nodeType replaces the stored type.
+func mergeNode(ctx context.Context, tx *sql.Tx, p *graphPartition, filter Filter, name string, nodeType string, now time.Time) (*embeddedNode, error) {
+	for _, id := range p.byName[name] {
+		n := p.nodes[id]
+		if n.agentID != filter.AgentID || n.runID != filter.RunID {
+			continue
+		}
+		if nodeType != "" && n.nodeType != nodeType {
+			if _, err := tx.ExecContext(ctx, `UPDATE graph_nodes SET type = ? WHERE id = ?`, nodeType, id); err != nil {
+				return nil, fmt.Errorf("failed to update type of node %s: %w", name, err)
+			}
+			updated := *n
+			updated.nodeType = nodeType
+			p.nodes[id] = &updated
+			return &updated, nil
+		}
+		return n, nil
+	}
+
+	res, err := tx.ExecContext(ctx, `INSERT INTO graph_nodes (user_id, agent_id, run_id, name, type, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		filter.UserID, filter.AgentID, filter.RunID, name, nodeType, now.UnixMilli())
+	if err != nil {
+		return nil, fmt.Errorf("failed to add node %s: %w", name, err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	n := &embeddedNode{id: id, name: name, nodeType: nodeType, agentID: filter.AgentID, runID: filter.RunID, attrs: Attributes{CreatedAt: now}}
+	p.addNode(n)
+	return n, nil
+}
+
+// closeEdge ends the validity of a current edge at t.
+func closeEdge(ctx context.Context, tx *sql.Tx, p *graphPartition, e *embeddedEdge, t time.Time) error {
+	if _, err := tx.ExecContext(ctx, `UPDATE graph_edges SET valid_to = ? WHERE id = ?`, t.UnixMilli(), e.id); err != nil {
+		return fmt.Errorf("failed to close relation %d: %w", e.id, err)
+	}
+	closed := *e
+	closed.validity.ValidTo = &t
+	p.edges[e.id] = &closed
+	return nil
+}
+
+func deleteEdge(ctx context.Context, tx *sql.Tx, p *graphPartition, e *embeddedEdge) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM graph_edges WHERE id = ?`, e.id); err != nil {
+		return fmt.Errorf("failed to delete relation %d: %w", e.id, err)
+	}
+	p.removeEdge(e.id)
+	return nil
+}
+
+// deleteNode deletes a node and its edges.
+func deleteNode(ctx context.Context, tx *sql.Tx, p *graphPartition, n *embeddedNode) error {
+	for _, edgeID := range p.incidentEdges(n.id) {
+		if err := deleteEdge(ctx, tx, p, p.edges[edgeID]); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM graph_nodes WHERE id = ?`, n.id); err != nil {
+		return fmt.Errorf("failed to delete node %s: %w", n.name, err)
+	}
+	p.removeNode(n.id)
+	return nil
+}
+
+// setAliases replaces the aliases of nodes.
+func setAliases(ctx context.Context, tx *sql.Tx, p *graphPartition, nodes []*embeddedNode, aliases []string) error {
+	if aliases == nil {
+		aliases = []string{}
+	}
+	data, err := json.Marshal(aliases)
+	if err != nil {
+		return err
+	}
+	for _, n := range nodes {
+		if _, err := tx.ExecContext(ctx, `UPDATE graph_nodes SET aliases = ? WHERE id = ?`, string(data), n.id); err != nil {
+			return fmt.Errorf("failed to set aliases of %s: %w", n.name, err)
+		}
+		updated := *p.nodes[n.id]
+		updated.aliases = aliases
+		for _, alias := range p.nodes[n.id].aliases {
+			unindex(p.byAlias, alias, n.id)
+		}
+		for _, alias := range aliases {
+			p.byAlias[alias] = append(p.byAlias[alias], n.id)
+		}
+		p.nodes[n.id] = &updated
+	}
+	return nil
+}
+
+// encodeEmbedding stores an embedding as little-endian float32s.
+func encodeEmbedding(embedding []float32) []byte {
+	if embedding == nil {
+		return nil
+	}
+	buf := make([]byte, 4*len(embedding))
+	for i, f := range embedding {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(f))
+	}
+	return buf
+}
+
+func decodeEmbedding(buf []byte) []float32 {
+	if len(buf) == 0 {
+		return nil
+	}
+	embedding := make([]float32, len(buf)/4)
+	for i := range embedding {
+		embedding[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+	}
+	return embedding
+}
+
+func (n *embeddedNode) inScope(filter Filter) bool {
+	return (filter.AgentID == "" || n.agentID == filter.AgentID) && (filter.RunID == "" || n.runID == filter.RunID)
+}
+
+func (p *graphPartition) addNode(n *embeddedNode) {
+	p.nodes[n.id] = n
+	p.byName[n.name] = append(p.byName[n.name], n.id)
+	for _, alias := range n.aliases {
+		p.byAlias[alias] = append(p.byAlias[alias], n.id)
+	}
+}
+
+func (p *graphPartition) removeNode(id int64) {
+	n, ok := p.nodes[id]
+	if !ok {
+		return
+	}
+	unindex(p.byName, n.name, id)
+	for _, alias := range n.aliases {
+		unindex(p.byAlias, alias, id)
+	}
+	delete(p.nodes, id)
+	delete(p.out, id)
+	delete(p.in, id)
+}
+
+// unindex removes id from the IDs indexed under key.
+func unindex(index map[string][]int64, key string, id int64) {
+	ids := index[key]
+	kept := make([]int64, 0, len(ids))
+	for _, other := range ids {
+		if other != id {
+			kept = append(kept, other)
+		}
+	}
+	if len(kept) == 0 {
+		delete(index, key)
+	} else {
+		index[key] = kept
+	}
+}
+
+func (p *graphPartition) addEdge(e *embeddedEdge) {
+	p.edges[e.id] = e
+	if p.out[e.source] == nil {
+		p.out[e.source] = make(map[int64]struct{})
+	}
+	p.out[e.source][e.id] = struct{}{}
+	if p.in[e.target] == nil {
+		p.in[e.target] = make(map[int64]struct{})
+	}
+	p.in[e.target][e.id] = struct{}{}
+}
+
+func (p *graphPartition) removeEdge(id int64) {
+	e, ok := p.edges[id]
+	if !ok {
+		return
+	}
+	delete(p.out[e.source], id)
+	delete(p.in[e.target], id)
+	delete(p.edges, id)
+}
+
+// incidentEdges returns the IDs of the edges leaving or entering a node, in ID order.
+func (p *graphPartition) incidentEdges(nodeID int64) []int64 {
+	ids := make([]int64, 0, len(p.out[nodeID])+len(p.in[nodeID]))
+	for id := range p.out[nodeID] {
+		ids = append(ids, id)
+	}
+	for id := range p.in[nodeID] {
+		if p.edges[id].source != nodeID { // Self-loops are already listed
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// nodesNamed returns the nodes with a name within the filter's scope, in ID order.
+func (p *graphPartition) nodesNamed(filter Filter, name string) []*embeddedNode {
+	var nodes []*embeddedNode
+	for _, id := range p.byName[name] {
+		if n := p.nodes[id]; n.inScope(filter) {
+			nodes = append(nodes, n)
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].id < nodes[j].id })
+	return nodes
+}
+
+// matchingEdges returns the edges from source to destination within the filter's scope,
+// restricted to one relationship unless it is empty.
+func (p *graphPartition) matchingEdges(filter Filter, source string, destination string, relationship string) []*embeddedEdge {
+	var matches []*embeddedEdge
+	for _, sourceID := range p.byName[source] {
+		if !p.nodes[sourceID].inScope(filter) {
+			continue
+		}
+		for edgeID := range p.out[sourceID] {
+			e := p.edges[edgeID]
+			target := p.nodes[e.target]
+			if target.name == destination && target.inScope(filter) && (relationship == "" || e.relationship == relationship) {
+				matches = append(matches, e)
+			}
+		}
+	}
+	return matches
+}
+
+func (p *graphPartition) relation(e *embeddedEdge) Relation {
+	source, target := p.nodes[e.source], p.nodes[e.target]
+	sourceAttrs, targetAttrs := source.attrs, target.attrs
+	return Relation{
+		Source:                source.name,
+		SourceType:            source.nodeType,
+		Relationship:          e.relationship,
+		Destination:           target.name,
+		DestinationType:       target.nodeType,
+		Attributes:            e.attrs,
+		Validity:              e.validity,
+		SourceAttributes:      &sourceAttrs,
+		DestinationAttributes: &targetAttrs,
+	}
+}
+
+// clone copies the partition's indexes so a write can be staged without touching the original.
+// Nodes and edges are shared; writers replace rather than mutate them.
+func (p *graphPartition) clone() *graphPartition {
+	c := newGraphPartition()
+	for id, n := range p.nodes {
+		c.nodes[id] = n
+	}
+	for name, ids := range p.byName {
+		c.byName[name] = append([]int64(nil), ids...)
+	}
+	for alias, ids := range p.byAlias {
+		c.byAlias[alias] = append([]int64(nil), ids...)
+	}
+	for id, e := range p.edges {
+		c.edges[id] = e
+	}
+	for id, edges := range p.out {
+		c.out[id] = make(map[int64]struct{}, len(edges))
+		for e := range edges {
+			c.out[id][e] = struct{}{}
+		}
+	}
+	for id, edges := range p.in {
+		c.in[id] = make(map[int64]struct{}, len(edges))
+		for e := range edges {
+			c.in[id][e] = struct{}{}
+		}
+	}
+	return c
+}
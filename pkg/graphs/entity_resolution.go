@@ -0,0 +1,224 @@
+package graphs
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// defaultResolutionThreshold is the cosine similarity above which two entity names are
+// considered the same entity when EntityResolutionConfig leaves Threshold unset.
+const defaultResolutionThreshold = 0.9
+
+// Embedder placeholder interface defines the text embedding used to compare entity names.
+type Embedder interface {
+	GetEmbedding(ctx context.Context, text string) ([]float32, error)
+}
+
+// MergeDecision records that an extracted entity was resolved to an existing canonical node.
+// It holds what is needed to audit the merge and to undo it with EntityResolver.Undo.
+type MergeDecision struct {
+	Filter    Filter     `json:"filter"`
+	Canonical string     `json:"canonical"`
+	Alias     string     `json:"alias"`
+	Score     float32    `json:"score"`
+	Moved     []Relation `json:"moved,omitempty"`   // The alias's relations before the merge
+	Created   []Relation `json:"created,omitempty"` // Relations the merge added to the canonical node
+}
+
+// EntityResolver maps extracted entities onto existing nodes whose name embeddings are
+// similar enough, so that "John", "john smith" and "John S." end up as one node with aliases.
+type EntityResolver struct {
+	embedder  Embedder
+	store     GraphStore
+	threshold float32
+}
+
+// NewEntityResolver creates a new EntityResolver. A threshold of 0 uses the default of 0.9.
+func NewEntityResolver(embedder Embedder, store GraphStore, threshold float32) *EntityResolver {
+	if threshold <= 0 {
+		threshold = defaultResolutionThreshold
+	}
+	return &EntityResolver{
+		embedder:  embedder,
+		store:     store,
+		threshold: threshold,
+	}
+}
+
+// Resolution is the outcome of EntityResolver.Resolve.
+type Resolution struct {
+	Entities  []Entity          `json:"entities"`         // The entities under their canonical names, without duplicates
+	Canonical map[string]string `json:"canonical"`        // Canonical name per normalized extracted name
+	Merges    []MergeDecision   `json:"merges,omitempty"` // Merges performed while resolving
+}
+
+// Resolve maps each entity onto the most similar existing node above the threshold, merging
+// the entity's name into that node's aliases. Entities without a similar node get their
+// embedding stored, so that later entities, including ones later in the same slice, can
+// resolve to them.
+func (r *EntityResolver) Resolve(ctx context.Context, filter Filter, entities []Entity) (*Resolution, error) {
+	if r.embedder == nil {
+		return nil, fmt.Errorf("embedder is nil")
+	}
+	if r.store == nil {
+		return nil, fmt.Errorf("graph store is nil")
+	}
+	res := &Resolution{Canonical: make(map[string]string, len(entities))}
+	add := func(name string, e Entity) {
+		canonical := NormalizeEntity(e.Name)
+		if _, ok := res.Canonical[canonical]; !ok {
+			res.Entities = append(res.Entities, e)
+		}
+		res.Canonical[canonical] = canonical
+		res.Canonical[name] = canonical
+	}
+	for _, e := range entities {
+		name := NormalizeEntity(e.Name)
+		if name == "" {
+			continue
+		}
+		if _, ok := res.Canonical[name]; ok {
+			continue
+		}
+		embedding, err := r.embedder.GetEmbedding(ctx, e.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to embed entity %q: %w", e.Name, err)
+		}
+		matches, err := r.store.SearchSimilarNodes(ctx, filter, embedding, r.threshold, 1)
+		if err != nil {
+			return nil, fmt.Errorf("failed to search nodes similar to %q: %w", e.Name, err)
+		}
+		if len(matches) == 0 {
+			if err := r.store.SetNodeEmbedding(ctx, filter, name, e.Type, embedding); err != nil {
+				return nil, fmt.Errorf("failed to store embedding of %q: %w", e.Name, err)
+			}
+			add(name, e)
+			continue
+		}
+
+		match := matches[0]
+		entityType := e.Type
+		if match.Type != "" {
+			entityType = match.Type
+		}
+		add(name, Entity{Name: match.Name, Type: entityType})
+		if match.Name == name || containsString(match.Aliases, name) {
+			continue
+		}
+		merged, err := r.store.MergeNodes(ctx, filter, match.Name, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to merge %q into %q: %w", name, match.Name, err)
+		}
+		res.Merges = append(res.Merges, MergeDecision{
+			Filter:    filter,
+			Canonical: match.Name,
+			Alias:     name,
+			Score:     match.Score,
+			Moved:     merged.Moved,
+			Created:   merged.Created,
+		})
+	}
+	return res, nil
+}
+
+// Undo reverts a merge: the relations it created on the canonical node are deleted, the
+// alias's own relations are restored and the alias is removed from the canonical node.
+func (r *EntityResolver) Undo(ctx context.Context, d MergeDecision) error {
+	if r.store == nil {
+		return fmt.Errorf("graph store is nil")
+	}
+	if len(d.Created) > 0 {
+		if err := r.store.DeleteRelations(ctx, d.Filter, d.Created); err != nil {
+			return fmt.Errorf("failed to delete merged relations: %w", err)
+		}
+	}
+	if len(d.Moved) > 0 {
+		if err := r.store.AddRelations(ctx, d.Filter, d.Moved); err != nil {
+			return fmt.Errorf("failed to restore relations of %q: %w", d.Alias, err)
+		}
+	}
+	if err := r.store.RemoveAlias(ctx, d.Filter, d.Canonical, d.Alias); err != nil {
+		return fmt.Errorf("failed to remove alias %q: %w", d.Alias, err)
+	}
+	return nil
+}
+
+// repointRelations rewrites the alias's relations onto the canonical node. Relations between
+// the two nodes are dropped, and current relations the canonical node already has are skipped;
+// closed ones are always kept as history. existing holds the canonical node's current relations.
+func repointRelations(moved []Relation, alias string, canonical string, canonicalType string, existing map[string]bool) []Relation {
+	var created []Relation
+	seen := make(map[string]bool)
+	for _, r := range moved {
+		rel := r
+		if rel.Source == alias {
+			rel.Source, rel.SourceType = canonical, canonicalType
+		}
+		if rel.Destination == alias {
+			rel.Destination, rel.DestinationType = canonical, canonicalType
+		}
+		if rel.Source == canonical && rel.Destination == canonical {
+			continue
+		}
+		if rel.ValidTo == nil {
+			key := relationKey(rel)
+			if existing[key] || seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		created = append(created, rel)
+	}
+	return created
+}
+
+// mergeAliases adds names to aliases, skipping duplicates, empty names and canonical itself.
+func mergeAliases(aliases []string, canonical string, names ...string) []string {
+	return removeString(appendUnique(aliases, names...), canonical)
+}
+
+// appendUnique returns a copy of list with the non-empty values it lacks appended.
+func appendUnique(list []string, values ...string) []string {
+	merged := append([]string(nil), list...)
+	for _, v := range values {
+		if v != "" && !containsString(merged, v) {
+			merged = append(merged, v)
+		}
+	}
+	return merged
+}
+
+// removeString returns list without s.
+func removeString(list []string, s string) []string {
+	kept := make([]string, 0, len(list))
+	for _, v := range list {
+		if v != s {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// sortMatches orders matches by descending score, then name, and truncates them to limit.
+func sortMatches(matches []NodeMatch, limit int) []NodeMatch {
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].Name < matches[j].Name
+	})
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches
+}
@@ -0,0 +1,198 @@
+package graphs
+
+import (
+	"context"
+	"fmt"
+)
+
+// ToolCallingLLM placeholder interface defines a chat completion that may answer with tool calls.
+type ToolCallingLLM interface {
+	ChatWithTools(ctx context.Context, systemPrompt string, userPrompt string, tools []Tool) ([]ToolCall, error)
+}
+
+// RejectedToolCall is a tool call that was skipped because its arguments were invalid.
+type RejectedToolCall struct {
+	Call  ToolCall `json:"call"`
+	Error string   `json:"error"`
+}
+
+// ExecutionResult summarizes the tool calls applied by a ToolExecutor.
+type ExecutionResult struct {
+	Added      []Relation          `json:"added,omitempty"`
+	Updated    []Relation          `json:"updated,omitempty"`
+	Closed     []Relation          `json:"closed,omitempty"`   // From delete calls, which end a relation's validity
+	Entities   []Entity            `json:"entities,omitempty"` // From extract_entities calls, which do not modify the graph
+	Rejected   []RejectedToolCall  `json:"rejected,omitempty"`
+	Violations []OntologyViolation `json:"violations,omitempty"` // Added or updated relations that did not fit the Ontology
+	Noop       int                 `json:"noop,omitempty"`
+	ToolCalls  int                 `json:"tool_calls"`
+}
+
+// ToolExecutor offers the graph tools to an LLM and applies the resulting calls to a GraphStore.
+type ToolExecutor struct {
+	llm      ToolCallingLLM
+	store    GraphStore
+	Ontology *Ontology // Optional; enforced on added and updated relations
+}
+
+// NewToolExecutor creates a new ToolExecutor.
+func NewToolExecutor(llm ToolCallingLLM, store GraphStore) *ToolExecutor {
+	return &ToolExecutor{
+		llm:   llm,
+		store: store,
+	}
+}
+
+// Run sends the prompts and tools to the LLM and executes the tool calls it returns.
+// Calls to tools that were not offered are rejected.
+func (e *ToolExecutor) Run(ctx context.Context, filter Filter, systemPrompt string, userPrompt string, tools []Tool) (*ExecutionResult, error) {
+	if e.llm == nil {
+		return nil, fmt.Errorf("LLM client is nil")
+	}
+	calls, err := e.llm.ChatWithTools(ctx, systemPrompt, userPrompt, tools)
+	if err != nil {
+		return nil, fmt.Errorf("LLM tool call failed: %w", err)
+	}
+	accepted, rejected := offeredCalls(calls, tools)
+	result, err := e.Execute(ctx, filter, accepted)
+	if result != nil {
+		result.ToolCalls = len(calls)
+		result.Rejected = append(result.Rejected, rejected...)
+	}
+	return result, err
+}
+
+// offeredCalls splits calls into those to one of tools and rejections for the others.
+func offeredCalls(calls []ToolCall, tools []Tool) ([]ToolCall, []RejectedToolCall) {
+	offered := make(map[string]bool, len(tools))
+	for _, t := range tools {
+		offered[t.Function.Name] = true
+	}
+	var accepted []ToolCall
+	var rejected []RejectedToolCall
+	for _, call := range calls {
+		if offered[call.Name] {
+			accepted = append(accepted, call)
+		} else {
+			rejected = append(rejected, RejectedToolCall{Call: call, Error: fmt.Sprintf("tool %q was not offered", call.Name)})
+		}
+	}
+	return accepted, rejected
+}
+
+// Execute validates and applies tool calls in order. Calls with invalid arguments are
+// skipped and reported in Rejected; a graph store error stops execution.
+func (e *ToolExecutor) Execute(ctx context.Context, filter Filter, calls []ToolCall) (*ExecutionResult, error) {
+	if e.store == nil {
+		return nil, fmt.Errorf("graph store is nil")
+	}
+	result := &ExecutionResult{ToolCalls: len(calls)}
+	for _, call := range calls {
+		args, err := ParseToolCall(call)
+		if err != nil {
+			result.Rejected = append(result.Rejected, RejectedToolCall{Call: call, Error: err.Error()})
+			continue
+		}
+		if err := e.apply(ctx, filter, call.Name, args, result); err != nil {
+			return result, fmt.Errorf("failed to execute %s: %w", call.Name, err)
+		}
+	}
+	return result, nil
+}
+
+func (e *ToolExecutor) apply(ctx context.Context, filter Filter, name string, args interface{}, result *ExecutionResult) error {
+	switch name {
+	case AddMemoryToolGraph.Function.Name:
+		a := args.(*GraphMemoryArgs)
+		return e.add(ctx, filter, []Relation{a.relation()}, result)
+	case UpdateMemoryToolGraph.Function.Name:
+		return e.update(ctx, filter, []Relation{args.(*GraphMemoryArgs).relation()}, result)
+	case DeleteMemoryToolGraph.Function.Name:
+		a := args.(*DeleteGraphMemoryArgs)
+		return e.close(ctx, filter, []Relation{{Source: a.Source, Relationship: a.Relationship, Destination: a.Destination}}, result)
+	case AddMemoryStructToolGraph.Function.Name:
+		return e.add(ctx, filter, relationsFromStructs(args.(*MemoryStructArgs).Memories), result)
+	case UpdateMemoryStructToolGraph.Function.Name:
+		return e.update(ctx, filter, relationsFromStructs(args.(*MemoryStructArgs).Memories), result)
+	case DeleteMemoryStructToolGraph.Function.Name:
+		return e.close(ctx, filter, relationsFromStructs(args.(*MemoryStructArgs).Memories), result)
+	case RelationsTool.Function.Name:
+		triplets := args.(*RelationsArgs).Relations
+		rels := make([]Relation, len(triplets))
+		for i, r := range triplets {
+			rels[i] = Relation{Source: r[0], Destination: r[1], Relationship: r[2]}
+		}
+		return e.add(ctx, filter, rels, result)
+	case RelationsStructTool.Function.Name:
+		return e.add(ctx, filter, relationsFromStructs(args.(*RelationsStructArgs).Relations), result)
+	case ExtractEntitiesTool.Function.Name:
+		for _, ent := range args.(*EntitiesArgs).Entities {
+			result.Entities = append(result.Entities, Entity{Name: ent[0], Type: ent[1]})
+		}
+	case ExtractEntitiesStructTool.Function.Name:
+		result.Entities = append(result.Entities, args.(*EntitiesStructArgs).Entities...)
+	case NoopTool.Function.Name, NoopStructTool.Function.Name:
+		result.Noop++
+	default:
+		return fmt.Errorf("unsupported tool %q", name)
+	}
+	return nil
+}
+
+func (e *ToolExecutor) add(ctx context.Context, filter Filter, rels []Relation, result *ExecutionResult) error {
+	rels = e.enforce(rels, result)
+	if len(rels) == 0 {
+		return nil
+	}
+	if err := e.store.AddRelations(ctx, filter, rels); err != nil {
+		return err
+	}
+	result.Added = append(result.Added, rels...)
+	return nil
+}
+
+func (e *ToolExecutor) update(ctx context.Context, filter Filter, rels []Relation, result *ExecutionResult) error {
+	for _, rel := range e.enforce(rels, result) {
+		if err := e.store.UpdateRelation(ctx, filter, rel); err != nil {
+			return err
+		}
+		result.Updated = append(result.Updated, rel)
+	}
+	return nil
+}
+
+// enforce returns the relations that fit the Ontology, in their ontology form.
+func (e *ToolExecutor) enforce(rels []Relation, result *ExecutionResult) []Relation {
+	accepted, violations := e.Ontology.EnforceRelations(rels)
+	result.Violations = append(result.Violations, violations...)
+	return accepted
+}
+
+func (e *ToolExecutor) close(ctx context.Context, filter Filter, rels []Relation, result *ExecutionResult) error {
+	if len(rels) == 0 {
+		return nil
+	}
+	if err := e.store.CloseRelations(ctx, filter, rels); err != nil {
+		return err
+	}
+	result.Closed = append(result.Closed, rels...)
+	return nil
+}
+
+func (a *GraphMemoryArgs) relation() Relation {
+	return Relation{
+		Source:          a.Source,
+		SourceType:      a.SourceType,
+		Relationship:    a.Relationship,
+		Destination:     a.Destination,
+		DestinationType: a.DestinationType,
+	}
+}
+
+func relationsFromStructs(items []RelationStruct) []Relation {
+	rels := make([]Relation, len(items))
+	for i, r := range items {
+		rels[i] = Relation{Source: r.Source, Destination: r.Destination, Relationship: r.Relationship}
+	}
+	return rels
+}
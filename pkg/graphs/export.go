@@ -0,0 +1,234 @@
+package graphs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ExportFormat is a serialization of exported graphs.
+type ExportFormat string
+
+const (
+	FormatGraphML ExportFormat = "graphml" // GraphML XML, one <graph> per scope
+	FormatJSONLD  ExportFormat = "jsonld"  // JSON-LD, one named graph per scope
+	FormatCypher  ExportFormat = "cypher"  // Cypher script replayable against Neo4j or Memgraph
+)
+
+// maxExportRelations bounds the relations read from one scope by ExportGraph.
+const maxExportRelations = 1000000
+
+// ParseExportFormat returns the format named s.
+func ParseExportFormat(s string) (ExportFormat, error) {
+	switch f := ExportFormat(s); f {
+	case FormatGraphML, FormatJSONLD, FormatCypher:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unsupported graph export format %q, expected graphml, jsonld or cypher", s)
+	}
+}
+
+// GraphSnapshot is the graph of one scope, as exported and imported. It holds the scope's
+// relations, closed ones included, with the attributes of their endpoints. Nodes are only
+// carried as endpoints: nodes without relations, the aliases recorded by MergeNodes and the
+// name embeddings set by SetNodeEmbedding are not part of a snapshot.
+type GraphSnapshot struct {
+	Filter    Filter     `json:"filter"`
+	Relations []Relation `json:"relations"`
+}
+
+// ExportOptions controls ExportGraph.
+type ExportOptions struct {
+	// BaseLabel writes Cypher scripts for stores that key nodes by a base label, Memgraph
+	// or Neo4j with base_label, instead of by their type. Other formats ignore it.
+	BaseLabel bool `json:"base_label,omitempty"`
+}
+
+// ImportOptions controls ImportGraph.
+type ImportOptions struct {
+	Scope   *Filter `json:"scope,omitempty"`   // Loads every snapshot into this scope instead of its own
+	Replace bool    `json:"replace,omitempty"` // Resets each target scope before loading it
+	DryRun  bool    `json:"dry_run,omitempty"` // Validates the input without writing
+}
+
+// ImportResult summarizes an import.
+type ImportResult struct {
+	Scopes    []Filter `json:"scopes"`
+	Relations int      `json:"relations"`
+}
+
+// exportNode is an endpoint of the relations of a snapshot.
+type exportNode struct {
+	Name string
+	Type string
+	Attributes
+}
+
+// ExportGraph writes the graphs of filters to w in format. A filter with only a user ID
+// exports the user's whole graph; pass one filter per user to export a tenant. The export
+// is lossy in the ways described on GraphSnapshot: after an import, merged aliases no longer
+// resolve to their canonical node, and entity resolution only matches an imported node once
+// its name has been embedded again by a new mention.
+func ExportGraph(ctx context.Context, store GraphStore, w io.Writer, format ExportFormat, opts ExportOptions, filters ...Filter) error {
+	if len(filters) == 0 {
+		return fmt.Errorf("graph export requires at least one scope")
+	}
+	snapshots := make([]GraphSnapshot, 0, len(filters))
+	for _, f := range filters {
+		relations, err := store.GetAll(ctx, f, QueryOptions{Limit: maxExportRelations, History: true})
+		if err != nil {
+			return fmt.Errorf("failed to read graph of user %s: %w", f.UserID, err)
+		}
+		if len(relations) == maxExportRelations {
+			return fmt.Errorf("graph of user %s exceeds %d relations", f.UserID, maxExportRelations)
+		}
+		snapshots = append(snapshots, GraphSnapshot{Filter: f, Relations: relations})
+	}
+	return EncodeGraph(w, format, opts, snapshots)
+}
+
+// ImportGraph reads graphs in format from r, validates them and loads them into store.
+// Store-managed attributes (timestamps, mention counts, recorded_at) are set anew by the
+// store, and relations are merged into any existing graph unless opts.Replace is set:
+// current relations merge with the current edge, and closed ones with the edge closed over
+// the same interval, so importing the same graph twice does not duplicate its history.
+func ImportGraph(ctx context.Context, store GraphStore, r io.Reader, format ExportFormat, opts ImportOptions) (*ImportResult, error) {
+	snapshots, err := DecodeGraph(r, format)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Scope != nil {
+		for i := range snapshots {
+			snapshots[i].Filter = *opts.Scope
+		}
+	}
+	for i, s := range snapshots {
+		if err := validateSnapshot(s); err != nil {
+			return nil, fmt.Errorf("invalid graph %d: %w", i, err)
+		}
+	}
+
+	result := &ImportResult{Scopes: make([]Filter, 0, len(snapshots))}
+	for _, s := range snapshots {
+		result.Scopes = append(result.Scopes, s.Filter)
+		result.Relations += len(s.Relations)
+	}
+	if opts.DryRun {
+		return result, nil
+	}
+	if opts.Replace {
+		reset := make(map[Filter]bool)
+		for _, s := range snapshots {
+			if reset[s.Filter] {
+				continue
+			}
+			if err := store.Reset(ctx, s.Filter); err != nil {
+				return nil, fmt.Errorf("failed to reset graph of user %s: %w", s.Filter.UserID, err)
+			}
+			reset[s.Filter] = true
+		}
+	}
+	for _, s := range snapshots {
+		if len(s.Relations) == 0 {
+			continue
+		}
+		if err := store.AddRelations(ctx, s.Filter, s.Relations); err != nil {
+			return nil, fmt.Errorf("failed to import graph of user %s: %w", s.Filter.UserID, err)
+		}
+	}
+	return result, nil
+}
+
+// EncodeGraph writes snapshots to w in format.
+func EncodeGraph(w io.Writer, format ExportFormat, opts ExportOptions, snapshots []GraphSnapshot) error {
+	switch format {
+	case FormatGraphML:
+		return encodeGraphML(w, snapshots)
+	case FormatJSONLD:
+		return encodeJSONLD(w, snapshots)
+	case FormatCypher:
+		return encodeCypher(w, snapshots, opts.BaseLabel)
+	default:
+		return fmt.Errorf("unsupported graph export format %q", format)
+	}
+}
+
+// DecodeGraph reads snapshots in format from r.
+func DecodeGraph(r io.Reader, format ExportFormat) ([]GraphSnapshot, error) {
+	var (
+		snapshots []GraphSnapshot
+		err       error
+	)
+	switch format {
+	case FormatGraphML:
+		snapshots, err = decodeGraphML(r)
+	case FormatJSONLD:
+		snapshots, err = decodeJSONLD(r)
+	case FormatCypher:
+		snapshots, err = decodeCypher(r)
+	default:
+		return nil, fmt.Errorf("unsupported graph export format %q", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s graph: %w", format, err)
+	}
+	return snapshots, nil
+}
+
+// validateSnapshot checks the scope and relations of s before they are written.
+func validateSnapshot(s GraphSnapshot) error {
+	if err := s.Filter.validate(); err != nil {
+		return err
+	}
+	for i, r := range s.Relations {
+		if err := checkRelation(normalizeRelation(r)); err != nil {
+			return fmt.Errorf("relation %d: %w", i, err)
+		}
+		if r.Confidence < 0 || r.Confidence > 1 {
+			return fmt.Errorf("relation %d: confidence %v is outside [0, 1]", i, r.Confidence)
+		}
+		if r.ValidTo != nil && !r.ValidFrom.IsZero() && r.ValidTo.Before(r.ValidFrom) {
+			return fmt.Errorf("relation %d: valid_to %s is before valid_from %s", i, r.ValidTo.Format(time.RFC3339), r.ValidFrom.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// snapshotNodes returns the endpoints of relations in order of first appearance.
+func snapshotNodes(relations []Relation) []exportNode {
+	var nodes []exportNode
+	seen := make(map[string]bool)
+	add := func(name, nodeType string, attrs *Attributes) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		n := exportNode{Name: name, Type: nodeType}
+		if attrs != nil {
+			n.Attributes = *attrs
+		}
+		nodes = append(nodes, n)
+	}
+	for _, r := range relations {
+		add(r.Source, r.SourceType, r.SourceAttributes)
+		add(r.Destination, r.DestinationType, r.DestinationAttributes)
+	}
+	return nodes
+}
+
+// withEndpoints sets the types and attributes of r's endpoints from nodes.
+func withEndpoints(r Relation, nodes map[string]exportNode) (Relation, error) {
+	source, ok := nodes[r.Source]
+	if !ok {
+		return r, fmt.Errorf("relation %s -[%s]-> %s references unknown node %q", r.Source, r.Relationship, r.Destination, r.Source)
+	}
+	destination, ok := nodes[r.Destination]
+	if !ok {
+		return r, fmt.Errorf("relation %s -[%s]-> %s references unknown node %q", r.Source, r.Relationship, r.Destination, r.Destination)
+	}
+	r.SourceType, r.DestinationType = source.Type, destination.Type
+	sourceAttrs, destinationAttrs := source.Attributes, destination.Attributes
+	r.SourceAttributes, r.DestinationAttributes = &sourceAttrs, &destinationAttrs
+	return r, nil
+}
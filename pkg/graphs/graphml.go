@@ -0,0 +1,311 @@
+package graphs
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+const graphMLNamespace = "http://graphml.graphdrawing.org/xmlns"
+
+type graphMLDocument struct {
+	XMLName xml.Name       `xml:"graphml"`
+	XMLNS   string         `xml:"xmlns,attr,omitempty"`
+	Keys    []graphMLKey   `xml:"key"`
+	Graphs  []graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Data        []graphMLData `xml:"data"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	ID     string        `xml:"id,attr,omitempty"`
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// graphMLKeys declares the data written by encodeGraphML. Keys are read back by their
+// attr.name, so files whose key ids were rewritten by other tools still import.
+var graphMLKeys = append([]graphMLKey{
+	{ID: "g_user_id", For: "graph", Name: "user_id", Type: "string"},
+	{ID: "g_agent_id", For: "graph", Name: "agent_id", Type: "string"},
+	{ID: "g_run_id", For: "graph", Name: "run_id", Type: "string"},
+	{ID: "n_name", For: "node", Name: "name", Type: "string"},
+	{ID: "n_type", For: "node", Name: "type", Type: "string"},
+	{ID: "e_relationship", For: "edge", Name: "relationship", Type: "string"},
+	{ID: "e_valid_from", For: "edge", Name: "valid_from", Type: "string"},
+	{ID: "e_valid_to", For: "edge", Name: "valid_to", Type: "string"},
+	{ID: "e_recorded_at", For: "edge", Name: "recorded_at", Type: "string"},
+}, append(attributeKeys("node"), attributeKeys("edge")...)...)
+
+// attributeKeys declares the Attributes data of element ("node" or "edge").
+func attributeKeys(element string) []graphMLKey {
+	keys := []graphMLKey{
+		{Name: "properties", Type: "string"},        // JSON object
+		{Name: "source_memory_ids", Type: "string"}, // JSON array
+		{Name: "extraction_model", Type: "string"},
+		{Name: "confidence", Type: "double"},
+		{Name: "created_at", Type: "string"},
+		{Name: "updated_at", Type: "string"},
+		{Name: "mention_count", Type: "int"},
+	}
+	for i := range keys {
+		keys[i].ID, keys[i].For = element[:1]+"_"+keys[i].Name, element
+	}
+	return keys
+}
+
+func encodeGraphML(w io.Writer, snapshots []GraphSnapshot) error {
+	doc := graphMLDocument{XMLNS: graphMLNamespace, Keys: graphMLKeys}
+	for i, s := range snapshots {
+		g := graphMLGraph{ID: fmt.Sprintf("g%d", i), EdgeDefault: "directed"}
+		g.Data = appendData(g.Data, "g_", "user_id", s.Filter.UserID)
+		g.Data = appendData(g.Data, "g_", "agent_id", s.Filter.AgentID)
+		g.Data = appendData(g.Data, "g_", "run_id", s.Filter.RunID)
+		for _, n := range snapshotNodes(s.Relations) {
+			node := graphMLNode{ID: g.ID + ":" + n.Name}
+			node.Data = appendData(node.Data, "n_", "name", n.Name)
+			node.Data = appendData(node.Data, "n_", "type", n.Type)
+			data, err := attributeData(node.Data, "n_", n.Attributes)
+			if err != nil {
+				return err
+			}
+			node.Data = data
+			g.Nodes = append(g.Nodes, node)
+		}
+		for j, r := range s.Relations {
+			edge := graphMLEdge{ID: fmt.Sprintf("%s:e%d", g.ID, j), Source: g.ID + ":" + r.Source, Target: g.ID + ":" + r.Destination}
+			edge.Data = appendData(edge.Data, "e_", "relationship", r.Relationship)
+			edge.Data = appendData(edge.Data, "e_", "valid_from", formatTime(r.ValidFrom))
+			if r.ValidTo != nil {
+				edge.Data = appendData(edge.Data, "e_", "valid_to", formatTime(*r.ValidTo))
+			}
+			edge.Data = appendData(edge.Data, "e_", "recorded_at", formatTime(r.RecordedAt))
+			data, err := attributeData(edge.Data, "e_", r.Attributes)
+			if err != nil {
+				return err
+			}
+			edge.Data = data
+			g.Edges = append(g.Edges, edge)
+		}
+		doc.Graphs = append(doc.Graphs, g)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf("failed to encode graphml: %w", err)
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func decodeGraphML(r io.Reader) ([]GraphSnapshot, error) {
+	var doc graphMLDocument
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	names := make(map[string]string, len(doc.Keys)) // key id -> attr.name
+	for _, k := range doc.Keys {
+		names[k.ID] = k.Name
+	}
+	values := func(data []graphMLData) map[string]string {
+		m := make(map[string]string, len(data))
+		for _, d := range data {
+			if name, ok := names[d.Key]; ok {
+				m[name] = d.Value
+			}
+		}
+		return m
+	}
+
+	snapshots := make([]GraphSnapshot, 0, len(doc.Graphs))
+	for _, g := range doc.Graphs {
+		if g.EdgeDefault == "undirected" {
+			return nil, fmt.Errorf("graph %s is undirected", g.ID)
+		}
+		gv := values(g.Data)
+		s := GraphSnapshot{Filter: Filter{UserID: gv["user_id"], AgentID: gv["agent_id"], RunID: gv["run_id"]}}
+		nodes := make(map[string]exportNode, len(g.Nodes))  // by GraphML id
+		byName := make(map[string]exportNode, len(g.Nodes)) // by entity name
+		for _, n := range g.Nodes {
+			nv := values(n.Data)
+			node := exportNode{Name: nv["name"], Type: nv["type"]}
+			if node.Name == "" {
+				node.Name = n.ID
+			}
+			attrs, err := parseAttributeValues(nv)
+			if err != nil {
+				return nil, fmt.Errorf("node %s: %w", n.ID, err)
+			}
+			node.Attributes = attrs
+			nodes[n.ID] = node
+			byName[node.Name] = node
+		}
+		for _, e := range g.Edges {
+			ev := values(e.Data)
+			source, ok := nodes[e.Source]
+			if !ok {
+				return nil, fmt.Errorf("edge %s references unknown node %q", e.ID, e.Source)
+			}
+			target, ok := nodes[e.Target]
+			if !ok {
+				return nil, fmt.Errorf("edge %s references unknown node %q", e.ID, e.Target)
+			}
+			rel := Relation{Source: source.Name, Relationship: ev["relationship"], Destination: target.Name}
+			attrs, err := parseAttributeValues(ev)
+			if err != nil {
+				return nil, fmt.Errorf("edge %s: %w", e.ID, err)
+			}
+			rel.Attributes = attrs
+			if rel.Validity, err = parseValidityValues(ev); err != nil {
+				return nil, fmt.Errorf("edge %s: %w", e.ID, err)
+			}
+			if rel, err = withEndpoints(rel, byName); err != nil {
+				return nil, err
+			}
+			s.Relations = append(s.Relations, rel)
+		}
+		snapshots = append(snapshots, s)
+	}
+	return snapshots, nil
+}
+
+// appendData appends a data element unless value is empty.
+func appendData(data []graphMLData, prefix string, name string, value string) []graphMLData {
+	if value == "" {
+		return data
+	}
+	return append(data, graphMLData{Key: prefix + name, Value: value})
+}
+
+// attributeData appends the data elements of attrs.
+func attributeData(data []graphMLData, prefix string, attrs Attributes) ([]graphMLData, error) {
+	if len(attrs.Properties) > 0 {
+		b, err := json.Marshal(attrs.Properties)
+		if err != nil {
+			return nil, fmt.Errorf("invalid properties: %w", err)
+		}
+		data = appendData(data, prefix, "properties", string(b))
+	}
+	if len(attrs.SourceMemoryIDs) > 0 {
+		b, err := json.Marshal(attrs.SourceMemoryIDs)
+		if err != nil {
+			return nil, err
+		}
+		data = appendData(data, prefix, "source_memory_ids", string(b))
+	}
+	data = appendData(data, prefix, "extraction_model", attrs.ExtractionModel)
+	if attrs.Confidence != 0 {
+		data = appendData(data, prefix, "confidence", strconv.FormatFloat(float64(attrs.Confidence), 'g', -1, 32))
+	}
+	data = appendData(data, prefix, "created_at", formatTime(attrs.CreatedAt))
+	data = appendData(data, prefix, "updated_at", formatTime(attrs.UpdatedAt))
+	if attrs.MentionCount != 0 {
+		data = appendData(data, prefix, "mention_count", strconv.Itoa(attrs.MentionCount))
+	}
+	return data, nil
+}
+
+// parseAttributeValues reads the values written by attributeData, keyed by attr.name.
+func parseAttributeValues(v map[string]string) (Attributes, error) {
+	var a Attributes
+	if s := v["properties"]; s != "" {
+		if err := json.Unmarshal([]byte(s), &a.Properties); err != nil {
+			return a, fmt.Errorf("invalid properties: %w", err)
+		}
+	}
+	if s := v["source_memory_ids"]; s != "" {
+		if err := json.Unmarshal([]byte(s), &a.SourceMemoryIDs); err != nil {
+			return a, fmt.Errorf("invalid source_memory_ids: %w", err)
+		}
+	}
+	a.ExtractionModel = v["extraction_model"]
+	if s := v["confidence"]; s != "" {
+		f, err := strconv.ParseFloat(s, 32)
+		if err != nil {
+			return a, fmt.Errorf("invalid confidence: %w", err)
+		}
+		a.Confidence = float32(f)
+	}
+	var err error
+	if a.CreatedAt, err = parseTime(v["created_at"]); err != nil {
+		return a, fmt.Errorf("invalid created_at: %w", err)
+	}
+	if a.UpdatedAt, err = parseTime(v["updated_at"]); err != nil {
+		return a, fmt.Errorf("invalid updated_at: %w", err)
+	}
+	if s := v["mention_count"]; s != "" {
+		if a.MentionCount, err = strconv.Atoi(s); err != nil {
+			return a, fmt.Errorf("invalid mention_count: %w", err)
+		}
+	}
+	return a, nil
+}
+
+// parseValidityValues reads the validity values of an edge, keyed by attr.name.
+func parseValidityValues(v map[string]string) (Validity, error) {
+	var (
+		validity Validity
+		err      error
+	)
+	if validity.ValidFrom, err = parseTime(v["valid_from"]); err != nil {
+		return validity, fmt.Errorf("invalid valid_from: %w", err)
+	}
+	if s := v["valid_to"]; s != "" {
+		t, err := parseTime(s)
+		if err != nil {
+			return validity, fmt.Errorf("invalid valid_to: %w", err)
+		}
+		validity.ValidTo = &t
+	}
+	if validity.RecordedAt, err = parseTime(v["recorded_at"]); err != nil {
+		return validity, fmt.Errorf("invalid recorded_at: %w", err)
+	}
+	return validity, nil
+}
+
+// formatTime renders t as RFC 3339, or "" for the zero time.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// parseTime parses an RFC 3339 time, returning the zero time for "".
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339Nano, s)
+}
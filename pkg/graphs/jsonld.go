@@ -0,0 +1,145 @@
+package graphs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+)
+
+// jsonLDContext maps the fields of exported items to IRIs under a gomem URN vocabulary
+// and types their values.
+var jsonLDContext = map[string]interface{}{
+	"@vocab":            "urn:gomem:",
+	"xsd":               "http://www.w3.org/2001/XMLSchema#",
+	"source":            map[string]string{"@type": "@id"},
+	"destination":       map[string]string{"@type": "@id"},
+	"properties":        map[string]string{"@type": "@json"},
+	"source_memory_ids": map[string]string{"@container": "@set"},
+	"confidence":        map[string]string{"@type": "xsd:double"},
+	"mention_count":     map[string]string{"@type": "xsd:integer"},
+	"created_at":        map[string]string{"@type": "xsd:dateTime"},
+	"updated_at":        map[string]string{"@type": "xsd:dateTime"},
+	"valid_from":        map[string]string{"@type": "xsd:dateTime"},
+	"valid_to":          map[string]string{"@type": "xsd:dateTime"},
+	"recorded_at":       map[string]string{"@type": "xsd:dateTime"},
+}
+
+const (
+	jsonLDScopeType    = "Scope"
+	jsonLDEntityType   = "Entity"
+	jsonLDRelationType = "Relation"
+)
+
+type jsonLDDocument struct {
+	Context interface{}   `json:"@context"`
+	Graph   []jsonLDScope `json:"@graph"`
+}
+
+// jsonLDScope is the named graph of one scope.
+type jsonLDScope struct {
+	ID      string       `json:"@id"`
+	Type    string       `json:"@type"`
+	UserID  string       `json:"user_id"`
+	AgentID string       `json:"agent_id,omitempty"`
+	RunID   string       `json:"run_id,omitempty"`
+	Graph   []jsonLDItem `json:"@graph"`
+}
+
+// jsonLDItem is an Entity node or a Relation between two of them.
+type jsonLDItem struct {
+	ID           string `json:"@id,omitempty"`
+	Type         string `json:"@type"`
+	Name         string `json:"name,omitempty"`
+	EntityType   string `json:"entity_type,omitempty"`
+	Source       string `json:"source,omitempty"`
+	Relationship string `json:"relationship,omitempty"`
+	Destination  string `json:"destination,omitempty"`
+	Attributes
+	*Validity // Relations only
+}
+
+func encodeJSONLD(w io.Writer, snapshots []GraphSnapshot) error {
+	doc := jsonLDDocument{Context: jsonLDContext, Graph: make([]jsonLDScope, 0, len(snapshots))}
+	for i, s := range snapshots {
+		scope := jsonLDScope{
+			ID:      fmt.Sprintf("_:g%d", i),
+			Type:    jsonLDScopeType,
+			UserID:  s.Filter.UserID,
+			AgentID: s.Filter.AgentID,
+			RunID:   s.Filter.RunID,
+			Graph:   []jsonLDItem{},
+		}
+		nodeID := func(name string) string { return scope.ID + "-" + url.PathEscape(name) }
+		for _, n := range snapshotNodes(s.Relations) {
+			scope.Graph = append(scope.Graph, jsonLDItem{ID: nodeID(n.Name), Type: jsonLDEntityType, Name: n.Name, EntityType: n.Type, Attributes: n.Attributes})
+		}
+		for _, r := range s.Relations {
+			validity := r.Validity
+			scope.Graph = append(scope.Graph, jsonLDItem{
+				Type:         jsonLDRelationType,
+				Source:       nodeID(r.Source),
+				Relationship: r.Relationship,
+				Destination:  nodeID(r.Destination),
+				Attributes:   r.Attributes,
+				Validity:     &validity,
+			})
+		}
+		doc.Graph = append(doc.Graph, scope)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf("failed to encode json-ld: %w", err)
+	}
+	return nil
+}
+
+func decodeJSONLD(r io.Reader) ([]GraphSnapshot, error) {
+	var doc jsonLDDocument
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	snapshots := make([]GraphSnapshot, 0, len(doc.Graph))
+	for _, scope := range doc.Graph {
+		if scope.Type != jsonLDScopeType {
+			return nil, fmt.Errorf("top-level item %s has type %q, expected %q", scope.ID, scope.Type, jsonLDScopeType)
+		}
+		s := GraphSnapshot{Filter: Filter{UserID: scope.UserID, AgentID: scope.AgentID, RunID: scope.RunID}}
+		ids := make(map[string]string) // @id -> entity name
+		nodes := make(map[string]exportNode)
+		for _, item := range scope.Graph {
+			if item.Type != jsonLDEntityType {
+				continue
+			}
+			if item.ID == "" || item.Name == "" {
+				return nil, fmt.Errorf("scope %s: entities require an @id and a name", scope.ID)
+			}
+			ids[item.ID] = item.Name
+			nodes[item.Name] = exportNode{Name: item.Name, Type: item.EntityType, Attributes: item.Attributes}
+		}
+		for _, item := range scope.Graph {
+			switch item.Type {
+			case jsonLDEntityType:
+				continue
+			case jsonLDRelationType:
+			default:
+				return nil, fmt.Errorf("scope %s: unsupported item type %q", scope.ID, item.Type)
+			}
+			rel := Relation{Source: ids[item.Source], Relationship: item.Relationship, Destination: ids[item.Destination], Attributes: item.Attributes}
+			if rel.Source == "" || rel.Destination == "" {
+				return nil, fmt.Errorf("scope %s: relation %q references unknown entity %q or %q", scope.ID, item.Relationship, item.Source, item.Destination)
+			}
+			if item.Validity != nil {
+				rel.Validity = *item.Validity
+			}
+			rel, err := withEndpoints(rel, nodes)
+			if err != nil {
+				return nil, err
+			}
+			s.Relations = append(s.Relations, rel)
+		}
+		snapshots = append(snapshots, s)
+	}
+	return snapshots, nil
+}
@@ -0,0 +1,62 @@
+package graphs
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pnocera/gomem/pkg/boltclient"
+)
+
+// memgraphVectorIndexCapacity is the initial capacity of the Memgraph vector index; it grows as needed.
+const memgraphVectorIndexCapacity = 1000
+
+// MemgraphGraphStore implements the GraphStore interface for Memgraph over the Bolt protocol.
+type MemgraphGraphStore struct {
+	*cypherGraphStore
+}
+
+// Compile-time check to ensure *MemgraphGraphStore satisfies the GraphStore interface.
+var _ GraphStore = (*MemgraphGraphStore)(nil)
+
+// NewMemgraphGraphStore connects to Memgraph and creates the entity indexes.
+func NewMemgraphGraphStore(ctx context.Context, cfg *MemgraphConfig) (*MemgraphGraphStore, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("memgraph config is nil")
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid memgraph config: %w", err)
+	}
+	store, err := newCypherGraphStore(ctx, "memgraph", memgraphDialect{}, cfg.EmbeddingDimensions, func(ctx context.Context) (*boltclient.Conn, error) {
+		return boltclient.Dial(ctx, boltclient.Config{URL: cfg.URL, Username: cfg.Username, Password: cfg.Password})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &MemgraphGraphStore{store}, nil
+}
+
+// memgraphDialect targets Memgraph, which has a single database, creates label-property
+// indexes with CREATE INDEX ON :Label(property) and configures vector indexes WITH CONFIG.
+// Nodes always carry the base label so that these indexes apply. Concurrent MERGEs of the
+// same node abort with a transient conflict error, which cypherGraphStore retries.
+type memgraphDialect struct{}
+
+func (memgraphDialect) indexQueries() []string {
+	return []string{
+		fmt.Sprintf("CREATE INDEX ON :`%s`(user_id)", baseLabel),
+		fmt.Sprintf("CREATE INDEX ON :`%s`(name)", baseLabel),
+	}
+}
+
+func (memgraphDialect) vectorIndexQuery(dimensions int) string {
+	return fmt.Sprintf("CREATE VECTOR INDEX entity_embedding ON :`%s`(embedding) "+
+		"WITH CONFIG {\"dimension\": %d, \"capacity\": %d, \"metric\": \"cos\"}", baseLabel, dimensions, memgraphVectorIndexCapacity)
+}
+
+func (memgraphDialect) runExtra() map[string]interface{} {
+	return nil
+}
+
+func (memgraphDialect) useBaseLabel() bool {
+	return true
+}
@@ -0,0 +1,61 @@
+package graphs
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pnocera/gomem/pkg/boltclient"
+)
+
+// Neo4jGraphStore implements the GraphStore interface for Neo4j over the Bolt protocol.
+type Neo4jGraphStore struct {
+	*cypherGraphStore
+}
+
+// Compile-time check to ensure *Neo4jGraphStore satisfies the GraphStore interface.
+var _ GraphStore = (*Neo4jGraphStore)(nil)
+
+// NewNeo4jGraphStore connects to Neo4j and, when BaseLabel is set, creates the entity indexes.
+func NewNeo4jGraphStore(ctx context.Context, cfg *Neo4jConfig) (*Neo4jGraphStore, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("neo4j config is nil")
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid neo4j config: %w", err)
+	}
+	store, err := newCypherGraphStore(ctx, "neo4j", neo4jDialect{cfg: cfg}, cfg.EmbeddingDimensions, func(ctx context.Context) (*boltclient.Conn, error) {
+		return boltclient.Dial(ctx, boltclient.Config{URL: cfg.URL, Username: cfg.Username, Password: cfg.Password})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Neo4jGraphStore{store}, nil
+}
+
+// neo4jDialect targets Neo4j 5, which supports IF NOT EXISTS, composite indexes and multiple databases.
+type neo4jDialect struct {
+	cfg *Neo4jConfig
+}
+
+func (d neo4jDialect) indexQueries() []string {
+	return []string{
+		fmt.Sprintf("CREATE INDEX entity_user_id IF NOT EXISTS FOR (n:`%s`) ON (n.user_id)", baseLabel),
+		fmt.Sprintf("CREATE INDEX entity_name_user_id IF NOT EXISTS FOR (n:`%s`) ON (n.name, n.user_id)", baseLabel),
+	}
+}
+
+func (d neo4jDialect) vectorIndexQuery(dimensions int) string {
+	return fmt.Sprintf("CREATE VECTOR INDEX entity_embedding IF NOT EXISTS FOR (n:`%s`) ON (n.embedding) "+
+		"OPTIONS {indexConfig: {`vector.dimensions`: %d, `vector.similarity_function`: 'cosine'}}", baseLabel, dimensions)
+}
+
+func (d neo4jDialect) runExtra() map[string]interface{} {
+	if d.cfg.Database == "" {
+		return nil
+	}
+	return map[string]interface{}{"db": d.cfg.Database}
+}
+
+func (d neo4jDialect) useBaseLabel() bool {
+	return d.cfg.BaseLabel
+}
@@ -0,0 +1,154 @@
+package graphs
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/pnocera/gomem/pkg/boltclient"
+	"github.com/pnocera/gomem/pkg/boltclient/bolttest"
+)
+
+// graphScript answers the queries of cypherGraphStore: node merges return an empty attribute
+// row, relation reads return rows, and the first failures queries fail with code.
+func graphScript(rows [][]interface{}, code string, failures int) bolttest.Script {
+	return func(run bolttest.Run) bolttest.Result {
+		switch {
+		case strings.HasPrefix(run.Query, "MERGE") && failures > 0:
+			failures--
+			return bolttest.Result{FailureCode: code, FailureMessage: "scripted failure"}
+		case strings.HasPrefix(run.Query, "MERGE"):
+			return bolttest.Result{Fields: []string{"source_" + propCreatedAt}, Records: [][]interface{}{{nil}}}
+		case strings.Contains(run.Query, "RETURN startNode(r).name AS source"):
+			return bolttest.Result{
+				Fields:  []string{"source", "source_labels", "relationship", "destination", "destination_labels", "valid_from"},
+				Records: rows,
+			}
+		}
+		return bolttest.Result{}
+	}
+}
+
+func newTestNeo4jStore(t *testing.T, srv *bolttest.Server, baseLabel bool) *Neo4jGraphStore {
+	t.Helper()
+	store, err := NewNeo4jGraphStore(context.Background(), &Neo4jConfig{
+		URL: srv.URL(), Username: "neo4j", Password: "secret", Database: "graph", BaseLabel: baseLabel, EmbeddingDimensions: 4,
+	})
+	if err != nil {
+		t.Fatalf("NewNeo4jGraphStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+var testRelation = Relation{Source: "Alice", SourceType: "person", Relationship: "works at", Destination: "Acme", DestinationType: "company"}
+
+func TestNeo4jGraphStoreDatabaseAndBaseLabel(t *testing.T) {
+	srv := bolttest.NewServer(t, graphScript([][]interface{}{
+		{"alice", []interface{}{baseLabel, "Person"}, "works_at", "acme", []interface{}{baseLabel, "Company"}, int64(1700000000000)},
+	}, "", 0))
+	store := newTestNeo4jStore(t, srv, true)
+	ctx := context.Background()
+	filter := Filter{UserID: "u1"}
+
+	if err := store.AddRelations(ctx, filter, []Relation{testRelation}); err != nil {
+		t.Fatalf("AddRelations: %v", err)
+	}
+	relations, err := store.GetAll(ctx, filter, QueryOptions{})
+	if err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+	if len(relations) != 1 || relations[0].Source != "alice" || relations[0].SourceType != "Person" ||
+		relations[0].Destination != "acme" || relations[0].DestinationType != "Company" || relations[0].ValidFrom.IsZero() {
+		t.Errorf("GetAll = %+v", relations)
+	}
+
+	queries := srv.Queries()
+	var indexes, merges int
+	for _, q := range queries {
+		if strings.HasPrefix(q, "CREATE") {
+			indexes++
+			if !strings.Contains(q, "`"+baseLabel+"`") {
+				t.Errorf("index query %q does not use the base label", q)
+			}
+		}
+		if strings.HasPrefix(q, "MERGE") {
+			merges++
+			if !strings.Contains(q, "(s:`"+baseLabel+"` {name: $source, user_id: $user_id})") || !strings.Contains(q, "SET s:`Person`") {
+				t.Errorf("merge query %q does not key nodes by the base label", q)
+			}
+		}
+	}
+	if indexes != 3 || merges != 1 {
+		t.Errorf("ran %d index and %d merge queries, want 3 and 1", indexes, merges)
+	}
+
+	for _, m := range srv.Requests() {
+		switch m.Tag {
+		case bolttest.TagBegin:
+			if m.Meta(0)["db"] != "graph" {
+				t.Errorf("BEGIN = %v, want db graph", m.Fields)
+			}
+		case bolttest.TagRun:
+			query, _ := m.Fields[0].(string)
+			inTx := strings.HasPrefix(query, "MERGE") || strings.HasPrefix(query, "MATCH (s:`"+baseLabel+"` {name:")
+			if !inTx && m.Meta(2)["db"] != "graph" {
+				t.Errorf("auto-commit RUN %q has metadata %v, want db graph", query, m.Meta(2))
+			}
+		}
+	}
+}
+
+func TestNeo4jGraphStoreTypeLabels(t *testing.T) {
+	srv := bolttest.NewServer(t, graphScript(nil, "", 0))
+	store := newTestNeo4jStore(t, srv, false)
+	if err := store.AddRelations(context.Background(), Filter{UserID: "u1"}, []Relation{testRelation}); err != nil {
+		t.Fatalf("AddRelations: %v", err)
+	}
+	for _, q := range srv.Queries() {
+		if strings.HasPrefix(q, "CREATE") {
+			t.Errorf("index query %q ran without a base label", q)
+		}
+		if strings.Contains(q, baseLabel) {
+			t.Errorf("query %q uses the base label", q)
+		}
+	}
+	if q := srv.Queries()[0]; !strings.Contains(q, "(s:`Person` {name: $source, user_id: $user_id})") {
+		t.Errorf("merge query %q does not key nodes by their type", q)
+	}
+}
+
+func TestNeo4jGraphStoreRetriesTransientError(t *testing.T) {
+	srv := bolttest.NewServer(t, graphScript(nil, "Neo.TransientError.Transaction.DeadlockDetected", maxTxAttempts-1))
+	store := newTestNeo4jStore(t, srv, true)
+	if err := store.AddRelations(context.Background(), Filter{UserID: "u1"}, []Relation{testRelation}); err != nil {
+		t.Fatalf("AddRelations: %v", err)
+	}
+	if begins, commits := srv.Count(bolttest.TagBegin), srv.Count(bolttest.TagCommit); begins != maxTxAttempts || commits != 1 {
+		t.Errorf("sent %d BEGIN and %d COMMIT, want %d and 1", begins, commits, maxTxAttempts)
+	}
+	if resets := srv.Count(bolttest.TagReset); resets != maxTxAttempts-1 {
+		t.Errorf("sent %d RESET, want one per failed attempt", resets)
+	}
+}
+
+func TestNeo4jGraphStoreFailure(t *testing.T) {
+	srv := bolttest.NewServer(t, graphScript(nil, "Neo.ClientError.Schema.ConstraintValidationFailed", 1))
+	store := newTestNeo4jStore(t, srv, true)
+	ctx := context.Background()
+
+	err := store.AddRelations(ctx, Filter{UserID: "u1"}, []Relation{testRelation})
+	var boltErr *boltclient.Error
+	if !errors.As(err, &boltErr) || boltErr.Code != "Neo.ClientError.Schema.ConstraintValidationFailed" {
+		t.Fatalf("AddRelations returned %v, want the server's FAILURE", err)
+	}
+	if begins, commits := srv.Count(bolttest.TagBegin), srv.Count(bolttest.TagCommit); begins != 1 || commits != 0 {
+		t.Errorf("sent %d BEGIN and %d COMMIT, want a single attempt without commit", begins, commits)
+	}
+
+	// The connection was reset and serves the next request.
+	if err := store.AddRelations(ctx, Filter{UserID: "u1"}, []Relation{testRelation}); err != nil {
+		t.Fatalf("AddRelations after a FAILURE: %v", err)
+	}
+}
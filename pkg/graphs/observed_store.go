@@ -0,0 +1,56 @@
+package graphs
+
+import "context"
+
+// ObservedStore wraps a GraphStore and reports the scope of every write that may change its
+// relations to onChange, so that data derived from the graph, such as community summaries,
+// can be refreshed whichever path wrote it: extraction, closing, deletion, entity merges and
+// their undo, or imports. Writes are reported even when they fail, since a failed write may
+// have been partly applied. Reads and SetNodeEmbedding go straight to the wrapped store.
+type ObservedStore struct {
+	GraphStore
+	onChange func(Filter)
+}
+
+// Compile-time check to ensure *ObservedStore satisfies the GraphStore interface.
+var _ GraphStore = (*ObservedStore)(nil)
+
+// NewObservedStore wraps store, calling onChange after each write.
+func NewObservedStore(store GraphStore, onChange func(Filter)) *ObservedStore {
+	return &ObservedStore{GraphStore: store, onChange: onChange}
+}
+
+func (s *ObservedStore) AddRelations(ctx context.Context, filter Filter, relations []Relation) error {
+	defer s.onChange(filter)
+	return s.GraphStore.AddRelations(ctx, filter, relations)
+}
+
+func (s *ObservedStore) UpdateRelation(ctx context.Context, filter Filter, relation Relation) error {
+	defer s.onChange(filter)
+	return s.GraphStore.UpdateRelation(ctx, filter, relation)
+}
+
+func (s *ObservedStore) CloseRelations(ctx context.Context, filter Filter, relations []Relation) error {
+	defer s.onChange(filter)
+	return s.GraphStore.CloseRelations(ctx, filter, relations)
+}
+
+func (s *ObservedStore) DeleteRelations(ctx context.Context, filter Filter, relations []Relation) error {
+	defer s.onChange(filter)
+	return s.GraphStore.DeleteRelations(ctx, filter, relations)
+}
+
+func (s *ObservedStore) MergeNodes(ctx context.Context, filter Filter, canonical string, alias string) (*MergeResult, error) {
+	defer s.onChange(filter)
+	return s.GraphStore.MergeNodes(ctx, filter, canonical, alias)
+}
+
+func (s *ObservedStore) RemoveAlias(ctx context.Context, filter Filter, canonical string, alias string) error {
+	defer s.onChange(filter)
+	return s.GraphStore.RemoveAlias(ctx, filter, canonical, alias)
+}
+
+func (s *ObservedStore) Reset(ctx context.Context, filter Filter) error {
+	defer s.onChange(filter)
+	return s.GraphStore.Reset(ctx, filter)
+}
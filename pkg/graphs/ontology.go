@@ -0,0 +1,263 @@
+package graphs
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Actions taken on out-of-schema data, reported in OntologyViolation.Action.
+const (
+	ViolationNormalized  = "normalized"
+	ViolationRejected    = "rejected"
+	ViolationQuarantined = "quarantined"
+)
+
+// Values of OntologyConfig.Violations.
+const (
+	violationModeNormalize  = "normalize"
+	violationModeQuarantine = "quarantine"
+)
+
+// OntologyViolation is an entity or relation that did not fit the ontology as extracted.
+// Normalized data was written in its corrected form; rejected and quarantined data was not.
+type OntologyViolation struct {
+	Entity   *Entity   `json:"entity,omitempty"`
+	Relation *Relation `json:"relation,omitempty"`
+	Reason   string    `json:"reason"`
+	Action   string    `json:"action"`
+}
+
+// QuarantinedRelation is a relation held back in the quarantine mode, with the scope it was
+// extracted for, so that it can be reviewed and re-applied as is.
+type QuarantinedRelation struct {
+	Filter   Filter   `json:"filter"`
+	Relation Relation `json:"relation"`
+}
+
+// Apply adds the relation to store in its scope, bypassing the ontology, e.g. once a reviewer
+// accepted it or the ontology was extended.
+func (q QuarantinedRelation) Apply(ctx context.Context, store GraphStore) error {
+	return store.AddRelations(ctx, q.Filter, []Relation{q.Relation})
+}
+
+// Ontology enforces an OntologyConfig. A nil *Ontology accepts everything unchanged.
+type Ontology struct {
+	entityTypes  map[string]bool
+	relations    map[string]RelationTypeConfig // Domain and Range hold normalized labels
+	typeSynonyms map[string]string
+	relSynonyms  map[string]string
+	mode         string
+	cfg          *OntologyConfig
+}
+
+// NewOntology compiles cfg, which should have been validated. It returns nil when cfg is nil.
+func NewOntology(cfg *OntologyConfig) *Ontology {
+	if cfg == nil {
+		return nil
+	}
+	o := &Ontology{
+		entityTypes:  make(map[string]bool, len(cfg.EntityTypes)),
+		relations:    make(map[string]RelationTypeConfig, len(cfg.RelationTypes)),
+		typeSynonyms: make(map[string]string),
+		relSynonyms:  make(map[string]string),
+		mode:         cfg.Violations,
+		cfg:          cfg,
+	}
+	if o.mode == "" {
+		o.mode = violationModeNormalize
+	}
+	for _, t := range cfg.EntityTypes {
+		o.entityTypes[normalizeLabel(t)] = true
+	}
+	for _, r := range cfg.RelationTypes {
+		def := RelationTypeConfig{Name: NormalizeRelationship(r.Name)}
+		for _, t := range r.Domain {
+			def.Domain = append(def.Domain, normalizeLabel(t))
+		}
+		for _, t := range r.Range {
+			def.Range = append(def.Range, normalizeLabel(t))
+		}
+		o.relations[def.Name] = def
+	}
+	for alias, name := range cfg.Synonyms {
+		if label := normalizeLabel(name); o.entityTypes[label] {
+			o.typeSynonyms[normalizeLabel(alias)] = label
+		}
+		if rel := NormalizeRelationship(name); o.relations[rel].Name != "" {
+			o.relSynonyms[NormalizeRelationship(alias)] = rel
+		}
+	}
+	return o
+}
+
+// entityType returns the ontology name of t and whether t is allowed. The empty type is
+// always allowed.
+func (o *Ontology) entityType(t string) (string, bool) {
+	label := normalizeLabel(t)
+	if label == "" {
+		return "", true
+	}
+	if canonical, ok := o.typeSynonyms[label]; ok {
+		label = canonical
+	}
+	return label, len(o.entityTypes) == 0 || o.entityTypes[label]
+}
+
+// relationship returns the ontology definition of rel, and false when rel is not allowed.
+func (o *Ontology) relationship(rel string) (RelationTypeConfig, bool) {
+	name := NormalizeRelationship(rel)
+	if canonical, ok := o.relSynonyms[name]; ok {
+		name = canonical
+	}
+	if len(o.relations) == 0 {
+		return RelationTypeConfig{Name: name}, true
+	}
+	def, ok := o.relations[name]
+	return def, ok
+}
+
+// strictAction is the action on data that fails a check in the configured mode.
+func (o *Ontology) strictAction() string {
+	if o.mode == violationModeQuarantine {
+		return ViolationQuarantined
+	}
+	return ViolationRejected
+}
+
+// EnforceEntities maps entity types through the synonyms and applies the violation mode to
+// entities of unknown types: they are untyped, or dropped in the reject and quarantine modes.
+func (o *Ontology) EnforceEntities(entities []Entity) ([]Entity, []OntologyViolation) {
+	if o == nil {
+		return entities, nil
+	}
+	accepted := make([]Entity, 0, len(entities))
+	var violations []OntologyViolation
+	for _, e := range entities {
+		label, ok := o.entityType(e.Type)
+		if ok {
+			if label != "" {
+				e.Type = label
+			}
+			accepted = append(accepted, e)
+			continue
+		}
+		v := OntologyViolation{Entity: &Entity{Name: e.Name, Type: e.Type}, Reason: fmt.Sprintf("entity type %q is not in the ontology", e.Type)}
+		if o.mode == violationModeNormalize {
+			v.Action = ViolationNormalized
+			e.Type = ""
+			accepted = append(accepted, e)
+		} else {
+			v.Action = o.strictAction()
+		}
+		violations = append(violations, v)
+	}
+	return accepted, violations
+}
+
+// EnforceRelations maps types and relationships through the synonyms and checks each relation
+// against the ontology. Untyped endpoints satisfy any domain and range. In the normalize mode,
+// unknown endpoint types are removed and a relation is reversed when only its inverse fits.
+func (o *Ontology) EnforceRelations(relations []Relation) ([]Relation, []OntologyViolation) {
+	if o == nil {
+		return relations, nil
+	}
+	accepted := make([]Relation, 0, len(relations))
+	var violations []OntologyViolation
+	for _, r := range relations {
+		fixed, reason, normalized := o.check(r)
+		if reason == "" {
+			accepted = append(accepted, fixed)
+			if normalized != "" {
+				original := r
+				violations = append(violations, OntologyViolation{Relation: &original, Reason: normalized, Action: ViolationNormalized})
+			}
+			continue
+		}
+		original := r
+		violations = append(violations, OntologyViolation{Relation: &original, Reason: reason, Action: o.strictAction()})
+	}
+	return accepted, violations
+}
+
+// check returns r in its ontology form, or the reason it does not fit. normalized describes
+// the corrections made in the normalize mode.
+func (o *Ontology) check(r Relation) (fixed Relation, reason string, normalized string) {
+	var fixes []string
+	def, ok := o.relationship(r.Relationship)
+	if !ok {
+		return r, fmt.Sprintf("relationship %q is not in the ontology", r.Relationship), ""
+	}
+	r.Relationship = def.Name
+	for _, endpoint := range []*string{&r.SourceType, &r.DestinationType} {
+		label, ok := o.entityType(*endpoint)
+		if !ok {
+			if o.mode != violationModeNormalize {
+				return r, fmt.Sprintf("entity type %q is not in the ontology", *endpoint), ""
+			}
+			fixes = append(fixes, fmt.Sprintf("removed entity type %q", *endpoint))
+			label = ""
+		}
+		*endpoint = label
+	}
+	if !fits(def, r.SourceType, r.DestinationType) {
+		if o.mode != violationModeNormalize || !fits(def, r.DestinationType, r.SourceType) {
+			return r, fmt.Sprintf("%s -[%s]-> %s does not fit %s", typeName(r.SourceType), def.Name, typeName(r.DestinationType), signature(def)), ""
+		}
+		r.Source, r.Destination = r.Destination, r.Source
+		r.SourceType, r.DestinationType = r.DestinationType, r.SourceType
+		r.SourceAttributes, r.DestinationAttributes = r.DestinationAttributes, r.SourceAttributes
+		fixes = append(fixes, "reversed to fit "+signature(def))
+	}
+	return r, "", strings.Join(fixes, "; ")
+}
+
+// fits reports whether the endpoint types satisfy def's domain and range.
+func fits(def RelationTypeConfig, sourceType string, destinationType string) bool {
+	return (sourceType == "" || len(def.Domain) == 0 || containsString(def.Domain, sourceType)) &&
+		(destinationType == "" || len(def.Range) == 0 || containsString(def.Range, destinationType))
+}
+
+func signature(def RelationTypeConfig) string {
+	return fmt.Sprintf("%s -[%s]-> %s", typeList(def.Domain), def.Name, typeList(def.Range))
+}
+
+func typeList(types []string) string {
+	if len(types) == 0 {
+		return "any"
+	}
+	return strings.Join(types, "|")
+}
+
+func typeName(t string) string {
+	if t == "" {
+		return "untyped"
+	}
+	return t
+}
+
+// EntityPrompt returns the instructions appended to the entity extraction prompt, or "".
+func (o *Ontology) EntityPrompt() string {
+	if o == nil || len(o.entityTypes) == 0 {
+		return ""
+	}
+	types := make([]string, 0, len(o.entityTypes))
+	for t := range o.entityTypes {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return "\nUse only these entity types: " + strings.Join(types, ", ") + ".\n"
+}
+
+// RelationPrompt returns the instructions appended to the relation extraction prompt, or "".
+func (o *Ontology) RelationPrompt() string {
+	if o == nil || len(o.relations) == 0 {
+		return ""
+	}
+	lines := make([]string, 0, len(o.relations))
+	for _, r := range o.cfg.RelationTypes {
+		lines = append(lines, "- "+signature(o.relations[NormalizeRelationship(r.Name)]))
+	}
+	return "\nUse only these relationship types, as source type -[relationship]-> destination type:\n" + strings.Join(lines, "\n") + "\n"
+}
@@ -0,0 +1,270 @@
+package graphs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// defaultNeighborhoodLimit bounds the existing relations shown to the LLM when deciding deletions.
+const defaultNeighborhoodLimit = 100
+
+// PipelineResult reports what one run of the ExtractionPipeline found and changed.
+type PipelineResult struct {
+	Entities   []Entity            `json:"entities,omitempty"`
+	Extracted  []Relation          `json:"extracted,omitempty"` // Relations found in the text
+	Existing   []Relation          `json:"existing,omitempty"`  // Neighborhood of the entities before the update
+	Added      []Relation          `json:"added,omitempty"`
+	Closed     []Relation          `json:"closed,omitempty"` // Relations the text made obsolete, kept as history
+	Rejected   []RejectedToolCall  `json:"rejected,omitempty"`
+	Merges     []MergeDecision     `json:"merges,omitempty"`     // Entities merged into existing nodes by the Resolver
+	Violations []OntologyViolation `json:"violations,omitempty"` // Extractions that did not fit the ontology
+}
+
+// ExtractionPipeline updates the graph from text in the mem0 style: extract entities,
+// extract the relations between them, fetch the entities' existing neighborhood, ask the
+// LLM which existing relations the text makes obsolete, then close those and apply the adds.
+// With a Resolver, entities are first mapped onto similar existing nodes. An ontology in the
+// config is described in the extraction prompts and enforced before anything is written.
+type ExtractionPipeline struct {
+	llm               ToolCallingLLM
+	store             GraphStore
+	cfg               *GraphStoreConfig
+	ontology          *Ontology
+	NeighborhoodLimit int             // Defaults to 100
+	Resolver          *EntityResolver // Optional
+}
+
+// NewExtractionPipeline creates a new ExtractionPipeline. cfg may be nil.
+func NewExtractionPipeline(llm ToolCallingLLM, store GraphStore, cfg *GraphStoreConfig) *ExtractionPipeline {
+	p := &ExtractionPipeline{
+		llm:               llm,
+		store:             store,
+		cfg:               cfg,
+		NeighborhoodLimit: defaultNeighborhoodLimit,
+	}
+	if cfg != nil {
+		p.ontology = NewOntology(cfg.Ontology)
+	}
+	return p
+}
+
+// ModelNamer is implemented by ToolCallingLLMs that can report their model, which the
+// ExtractionPipeline records as the extraction model of the relations it adds.
+type ModelNamer interface {
+	ModelName() string
+}
+
+// Process runs the pipeline for text within the filter's scope. provenance, e.g. the
+// SourceMemoryIDs of the memory text comes from, is recorded on every added relation.
+func (p *ExtractionPipeline) Process(ctx context.Context, filter Filter, text string, provenance Attributes) (*PipelineResult, error) {
+	if p.llm == nil {
+		return nil, fmt.Errorf("LLM client is nil")
+	}
+	if p.store == nil {
+		return nil, fmt.Errorf("graph store is nil")
+	}
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+	result := &PipelineResult{}
+
+	entities, err := p.extractEntities(ctx, filter, text, result)
+	if err != nil {
+		return nil, err
+	}
+	// Relations keep the extracted types of their endpoints, so that those of dropped
+	// entities are checked against the ontology too.
+	types := make(map[string]string, len(entities))
+	for _, e := range entities {
+		types[NormalizeEntity(e.Name)] = e.Type
+	}
+	entities, violations := p.ontology.EnforceEntities(entities)
+	result.Violations = append(result.Violations, violations...)
+	var canonical map[string]string
+	if p.Resolver != nil && len(entities) > 0 {
+		resolution, err := p.Resolver.Resolve(ctx, filter, entities)
+		if err != nil {
+			return nil, fmt.Errorf("entity resolution failed: %w", err)
+		}
+		entities, canonical = resolution.Entities, resolution.Canonical
+		result.Merges = resolution.Merges
+	}
+	result.Entities = entities
+	if len(entities) == 0 {
+		return result, nil
+	}
+
+	for _, e := range entities {
+		types[NormalizeEntity(e.Name)] = e.Type
+	}
+	extracted, err := p.extractRelations(ctx, text, entities, types, canonical, result)
+	if err != nil {
+		return nil, err
+	}
+	result.Extracted = extracted
+	extracted, violations = p.ontology.EnforceRelations(extracted)
+	result.Violations = append(result.Violations, violations...)
+
+	names := make([]string, len(entities))
+	for i, e := range entities {
+		names[i] = e.Name
+	}
+	limit := p.NeighborhoodLimit
+	if limit <= 0 {
+		limit = defaultNeighborhoodLimit
+	}
+	existing, err := p.store.SearchByEntity(ctx, filter, names, QueryOptions{Limit: limit})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch existing relations: %w", err)
+	}
+	result.Existing = existing
+
+	obsolete, err := p.obsoleteRelations(ctx, filter, text, existing, result)
+	if err != nil {
+		return nil, err
+	}
+	if len(obsolete) > 0 {
+		if err := p.store.CloseRelations(ctx, filter, obsolete); err != nil {
+			return nil, fmt.Errorf("failed to close obsolete relations: %w", err)
+		}
+		result.Closed = obsolete
+	}
+	if namer, ok := p.llm.(ModelNamer); ok && provenance.ExtractionModel == "" {
+		provenance.ExtractionModel = namer.ModelName()
+	}
+	for i := range extracted {
+		extracted[i].Attributes = provenance
+	}
+	if len(extracted) > 0 {
+		if err := p.store.AddRelations(ctx, filter, extracted); err != nil {
+			return nil, fmt.Errorf("failed to add relations: %w", err)
+		}
+		result.Added = extracted
+	}
+	return result, nil
+}
+
+// extractEntities asks the LLM for the entities of text using ExtractEntitiesTool.
+func (p *ExtractionPipeline) extractEntities(ctx context.Context, filter Filter, text string, result *PipelineResult) ([]Entity, error) {
+	calls, err := p.llm.ChatWithTools(ctx, GetExtractEntitiesPrompt(filter.UserID)+p.ontology.EntityPrompt(), text, []Tool{ExtractEntitiesTool})
+	if err != nil {
+		return nil, fmt.Errorf("entity extraction failed: %w", err)
+	}
+	seen := make(map[string]bool)
+	var entities []Entity
+	for _, call := range p.acceptCalls(calls, result, ExtractEntitiesTool) {
+		args, err := ParseToolCall(call)
+		if err != nil {
+			result.Rejected = append(result.Rejected, RejectedToolCall{Call: call, Error: err.Error()})
+			continue
+		}
+		for _, e := range args.(*EntitiesArgs).Entities {
+			key := NormalizeEntity(e[0])
+			if key == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			entities = append(entities, Entity{Name: e[0], Type: e[1]})
+		}
+	}
+	return entities, nil
+}
+
+// extractRelations asks the LLM for relations between the entities using RelationsTool and
+// ExtractRelationsPromptTemplate. Endpoints are renamed through canonical, which may be nil,
+// and their types are looked up in types by normalized name.
+func (p *ExtractionPipeline) extractRelations(ctx context.Context, text string, entities []Entity, types map[string]string, canonical map[string]string, result *PipelineResult) ([]Relation, error) {
+	customPrompt := ""
+	if p.cfg != nil {
+		customPrompt = p.cfg.CustomPrompt
+	}
+	names := make([]string, len(entities))
+	for i, e := range entities {
+		names[i] = e.Name
+	}
+	userPrompt := fmt.Sprintf("List of entities: %s\n\nText: %s", strings.Join(names, ", "), text)
+
+	calls, err := p.llm.ChatWithTools(ctx, GetExtractRelationsPrompt(customPrompt)+p.ontology.RelationPrompt(), userPrompt, []Tool{RelationsTool})
+	if err != nil {
+		return nil, fmt.Errorf("relation extraction failed: %w", err)
+	}
+	var relations []Relation
+	for _, call := range p.acceptCalls(calls, result, RelationsTool) {
+		args, err := ParseToolCall(call)
+		if err != nil {
+			result.Rejected = append(result.Rejected, RejectedToolCall{Call: call, Error: err.Error()})
+			continue
+		}
+		for _, r := range args.(*RelationsArgs).Relations {
+			source, destination := r[0], r[1]
+			if name, ok := canonical[NormalizeEntity(source)]; ok {
+				source = name
+			}
+			if name, ok := canonical[NormalizeEntity(destination)]; ok {
+				destination = name
+			}
+			relations = append(relations, Relation{
+				Source:          source,
+				SourceType:      types[NormalizeEntity(source)],
+				Relationship:    r[2],
+				Destination:     destination,
+				DestinationType: types[NormalizeEntity(destination)],
+			})
+		}
+	}
+	return relations, nil
+}
+
+// obsoleteRelations asks the LLM which existing relations the text contradicts, using
+// GetDeleteMessages. Deletions of relations that are not in existing are ignored.
+func (p *ExtractionPipeline) obsoleteRelations(ctx context.Context, filter Filter, text string, existing []Relation, result *PipelineResult) ([]Relation, error) {
+	if len(existing) == 0 {
+		return nil, nil
+	}
+	known := make(map[string]bool, len(existing))
+	lines := make([]string, len(existing))
+	for i, r := range existing {
+		known[relationKey(r)] = true
+		lines[i] = fmt.Sprintf("%s -- %s -- %s", r.Source, r.Relationship, r.Destination)
+	}
+	systemPrompt, userPrompt := GetDeleteMessages(strings.Join(lines, "\n"), text, filter.UserID)
+
+	tools := []Tool{DeleteMemoryToolGraph, NoopTool}
+	calls, err := p.llm.ChatWithTools(ctx, systemPrompt, userPrompt, tools)
+	if err != nil {
+		return nil, fmt.Errorf("obsolete relation detection failed: %w", err)
+	}
+	var deletes []Relation
+	for _, call := range p.acceptCalls(calls, result, tools...) {
+		if call.Name != DeleteMemoryToolGraph.Function.Name {
+			continue
+		}
+		args, err := ParseToolCall(call)
+		if err != nil {
+			result.Rejected = append(result.Rejected, RejectedToolCall{Call: call, Error: err.Error()})
+			continue
+		}
+		a := args.(*DeleteGraphMemoryArgs)
+		rel := Relation{Source: a.Source, Relationship: a.Relationship, Destination: a.Destination}
+		if !known[relationKey(rel)] {
+			result.Rejected = append(result.Rejected, RejectedToolCall{Call: call, Error: "relation is not in the existing graph"})
+			continue
+		}
+		deletes = append(deletes, rel)
+	}
+	return deletes, nil
+}
+
+// acceptCalls returns the calls to offered tools, recording the others as rejected.
+func (p *ExtractionPipeline) acceptCalls(calls []ToolCall, result *PipelineResult, offered ...Tool) []ToolCall {
+	accepted, rejected := offeredCalls(calls, offered)
+	result.Rejected = append(result.Rejected, rejected...)
+	return accepted
+}
+
+// relationKey identifies a relation by its normalized endpoints and type.
+func relationKey(r Relation) string {
+	n := normalizeRelation(r)
+	return n.Source + "\x00" + n.Relationship + "\x00" + n.Destination
+}
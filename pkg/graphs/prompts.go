@@ -6,6 +6,12 @@ import (
 )
 
 const (
+	ExtractEntitiesPromptTemplate = `
+You are a smart assistant who understands entities and their types in a given text.
+If the user message contains a self reference such as 'I', 'me', 'my' etc., use USER_ID as the source entity.
+Extract all the entities from the text.
+***DO NOT*** answer the question itself if the given text is a question.
+`
 	UpdateGraphPromptTemplate = `
 You are a Network Graph Maker.
 The user wants to update the knowledge graph with new information.
@@ -107,3 +113,14 @@ func GetDeleteMessages(existingMemories string, data string, userID string) (sys
 	userPrompt = fmt.Sprintf("Here are the existing memories: %s \n\n New Information: %s", existingMemories, data)
 	return
 }
+
+// GetExtractEntitiesPrompt prepares the system prompt for extracting entities on behalf of userID.
+func GetExtractEntitiesPrompt(userID string) string {
+	return strings.ReplaceAll(ExtractEntitiesPromptTemplate, "USER_ID", userID)
+}
+
+// GetExtractRelationsPrompt prepares the system prompt for extracting relations, substituting
+// CUSTOM_PROMPT with the configured custom prompt (or removing it).
+func GetExtractRelationsPrompt(customPrompt string) string {
+	return strings.ReplaceAll(ExtractRelationsPromptTemplate, "CUSTOM_PROMPT", customPrompt)
+}
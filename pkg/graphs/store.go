@@ -0,0 +1,225 @@
+package graphs
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Relation is a directed, typed edge between two entities, e.g. (alice:Person)-[works_at]->(acme:Organization).
+// The embedded Attributes are the edge's; SourceAttributes and DestinationAttributes are the
+// endpoints'. On writes only their Properties are used, and the edge's provenance is also
+// merged into both endpoints.
+type Relation struct {
+	Source          string `json:"source"`
+	SourceType      string `json:"source_type,omitempty"`
+	Relationship    string `json:"relationship"`
+	Destination     string `json:"destination"`
+	DestinationType string `json:"destination_type,omitempty"`
+	Attributes
+	Validity
+	SourceAttributes      *Attributes `json:"source_attributes,omitempty"`
+	DestinationAttributes *Attributes `json:"destination_attributes,omitempty"`
+}
+
+// Validity is the bi-temporal interval of an edge: when the relation held in the world
+// (valid time) and when the store learned it (transaction time).
+type Validity struct {
+	ValidFrom  time.Time  `json:"valid_from,omitempty"`  // Defaults to when the edge is recorded
+	ValidTo    *time.Time `json:"valid_to,omitempty"`    // Nil while the relation still holds
+	RecordedAt time.Time  `json:"recorded_at,omitempty"` // Set by the store
+}
+
+// validAt reports whether the interval contains t.
+func (v Validity) validAt(t time.Time) bool {
+	return !v.ValidFrom.After(t) && (v.ValidTo == nil || v.ValidTo.After(t))
+}
+
+// sameInterval reports whether v and o are closed over the same interval, to the millisecond
+// the stores keep. Imports use it to recognize history that was already restored.
+func (v Validity) sameInterval(o Validity) bool {
+	return v.ValidTo != nil && o.ValidTo != nil && !v.ValidFrom.IsZero() &&
+		v.ValidFrom.UnixMilli() == o.ValidFrom.UnixMilli() && v.ValidTo.UnixMilli() == o.ValidTo.UnixMilli()
+}
+
+// Attributes are the properties and provenance of a node or an edge.
+type Attributes struct {
+	Properties      map[string]interface{} `json:"properties,omitempty"`
+	SourceMemoryIDs []string               `json:"source_memory_ids,omitempty"` // Memories the element was extracted from
+	ExtractionModel string                 `json:"extraction_model,omitempty"`  // Model of the latest extraction
+	Confidence      float32                `json:"confidence,omitempty"`        // Highest extraction confidence, 0 to 1; 0 when unknown
+	CreatedAt       time.Time              `json:"created_at,omitempty"`        // Set by the store
+	UpdatedAt       time.Time              `json:"updated_at,omitempty"`        // Set by the store
+	MentionCount    int                    `json:"mention_count,omitempty"`     // Times the element was added; set by the store
+}
+
+// mergeAttributes folds one more mention into stored attributes: properties are overwritten
+// key by key, memory IDs are unioned, the model is replaced when given, the confidence keeps
+// its maximum and the mention count is incremented.
+func mergeAttributes(stored Attributes, incoming Attributes, now time.Time) Attributes {
+	merged := stored
+	if len(incoming.Properties) > 0 {
+		merged.Properties = make(map[string]interface{}, len(stored.Properties)+len(incoming.Properties))
+		for k, v := range stored.Properties {
+			merged.Properties[k] = v
+		}
+		for k, v := range incoming.Properties {
+			merged.Properties[k] = v
+		}
+	}
+	merged.SourceMemoryIDs = appendUnique(stored.SourceMemoryIDs, incoming.SourceMemoryIDs...)
+	if incoming.ExtractionModel != "" {
+		merged.ExtractionModel = incoming.ExtractionModel
+	}
+	if incoming.Confidence > merged.Confidence {
+		merged.Confidence = incoming.Confidence
+	}
+	if merged.CreatedAt.IsZero() {
+		merged.CreatedAt = now
+	}
+	merged.UpdatedAt = now
+	merged.MentionCount++
+	return merged
+}
+
+// endpointAttributes returns the attributes written to a relation's endpoint: the edge's
+// provenance with the endpoint's own properties.
+func (r Relation) endpointAttributes(endpoint *Attributes) Attributes {
+	attrs := Attributes{
+		SourceMemoryIDs: r.SourceMemoryIDs,
+		ExtractionModel: r.ExtractionModel,
+		Confidence:      r.Confidence,
+	}
+	if endpoint != nil {
+		attrs.Properties = endpoint.Properties
+	}
+	return attrs
+}
+
+// Filter scopes graph operations to the entities of one user, and optionally one agent or run.
+type Filter struct {
+	UserID  string `json:"user_id" validate:"required"`
+	AgentID string `json:"agent_id,omitempty"`
+	RunID   string `json:"run_id,omitempty"`
+}
+
+// NodeMatch is a node found by SearchSimilarNodes.
+type NodeMatch struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type,omitempty"`
+	Aliases []string `json:"aliases,omitempty"`
+	Score   float32  `json:"score"` // Cosine similarity to the query embedding
+}
+
+// MergeResult describes the relations MergeNodes re-pointed from the alias to the canonical node.
+type MergeResult struct {
+	Moved   []Relation `json:"moved,omitempty"`   // The alias's relations as they were before the merge
+	Created []Relation `json:"created,omitempty"` // Relations that did not already exist on the canonical node
+}
+
+// QueryOptions controls graph reads.
+type QueryOptions struct {
+	Limit   int        `json:"limit,omitempty"`   // Maximum relations to return, defaults to 100
+	AsOf    *time.Time `json:"as_of,omitempty"`   // Only relations valid at this time; defaults to now
+	History bool       `json:"history,omitempty"` // Also return closed relations; AsOf is then ignored
+}
+
+const (
+	defaultQueryLimit = 100
+	maxTraverseHops   = 5 // Bounds variable-length matches, whose cost grows exponentially with depth
+)
+
+// GraphStore defines the common interface for graph database providers.
+// Entity names and relationship types are normalized with NormalizeEntity and
+// NormalizeRelationship before they are stored or matched.
+type GraphStore interface {
+	// AddRelations merges both endpoints of each relation and the current edge between them.
+	// An edge whose relation was closed is not reopened; a new interval is recorded instead.
+	AddRelations(ctx context.Context, filter Filter, relations []Relation) error
+	// UpdateRelation closes every current edge from relation.Source to relation.Destination and adds relation.
+	UpdateRelation(ctx context.Context, filter Filter, relation Relation) error
+	// CloseRelations ends the validity of the current matching edges at each relation's ValidTo,
+	// or now when it is unset, keeping them for as-of queries. Types are ignored when matching.
+	CloseRelations(ctx context.Context, filter Filter, relations []Relation) error
+	// DeleteRelations removes the matching edges and their history. Types are ignored when matching.
+	DeleteRelations(ctx context.Context, filter Filter, relations []Relation) error
+	// SearchByEntity returns the relations in which any of entities takes part, in either direction.
+	// Entities are matched by node name or by the aliases recorded by MergeNodes.
+	SearchByEntity(ctx context.Context, filter Filter, entities []string, opts QueryOptions) ([]Relation, error)
+	// Traverse returns the relations reachable from entities within hops edges, in either direction,
+	// matching entities as SearchByEntity does.
+	Traverse(ctx context.Context, filter Filter, entities []string, hops int, opts QueryOptions) ([]Relation, error)
+	// GetAll returns the relations of the filter's scope.
+	GetAll(ctx context.Context, filter Filter, opts QueryOptions) ([]Relation, error)
+	// SetNodeEmbedding stores the embedding of an entity's name, creating the node if needed.
+	SetNodeEmbedding(ctx context.Context, filter Filter, name string, nodeType string, embedding []float32) error
+	// SearchSimilarNodes returns up to limit nodes whose name embedding has a cosine similarity
+	// of at least threshold with embedding, best first.
+	SearchSimilarNodes(ctx context.Context, filter Filter, embedding []float32, threshold float32, limit int) ([]NodeMatch, error)
+	// MergeNodes folds alias into canonical: the alias's relations are re-pointed to canonical,
+	// alias (and its own aliases) are added to canonical's aliases, and the alias node is deleted.
+	// canonical must exist; alias may not.
+	MergeNodes(ctx context.Context, filter Filter, canonical string, alias string) (*MergeResult, error)
+	// RemoveAlias removes alias from canonical's aliases, e.g. to undo a merge.
+	RemoveAlias(ctx context.Context, filter Filter, canonical string, alias string) error
+	// Reset deletes every entity and relation in the filter's scope.
+	Reset(ctx context.Context, filter Filter) error
+	Close() error
+}
+
+// NewGraphStore connects to the graph store selected by cfg.Provider.
+func NewGraphStore(ctx context.Context, cfg *GraphStoreConfig) (GraphStore, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("graph store config is nil")
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid graph store config: %w", err)
+	}
+	switch c := cfg.Config.(type) {
+	case *Neo4jConfig:
+		return NewNeo4jGraphStore(ctx, c)
+	case *MemgraphConfig:
+		return NewMemgraphGraphStore(ctx, c)
+	case *EmbeddedConfig:
+		return NewEmbeddedGraphStore(c)
+	case *DgraphConfig:
+		return NewDgraphGraphStore(ctx, c)
+	default:
+		return nil, fmt.Errorf("unsupported graph store provider: %s", cfg.Provider)
+	}
+}
+
+func (f Filter) validate() error {
+	if f.UserID == "" {
+		return fmt.Errorf("graph filter requires a user_id")
+	}
+	return nil
+}
+
+// includes reports whether a relation with validity v is returned by reads using o
+// evaluated at asOf.
+func (o QueryOptions) includes(v Validity, asOf time.Time) bool {
+	return o.History || v.validAt(asOf)
+}
+
+func (o QueryOptions) asOf() time.Time {
+	if o.AsOf == nil {
+		return time.Now()
+	}
+	return *o.AsOf
+}
+
+// closedAt returns when CloseRelations ends r's validity.
+func (r Relation) closedAt(now time.Time) time.Time {
+	if r.ValidTo != nil {
+		return *r.ValidTo
+	}
+	return now
+}
+
+func (o QueryOptions) limit() int {
+	if o.Limit <= 0 {
+		return defaultQueryLimit
+	}
+	return o.Limit
+}
@@ -0,0 +1,221 @@
+package graphs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// ToolCall is a function call returned by the LLM. Arguments is the raw JSON object the
+// model produced, as in OpenAI's tool_calls[].function.arguments.
+type ToolCall struct {
+	ID        string `json:"id,omitempty"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// GraphMemoryArgs are the arguments of add_graph_memory and update_graph_memory.
+type GraphMemoryArgs struct {
+	Source          string `json:"source"`
+	Destination     string `json:"destination"`
+	Relationship    string `json:"relationship"`
+	SourceType      string `json:"source_type"`
+	DestinationType string `json:"destination_type"`
+}
+
+// DeleteGraphMemoryArgs are the arguments of delete_graph_memory.
+type DeleteGraphMemoryArgs struct {
+	Source       string `json:"source"`
+	Destination  string `json:"destination"`
+	Relationship string `json:"relationship"`
+}
+
+// RelationsArgs are the arguments of extract_relations: [source, destination, relationship] triplets.
+type RelationsArgs struct {
+	Relations [][]string `json:"relations"`
+}
+
+// EntitiesArgs are the arguments of extract_entities: [name, type] pairs.
+type EntitiesArgs struct {
+	Entities [][]string `json:"entities"`
+}
+
+// RelationStruct is one relation of the structured tools.
+type RelationStruct struct {
+	Source       string `json:"source"`
+	Destination  string `json:"destination"`
+	Relationship string `json:"relationship"`
+}
+
+// MemoryStructArgs are the arguments of add_memory_struct, update_memory_struct and delete_memory_struct.
+type MemoryStructArgs struct {
+	Memories []RelationStruct `json:"memories"`
+}
+
+// RelationsStructArgs are the arguments of extract_relations_struct.
+type RelationsStructArgs struct {
+	Relations []RelationStruct `json:"relations"`
+}
+
+// Entity is a named, typed entity extracted from text.
+type Entity struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// EntitiesStructArgs are the arguments of extract_entities_struct.
+type EntitiesStructArgs struct {
+	Entities []Entity `json:"entities"`
+}
+
+// NoopArgs are the (empty) arguments of noop and noop_struct.
+type NoopArgs struct{}
+
+// graphTools lists every tool defined in tools.go with a constructor for its typed arguments.
+var graphTools = map[string]struct {
+	tool    Tool
+	newArgs func() interface{}
+}{
+	AddMemoryToolGraph.Function.Name:          {AddMemoryToolGraph, func() interface{} { return &GraphMemoryArgs{} }},
+	UpdateMemoryToolGraph.Function.Name:       {UpdateMemoryToolGraph, func() interface{} { return &GraphMemoryArgs{} }},
+	DeleteMemoryToolGraph.Function.Name:       {DeleteMemoryToolGraph, func() interface{} { return &DeleteGraphMemoryArgs{} }},
+	NoopTool.Function.Name:                    {NoopTool, func() interface{} { return &NoopArgs{} }},
+	RelationsTool.Function.Name:               {RelationsTool, func() interface{} { return &RelationsArgs{} }},
+	ExtractEntitiesTool.Function.Name:         {ExtractEntitiesTool, func() interface{} { return &EntitiesArgs{} }},
+	AddMemoryStructToolGraph.Function.Name:    {AddMemoryStructToolGraph, func() interface{} { return &MemoryStructArgs{} }},
+	UpdateMemoryStructToolGraph.Function.Name: {UpdateMemoryStructToolGraph, func() interface{} { return &MemoryStructArgs{} }},
+	DeleteMemoryStructToolGraph.Function.Name: {DeleteMemoryStructToolGraph, func() interface{} { return &MemoryStructArgs{} }},
+	NoopStructTool.Function.Name:              {NoopStructTool, func() interface{} { return &NoopArgs{} }},
+	RelationsStructTool.Function.Name:         {RelationsStructTool, func() interface{} { return &RelationsStructArgs{} }},
+	ExtractEntitiesStructTool.Function.Name:   {ExtractEntitiesStructTool, func() interface{} { return &EntitiesStructArgs{} }},
+}
+
+// ParseToolCall validates a call against its tool's ToolParameters and decodes the arguments
+// into the tool's typed struct, e.g. *GraphMemoryArgs for add_graph_memory.
+func ParseToolCall(call ToolCall) (interface{}, error) {
+	entry, ok := graphTools[call.Name]
+	if !ok {
+		return nil, fmt.Errorf("unknown tool %q", call.Name)
+	}
+	raw := []byte(call.Arguments)
+	if len(bytes.TrimSpace(raw)) == 0 {
+		raw = []byte("{}")
+	}
+	if err := ValidateArguments(entry.tool.Function.Parameters, raw); err != nil {
+		return nil, fmt.Errorf("invalid arguments for %s: %w", call.Name, err)
+	}
+	args := entry.newArgs()
+	if err := json.Unmarshal(raw, args); err != nil {
+		return nil, fmt.Errorf("invalid arguments for %s: %w", call.Name, err)
+	}
+	if err := checkArgs(args); err != nil {
+		return nil, fmt.Errorf("invalid arguments for %s: %w", call.Name, err)
+	}
+	return args, nil
+}
+
+// ValidateArguments checks a JSON object against a tool's parameter schema: required
+// properties must be present and non-empty, and every declared property must have its
+// declared JSON type. Properties the schema does not declare are allowed.
+func ValidateArguments(params ToolParameters, raw json.RawMessage) error {
+	var args map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&args); err != nil {
+		return fmt.Errorf("arguments must be a JSON object: %w", err)
+	}
+	if args == nil {
+		return fmt.Errorf("arguments must be a JSON object")
+	}
+	for _, name := range params.Required {
+		v, ok := args[name]
+		if !ok || v == nil {
+			return fmt.Errorf("missing required property %q", name)
+		}
+		if s, isString := v.(string); isString && s == "" {
+			return fmt.Errorf("required property %q is empty", name)
+		}
+	}
+	for name, prop := range params.Properties {
+		v, ok := args[name]
+		if !ok || v == nil {
+			continue
+		}
+		if !matchesJSONType(prop.Type, v) {
+			return fmt.Errorf("property %q must be of type %s, got %s", name, prop.Type, jsonTypeOf(v))
+		}
+	}
+	return nil
+}
+
+func matchesJSONType(want string, v interface{}) bool {
+	switch want {
+	case "", "any":
+		return true
+	case "integer":
+		n, ok := v.(json.Number)
+		if !ok {
+			return false
+		}
+		f, err := n.Float64()
+		return err == nil && f == math.Trunc(f)
+	default:
+		return jsonTypeOf(v) == want
+	}
+}
+
+func jsonTypeOf(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case bool:
+		return "boolean"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return "null"
+	}
+}
+
+// checkArgs validates the item shapes that ToolParameters cannot express.
+func checkArgs(args interface{}) error {
+	switch a := args.(type) {
+	case *RelationsArgs:
+		for i, r := range a.Relations {
+			if len(r) != 3 || r[0] == "" || r[1] == "" || r[2] == "" {
+				return fmt.Errorf("relations[%d] must be [source, destination, relationship], got %v", i, r)
+			}
+		}
+	case *EntitiesArgs:
+		for i, e := range a.Entities {
+			if len(e) != 2 || e[0] == "" {
+				return fmt.Errorf("entities[%d] must be [name, type], got %v", i, e)
+			}
+		}
+	case *MemoryStructArgs:
+		return checkRelationStructs("memories", a.Memories)
+	case *RelationsStructArgs:
+		return checkRelationStructs("relations", a.Relations)
+	case *EntitiesStructArgs:
+		for i, e := range a.Entities {
+			if e.Name == "" {
+				return fmt.Errorf("entities[%d] has no name", i)
+			}
+		}
+	}
+	return nil
+}
+
+func checkRelationStructs(field string, items []RelationStruct) error {
+	for i, r := range items {
+		if r.Source == "" || r.Destination == "" || r.Relationship == "" {
+			return fmt.Errorf("%s[%d] requires source, destination and relationship", field, i)
+		}
+	}
+	return nil
+}
@@ -244,3 +244,9 @@ var DeleteMemoryToolGraph = Tool{
 		},
 	},
 }
+
+// GraphMemoryTools are offered to the LLM when it edits the graph one relation per call.
+var GraphMemoryTools = []Tool{AddMemoryToolGraph, UpdateMemoryToolGraph, DeleteMemoryToolGraph, NoopTool}
+
+// GraphMemoryStructTools are offered to the LLM when it edits the graph with lists of relations.
+var GraphMemoryStructTools = []Tool{AddMemoryStructToolGraph, UpdateMemoryStructToolGraph, DeleteMemoryStructToolGraph, NoopStructTool}
@@ -1,4 +1,65 @@
 package graphs
 
-// This file is intentionally left empty for now.
-// It can be used to add utility functions for the graphs package in the future.
+import (
+	"strings"
+	"unicode"
+)
+
+// NormalizeEntity lowercases an entity name, trims it and joins its words with underscores,
+// so that "New York" and "new  york" refer to the same node.
+func NormalizeEntity(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(name)), "_")
+}
+
+// NormalizeRelationship turns a relationship phrase into a safe edge type such as "works_at".
+// Characters other than letters, digits and underscores are replaced, because edge types are
+// interpolated into Cypher and cannot be passed as parameters.
+func NormalizeRelationship(rel string) string {
+	return identifier(strings.ToLower(rel))
+}
+
+// normalizeLabel turns an entity type into a safe node label such as "Person".
+func normalizeLabel(entityType string) string {
+	label := identifier(entityType)
+	if label == "" {
+		return ""
+	}
+	r := []rune(label)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
+
+// identifier keeps letters, digits and underscores, collapsing everything else to single
+// underscores. A leading digit is prefixed with an underscore.
+func identifier(s string) string {
+	var b strings.Builder
+	pendingSep := false
+	for _, r := range strings.TrimSpace(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			if pendingSep && b.Len() > 0 {
+				b.WriteByte('_')
+			}
+			pendingSep = false
+			b.WriteRune(r)
+			continue
+		}
+		pendingSep = true
+	}
+	out := b.String()
+	if out != "" && unicode.IsDigit([]rune(out)[0]) {
+		out = "_" + out
+	}
+	return out
+}
+
+// normalizeRelation applies NormalizeEntity, NormalizeRelationship and normalizeLabel to r,
+// keeping its attributes.
+func normalizeRelation(r Relation) Relation {
+	n := r
+	n.Source = NormalizeEntity(r.Source)
+	n.SourceType = normalizeLabel(r.SourceType)
+	n.Relationship = NormalizeRelationship(r.Relationship)
+	n.Destination = NormalizeEntity(r.Destination)
+	n.DestinationType = normalizeLabel(r.DestinationType)
+	return n
+}
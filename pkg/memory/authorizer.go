@@ -0,0 +1,90 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrForbidden is returned when a caller's scope does not cover the memories it accesses.
+var ErrForbidden = errors.New("forbidden")
+
+// errorCodeForbidden marks worker replies whose error is ErrForbidden.
+const errorCodeForbidden = "forbidden"
+
+// Action is the kind of access an Authorizer decides on.
+type Action string
+
+// Actions checked by the service and the workers.
+const (
+	ActionRead   Action = "read"
+	ActionUpdate Action = "update"
+	ActionDelete Action = "delete"
+)
+
+// Authorizer decides whether a caller may perform action on data owned by owner. For a
+// single memory the owner is the user, agent and run it was stored with; for searches
+// and history queries it is the scope being requested. Implementations return an error
+// wrapping ErrForbidden to deny access.
+type Authorizer interface {
+	Authorize(ctx context.Context, caller BaseRequestInfo, owner BaseRequestInfo, action Action) error
+}
+
+// ScopeAuthorizer is the default Authorizer. The caller must name a user, which must be
+// the owner's; an agent or run the caller also names narrows access to owners with that
+// same agent or run. Memories stored without a user are only reachable through a custom
+// Authorizer.
+type ScopeAuthorizer struct{}
+
+// Compile-time check to ensure ScopeAuthorizer satisfies the Authorizer interface.
+var _ Authorizer = ScopeAuthorizer{}
+
+// Authorize implements Authorizer.
+func (ScopeAuthorizer) Authorize(ctx context.Context, caller BaseRequestInfo, owner BaseRequestInfo, action Action) error {
+	if caller.UserID == "" {
+		return fmt.Errorf("%w: %s requires a user_id", ErrForbidden, action)
+	}
+	if caller.UserID != owner.UserID {
+		return fmt.Errorf("%w: %s outside the caller's user_id", ErrForbidden, action)
+	}
+	if caller.AgentID != "" && caller.AgentID != owner.AgentID {
+		return fmt.Errorf("%w: %s outside the caller's agent_id", ErrForbidden, action)
+	}
+	if caller.RunID != "" && caller.RunID != owner.RunID {
+		return fmt.Errorf("%w: %s outside the caller's run_id", ErrForbidden, action)
+	}
+	return nil
+}
+
+// authorizerOrDefault returns authz, or ScopeAuthorizer when it is nil.
+func authorizerOrDefault(authz Authorizer) Authorizer {
+	if authz == nil {
+		return ScopeAuthorizer{}
+	}
+	return authz
+}
+
+// payloadOwner returns the scope a memory was stored with.
+func payloadOwner(payload map[string]interface{}) BaseRequestInfo {
+	owner := BaseRequestInfo{}
+	owner.UserID, _ = payload["user_id"].(string)
+	owner.AgentID, _ = payload["agent_id"].(string)
+	owner.RunID, _ = payload["run_id"].(string)
+	return owner
+}
+
+// replyError fills the Error and Code fields of a worker reply from err.
+func replyError(err error) (message string, code string) {
+	if errors.Is(err, ErrForbidden) {
+		return err.Error(), errorCodeForbidden
+	}
+	return err.Error(), ""
+}
+
+// responseError converts the Error and Code fields of a worker reply back into an error.
+func responseError(op string, message string, code string) error {
+	if code == errorCodeForbidden {
+		return fmt.Errorf("%s failed: %w", op, ErrForbidden)
+	}
+	return fmt.Errorf("%s failed: %s", op, message)
+}
@@ -22,11 +22,9 @@ type OpenAIClient interface {
 	ExtractGraphData(ctx context.Context, text string, prompt string) ([]Entity, []Relation, error)
 }
 
-// DgraphClient placeholder interface defines methods for interacting with a Dgraph-like graph database.
-// These are simplified for the shell implementation.
-type DgraphClient interface {
-	Mutate(ctx context.Context, data interface{}) error                              // Simplified
-	Query(ctx context.Context, query string, vars map[string]string) ([]byte, error) // Simplified
+// LLMClient placeholder interface defines a plain chat completion call against an LLM.
+type LLMClient interface {
+	Complete(ctx context.Context, systemPrompt string, userPrompt string) (string, error)
 }
 
 // Ensure vectorstores.VectorStore is available for QdrantWorker.
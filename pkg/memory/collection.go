@@ -0,0 +1,160 @@
+package memory
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/pnocera/gomem/pkg/vectorstores"
+)
+
+const defaultDistanceMetric = "cosine"
+
+// ErrEmbeddingDimensionMismatch is returned when a vector's length does not match the collection.
+var ErrEmbeddingDimensionMismatch = errors.New("embedding dimension mismatch")
+
+// collectionSettings holds the collection addressing shared by the vector store providers.
+type collectionSettings struct {
+	CollectionName string
+	Alias          string
+}
+
+// vectorCollectionSettings returns the collection name and alias from cfg.
+func vectorCollectionSettings(cfg *Config) (*collectionSettings, error) {
+	if cfg == nil || cfg.VectorStoreConfig == nil {
+		return nil, fmt.Errorf("vector_store_config is not set")
+	}
+	var settings collectionSettings
+	switch c := cfg.VectorStoreConfig.Config.(type) {
+	case *vectorstores.QdrantConfig:
+		settings = collectionSettings{CollectionName: c.CollectionName, Alias: c.Alias}
+	case *vectorstores.InMemoryConfig:
+		settings = collectionSettings{CollectionName: c.CollectionName, Alias: c.Alias}
+	default:
+		return nil, fmt.Errorf("vector_store_config.config has unsupported type %T", cfg.VectorStoreConfig.Config)
+	}
+	if settings.CollectionName == "" {
+		return nil, fmt.Errorf("vector_store_config.config.collection_name is empty")
+	}
+	return &settings, nil
+}
+
+// vectorCollectionName returns the name workers use to address the vector store:
+// the configured alias if there is one, otherwise the collection itself.
+func vectorCollectionName(cfg *Config) (string, error) {
+	settings, err := vectorCollectionSettings(cfg)
+	if err != nil {
+		return "", err
+	}
+	if settings.Alias != "" {
+		return settings.Alias, nil
+	}
+	return settings.CollectionName, nil
+}
+
+// BootstrapVectorStore prepares the configured collection for writes. Without an alias it
+// behaves like EnsureCollection. With an alias it validates the collection the alias points
+// at, or creates CollectionName and points the alias at it when the alias does not exist yet.
+func BootstrapVectorStore(vs vectorstores.VectorStore, cfg *Config) (*vectorstores.CollectionInfo, error) {
+	settings, err := vectorCollectionSettings(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if settings.Alias == "" {
+		return EnsureCollection(vs, settings.CollectionName, cfg.Embedder)
+	}
+	if vs == nil {
+		return nil, fmt.Errorf("VectorStore client is nil")
+	}
+
+	target, err := vs.ResolveAlias(settings.Alias)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve alias %s: %w", settings.Alias, err)
+	}
+	if target != "" {
+		return EnsureCollection(vs, target, cfg.Embedder)
+	}
+	info, err := EnsureCollection(vs, settings.CollectionName, cfg.Embedder)
+	if err != nil {
+		return nil, err
+	}
+	if err := vs.SwitchAlias(settings.Alias, settings.CollectionName); err != nil {
+		return nil, fmt.Errorf("failed to point alias %s at %s: %w", settings.Alias, settings.CollectionName, err)
+	}
+	return info, nil
+}
+
+// EnsureCollection creates the named collection with the embedder's dimension and
+// distance metric if it does not exist, and otherwise verifies that the existing
+// collection was created for vectors of the same size. It returns the collection info.
+func EnsureCollection(vs vectorstores.VectorStore, name string, embedder *EmbedderConfig) (*vectorstores.CollectionInfo, error) {
+	if vs == nil {
+		return nil, fmt.Errorf("VectorStore client is nil")
+	}
+	if embedder == nil {
+		return nil, fmt.Errorf("embedder config is required to bootstrap collection %s", name)
+	}
+	metric := embedder.DistanceMetric
+	if metric == "" {
+		metric = defaultDistanceMetric
+	}
+
+	collections, err := vs.ListCollections()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list collections: %w", err)
+	}
+	exists := false
+	for _, c := range collections {
+		if c == name {
+			exists = true
+			break
+		}
+	}
+	if !exists {
+		if len(embedder.NamedVectors) > 0 {
+			params := make(map[string]vectorstores.VectorParams, len(embedder.NamedVectors))
+			for _, n := range embedder.NamedVectors {
+				params[n] = vectorstores.VectorParams{Size: embedder.Dimensions, DistanceMetric: metric}
+			}
+			err = vs.CreateNamedCollection(name, params)
+		} else {
+			err = vs.CreateCollection(name, embedder.Dimensions, metric)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to create collection %s: %w", name, err)
+		}
+	}
+
+	info, err := vs.CollectionInfo(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get info for collection %s: %w", name, err)
+	}
+	if len(embedder.NamedVectors) > 0 {
+		for _, n := range embedder.NamedVectors {
+			params, ok := info.NamedVectors[n]
+			if !ok {
+				return nil, fmt.Errorf("collection %s has no named vector %q; create a new collection or migrate", name, n)
+			}
+			if params.Size != embedder.Dimensions {
+				return nil, fmt.Errorf("%w: named vector %q of collection %s stores %d dimensions but embedder %s produces %d",
+					ErrEmbeddingDimensionMismatch, n, name, params.Size, embedder.Model, embedder.Dimensions)
+			}
+		}
+		return info, nil
+	}
+	if info.VectorSize != embedder.Dimensions {
+		return nil, fmt.Errorf("%w: collection %s stores %d-dimensional vectors but embedder %s produces %d; migrate the collection or restore the previous embedding model",
+			ErrEmbeddingDimensionMismatch, name, info.VectorSize, embedder.Model, embedder.Dimensions)
+	}
+	if info.DistanceMetric != "" && info.DistanceMetric != metric {
+		return nil, fmt.Errorf("collection %s uses distance metric %q but embedder is configured for %q", name, info.DistanceMetric, metric)
+	}
+	return info, nil
+}
+
+// checkEmbeddingDimension rejects embeddings whose length differs from want. A want of 0 disables the check.
+func checkEmbeddingDimension(embedding []float32, want int) error {
+	if want > 0 && len(embedding) != want {
+		return fmt.Errorf("%w: got %d dimensions, collection expects %d", ErrEmbeddingDimensionMismatch, len(embedding), want)
+	}
+	return nil
+}
@@ -0,0 +1,536 @@
+package memory
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pnocera/gomem/pkg/graphs"
+	"github.com/pnocera/gomem/pkg/vectorstores"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultCommunityRefreshSeconds = 600
+	defaultMinCommunitySize        = 3
+	defaultMinEntityDegree         = 5
+	defaultCommunityIterations     = 20
+	defaultMaxPromptRelations      = 200
+
+	// maxCommunityRelations bounds the relations read from one scope per refresh.
+	maxCommunityRelations = 100000
+
+	// Values of the memory_type payload field of stored summaries.
+	MemoryTypeCommunitySummary = "community_summary"
+	MemoryTypeEntitySummary    = "entity_summary"
+
+	eventSummaryUpserted = "GRAPH_SUMMARY_UPSERT"
+	eventSummaryDeleted  = "GRAPH_SUMMARY_DELETE"
+)
+
+// communitySummarySystemPrompt asks for a summary of a cluster of related entities.
+const communitySummarySystemPrompt = `You summarize part of a user's knowledge graph for a memory retrieval system.
+You will be given the facts of one community of closely related entities, one "source -- relationship -- destination" triple per line.
+Write a concise summary in plain prose of what the community is about: who or what is involved, how they are related and the notable facts.
+Only use the given facts. Respond with the summary only.`
+
+// entitySummarySystemPrompt asks for a summary of everything known about one entity.
+const entitySummarySystemPrompt = `You summarize part of a user's knowledge graph for a memory retrieval system.
+You will be given an entity and its facts, one "source -- relationship -- destination" triple per line.
+Write a concise profile of the entity in plain prose covering the notable facts.
+Only use the given facts. Respond with the summary only.`
+
+// CommunityRefreshResult reports what one refresh of a scope changed.
+type CommunityRefreshResult struct {
+	Communities int `json:"communities"` // Communities large enough to be summarized
+	Entities    int `json:"entities"`    // High-degree entities summarized
+	Written     int `json:"written"`     // Summaries created or rewritten
+	Unchanged   int `json:"unchanged"`   // Summaries whose subgraph fingerprint did not change
+	Deleted     int `json:"deleted"`     // Summaries of communities and entities that no longer qualify
+}
+
+// graphSummary is one community or entity summary to keep in the vector store.
+type graphSummary struct {
+	ID          string
+	Kind        string // MemoryTypeCommunitySummary or MemoryTypeEntitySummary
+	Key         string // Smallest member of the community, or the entity name
+	Entities    []string
+	Relations   []graphs.Relation
+	Fingerprint string
+}
+
+// CommunityWorker periodically clusters the entities of each changed graph scope into
+// communities with label propagation, asks the LLM for a summary of every community and
+// every high-degree entity, and stores the summaries as memories of the scope so that search
+// finds them. A summary is only rewritten when the fingerprint of its subgraph changed, and
+// summaries of communities that dissolved are deleted. Scopes are marked as changed by the
+// graph store add messages and by MarkDirty; wrap the graph store written by the other
+// components with graphs.NewObservedStore(store, w.MarkDirty) so that closes, deletions,
+// merges and imports mark their scopes too.
+type CommunityWorker struct {
+	nc       NATSClient
+	cfg      *Config
+	llm      LLMClient
+	embedder OpenAIClient
+	graph    graphs.GraphStore
+	vs       vectorstores.VectorStore
+	lexical  LexicalIndex // Optional
+
+	mu    sync.Mutex
+	dirty map[string]graphs.Filter
+	known map[string]graphs.Filter // Every scope marked so far, to find those a write overlaps
+}
+
+// NewCommunityWorker creates a new CommunityWorker. lexical may be nil when hybrid search is not used.
+func NewCommunityWorker(nc NATSClient, cfg *Config, llm LLMClient, embedder OpenAIClient, graph graphs.GraphStore, vs vectorstores.VectorStore, lexical LexicalIndex) *CommunityWorker {
+	return &CommunityWorker{
+		nc:       nc,
+		cfg:      cfg,
+		llm:      llm,
+		embedder: embedder,
+		graph:    graph,
+		vs:       vs,
+		lexical:  lexical,
+		dirty:    make(map[string]graphs.Filter),
+		known:    make(map[string]graphs.Filter),
+	}
+}
+
+// Start listens for graph changes and refreshes the changed scopes on every tick.
+func (w *CommunityWorker) Start(ctx context.Context) error {
+	if !w.cfg.EnableGraphStore {
+		fmt.Println("CommunityWorker: Graph store is disabled in config, worker will not start.")
+		<-ctx.Done()
+		return nil
+	}
+	if w.graph == nil || w.vs == nil || w.llm == nil || w.embedder == nil {
+		fmt.Println("CommunityWorker: Graph store, vector store, LLM or embedder is nil, worker will not start.")
+		<-ctx.Done()
+		return nil
+	}
+
+	fmt.Printf("CommunityWorker started, listening on topic: %s\n", w.cfg.TopicMemoryGraphStoreAdd)
+	// In a real implementation, w.nc.Subscribe would be called here.
+	// The handler would be w.handleGraphStoreAddMessage.
+	go func() {
+		// Simulated subscription loop
+	}()
+
+	ticker := time.NewTicker(w.refreshInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Println("CommunityWorker shutting down.")
+			return nil
+		case <-ticker.C:
+			w.refreshDirty(ctx)
+		}
+	}
+}
+
+// handleGraphStoreAddMessage marks the scope of a graph store add message for refresh.
+func (w *CommunityWorker) handleGraphStoreAddMessage(payload []byte) error {
+	var graphData GraphStoreStorageData
+	if err := json.Unmarshal(payload, &graphData); err != nil {
+		fmt.Printf("CommunityWorker: Error unmarshalling GraphStoreStorageData: %v\n", err)
+		return fmt.Errorf("error unmarshalling GraphStoreStorageData: %w", err)
+	}
+	w.MarkDirty(graphs.Filter{UserID: graphData.UserID, AgentID: graphData.AgentID, RunID: graphData.RunID})
+	return nil
+}
+
+// MarkDirty schedules the scope for the next refresh, along with the known scopes whose
+// graph overlaps it: a write to a user's graph changes the graphs of the user's agents and
+// runs, and the other way round.
+func (w *CommunityWorker) MarkDirty(filter graphs.Filter) {
+	if filter.UserID == "" {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.known[summaryScope(filter)] = filter
+	for key, scope := range w.known {
+		if scopesOverlap(scope, filter) {
+			w.dirty[key] = scope
+		}
+	}
+}
+
+// scopesOverlap reports whether a relation can be in the graphs of both a and b.
+func scopesOverlap(a, b graphs.Filter) bool {
+	return a.UserID == b.UserID &&
+		(a.AgentID == "" || b.AgentID == "" || a.AgentID == b.AgentID) &&
+		(a.RunID == "" || b.RunID == "" || a.RunID == b.RunID)
+}
+
+// refreshDirty refreshes every scope marked since the last tick. Failed scopes are marked again.
+func (w *CommunityWorker) refreshDirty(ctx context.Context) {
+	w.mu.Lock()
+	scopes := w.dirty
+	w.dirty = make(map[string]graphs.Filter)
+	w.mu.Unlock()
+
+	for _, filter := range scopes {
+		result, err := w.Refresh(ctx, filter)
+		if err != nil {
+			fmt.Printf("CommunityWorker: Error refreshing summaries of user %s: %v\n", filter.UserID, err)
+			w.MarkDirty(filter)
+			continue
+		}
+		fmt.Printf("CommunityWorker: Refreshed user %s: %d communities, %d entities, %d written, %d unchanged, %d deleted\n",
+			filter.UserID, result.Communities, result.Entities, result.Written, result.Unchanged, result.Deleted)
+	}
+}
+
+// Refresh brings the summaries of the filter's scope in line with its current graph.
+func (w *CommunityWorker) Refresh(ctx context.Context, filter graphs.Filter) (*CommunityRefreshResult, error) {
+	if w.graph == nil || w.vs == nil || w.llm == nil || w.embedder == nil {
+		return nil, fmt.Errorf("community summaries require a graph store, vector store, LLM and embedder")
+	}
+	collectionName, err := vectorCollectionName(w.cfg)
+	if err != nil {
+		return nil, err
+	}
+	relations, err := w.graph.GetAll(ctx, filter, graphs.QueryOptions{Limit: maxCommunityRelations})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read graph: %w", err)
+	}
+
+	result := &CommunityRefreshResult{}
+	summaries := w.plan(filter, relations, result)
+	keep := make(map[string]bool, len(summaries))
+	for _, s := range summaries {
+		keep[s.ID] = true
+		existing, err := w.vs.GetVector(collectionName, s.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read summary %s: %w", s.ID, err)
+		}
+		if existing != nil && existing.Payload["fingerprint"] == s.Fingerprint {
+			result.Unchanged++
+			continue
+		}
+		if err := w.write(ctx, collectionName, filter, s); err != nil {
+			return nil, err
+		}
+		result.Written++
+	}
+
+	stale, err := w.staleSummaries(collectionName, filter, keep)
+	if err != nil {
+		return nil, err
+	}
+	if len(stale) > 0 {
+		if err := w.vs.DeleteVectors(collectionName, stale); err != nil {
+			return nil, fmt.Errorf("failed to delete stale summaries: %w", err)
+		}
+		for _, id := range stale {
+			if w.lexical != nil {
+				if err := w.lexical.Remove(ctx, id); err != nil {
+					fmt.Printf("CommunityWorker: Error removing summary %s from lexical index: %v\n", id, err)
+				}
+			}
+			w.publishHistoryEvent(filter, id, eventSummaryDeleted, map[string]interface{}{"collection_name": collectionName})
+		}
+		result.Deleted = len(stale)
+	}
+	return result, nil
+}
+
+// plan returns the summaries the scope should have: one per community of at least
+// MinCommunitySize entities and one per entity with at least MinEntityDegree relations.
+func (w *CommunityWorker) plan(filter graphs.Filter, relations []graphs.Relation, result *CommunityRefreshResult) []graphSummary {
+	scope := summaryScope(filter)
+	var summaries []graphSummary
+	for _, members := range detectCommunities(relations, w.settings().MaxIterations) {
+		if len(members) < w.settings().MinCommunitySize {
+			continue
+		}
+		in := make(map[string]bool, len(members))
+		for _, m := range members {
+			in[m] = true
+		}
+		var rels []graphs.Relation
+		for _, r := range relations {
+			if in[r.Source] && in[r.Destination] {
+				rels = append(rels, r)
+			}
+		}
+		summaries = append(summaries, newGraphSummary(scope, MemoryTypeCommunitySummary, members[0], members, rels))
+		result.Communities++
+	}
+
+	byEntity := make(map[string][]graphs.Relation)
+	for _, r := range relations {
+		byEntity[r.Source] = append(byEntity[r.Source], r)
+		if r.Destination != r.Source {
+			byEntity[r.Destination] = append(byEntity[r.Destination], r)
+		}
+	}
+	entities := make([]string, 0, len(byEntity))
+	for name, rels := range byEntity {
+		if len(rels) >= w.settings().MinEntityDegree {
+			entities = append(entities, name)
+		}
+	}
+	sort.Strings(entities)
+	for _, name := range entities {
+		summaries = append(summaries, newGraphSummary(scope, MemoryTypeEntitySummary, name, []string{name}, byEntity[name]))
+		result.Entities++
+	}
+	return summaries
+}
+
+// write asks the LLM for the summary, embeds it and stores it under its stable ID.
+func (w *CommunityWorker) write(ctx context.Context, collectionName string, filter graphs.Filter, s graphSummary) error {
+	lines := make([]string, len(s.Relations))
+	for i, r := range s.Relations {
+		lines[i] = fmt.Sprintf("%s -- %s -- %s", r.Source, r.Relationship, r.Destination)
+	}
+	sort.Strings(lines)
+	if limit := w.settings().MaxPromptRelations; len(lines) > limit {
+		lines = lines[:limit]
+	}
+	systemPrompt := communitySummarySystemPrompt
+	userPrompt := fmt.Sprintf("Entities: %s\n\nFacts:\n%s", strings.Join(s.Entities, ", "), strings.Join(lines, "\n"))
+	if s.Kind == MemoryTypeEntitySummary {
+		systemPrompt = entitySummarySystemPrompt
+		userPrompt = fmt.Sprintf("Entity: %s\n\nFacts:\n%s", s.Key, strings.Join(lines, "\n"))
+	}
+	text, err := w.llm.Complete(ctx, systemPrompt, userPrompt)
+	if err != nil {
+		return fmt.Errorf("failed to summarize %s %s: %w", s.Kind, s.Key, err)
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return fmt.Errorf("LLM returned an empty summary for %s %s", s.Kind, s.Key)
+	}
+
+	input := vectorstores.VectorInput{
+		ID: s.ID,
+		Payload: map[string]interface{}{
+			"text":          text,
+			"user_id":       filter.UserID,
+			"agent_id":      filter.AgentID,
+			"run_id":        filter.RunID,
+			"timestamp":     time.Now().UTC().Format(time.RFC3339Nano),
+			"hash":          ContentHash(text),
+			"memory_type":   s.Kind,
+			"summary_scope": summaryScope(filter),
+			"summary_key":   s.Key,
+			"entities":      s.Entities,
+			"fingerprint":   s.Fingerprint,
+		},
+	}
+	if names := configuredVectorNames(w.cfg); len(names) > 0 {
+		input.Vectors, err = embedNamedVectors(ctx, w.embedder, names, text, text)
+	} else {
+		input.Embedding, err = w.embedder.GetEmbedding(ctx, text)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to embed summary of %s %s: %w", s.Kind, s.Key, err)
+	}
+	if err := w.vs.InsertVectors(collectionName, []vectorstores.VectorInput{input}); err != nil {
+		return fmt.Errorf("failed to store summary of %s %s: %w", s.Kind, s.Key, err)
+	}
+	if w.lexical != nil {
+		doc := LexicalDocument{ID: s.ID, Text: text, UserID: filter.UserID, Metadata: input.Payload}
+		if err := w.lexical.Index(ctx, doc); err != nil {
+			fmt.Printf("CommunityWorker: Error indexing summary %s in lexical index: %v\n", s.ID, err)
+		}
+	}
+	w.publishHistoryEvent(filter, s.ID, eventSummaryUpserted, map[string]interface{}{
+		"collection_name": collectionName,
+		"memory_type":     s.Kind,
+		"summary_key":     s.Key,
+		"fingerprint":     s.Fingerprint,
+		"relations_count": len(s.Relations),
+	})
+	return nil
+}
+
+// staleSummaries returns the IDs of the scope's stored summaries that are not in keep.
+func (w *CommunityWorker) staleSummaries(collectionName string, filter graphs.Filter, keep map[string]bool) ([]string, error) {
+	const pageSize = 256
+	query := &vectorstores.QueryFilter{
+		UserID:   filter.UserID,
+		Metadata: map[string]interface{}{"summary_scope": summaryScope(filter)},
+	}
+	var stale []string
+	for offset := uint64(0); ; offset += pageSize {
+		page, err := w.vs.ListVectors(collectionName, pageSize, offset, query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list summaries: %w", err)
+		}
+		for _, p := range page {
+			if !keep[p.ID] {
+				stale = append(stale, p.ID)
+			}
+		}
+		if len(page) < pageSize {
+			return stale, nil
+		}
+	}
+}
+
+// settings returns the CommunityConfig with defaults applied.
+func (w *CommunityWorker) settings() CommunityConfig {
+	var c CommunityConfig
+	if w.cfg.Communities != nil {
+		c = *w.cfg.Communities
+	}
+	if c.RefreshSeconds <= 0 {
+		c.RefreshSeconds = defaultCommunityRefreshSeconds
+	}
+	if c.MinCommunitySize <= 0 {
+		c.MinCommunitySize = defaultMinCommunitySize
+	}
+	if c.MinEntityDegree <= 0 {
+		c.MinEntityDegree = defaultMinEntityDegree
+	}
+	if c.MaxIterations <= 0 {
+		c.MaxIterations = defaultCommunityIterations
+	}
+	if c.MaxPromptRelations <= 0 {
+		c.MaxPromptRelations = defaultMaxPromptRelations
+	}
+	return c
+}
+
+func (w *CommunityWorker) refreshInterval() time.Duration {
+	return time.Duration(w.settings().RefreshSeconds) * time.Second
+}
+
+// publishHistoryEvent sends a MemoryEvent for a summary to TopicMemoryHistoryLog. Failures are logged, not returned.
+func (w *CommunityWorker) publishHistoryEvent(filter graphs.Filter, summaryID string, eventType string, details map[string]interface{}) {
+	eventData, err := json.Marshal(MemoryEvent{
+		EventID:   uuid.New().String(),
+		MemoryID:  summaryID,
+		EventType: eventType,
+		Timestamp: time.Now().UTC(),
+		UserID:    filter.UserID,
+		AgentID:   filter.AgentID,
+		RunID:     filter.RunID,
+		Details:   details,
+	})
+	if err != nil {
+		fmt.Printf("CommunityWorker: Error marshalling MemoryEvent: %v\n", err)
+		return
+	}
+	if w.nc == nil {
+		fmt.Printf("NATS_PUBLISH (CommunityWorker - nc is nil): Topic=%s, Payload=%s\n", w.cfg.TopicMemoryHistoryLog, string(eventData))
+		return
+	}
+	if err := w.nc.Publish(context.Background(), w.cfg.TopicMemoryHistoryLog, eventData); err != nil {
+		fmt.Printf("CommunityWorker: Error publishing MemoryEvent to NATS topic %s: %v\n", w.cfg.TopicMemoryHistoryLog, err)
+	}
+}
+
+// newGraphSummary builds the summary of members, whose ID is stable for the scope, kind and key.
+func newGraphSummary(scope string, kind string, key string, members []string, relations []graphs.Relation) graphSummary {
+	return graphSummary{
+		ID:          uuid.NewSHA1(uuid.NameSpaceURL, []byte("gomem:"+kind+":"+scope+":"+key)).String(),
+		Kind:        kind,
+		Key:         key,
+		Entities:    members,
+		Relations:   relations,
+		Fingerprint: subgraphFingerprint(relations),
+	}
+}
+
+// subgraphFingerprint hashes the triples and endpoint types of relations, in any order.
+func subgraphFingerprint(relations []graphs.Relation) string {
+	lines := make([]string, len(relations))
+	for i, r := range relations {
+		lines[i] = strings.Join([]string{r.Source, r.SourceType, r.Relationship, r.Destination, r.DestinationType}, "\x00")
+	}
+	sort.Strings(lines)
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// summaryScope identifies a graph scope in the summary_scope payload field.
+func summaryScope(filter graphs.Filter) string {
+	return filter.UserID + "/" + filter.AgentID + "/" + filter.RunID
+}
+
+// detectCommunities clusters the entities of relations with label propagation and returns
+// each community as its sorted members, ordered by their first member. Nodes are visited in
+// name order and ties are broken by tieRank, so the result is deterministic.
+func detectCommunities(relations []graphs.Relation, maxIterations int) [][]string {
+	weights := make(map[string]map[string]int)
+	link := func(a, b string) {
+		if weights[a] == nil {
+			weights[a] = make(map[string]int)
+		}
+		weights[a][b]++
+	}
+	for _, r := range relations {
+		if r.Source == r.Destination {
+			link(r.Source, r.Source)
+			continue
+		}
+		link(r.Source, r.Destination)
+		link(r.Destination, r.Source)
+	}
+	nodes := make([]string, 0, len(weights))
+	labels := make(map[string]string, len(weights))
+	for n := range weights {
+		nodes = append(nodes, n)
+		labels[n] = n
+	}
+	sort.Strings(nodes)
+
+	for i := 0; i < maxIterations; i++ {
+		changed := false
+		for _, n := range nodes {
+			counts := make(map[string]int)
+			for neighbor, weight := range weights[n] {
+				if neighbor != n {
+					counts[labels[neighbor]] += weight
+				}
+			}
+			// Keep the current label while it is among the most frequent ones.
+			best, bestCount := labels[n], counts[labels[n]]
+			for label, count := range counts {
+				if count > bestCount || (count == bestCount && counts[labels[n]] < count && tieRank(n, label) < tieRank(n, best)) {
+					best, bestCount = label, count
+				}
+			}
+			if best != labels[n] {
+				labels[n] = best
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+
+	groups := make(map[string][]string)
+	for _, n := range nodes {
+		groups[labels[n]] = append(groups[labels[n]], n)
+	}
+	communities := make([][]string, 0, len(groups))
+	for _, members := range groups {
+		communities = append(communities, members) // nodes were sorted, so members are too
+	}
+	sort.Slice(communities, func(i, j int) bool { return communities[i][0] < communities[j][0] })
+	return communities
+}
+
+// tieRank orders the labels tied for a node. Hashing instead of comparing names keeps
+// alphabetically small labels from spreading across weakly connected parts of the graph.
+func tieRank(node string, label string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(node + "\x00" + label))
+	return h.Sum64()
+}
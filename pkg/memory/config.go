@@ -1,6 +1,7 @@
 package memory
 
 import (
+	"encoding/json"
 	"fmt"
 
 	"github.com/pnocera/gomem/pkg/graphs"
@@ -30,13 +31,148 @@ type Config struct {
 	EnableGraphStore bool `json:"enable_graph_store"`
 	EnableInfer      bool `json:"enable_infer"` // default:"true" is conceptual, Go uses zero value (false)
 
+	// DuplicatePolicy controls what the QdrantWorker does with a memory whose content hash
+	// already exists with the same user, agent and run: "skip" (default) drops it, "merge" folds
+	// its metadata, except the owner keys, into the existing memory and "allow" stores it anyway.
+	// Memories without a user, agent or run are never deduplicated.
+	DuplicatePolicy string `json:"duplicate_policy,omitempty" validate:"omitempty,oneof=skip merge allow"`
+
 	GraphConfig       *graphs.GraphStoreConfig        `json:"graph_config,omitempty"`
 	VectorStoreConfig *vectorstores.VectorStoreConfig `json:"vector_store_config,omitempty"`
+	Embedder          *EmbedderConfig                 `json:"embedder,omitempty"`    // Required for collection bootstrap
+	Communities       *CommunityConfig                `json:"communities,omitempty"` // Enables the CommunityWorker
+	HistoryStore      *HistoryStoreConfig             `json:"history_store,omitempty"`
 
 	CustomFactExtractionPrompt string `json:"custom_fact_extraction_prompt,omitempty"`
 	CustomUpdateMemoryPrompt   string `json:"custom_update_memory_prompt,omitempty"`
 }
 
+// EmbedderConfig describes the embedding model whose vectors are stored in the vector store.
+type EmbedderConfig struct {
+	Model          string `json:"model" validate:"required"`
+	Dimensions     int    `json:"dimensions" validate:"required,gt=0"`
+	DistanceMetric string `json:"distance_metric,omitempty" validate:"omitempty,oneof=cosine dot euclid"` // Defaults to "cosine"
+	// NamedVectors, when set, stores one vector per name ("fact", "raw_text") for every memory
+	// instead of a single unnamed vector. The first name is the default search target.
+	NamedVectors []string `json:"named_vectors,omitempty" validate:"omitempty,unique,dive,oneof=fact raw_text"`
+}
+
+// Validate validates the EmbedderConfig struct.
+func (c *EmbedderConfig) Validate() error {
+	validate := validator.New()
+	return validate.Struct(c)
+}
+
+// CommunityConfig tunes the CommunityWorker. Zero values select the defaults.
+type CommunityConfig struct {
+	RefreshSeconds     int `json:"refresh_seconds,omitempty" validate:"omitempty,gte=1"`      // Defaults to 600
+	MinCommunitySize   int `json:"min_community_size,omitempty" validate:"omitempty,gte=2"`   // Defaults to 3 entities
+	MinEntityDegree    int `json:"min_entity_degree,omitempty" validate:"omitempty,gte=1"`    // Defaults to 5 relations
+	MaxIterations      int `json:"max_iterations,omitempty" validate:"omitempty,gte=1"`       // Label propagation rounds, defaults to 20
+	MaxPromptRelations int `json:"max_prompt_relations,omitempty" validate:"omitempty,gte=1"` // Defaults to 200
+}
+
+// Validate validates the CommunityConfig struct.
+func (c *CommunityConfig) Validate() error {
+	validate := validator.New()
+	return validate.Struct(c)
+}
+
+// HistoryStoreConfig selects the HistoryStore built by NewHistoryStore.
+type HistoryStoreConfig struct {
+	Provider string      `json:"provider" validate:"required,oneof=sqlite postgres"`
+	Config   interface{} `json:"config" validate:"required"` // *SQLiteHistoryConfig or *PostgresHistoryConfig
+}
+
+// Validate validates the HistoryStoreConfig struct and its provider config.
+func (c *HistoryStoreConfig) Validate() error {
+	validate := validator.New()
+	if err := validate.Struct(c); err != nil {
+		return err
+	}
+	switch c.Provider {
+	case "sqlite":
+		sqliteCfg, ok := c.Config.(*SQLiteHistoryConfig)
+		if !ok {
+			return fmt.Errorf("config for provider 'sqlite' must be of type *SQLiteHistoryConfig, got %T", c.Config)
+		}
+		return sqliteCfg.Validate()
+	case "postgres":
+		postgresCfg, ok := c.Config.(*PostgresHistoryConfig)
+		if !ok {
+			return fmt.Errorf("config for provider 'postgres' must be of type *PostgresHistoryConfig, got %T", c.Config)
+		}
+		return postgresCfg.Validate()
+	default:
+		return fmt.Errorf("provider '%s' is valid but has an unexpected config type: %T", c.Provider, c.Config)
+	}
+}
+
+// UnmarshalJSON custom unmarshaler for HistoryStoreConfig.
+func (c *HistoryStoreConfig) UnmarshalJSON(data []byte) error {
+	type Alias HistoryStoreConfig
+	aux := &struct {
+		Config json.RawMessage `json:"config"`
+		*Alias
+	}{
+		Alias: (*Alias)(c),
+	}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	switch c.Provider {
+	case "sqlite":
+		var sqliteCfg SQLiteHistoryConfig
+		if err := json.Unmarshal(aux.Config, &sqliteCfg); err != nil {
+			return fmt.Errorf("failed to unmarshal sqlite history config: %w", err)
+		}
+		c.Config = &sqliteCfg
+	case "postgres":
+		var postgresCfg PostgresHistoryConfig
+		if err := json.Unmarshal(aux.Config, &postgresCfg); err != nil {
+			return fmt.Errorf("failed to unmarshal postgres history config: %w", err)
+		}
+		c.Config = &postgresCfg
+	default:
+		return fmt.Errorf("unknown history store provider: %s", c.Provider)
+	}
+
+	return nil
+}
+
+// SQLiteHistoryConfig configures a SQLiteHistoryStore.
+type SQLiteHistoryConfig struct {
+	Path string `json:"path" validate:"required"` // SQLite data source name
+}
+
+// Validate validates the SQLiteHistoryConfig struct.
+func (c *SQLiteHistoryConfig) Validate() error {
+	validate := validator.New()
+	return validate.Struct(c)
+}
+
+// PostgresHistoryConfig configures a PostgresHistoryStore.
+type PostgresHistoryConfig struct {
+	DSN          string `json:"dsn" validate:"required"`
+	DriverName   string `json:"driver_name,omitempty"`                               // database/sql driver, defaults to "pgx"; the binary must import any other
+	MaxOpenConns int    `json:"max_open_conns,omitempty" validate:"omitempty,gte=1"` // Unlimited when 0
+	BatchSize    int    `json:"batch_size,omitempty" validate:"omitempty,gte=1"`     // Events per INSERT, defaults to 100, at most 5461
+}
+
+// Validate validates the PostgresHistoryConfig struct.
+func (c *PostgresHistoryConfig) Validate() error {
+	validate := validator.New()
+	if err := validate.Struct(c); err != nil {
+		return err
+	}
+	if c.BatchSize > maxPostgresHistoryBatch {
+		return fmt.Errorf("batch_size %d exceeds %d, the most events one INSERT can bind", c.BatchSize, maxPostgresHistoryBatch)
+	}
+	return nil
+}
+
 // Validate validates the Config struct.
 func (c *Config) Validate() error {
 	validate := validator.New()
@@ -54,5 +190,15 @@ func (c *Config) Validate() error {
 			return fmt.Errorf("vector_store_config validation failed: %w", err)
 		}
 	}
+	if c.Communities != nil {
+		if err := c.Communities.Validate(); err != nil {
+			return fmt.Errorf("communities validation failed: %w", err)
+		}
+	}
+	if c.HistoryStore != nil {
+		if err := c.HistoryStore.Validate(); err != nil {
+			return fmt.Errorf("history_store validation failed: %w", err)
+		}
+	}
 	return nil
 }
@@ -0,0 +1,124 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pnocera/gomem/pkg/vectorstores"
+
+	"github.com/google/uuid"
+)
+
+// DeleteWorker answers delete requests for a single memory, removing it from the vector
+// store and the lexical index.
+type DeleteWorker struct {
+	nc      NATSClient
+	cfg     *Config
+	vs      vectorstores.VectorStore
+	lexical LexicalIndex // Optional keyword index kept in step with the vector store
+	authz   Authorizer
+}
+
+// NewDeleteWorker creates a new DeleteWorker. lexical may be nil when hybrid search is
+// not used; a nil authz uses ScopeAuthorizer.
+func NewDeleteWorker(nc NATSClient, cfg *Config, vs vectorstores.VectorStore, lexical LexicalIndex, authz Authorizer) *DeleteWorker {
+	return &DeleteWorker{
+		nc:      nc,
+		cfg:     cfg,
+		vs:      vs,
+		lexical: lexical,
+		authz:   authorizerOrDefault(authz),
+	}
+}
+
+// Start begins the worker's NATS subscription.
+func (w *DeleteWorker) Start(ctx context.Context) error {
+	if w.nc == nil {
+		fmt.Println("DeleteWorker: NATS client is nil, worker will not start.")
+		<-ctx.Done()
+		return nil
+	}
+	if w.vs == nil {
+		fmt.Println("DeleteWorker: VectorStore client (vs) is nil, worker will not start effectively.")
+	}
+
+	fmt.Printf("DeleteWorker started, listening on topic: %s\n", w.cfg.TopicMemoryDelete)
+	// In a real implementation, w.nc.Subscribe would be called here.
+	// The handler would be w.handleDeleteMessage, with its return value sent as the reply.
+	go func() {
+		// Simulated subscription loop
+	}()
+
+	<-ctx.Done()
+	fmt.Println("DeleteWorker shutting down.")
+	return nil
+}
+
+// handleDeleteMessage processes a GetRequestData and returns the marshalled MemoryWriteResponse.
+func (w *DeleteWorker) handleDeleteMessage(payload []byte) ([]byte, error) {
+	fmt.Printf("DeleteWorker received payload: %s\n", string(payload))
+
+	var resp MemoryWriteResponse
+	var req GetRequestData
+	if err := json.Unmarshal(payload, &req); err != nil {
+		fmt.Printf("DeleteWorker: Error unmarshalling GetRequestData: %v\n", err)
+		resp.Error = fmt.Sprintf("error unmarshalling GetRequestData: %v", err)
+	} else if err := w.delete(context.Background(), &req); err != nil {
+		fmt.Printf("DeleteWorker: Error deleting MemoryID %s: %v\n", req.MemoryID, err)
+		resp.Error, resp.Code = replyError(err)
+	}
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling MemoryWriteResponse: %w", err)
+	}
+	return data, nil
+}
+
+// delete authorizes req and removes its memory.
+func (w *DeleteWorker) delete(ctx context.Context, req *GetRequestData) error {
+	if w.vs == nil {
+		return fmt.Errorf("VectorStore client is nil")
+	}
+	collectionName, err := vectorCollectionName(w.cfg)
+	if err != nil {
+		return err
+	}
+	stored, err := w.vs.GetVector(collectionName, req.MemoryID)
+	if err != nil {
+		return fmt.Errorf("error getting memory %s: %w", req.MemoryID, err)
+	}
+	if stored == nil {
+		return fmt.Errorf("memory %s not found", req.MemoryID)
+	}
+	owner := payloadOwner(stored.Payload)
+	if err := w.authz.Authorize(ctx, req.BaseRequestInfo, owner, ActionDelete); err != nil {
+		return err
+	}
+
+	if err := w.vs.DeleteVectors(collectionName, []string{req.MemoryID}); err != nil {
+		return fmt.Errorf("error deleting memory %s: %w", req.MemoryID, err)
+	}
+	if w.lexical != nil {
+		if err := w.lexical.Remove(ctx, req.MemoryID); err != nil {
+			fmt.Printf("DeleteWorker: Error removing MemoryID %s from lexical index: %v\n", req.MemoryID, err)
+		}
+	}
+
+	oldText, _ := stored.Payload["text"].(string)
+	publishMemoryHistoryEvent(w.nc, w.cfg, "DeleteWorker", MemoryEvent{
+		EventID:   uuid.New().String(),
+		MemoryID:  req.MemoryID,
+		EventType: "MEMORY_DELETED",
+		Timestamp: time.Now().UTC(),
+		UserID:    owner.UserID,
+		AgentID:   owner.AgentID,
+		RunID:     owner.RunID,
+		ActorID:   req.ActorID,
+		OldMemory: oldText,
+		Details:   map[string]interface{}{"collection_name": collectionName},
+	})
+	return nil
+}
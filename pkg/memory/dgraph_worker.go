@@ -3,7 +3,7 @@ package memory
 import (
 	"context"
 	"encoding/json"
-	"fmt" // Assuming graphs config is needed for prompts
+	"fmt"
 	"time"
 
 	"github.com/pnocera/gomem/pkg/graphs"
@@ -11,22 +11,45 @@ import (
 	"github.com/google/uuid"
 )
 
-// DgraphWorker handles storing graph data in Dgraph (or a similar graph DB).
+// History events published for extractions held back by the ontology's quarantine mode.
+const (
+	eventRelationQuarantined = "RELATION_QUARANTINED"
+	eventEntityQuarantined   = "ENTITY_QUARANTINED"
+)
+
+// DgraphWorker handles storing graph data in the configured graph store.
 type DgraphWorker struct {
 	nc       NATSClient
 	cfg      *Config
-	openai   OpenAIClient
-	dg       DgraphClient             // Dgraph client interface
+	store    graphs.GraphStore
+	pipeline *graphs.ExtractionPipeline
+	ontology *graphs.Ontology         // Enforced on pre-extracted relations; the pipeline enforces its own
 	graphCfg *graphs.GraphStoreConfig // For graph-specific prompts or settings
 }
 
-// NewDgraphWorker creates a new DgraphWorker.
-func NewDgraphWorker(nc NATSClient, cfg *Config, openai OpenAIClient, dg DgraphClient, graphCfg *graphs.GraphStoreConfig) *DgraphWorker {
+// NewDgraphWorker creates a new DgraphWorker. Text is turned into relations by a
+// graphs.ExtractionPipeline driven by llm. When graphCfg enables entity resolution,
+// extracted entities are matched to existing nodes using embedder, which may be nil otherwise.
+// Relations that do not fit graphCfg's ontology are normalized or dropped; quarantined ones
+// are published as RELATION_QUARANTINED or ENTITY_QUARANTINED history events for review.
+func NewDgraphWorker(nc NATSClient, cfg *Config, llm graphs.ToolCallingLLM, embedder graphs.Embedder, store graphs.GraphStore, graphCfg *graphs.GraphStoreConfig) *DgraphWorker {
+	var pipeline *graphs.ExtractionPipeline
+	if llm != nil && store != nil {
+		pipeline = graphs.NewExtractionPipeline(llm, store, graphCfg)
+		if graphCfg != nil && graphCfg.EntityResolution != nil && embedder != nil {
+			pipeline.Resolver = graphs.NewEntityResolver(embedder, store, graphCfg.EntityResolution.Threshold)
+		}
+	}
+	var ontology *graphs.Ontology
+	if graphCfg != nil {
+		ontology = graphs.NewOntology(graphCfg.Ontology)
+	}
 	return &DgraphWorker{
 		nc:       nc,
 		cfg:      cfg,
-		openai:   openai,
-		dg:       dg,
+		store:    store,
+		pipeline: pipeline,
+		ontology: ontology,
 		graphCfg: graphCfg,
 	}
 }
@@ -44,11 +67,11 @@ func (w *DgraphWorker) Start(ctx context.Context) error {
 		<-ctx.Done()
 		return nil
 	}
-	if w.dg == nil {
-		fmt.Println("DgraphWorker: Dgraph client (dg) is nil, worker will not start effectively.")
+	if w.store == nil {
+		fmt.Println("DgraphWorker: Graph store is nil, worker will not start effectively.")
 	}
-	if w.openai == nil {
-		fmt.Println("DgraphWorker: OpenAI client is nil, graph data extraction will be skipped.")
+	if w.pipeline == nil {
+		fmt.Println("DgraphWorker: LLM client is nil, graph data extraction will be skipped.")
 	}
 
 	fmt.Printf("DgraphWorker started, listening on topic: %s\n", w.cfg.TopicMemoryGraphStoreAdd)
@@ -74,84 +97,158 @@ func (w *DgraphWorker) handleGraphStoreAddMessage(payload []byte) error {
 	}
 	fmt.Printf("DgraphWorker: Unmarshalled GraphStoreStorageData for MemoryID: %s\n", graphData.MemoryID)
 
-	if w.dg == nil {
-		fmt.Println("DgraphWorker: Dgraph client is nil, cannot store graph data.")
-		return fmt.Errorf("Dgraph client is nil")
+	if w.store == nil {
+		fmt.Println("DgraphWorker: Graph store is nil, cannot store graph data.")
+		return fmt.Errorf("graph store is nil")
 	}
-
-	// Simulate OpenAI ExtractGraphData if not already populated and OpenAI client exists
-	if (len(graphData.Entities) == 0 || len(graphData.Relationships) == 0) && w.openai != nil {
-		fmt.Println("DgraphWorker: Simulating OpenAI ExtractGraphData call...")
-		customPrompt := ""
-		if w.graphCfg != nil {
-			customPrompt = w.graphCfg.CustomPrompt
-		} else if w.cfg.CustomFactExtractionPrompt != "" { // Fallback to general fact extraction prompt if specific graph prompt not set
-			customPrompt = w.cfg.CustomFactExtractionPrompt
+	filter := graphs.Filter{UserID: graphData.UserID, AgentID: graphData.AgentID, RunID: graphData.RunID}
+	ctx := context.Background()
+
+	details := map[string]interface{}{}
+	var (
+		merges     []graphs.MergeDecision
+		violations []graphs.OntologyViolation
+	)
+	if len(graphData.Relationships) > 0 {
+		// Relations extracted upstream are stored as-is, within the ontology.
+		extracted := relationsFromGraphData(graphData)
+		relations, relViolations := w.ontology.EnforceRelations(extracted)
+		if len(relations) > 0 {
+			if err := w.store.AddRelations(ctx, filter, relations); err != nil {
+				fmt.Printf("DgraphWorker: Error adding relations: %v\n", err)
+				return fmt.Errorf("error adding relations: %w", err)
+			}
 		}
-
-		entities, relations, err := w.openai.ExtractGraphData(context.Background(), graphData.TextForGraph, customPrompt)
+		details["entities_count"] = len(graphData.Entities)
+		details["relationships_count"] = len(extracted)
+		details["added_count"] = len(relations)
+		violations = relViolations
+	} else if w.pipeline != nil {
+		provenance := graphs.Attributes{SourceMemoryIDs: []string{graphData.MemoryID}}
+		result, err := w.pipeline.Process(ctx, filter, graphData.TextForGraph, provenance)
 		if err != nil {
-			fmt.Printf("DgraphWorker: Error simulating OpenAI ExtractGraphData: %v\n", err)
-			// Decide if this is fatal or proceed without graph data
-		} else {
-			graphData.Entities = entities
-			graphData.Relationships = relations
-			fmt.Printf("DgraphWorker: Simulated graph data extraction for MemoryID: %s. Entities: %d, Relations: %d\n", graphData.MemoryID, len(entities), len(relations))
+			fmt.Printf("DgraphWorker: Error running graph extraction pipeline: %v\n", err)
+			return fmt.Errorf("error running graph extraction pipeline: %w", err)
 		}
-	} else if w.openai == nil {
-		fmt.Println("DgraphWorker: OpenAI client is nil, skipping graph data extraction by OpenAI.")
-	}
-
-	if len(graphData.Entities) > 0 || len(graphData.Relationships) > 0 {
-		fmt.Printf("DgraphWorker: Simulating Dgraph Mutate call for MemoryID: %s\n", graphData.MemoryID)
-		// In a real scenario, you'd transform graphData.Entities and graphData.Relationships
-		// into the format expected by dg.Mutate.
-		// For shell, we can just pass the struct, or a simplified map.
-		mockMutationData := map[string]interface{}{
-			"memoryId":      graphData.MemoryID,
-			"entities":      graphData.Entities,
-			"relationships": graphData.Relationships,
+		fmt.Printf("DgraphWorker: Updated graph for MemoryID: %s. Entities: %d, Added: %d, Closed: %d, Rejected tool calls: %d, Ontology violations: %d\n",
+			graphData.MemoryID, len(result.Entities), len(result.Added), len(result.Closed), len(result.Rejected), len(result.Violations))
+		details["entities_count"] = len(result.Entities)
+		details["relationships_count"] = len(result.Extracted)
+		details["added_count"] = len(result.Added)
+		details["closed_count"] = len(result.Closed)
+		if len(result.Closed) > 0 {
+			details["closed"] = result.Closed
 		}
-		err := w.dg.Mutate(context.Background(), mockMutationData)
-		if err != nil {
-			fmt.Printf("DgraphWorker: Error simulating Dgraph Mutate: %v\n", err)
-			return fmt.Errorf("error mutating graph data: %w", err)
+		if len(result.Merges) > 0 {
+			details["merged_count"] = len(result.Merges)
 		}
-		fmt.Printf("DgraphWorker: Successfully simulated graph data mutation for MemoryID: %s\n", graphData.MemoryID)
+		merges, violations = result.Merges, result.Violations
 	} else {
-		fmt.Printf("DgraphWorker: No entities or relationships to store for MemoryID: %s\n", graphData.MemoryID)
+		fmt.Printf("DgraphWorker: No relationships and no LLM client, nothing to store for MemoryID: %s\n", graphData.MemoryID)
+		return nil
 	}
 
-	// Simulate publishing MemoryEvent to TopicMemoryHistoryLog
+	if len(violations) > 0 {
+		details["violations_count"] = len(violations)
+	}
+	// Quarantined extractions are logged on their own so they can be reviewed. Relations are
+	// recorded as a graphs.QuarantinedRelation, with their provenance, to be re-applied as is.
+	for _, v := range violations {
+		if v.Action != graphs.ViolationQuarantined {
+			continue
+		}
+		switch {
+		case v.Relation != nil:
+			rel := *v.Relation
+			if len(rel.Attributes.SourceMemoryIDs) == 0 {
+				rel.Attributes.SourceMemoryIDs = []string{graphData.MemoryID}
+			}
+			w.publishHistoryEvent(graphData, eventRelationQuarantined, map[string]interface{}{
+				"reason":      v.Reason,
+				"quarantined": graphs.QuarantinedRelation{Filter: filter, Relation: rel},
+			})
+		case v.Entity != nil:
+			w.publishHistoryEvent(graphData, eventEntityQuarantined, map[string]interface{}{
+				"reason": v.Reason,
+				"entity": v.Entity,
+				"filter": filter,
+			})
+		}
+	}
+	// Each merge is logged on its own so it can be audited, and undone with graphs.EntityResolver.Undo.
+	for _, merge := range merges {
+		w.publishHistoryEvent(graphData, "ENTITY_MERGED", map[string]interface{}{
+			"canonical": merge.Canonical,
+			"alias":     merge.Alias,
+			"score":     merge.Score,
+			"decision":  merge,
+		})
+	}
+	w.publishHistoryEvent(graphData, "GRAPH_STORE_ADD", details)
+	return nil
+}
+
+// publishHistoryEvent publishes a MemoryEvent about graphData to TopicMemoryHistoryLog.
+func (w *DgraphWorker) publishHistoryEvent(graphData GraphStoreStorageData, eventType string, details map[string]interface{}) {
 	historyEvent := MemoryEvent{
 		EventID:   uuid.New().String(),
 		MemoryID:  graphData.MemoryID,
-		EventType: "GRAPH_STORE_ADD",
+		EventType: eventType,
 		Timestamp: time.Now().UTC(),
 		UserID:    graphData.UserID,
 		AgentID:   graphData.AgentID,
 		RunID:     graphData.RunID,
 		ActorID:   graphData.ActorID,
-		Details: map[string]interface{}{
-			"entities_count":      len(graphData.Entities),
-			"relationships_count": len(graphData.Relationships),
-		},
+		Details:   details,
 	}
 	eventData, err := json.Marshal(historyEvent)
 	if err != nil {
 		fmt.Printf("DgraphWorker: Error marshalling MemoryEvent: %v\n", err)
+		return
+	}
+	if w.nc == nil {
+		fmt.Printf("NATS_PUBLISH (DgraphWorker - nc is nil): Topic=%s, Payload=%s\n", w.cfg.TopicMemoryHistoryLog, string(eventData))
+		return
+	}
+	if err := w.nc.Publish(context.Background(), w.cfg.TopicMemoryHistoryLog, eventData); err != nil {
+		fmt.Printf("DgraphWorker: Error publishing MemoryEvent to NATS topic %s: %v\n", w.cfg.TopicMemoryHistoryLog, err)
 	} else {
-		if w.nc != nil {
-			err = w.nc.Publish(context.Background(), w.cfg.TopicMemoryHistoryLog, eventData)
-			if err != nil {
-				fmt.Printf("DgraphWorker: Error publishing MemoryEvent to NATS topic %s: %v\n", w.cfg.TopicMemoryHistoryLog, err)
-			} else {
-				fmt.Printf("DgraphWorker: Published MemoryEvent to %s for MemoryID: %s\n", w.cfg.TopicMemoryHistoryLog, graphData.MemoryID)
-			}
-		} else {
-			fmt.Printf("NATS_PUBLISH (DgraphWorker - nc is nil): Topic=%s, Payload=%s\n", w.cfg.TopicMemoryHistoryLog, string(eventData))
-		}
+		fmt.Printf("DgraphWorker: Published %s MemoryEvent to %s for MemoryID: %s\n", eventType, w.cfg.TopicMemoryHistoryLog, graphData.MemoryID)
 	}
+}
 
-	return nil
+// relationsFromGraphData converts pre-extracted relationships, resolving entity IDs to names,
+// types and attributes. Relationships without source memories are attributed to data.MemoryID.
+func relationsFromGraphData(data GraphStoreStorageData) []graphs.Relation {
+	entities := make(map[string]Entity, len(data.Entities))
+	for _, e := range data.Entities {
+		entities[e.ID] = e
+	}
+	endpoint := func(id string) (string, string, *graphs.Attributes) {
+		if e, ok := entities[id]; ok && e.Name != "" {
+			attrs := e.Attributes
+			return e.Name, e.Type, &attrs
+		}
+		return id, "", nil
+	}
+	relations := make([]graphs.Relation, 0, len(data.Relationships))
+	for _, r := range data.Relationships {
+		source, sourceType, sourceAttrs := endpoint(r.SourceID)
+		destination, destinationType, destinationAttrs := endpoint(r.TargetID)
+		attrs := r.Attributes
+		if len(attrs.SourceMemoryIDs) == 0 && data.MemoryID != "" {
+			attrs.SourceMemoryIDs = []string{data.MemoryID}
+		}
+		relations = append(relations, graphs.Relation{
+			Source:                source,
+			SourceType:            sourceType,
+			Relationship:          r.RelationshipType,
+			Destination:           destination,
+			DestinationType:       destinationType,
+			Attributes:            attrs,
+			SourceAttributes:      sourceAttrs,
+			DestinationAttributes: destinationAttrs,
+		})
+	}
+	return relations
 }
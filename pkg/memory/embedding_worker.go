@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 	// Required for MemoryEvent
 	// "github.com/google/uuid" // Required for MemoryEvent
 )
@@ -56,9 +57,22 @@ func (w *EmbeddingWorker) handleEmbedMessage(payload []byte) error {
 	}
 	fmt.Printf("EmbeddingWorker: Unmarshalled ProcessedMemoryData for MemoryID: %s\n", processedData.MemoryID)
 
+	rawText := rawConversationText(processedData.OriginalMessages)
 	var embedding []float32
+	var namedEmbeddings map[string][]float32
 	var err error
-	if w.openai != nil {
+	if names := configuredVectorNames(w.cfg); w.openai != nil && len(names) > 0 {
+		factText := processedData.ProcessedText
+		if len(processedData.ExtractedFacts) > 0 {
+			factText = strings.Join(processedData.ExtractedFacts, "\n")
+		}
+		namedEmbeddings, err = embedNamedVectors(context.Background(), w.openai, names, factText, rawText)
+		if err != nil {
+			fmt.Printf("EmbeddingWorker: Error generating named vectors: %v\n", err)
+			return fmt.Errorf("error getting named embeddings: %w", err)
+		}
+		fmt.Printf("EmbeddingWorker: Generated named vectors %v for MemoryID: %s\n", names, processedData.MemoryID)
+	} else if w.openai != nil {
 		fmt.Println("EmbeddingWorker: Simulating OpenAI GetEmbedding call...")
 		embedding, err = w.openai.GetEmbedding(context.Background(), processedData.ProcessedText)
 		if err != nil {
@@ -78,7 +92,10 @@ func (w *EmbeddingWorker) handleEmbedMessage(payload []byte) error {
 		MemoryID:        processedData.MemoryID,
 		TextToEmbed:     processedData.ProcessedText, // Or specific parts if logic changes
 		Embedding:       embedding,
+		Embeddings:      namedEmbeddings,
 		ProcessedText:   processedData.ProcessedText,
+		RawText:         rawText,
+		Hash:            processedData.Hash,
 	}
 
 	jsonData, err := json.Marshal(embeddingData)
@@ -0,0 +1,89 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pnocera/gomem/pkg/vectorstores"
+)
+
+// GetWorker answers requests for a single memory by ID from the vector store.
+type GetWorker struct {
+	nc    NATSClient
+	cfg   *Config
+	vs    vectorstores.VectorStore
+	authz Authorizer
+}
+
+// NewGetWorker creates a new GetWorker. A nil authz uses ScopeAuthorizer.
+func NewGetWorker(nc NATSClient, cfg *Config, vs vectorstores.VectorStore, authz Authorizer) *GetWorker {
+	return &GetWorker{
+		nc:    nc,
+		cfg:   cfg,
+		vs:    vs,
+		authz: authorizerOrDefault(authz),
+	}
+}
+
+// Start begins the worker's NATS subscription.
+func (w *GetWorker) Start(ctx context.Context) error {
+	if w.nc == nil {
+		fmt.Println("GetWorker: NATS client is nil, worker will not start.")
+		<-ctx.Done()
+		return nil
+	}
+	if w.vs == nil {
+		fmt.Println("GetWorker: VectorStore client (vs) is nil, worker will not start effectively.")
+	}
+
+	fmt.Printf("GetWorker started, listening on topic: %s\n", w.cfg.TopicMemoryGet)
+	// In a real implementation, w.nc.Subscribe would be called here.
+	// The handler would be w.handleGetMessage, with its return value sent as the reply.
+	go func() {
+		// Simulated subscription loop
+	}()
+
+	<-ctx.Done()
+	fmt.Println("GetWorker shutting down.")
+	return nil
+}
+
+// handleGetMessage processes a GetRequestData and returns the marshalled GetMemoryResponse.
+func (w *GetWorker) handleGetMessage(payload []byte) ([]byte, error) {
+	fmt.Printf("GetWorker received payload: %s\n", string(payload))
+
+	var resp GetMemoryResponse
+	var req GetRequestData
+	if err := json.Unmarshal(payload, &req); err != nil {
+		fmt.Printf("GetWorker: Error unmarshalling GetRequestData: %v\n", err)
+		resp.Error = fmt.Sprintf("error unmarshalling GetRequestData: %v", err)
+	} else if w.vs == nil {
+		resp.Error = "VectorStore client is nil"
+	} else if collectionName, err := vectorCollectionName(w.cfg); err != nil {
+		resp.Error = err.Error()
+	} else {
+		stored, err := w.vs.GetVector(collectionName, req.MemoryID)
+		switch {
+		case err != nil:
+			fmt.Printf("GetWorker: Error getting MemoryID %s: %v\n", req.MemoryID, err)
+			resp.Error = fmt.Sprintf("error getting memory %s: %v", req.MemoryID, err)
+		case stored == nil:
+			resp.Error = fmt.Sprintf("memory %s not found", req.MemoryID)
+		default:
+			if err := w.authz.Authorize(context.Background(), req.BaseRequestInfo, payloadOwner(stored.Payload), ActionRead); err != nil {
+				fmt.Printf("GetWorker: Refusing MemoryID %s: %v\n", req.MemoryID, err)
+				resp.Error, resp.Code = replyError(err)
+				break
+			}
+			result := memoryResultFromPayload(stored.ID, 0, stored.Payload)
+			resp.Result = &result
+		}
+	}
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling GetMemoryResponse: %w", err)
+	}
+	return data, nil
+}
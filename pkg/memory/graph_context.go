@@ -0,0 +1,157 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pnocera/gomem/pkg/graphs"
+)
+
+const (
+	defaultGraphHops  = 1
+	defaultGraphLimit = 10
+	// maxQueryNGram bounds the word n-grams tried as entity names when no LLM is available.
+	maxQueryNGram = 3
+)
+
+// graphContext returns the relations within the request's hops of the entities in its query,
+// ranked by BM25 of the triple text against the query. Relations that share no term with
+// the query follow the ranked ones in traversal order.
+func (w *SearchWorker) graphContext(ctx context.Context, req *SearchMemoryRequest) ([]GraphRelation, error) {
+	filter := graphs.Filter{UserID: req.UserID, AgentID: req.AgentID, RunID: req.RunID}
+	entities, err := w.queryEntities(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if len(entities) == 0 {
+		return nil, nil
+	}
+	hops := req.GraphHops
+	if hops <= 0 {
+		hops = defaultGraphHops
+	}
+	limit := req.GraphLimit
+	if limit <= 0 {
+		limit = defaultGraphLimit
+	}
+	relations, err := w.graph.Traverse(ctx, filter, entities, hops, graphs.QueryOptions{AsOf: req.GraphAsOf})
+	if err != nil {
+		return nil, fmt.Errorf("error traversing graph: %w", err)
+	}
+	if len(relations) == 0 {
+		return nil, nil
+	}
+
+	idx := NewBM25Index()
+	for i, r := range relations {
+		text := strings.Join([]string{r.Source, r.Relationship, r.Destination}, " ")
+		if err := idx.Index(ctx, LexicalDocument{ID: strconv.Itoa(i), Text: text}); err != nil {
+			return nil, fmt.Errorf("error indexing graph relations: %w", err)
+		}
+	}
+	hits, err := idx.Search(ctx, req.Query, 0, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error ranking graph relations: %w", err)
+	}
+	scores := make(map[int]float32, len(hits))
+	for _, h := range hits {
+		i, _ := strconv.Atoi(h.ID)
+		scores[i] = h.Score
+	}
+	order := make([]int, len(relations))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return scores[order[a]] > scores[order[b]] })
+	if len(order) > limit {
+		order = order[:limit]
+	}
+
+	ranked := make([]GraphRelation, len(order))
+	for i, j := range order {
+		r := relations[j]
+		ranked[i] = GraphRelation{
+			SourceNodeID: r.Source,
+			SourceType:   r.SourceType,
+			TargetNodeID: r.Destination,
+			TargetType:   r.DestinationType,
+			Type:         r.Relationship,
+			Score:        scores[j],
+			Attributes:   r.Attributes,
+		}
+	}
+	return ranked, nil
+}
+
+// queryEntities names the entities of the query, using the LLM when available and the
+// query's word n-grams otherwise.
+func (w *SearchWorker) queryEntities(ctx context.Context, req *SearchMemoryRequest) ([]string, error) {
+	if w.llm == nil {
+		return queryNGrams(req.Query), nil
+	}
+	calls, err := w.llm.ChatWithTools(ctx, graphs.GetExtractEntitiesPrompt(req.UserID), req.Query, []graphs.Tool{graphs.ExtractEntitiesTool})
+	if err != nil {
+		return nil, fmt.Errorf("error extracting query entities: %w", err)
+	}
+	var names []string
+	for _, call := range calls {
+		if call.Name != graphs.ExtractEntitiesTool.Function.Name {
+			continue
+		}
+		args, err := graphs.ParseToolCall(call)
+		if err != nil {
+			fmt.Printf("SearchWorker: Skipping invalid entity extraction call: %v\n", err)
+			continue
+		}
+		for _, e := range args.(*graphs.EntitiesArgs).Entities {
+			names = append(names, e[0])
+		}
+	}
+	return names, nil
+}
+
+// queryNGrams returns the query's word n-grams up to maxQueryNGram words, e.g. "new york"
+// for "flights to New York", as candidate entity names.
+func queryNGrams(query string) []string {
+	words := tokenize(query)
+	var grams []string
+	for n := 1; n <= maxQueryNGram; n++ {
+		for i := 0; i+n <= len(words); i++ {
+			grams = append(grams, strings.Join(words[i:i+n], " "))
+		}
+	}
+	return grams
+}
+
+// attachRelations gives each result the relations whose source or target it mentions.
+// Relations no result mentions are attached to the top result.
+func attachRelations(results []MemoryResult, relations []GraphRelation) {
+	if len(results) == 0 || len(relations) == 0 {
+		return
+	}
+	texts := make([]string, len(results))
+	for i, r := range results {
+		texts[i] = " " + strings.Join(tokenize(r.Memory), " ") + " "
+	}
+	for _, rel := range relations {
+		attached := false
+		for i := range results {
+			if mentionsEntity(texts[i], rel.SourceNodeID) || mentionsEntity(texts[i], rel.TargetNodeID) {
+				results[i].Relations = append(results[i].Relations, rel)
+				attached = true
+			}
+		}
+		if !attached {
+			results[0].Relations = append(results[0].Relations, rel)
+		}
+	}
+}
+
+// mentionsEntity reports whether the padded, tokenized text contains the entity's words.
+func mentionsEntity(text string, entity string) bool {
+	words := tokenize(entity)
+	return len(words) > 0 && strings.Contains(text, " "+strings.Join(words, " ")+" ")
+}
@@ -0,0 +1,16 @@
+package memory
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// ContentHash returns the hex SHA-256 of text after normalization: lowercased,
+// trimmed and with every run of whitespace collapsed to a single space. Clients
+// can use it to compare their own text with MemoryResult.Hash.
+func ContentHash(text string) string {
+	normalized := strings.Join(strings.Fields(strings.ToLower(text)), " ")
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
@@ -3,8 +3,11 @@ package memory
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -20,6 +23,9 @@ type HistoryStore interface {
 	// GetHistory retrieves all events for a specific memory ID, ordered by timestamp.
 	GetHistory(ctx context.Context, memoryID string) ([]*MemoryEvent, error)
 
+	// QueryHistory returns a page of the events matching query.
+	QueryHistory(ctx context.Context, query *HistoryQuery) (*HistoryPage, error)
+
 	// Reset clears all history.
 	Reset(ctx context.Context) error
 
@@ -27,6 +33,33 @@ type HistoryStore interface {
 	Close() error
 }
 
+// NewHistoryStore creates the HistoryStore selected by cfg.
+func NewHistoryStore(ctx context.Context, cfg *HistoryStoreConfig) (HistoryStore, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("history store config is nil")
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid history store config: %w", err)
+	}
+	// Each case returns on error so that a nil store is not wrapped in a non-nil interface.
+	switch c := cfg.Config.(type) {
+	case *SQLiteHistoryConfig:
+		store, err := NewSQLiteHistoryStore(c.Path)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	case *PostgresHistoryConfig:
+		store, err := NewPostgresHistoryStore(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	default:
+		return nil, fmt.Errorf("unsupported history store config type: %T", cfg.Config)
+	}
+}
+
 // SQLiteHistoryStore implements the HistoryStore interface using SQLite.
 type SQLiteHistoryStore struct {
 	db     *sql.DB
@@ -54,54 +87,43 @@ func NewSQLiteHistoryStore(dataSourceName string) (*SQLiteHistoryStore, error) {
 		dbPath: dataSourceName,
 	}
 
-	if err := store._createHistoryTable(); err != nil {
+	if _, err := newSQLiteMigrator(db).migrate(context.Background(), false); err != nil {
 		store.Close()
-		return nil, fmt.Errorf("failed to create history table: %w", err)
+		return nil, fmt.Errorf("failed to migrate history schema: %w", err)
 	}
 
 	return store, nil
 }
 
-// _createHistoryTable creates the history table if it doesn't already exist.
-func (s *SQLiteHistoryStore) _createHistoryTable() error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	createTableSQL := `
-	CREATE TABLE IF NOT EXISTS history (
-		event_id TEXT PRIMARY KEY,
-		memory_id TEXT,
-		event_type TEXT NOT NULL,
-		timestamp DATETIME NOT NULL,
-		user_id TEXT,
-		agent_id TEXT,
-		run_id TEXT,
-		actor_id TEXT,
-		old_memory TEXT,
-		new_memory TEXT,
-		search_query TEXT,
-		details TEXT
-	);`
-
-	createMemoryIDIndexSQL := `CREATE INDEX IF NOT EXISTS idx_history_memory_id ON history (memory_id);`
-	createTimestampIndexSQL := `CREATE INDEX IF NOT EXISTS idx_history_timestamp ON history (timestamp);`
-
-	_, err := s.db.Exec(createTableSQL)
+// MigrateSQLiteHistoryStore brings the history schema of a SQLite database to the latest
+// version, as NewSQLiteHistoryStore does on startup. With dryRun it only reports the
+// migrations that would run.
+func MigrateSQLiteHistoryStore(ctx context.Context, dataSourceName string, dryRun bool) (*MigrationPlan, error) {
+	db, err := sql.Open("sqlite3", dataSourceName)
 	if err != nil {
-		return fmt.Errorf("failed to execute create history table statement: %w", err)
+		return nil, fmt.Errorf("failed to open sqlite database: %w", err)
 	}
+	defer db.Close()
+	return newSQLiteMigrator(db).migrate(ctx, dryRun)
+}
 
-	_, err = s.db.Exec(createMemoryIDIndexSQL)
+// newSQLiteMigrator returns a migrator for the embedded SQLite migrations.
+func newSQLiteMigrator(db *sql.DB) *migrator {
+	migrations, err := loadMigrations("sqlite")
 	if err != nil {
-		return fmt.Errorf("failed to create memory_id index: %w", err)
+		// The migrations are embedded, so this only fails for a broken build.
+		panic(err)
 	}
-
-	_, err = s.db.Exec(createTimestampIndexSQL)
-	if err != nil {
-		return fmt.Errorf("failed to create timestamp index: %w", err)
+	return &migrator{
+		db:          db,
+		migrations:  migrations,
+		placeholder: func(int) string { return "?" },
+		tableExists: func(ctx context.Context, db *sql.DB, table string) (bool, error) {
+			var n int
+			err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, table).Scan(&n)
+			return n > 0, err
+		},
 	}
-
-	return nil
 }
 
 // LogEvent records a memory event.
@@ -119,6 +141,8 @@ func (s *SQLiteHistoryStore) LogEvent(ctx context.Context, event *MemoryEvent) e
 	if event.Timestamp.IsZero() {
 		event.Timestamp = time.Now().UTC()
 	}
+	// Stored timestamps are compared as text, so they must share a time zone.
+	event.Timestamp = event.Timestamp.UTC()
 
 	detailsJSON, err := json.Marshal(event.Details)
 	if err != nil {
@@ -163,11 +187,10 @@ func (s *SQLiteHistoryStore) GetHistory(ctx context.Context, memoryID string) ([
 	defer s.mu.RUnlock()
 
 	query := `
-		SELECT event_id, memory_id, event_type, timestamp, user_id, agent_id,
-		       run_id, actor_id, old_memory, new_memory, search_query, details
+		SELECT ` + historyColumns + `
 		FROM history
 		WHERE memory_id = ?
-		ORDER BY timestamp ASC
+		ORDER BY timestamp ASC, event_id ASC
 	`
 	rows, err := s.db.QueryContext(ctx, query, memoryID)
 	if err != nil {
@@ -175,6 +198,147 @@ func (s *SQLiteHistoryStore) GetHistory(ctx context.Context, memoryID string) ([
 	}
 	defer rows.Close()
 
+	return scanHistoryRows(rows)
+}
+
+// ErrInvalidHistoryCursor is returned by QueryHistory for a cursor it did not issue.
+var ErrInvalidHistoryCursor = errors.New("invalid history cursor")
+
+// historyColumns are the columns read by scanHistoryRows.
+const historyColumns = `event_id, memory_id, event_type, timestamp, user_id, agent_id,
+		       run_id, actor_id, old_memory, new_memory, search_query, details`
+
+// historyCursor is the position after the last event of a page.
+type historyCursor struct {
+	Timestamp time.Time `json:"ts"`
+	EventID   string    `json:"id"`
+}
+
+func encodeHistoryCursor(event *MemoryEvent) string {
+	data, _ := json.Marshal(historyCursor{Timestamp: event.Timestamp.UTC(), EventID: event.EventID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeHistoryCursor(cursor string) (*historyCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidHistoryCursor
+	}
+	var c historyCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.EventID == "" || c.Timestamp.IsZero() {
+		return nil, ErrInvalidHistoryCursor
+	}
+	c.Timestamp = c.Timestamp.UTC()
+	return &c, nil
+}
+
+// QueryHistory returns a page of the events matching query, using the timestamp and
+// event ID of the page's last event as a keyset cursor.
+func (s *SQLiteHistoryStore) QueryHistory(ctx context.Context, query *HistoryQuery) (*HistoryPage, error) {
+	stmt, args, limit, err := historyQuerySQL(query, func(int) string { return "?" })
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.db == nil {
+		return nil, fmt.Errorf("SQLiteHistoryStore is closed")
+	}
+	rows, err := s.db.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query history: %w", err)
+	}
+	defer rows.Close()
+
+	events, err := scanHistoryRows(rows)
+	if err != nil {
+		return nil, err
+	}
+	return historyPage(events, limit), nil
+}
+
+// historyQuerySQL builds the SELECT statement and arguments for query, with placeholder
+// returning the n-th bind parameter. It selects one row more than the returned page size
+// so that historyPage can tell whether there is a next page.
+func historyQuerySQL(query *HistoryQuery, placeholder func(n int) string) (string, []interface{}, int, error) {
+	if err := query.Validate(); err != nil {
+		return "", nil, 0, fmt.Errorf("invalid history query: %w", err)
+	}
+
+	var conds []string
+	var args []interface{}
+	bind := func(v interface{}) string {
+		args = append(args, v)
+		return placeholder(len(args))
+	}
+	for _, field := range []struct{ column, value string }{
+		{"memory_id", query.MemoryID},
+		{"user_id", query.UserID},
+		{"agent_id", query.AgentID},
+		{"run_id", query.RunID},
+		{"actor_id", query.ActorID},
+	} {
+		if field.value != "" {
+			conds = append(conds, field.column+" = "+bind(field.value))
+		}
+	}
+	if len(query.EventTypes) > 0 {
+		params := make([]string, len(query.EventTypes))
+		for i, eventType := range query.EventTypes {
+			params[i] = bind(eventType)
+		}
+		conds = append(conds, "event_type IN ("+strings.Join(params, ", ")+")")
+	}
+	if !query.Since.IsZero() {
+		conds = append(conds, "timestamp >= "+bind(query.Since.UTC()))
+	}
+	if !query.Until.IsZero() {
+		conds = append(conds, "timestamp < "+bind(query.Until.UTC()))
+	}
+
+	order, cmp := "ASC", ">"
+	if query.Order == "desc" {
+		order, cmp = "DESC", "<"
+	}
+	if query.Cursor != "" {
+		cursor, err := decodeHistoryCursor(query.Cursor)
+		if err != nil {
+			return "", nil, 0, err
+		}
+		conds = append(conds, fmt.Sprintf("(timestamp %s %s OR (timestamp = %s AND event_id %s %s))",
+			cmp, bind(cursor.Timestamp), bind(cursor.Timestamp), cmp, bind(cursor.EventID)))
+	}
+
+	limit := query.Limit
+	if limit == 0 {
+		limit = DefaultHistoryPageSize
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = "WHERE " + strings.Join(conds, " AND ")
+	}
+	stmt := fmt.Sprintf("SELECT %s FROM history %s ORDER BY timestamp %s, event_id %s LIMIT %s",
+		historyColumns, where, order, order, bind(limit+1))
+	return stmt, args, limit, nil
+}
+
+// historyPage turns the rows selected by historyQuerySQL into a page of at most limit events.
+func historyPage(events []*MemoryEvent, limit int) *HistoryPage {
+	page := &HistoryPage{Events: events}
+	if len(events) > limit {
+		page.Events = events[:limit]
+		page.NextCursor = encodeHistoryCursor(page.Events[limit-1])
+	}
+	if page.Events == nil {
+		page.Events = []*MemoryEvent{}
+	}
+	return page
+}
+
+// scanHistoryRows reads the events of rows selected with historyColumns.
+func scanHistoryRows(rows *sql.Rows) ([]*MemoryEvent, error) {
 	var events []*MemoryEvent
 	for rows.Next() {
 		event := &MemoryEvent{}
@@ -224,7 +388,7 @@ func (s *SQLiteHistoryStore) GetHistory(ctx context.Context, memoryID string) ([
 		events = append(events, event)
 	}
 
-	if err = rows.Err(); err != nil {
+	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("error iterating history rows: %w", err)
 	}
 
@@ -236,17 +400,10 @@ func (s *SQLiteHistoryStore) Reset(ctx context.Context) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	dropTableSQL := `DROP TABLE IF EXISTS history;`
-	_, err := s.db.ExecContext(ctx, dropTableSQL)
-	if err != nil {
-		return fmt.Errorf("failed to drop history table: %w", err)
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM history`); err != nil {
+		return fmt.Errorf("failed to clear history table: %w", err)
 	}
-
-	// Re-create the table
-	// Note: _createHistoryTable already acquires its own lock, but since Reset holds the lock,
-	// it's okay. If _createHistoryTable was called without Reset holding the lock,
-	// it would manage its own concurrency.
-	return s._createHistoryTable()
+	return nil
 }
 
 // Close closes any underlying database connections.
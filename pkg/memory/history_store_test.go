@@ -0,0 +1,20 @@
+package memory_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/pnocera/gomem/pkg/memory"
+	"github.com/pnocera/gomem/pkg/memory/historytest"
+)
+
+func TestSQLiteHistoryStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	historytest.Run(t, func(t *testing.T) memory.HistoryStore {
+		store, err := memory.NewSQLiteHistoryStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	})
+}
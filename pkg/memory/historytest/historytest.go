@@ -0,0 +1,371 @@
+// Package historytest is a conformance suite for memory.HistoryStore implementations.
+// Every store is expected to pass it, so that they can be swapped through
+// memory.NewHistoryStore without changing behaviour. Run it from a test of the store:
+//
+//	func TestSQLiteHistoryStore(t *testing.T) {
+//		historytest.Run(t, func(t *testing.T) memory.HistoryStore {
+//			store, err := memory.NewSQLiteHistoryStore(filepath.Join(t.TempDir(), "history.db"))
+//			if err != nil {
+//				t.Fatal(err)
+//			}
+//			return store
+//		})
+//	}
+//
+// The PostgreSQL store runs against a throwaway server started by StartPostgres:
+//
+//	func TestPostgresHistoryStore(t *testing.T) {
+//		dsn := historytest.StartPostgres(t)
+//		historytest.Run(t, func(t *testing.T) memory.HistoryStore {
+//			store, err := memory.NewPostgresHistoryStore(context.Background(), &memory.PostgresHistoryConfig{DSN: dsn})
+//			if err != nil {
+//				t.Fatal(err)
+//			}
+//			return store
+//		})
+//	}
+package historytest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pnocera/gomem/pkg/memory"
+)
+
+// Run runs the conformance suite. newStore is called once per subtest; the store may share
+// its database with earlier ones, as Run resets it first and closes it when the subtest ends.
+func Run(t *testing.T, newStore func(t *testing.T) memory.HistoryStore) {
+	for _, tc := range []struct {
+		name string
+		test func(t *testing.T, store memory.HistoryStore)
+	}{
+		{"LogEventAndGetHistory", testLogEventAndGetHistory},
+		{"GetHistoryUnknownMemory", testGetHistoryUnknownMemory},
+		{"DuplicateEventID", testDuplicateEventID},
+		{"QueryFilters", testQueryFilters},
+		{"QueryPagination", testQueryPagination},
+		{"QueryInvalid", testQueryInvalid},
+		{"ConcurrentLogEvent", testConcurrentLogEvent},
+		{"Reset", testReset},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			store := newStore(t)
+			t.Cleanup(func() {
+				if err := store.Close(); err != nil {
+					t.Errorf("Close: %v", err)
+				}
+			})
+			if err := store.Reset(context.Background()); err != nil {
+				t.Fatalf("Reset: %v", err)
+			}
+			tc.test(t, store)
+		})
+	}
+}
+
+// base is the time the fixtures are logged around. Offsets are whole milliseconds so that
+// stores with microsecond precision return them unchanged.
+var base = time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func at(ms int) time.Time {
+	return base.Add(time.Duration(ms) * time.Millisecond)
+}
+
+func logEvents(t *testing.T, store memory.HistoryStore, events ...*memory.MemoryEvent) {
+	t.Helper()
+	for _, event := range events {
+		if err := store.LogEvent(context.Background(), event); err != nil {
+			t.Fatalf("LogEvent(%s): %v", event.EventID, err)
+		}
+	}
+}
+
+func eventIDs(events []*memory.MemoryEvent) []string {
+	ids := make([]string, len(events))
+	for i, event := range events {
+		ids[i] = event.EventID
+	}
+	return ids
+}
+
+func query(t *testing.T, store memory.HistoryStore, q memory.HistoryQuery) *memory.HistoryPage {
+	t.Helper()
+	page, err := store.QueryHistory(context.Background(), &q)
+	if err != nil {
+		t.Fatalf("QueryHistory(%+v): %v", q, err)
+	}
+	return page
+}
+
+func testLogEventAndGetHistory(t *testing.T, store memory.HistoryStore) {
+	want := &memory.MemoryEvent{
+		EventID:     "e2",
+		MemoryID:    "m1",
+		EventType:   "MEMORY_UPDATED",
+		Timestamp:   at(2000).In(time.FixedZone("UTC+2", 2*3600)),
+		UserID:      "alice",
+		AgentID:     "assistant",
+		RunID:       "run-1",
+		ActorID:     "support",
+		OldMemory:   "likes tea",
+		NewMemory:   "likes coffee",
+		SearchQuery: "drinks",
+		Details:     map[string]interface{}{"collection_name": "memories", "count": float64(2)},
+	}
+	generated := &memory.MemoryEvent{MemoryID: "m1", EventType: "MEMORY_DELETED", UserID: "alice"}
+	logEvents(t, store,
+		&memory.MemoryEvent{EventID: "e1", MemoryID: "m1", EventType: "VECTOR_STORE_ADD", Timestamp: at(1000), UserID: "alice"},
+		want,
+		&memory.MemoryEvent{EventID: "e3", MemoryID: "m2", EventType: "VECTOR_STORE_ADD", Timestamp: at(1500), UserID: "bob"},
+		generated,
+	)
+	if generated.EventID == "" || generated.Timestamp.IsZero() {
+		t.Fatalf("LogEvent did not fill EventID and Timestamp: %+v", generated)
+	}
+
+	events, err := store.GetHistory(context.Background(), "m1")
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	if got := eventIDs(events); !reflect.DeepEqual(got, []string{"e1", "e2", generated.EventID}) {
+		t.Fatalf("GetHistory returned %v, want e1, e2 and the generated event in timestamp order", got)
+	}
+	got := events[1]
+	if !got.Timestamp.Equal(want.Timestamp) {
+		t.Errorf("Timestamp = %v, want %v", got.Timestamp, want.Timestamp)
+	}
+	got.Timestamp = want.Timestamp
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetHistory returned %+v, want %+v", got, want)
+	}
+}
+
+func testGetHistoryUnknownMemory(t *testing.T, store memory.HistoryStore) {
+	events, err := store.GetHistory(context.Background(), "missing")
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("GetHistory returned %d events for an unknown memory", len(events))
+	}
+}
+
+func testDuplicateEventID(t *testing.T, store memory.HistoryStore) {
+	logEvents(t, store, &memory.MemoryEvent{EventID: "dup", EventType: "VECTOR_STORE_ADD", Timestamp: at(0)})
+	err := store.LogEvent(context.Background(), &memory.MemoryEvent{EventID: "dup", EventType: "VECTOR_STORE_ADD", Timestamp: at(1)})
+	if err == nil {
+		t.Fatal("LogEvent accepted a duplicate event ID")
+	}
+}
+
+func testQueryFilters(t *testing.T, store memory.HistoryStore) {
+	logEvents(t, store,
+		&memory.MemoryEvent{EventID: "a1", MemoryID: "m1", EventType: "VECTOR_STORE_ADD", Timestamp: at(0), UserID: "alice", AgentID: "bot", RunID: "r1"},
+		&memory.MemoryEvent{EventID: "a2", MemoryID: "m1", EventType: "MEMORY_UPDATED", Timestamp: at(10), UserID: "alice", AgentID: "bot", RunID: "r2", ActorID: "support"},
+		&memory.MemoryEvent{EventID: "a3", MemoryID: "m2", EventType: "MEMORY_DELETED", Timestamp: at(20), UserID: "alice", AgentID: "other"},
+		&memory.MemoryEvent{EventID: "b1", MemoryID: "m3", EventType: "VECTOR_STORE_ADD", Timestamp: at(15), UserID: "bob", AgentID: "bot"},
+	)
+	for _, tc := range []struct {
+		name  string
+		query memory.HistoryQuery
+		want  []string
+	}{
+		{"all", memory.HistoryQuery{}, []string{"a1", "a2", "b1", "a3"}},
+		{"memory", memory.HistoryQuery{MemoryID: "m1"}, []string{"a1", "a2"}},
+		{"user", memory.HistoryQuery{UserID: "alice"}, []string{"a1", "a2", "a3"}},
+		{"agent", memory.HistoryQuery{AgentID: "bot"}, []string{"a1", "a2", "b1"}},
+		{"user and run", memory.HistoryQuery{UserID: "alice", RunID: "r2"}, []string{"a2"}},
+		{"actor", memory.HistoryQuery{ActorID: "support"}, []string{"a2"}},
+		{"event types", memory.HistoryQuery{EventTypes: []string{"MEMORY_UPDATED", "MEMORY_DELETED"}}, []string{"a2", "a3"}},
+		{"since is inclusive", memory.HistoryQuery{Since: at(10)}, []string{"a2", "b1", "a3"}},
+		{"until is exclusive", memory.HistoryQuery{Until: at(15)}, []string{"a1", "a2"}},
+		{"range in another zone", memory.HistoryQuery{Since: at(10).In(time.FixedZone("UTC-5", -5*3600)), Until: at(20)}, []string{"a2", "b1"}},
+		{"descending", memory.HistoryQuery{UserID: "alice", Order: "desc"}, []string{"a3", "a2", "a1"}},
+		{"no match", memory.HistoryQuery{UserID: "carol"}, []string{}},
+	} {
+		page := query(t, store, tc.query)
+		if got := eventIDs(page.Events); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+		if page.NextCursor != "" {
+			t.Errorf("%s: NextCursor set on the only page", tc.name)
+		}
+	}
+}
+
+func testQueryPagination(t *testing.T, store memory.HistoryStore) {
+	// Pairs of events share a timestamp so that pages must break ties on the event ID.
+	for i := 0; i < 23; i++ {
+		id := fmt.Sprintf("p%02d", 22-i) // IDs run against insertion order
+		logEvents(t, store, &memory.MemoryEvent{EventID: id, EventType: "VECTOR_STORE_ADD", Timestamp: at(i / 2), UserID: "alice"})
+	}
+	logEvents(t, store, &memory.MemoryEvent{EventID: "other", EventType: "VECTOR_STORE_ADD", Timestamp: at(5), UserID: "bob"})
+	page := query(t, store, memory.HistoryQuery{UserID: "alice", Limit: memory.MaxHistoryPageSize})
+	want := eventIDs(page.Events)
+	if len(want) != 23 {
+		t.Fatalf("got %d events, want 23", len(want))
+	}
+	for i := 1; i < len(page.Events); i++ {
+		prev, cur := page.Events[i-1], page.Events[i]
+		if cur.Timestamp.Before(prev.Timestamp) || (cur.Timestamp.Equal(prev.Timestamp) && cur.EventID < prev.EventID) {
+			t.Fatalf("events not ordered by timestamp then event ID: %v", want)
+		}
+	}
+
+	for _, order := range []string{"asc", "desc"} {
+		var got []string
+		cursor := ""
+		for pages := 0; ; pages++ {
+			if pages > 10 {
+				t.Fatalf("%s: pagination does not terminate", order)
+			}
+			page := query(t, store, memory.HistoryQuery{UserID: "alice", Order: order, Limit: 4, Cursor: cursor})
+			if len(page.Events) > 4 {
+				t.Fatalf("%s: page of %d events exceeds the limit", order, len(page.Events))
+			}
+			got = append(got, eventIDs(page.Events)...)
+			if page.NextCursor == "" {
+				break
+			}
+			cursor = page.NextCursor
+		}
+		expected := want
+		if order == "desc" {
+			expected = reverse(want)
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s: paged through %v, want %v", order, got, expected)
+		}
+	}
+
+	page = query(t, store, memory.HistoryQuery{UserID: "alice", Limit: 23})
+	if len(page.Events) != 23 || page.NextCursor != "" {
+		t.Errorf("a page holding the last event returned %d events and cursor %q", len(page.Events), page.NextCursor)
+	}
+}
+
+func reverse(ids []string) []string {
+	out := make([]string, len(ids))
+	for i, id := range ids {
+		out[len(ids)-1-i] = id
+	}
+	return out
+}
+
+func testQueryInvalid(t *testing.T, store memory.HistoryStore) {
+	_, err := store.QueryHistory(context.Background(), &memory.HistoryQuery{Cursor: "not a cursor"})
+	if !errors.Is(err, memory.ErrInvalidHistoryCursor) {
+		t.Errorf("QueryHistory with a bad cursor returned %v, want ErrInvalidHistoryCursor", err)
+	}
+	for _, q := range []memory.HistoryQuery{
+		{Order: "sideways"},
+		{Limit: -1},
+		{Limit: memory.MaxHistoryPageSize + 1},
+		{Since: at(10), Until: at(10)},
+	} {
+		if _, err := store.QueryHistory(context.Background(), &q); err == nil {
+			t.Errorf("QueryHistory accepted %+v", q)
+		}
+	}
+}
+
+func testConcurrentLogEvent(t *testing.T, store memory.HistoryStore) {
+	const writers, perWriter = 8, 25
+	var wg sync.WaitGroup
+	errs := make(chan error, writers*perWriter)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				errs <- store.LogEvent(context.Background(), &memory.MemoryEvent{
+					EventID:   fmt.Sprintf("w%d-%02d", w, i),
+					MemoryID:  fmt.Sprintf("m%d", w),
+					EventType: "VECTOR_STORE_ADD",
+					Timestamp: at(i),
+					UserID:    "alice",
+				})
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("concurrent LogEvent: %v", err)
+		}
+	}
+	page := query(t, store, memory.HistoryQuery{UserID: "alice", Limit: memory.MaxHistoryPageSize})
+	if len(page.Events) != writers*perWriter {
+		t.Fatalf("stored %d events, want %d", len(page.Events), writers*perWriter)
+	}
+}
+
+func testReset(t *testing.T, store memory.HistoryStore) {
+	logEvents(t, store, &memory.MemoryEvent{EventID: "r1", MemoryID: "m1", EventType: "VECTOR_STORE_ADD", Timestamp: at(0)})
+	if err := store.Reset(context.Background()); err != nil {
+		t.Fatalf("Reset: %v", err)
+	}
+	if page := query(t, store, memory.HistoryQuery{}); len(page.Events) != 0 {
+		t.Fatalf("%d events left after Reset", len(page.Events))
+	}
+	logEvents(t, store, &memory.MemoryEvent{EventID: "r1", MemoryID: "m1", EventType: "VECTOR_STORE_ADD", Timestamp: at(0)})
+	if events, err := store.GetHistory(context.Background(), "m1"); err != nil || len(events) != 1 {
+		t.Fatalf("GetHistory after Reset returned %d events, %v", len(events), err)
+	}
+}
+
+// StartPostgres starts a throwaway PostgreSQL server for the test and returns its DSN. It
+// needs initdb and pg_ctl, from GOMEM_POSTGRES_BIN or the PATH, and skips the test when they
+// are missing. The server listens on a free local port and is stopped at cleanup.
+func StartPostgres(t *testing.T) string {
+	t.Helper()
+	initdb, pgCtl := "initdb", "pg_ctl"
+	if dir := os.Getenv("GOMEM_POSTGRES_BIN"); dir != "" {
+		initdb, pgCtl = filepath.Join(dir, initdb), filepath.Join(dir, pgCtl)
+	}
+	for _, bin := range []string{initdb, pgCtl} {
+		if _, err := exec.LookPath(bin); err != nil {
+			t.Skipf("PostgreSQL binaries not found (set GOMEM_POSTGRES_BIN): %v", err)
+		}
+	}
+	if os.Geteuid() == 0 {
+		t.Skip("initdb cannot run as root")
+	}
+
+	dir := t.TempDir()
+	data := filepath.Join(dir, "data")
+	if out, err := exec.Command(initdb, "-D", data, "-U", "postgres", "-A", "trust", "--no-sync").CombinedOutput(); err != nil {
+		t.Fatalf("initdb: %v\n%s", err, out)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to find a free port: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	options := fmt.Sprintf("-p %d -k %s -c listen_addresses=127.0.0.1 -c fsync=off", port, dir)
+	start := exec.Command(pgCtl, "-D", data, "-o", options, "-l", filepath.Join(dir, "postgres.log"), "-w", "start")
+	if out, err := start.CombinedOutput(); err != nil {
+		log, _ := os.ReadFile(filepath.Join(dir, "postgres.log"))
+		t.Fatalf("pg_ctl start: %v\n%s\n%s", err, out, log)
+	}
+	t.Cleanup(func() {
+		if out, err := exec.Command(pgCtl, "-D", data, "-m", "immediate", "-w", "stop").CombinedOutput(); err != nil {
+			t.Logf("pg_ctl stop: %v\n%s", err, out)
+		}
+	})
+	return fmt.Sprintf("host=127.0.0.1 port=%d user=postgres dbname=postgres sslmode=disable", port)
+}
@@ -0,0 +1,116 @@
+package memory
+
+import (
+	"sort"
+
+	"github.com/pnocera/gomem/pkg/vectorstores"
+)
+
+const (
+	// FusionRRF fuses ranked lists with reciprocal rank fusion.
+	FusionRRF = "rrf"
+	// FusionWeighted fuses min-max normalized scores with a weighted sum.
+	FusionWeighted = "weighted"
+
+	defaultRRFK = 60
+)
+
+// fusedCandidate is a search hit after combining vector and lexical results.
+// Payload is nil when the hit only came from the lexical index.
+type fusedCandidate struct {
+	ID      string
+	Score   float32
+	Payload map[string]interface{}
+}
+
+// fuseResults combines vector and lexical hits according to opts.
+func fuseResults(vectorHits []vectorstores.SearchResult, lexicalHits []LexicalResult, opts *HybridSearchOptions) []fusedCandidate {
+	vectorWeight, lexicalWeight := float32(1), float32(1)
+	fusion := FusionRRF
+	rrfK := defaultRRFK
+	if opts != nil {
+		if opts.VectorWeight != nil {
+			vectorWeight = *opts.VectorWeight
+		}
+		if opts.LexicalWeight != nil {
+			lexicalWeight = *opts.LexicalWeight
+		}
+		if opts.Fusion != "" {
+			fusion = opts.Fusion
+		}
+		if opts.RRFK > 0 {
+			rrfK = opts.RRFK
+		}
+	}
+
+	candidates := make(map[string]*fusedCandidate)
+	get := func(id string) *fusedCandidate {
+		c, ok := candidates[id]
+		if !ok {
+			c = &fusedCandidate{ID: id}
+			candidates[id] = c
+		}
+		return c
+	}
+
+	switch fusion {
+	case FusionWeighted:
+		vectorNorm := minMaxNormalize(len(vectorHits), func(i int) float32 { return vectorHits[i].Score })
+		lexicalNorm := minMaxNormalize(len(lexicalHits), func(i int) float32 { return lexicalHits[i].Score })
+		for i, hit := range vectorHits {
+			c := get(hit.ID)
+			c.Payload = hit.Payload
+			c.Score += vectorWeight * vectorNorm[i]
+		}
+		for i, hit := range lexicalHits {
+			get(hit.ID).Score += lexicalWeight * lexicalNorm[i]
+		}
+	default: // FusionRRF
+		for rank, hit := range vectorHits {
+			c := get(hit.ID)
+			c.Payload = hit.Payload
+			c.Score += vectorWeight / float32(rrfK+rank+1)
+		}
+		for rank, hit := range lexicalHits {
+			get(hit.ID).Score += lexicalWeight / float32(rrfK+rank+1)
+		}
+	}
+
+	fused := make([]fusedCandidate, 0, len(candidates))
+	for _, c := range candidates {
+		fused = append(fused, *c)
+	}
+	sort.Slice(fused, func(i, j int) bool {
+		if fused[i].Score == fused[j].Score {
+			return fused[i].ID < fused[j].ID
+		}
+		return fused[i].Score > fused[j].Score
+	})
+	return fused
+}
+
+// minMaxNormalize scales n scores into [0, 1]. A list where every score is equal maps to 1.
+func minMaxNormalize(n int, score func(i int) float32) []float32 {
+	normalized := make([]float32, n)
+	if n == 0 {
+		return normalized
+	}
+	lo, hi := score(0), score(0)
+	for i := 1; i < n; i++ {
+		s := score(i)
+		if s < lo {
+			lo = s
+		}
+		if s > hi {
+			hi = s
+		}
+	}
+	for i := 0; i < n; i++ {
+		if hi == lo {
+			normalized[i] = 1
+		} else {
+			normalized[i] = (score(i) - lo) / (hi - lo)
+		}
+	}
+	return normalized
+}
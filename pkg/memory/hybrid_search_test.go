@@ -0,0 +1,121 @@
+package memory
+
+import (
+	"math"
+	"testing"
+
+	"github.com/pnocera/gomem/pkg/vectorstores"
+)
+
+func weight(w float32) *float32 {
+	return &w
+}
+
+func TestFuseResults(t *testing.T) {
+	vectorHits := []vectorstores.SearchResult{
+		{ID: "v1", Score: 0.9, Payload: map[string]interface{}{"text": "v1"}},
+		{ID: "shared", Score: 0.5, Payload: map[string]interface{}{"text": "shared"}},
+	}
+	lexicalHits := []LexicalResult{
+		{ID: "shared", Score: 3},
+		{ID: "l1", Score: 1},
+	}
+
+	tests := []struct {
+		name       string
+		opts       *HybridSearchOptions
+		wantIDs    []string
+		wantScores []float32
+	}{
+		{
+			name:       "rrf defaults",
+			opts:       nil,
+			wantIDs:    []string{"shared", "v1", "l1"},
+			wantScores: []float32{1.0/61 + 1.0/62, 1.0 / 61, 1.0 / 62},
+		},
+		{
+			name:       "rrf custom k",
+			opts:       &HybridSearchOptions{Fusion: FusionRRF, RRFK: 1},
+			wantIDs:    []string{"shared", "v1", "l1"},
+			wantScores: []float32{1.0/2 + 1.0/3, 1.0 / 2, 1.0 / 3},
+		},
+		{
+			name:       "rrf zero vector weight",
+			opts:       &HybridSearchOptions{VectorWeight: weight(0)},
+			wantIDs:    []string{"shared", "l1", "v1"},
+			wantScores: []float32{1.0 / 61, 1.0 / 62, 0},
+		},
+		{
+			name:       "rrf zero lexical weight",
+			opts:       &HybridSearchOptions{LexicalWeight: weight(0)},
+			wantIDs:    []string{"v1", "shared", "l1"},
+			wantScores: []float32{1.0 / 61, 1.0 / 62, 0},
+		},
+		{
+			name:       "weighted ties break by ID",
+			opts:       &HybridSearchOptions{Fusion: FusionWeighted},
+			wantIDs:    []string{"shared", "v1", "l1"},
+			wantScores: []float32{1, 1, 0},
+		},
+		{
+			name:       "weighted uneven weights",
+			opts:       &HybridSearchOptions{Fusion: FusionWeighted, VectorWeight: weight(0.5), LexicalWeight: weight(2)},
+			wantIDs:    []string{"shared", "v1", "l1"},
+			wantScores: []float32{2, 0.5, 0},
+		},
+		{
+			name:       "weighted zero vector weight",
+			opts:       &HybridSearchOptions{Fusion: FusionWeighted, VectorWeight: weight(0)},
+			wantIDs:    []string{"shared", "l1", "v1"},
+			wantScores: []float32{1, 0, 0},
+		},
+		{
+			name:       "weighted zero lexical weight",
+			opts:       &HybridSearchOptions{Fusion: FusionWeighted, LexicalWeight: weight(0)},
+			wantIDs:    []string{"v1", "l1", "shared"},
+			wantScores: []float32{1, 0, 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fused := fuseResults(vectorHits, lexicalHits, tt.opts)
+			if len(fused) != len(tt.wantIDs) {
+				t.Fatalf("got %d candidates, want %d", len(fused), len(tt.wantIDs))
+			}
+			for i, c := range fused {
+				if c.ID != tt.wantIDs[i] || math.Abs(float64(c.Score-tt.wantScores[i])) > 1e-6 {
+					t.Errorf("candidate %d = %s (%v), want %s (%v)", i, c.ID, c.Score, tt.wantIDs[i], tt.wantScores[i])
+				}
+				if wantPayload := c.ID != "l1"; (c.Payload != nil) != wantPayload {
+					t.Errorf("candidate %s payload = %v, want one only for vector hits", c.ID, c.Payload)
+				}
+			}
+		})
+	}
+}
+
+func TestMinMaxNormalize(t *testing.T) {
+	tests := []struct {
+		name   string
+		scores []float32
+		want   []float32
+	}{
+		{"empty", nil, []float32{}},
+		{"equal scores", []float32{0.3, 0.3}, []float32{1, 1}},
+		{"spread", []float32{2, 4, 3}, []float32{0, 1, 0.5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := minMaxNormalize(len(tt.scores), func(i int) float32 { return tt.scores[i] })
+			if len(got) != len(tt.want) {
+				t.Fatalf("minMaxNormalize = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("minMaxNormalize = %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
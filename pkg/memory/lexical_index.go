@@ -0,0 +1,218 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/pnocera/gomem/pkg/vectorstores"
+)
+
+// LexicalDocument is a memory text indexed for keyword search.
+type LexicalDocument struct {
+	ID       string                 `json:"id"`
+	Text     string                 `json:"text"`
+	UserID   string                 `json:"user_id,omitempty"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"` // Matched against QueryFilter.Metadata
+}
+
+// LexicalResult is a single keyword search hit.
+type LexicalResult struct {
+	ID    string  `json:"id"`
+	Score float32 `json:"score"`
+}
+
+// LexicalIndex defines the interface for a keyword index kept alongside the vector store.
+type LexicalIndex interface {
+	// Index adds or replaces a document.
+	Index(ctx context.Context, doc LexicalDocument) error
+
+	// Remove deletes a document. Removing an unknown ID is not an error.
+	Remove(ctx context.Context, id string) error
+
+	// Search returns the best matching documents for query, highest score first.
+	Search(ctx context.Context, query string, limit int, filter *vectorstores.QueryFilter) ([]LexicalResult, error)
+}
+
+// BM25Index implements LexicalIndex in memory using Okapi BM25 scoring.
+type BM25Index struct {
+	mu       sync.RWMutex
+	k1       float64
+	b        float64
+	docs     map[string]*bm25Doc
+	docFreq  map[string]int // Number of documents containing each term
+	totalLen int
+}
+
+type bm25Doc struct {
+	doc    LexicalDocument
+	terms  map[string]int
+	length int
+}
+
+// Compile-time check to ensure *BM25Index satisfies the LexicalIndex interface.
+var _ LexicalIndex = (*BM25Index)(nil)
+
+// NewBM25Index creates an empty BM25Index with the usual k1=1.2, b=0.75 parameters.
+func NewBM25Index() *BM25Index {
+	return &BM25Index{
+		k1:      1.2,
+		b:       0.75,
+		docs:    make(map[string]*bm25Doc),
+		docFreq: make(map[string]int),
+	}
+}
+
+// Index adds or replaces a document.
+func (idx *BM25Index) Index(ctx context.Context, doc LexicalDocument) error {
+	if doc.ID == "" {
+		return fmt.Errorf("lexical document ID cannot be empty")
+	}
+	tokens := tokenize(doc.Text)
+	terms := make(map[string]int, len(tokens))
+	for _, t := range tokens {
+		terms[t]++
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.removeLocked(doc.ID)
+	idx.docs[doc.ID] = &bm25Doc{doc: doc, terms: terms, length: len(tokens)}
+	for t := range terms {
+		idx.docFreq[t]++
+	}
+	idx.totalLen += len(tokens)
+	return nil
+}
+
+// Remove deletes a document. Removing an unknown ID is not an error.
+func (idx *BM25Index) Remove(ctx context.Context, id string) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.removeLocked(id)
+	return nil
+}
+
+func (idx *BM25Index) removeLocked(id string) {
+	existing, ok := idx.docs[id]
+	if !ok {
+		return
+	}
+	for t := range existing.terms {
+		idx.docFreq[t]--
+		if idx.docFreq[t] <= 0 {
+			delete(idx.docFreq, t)
+		}
+	}
+	idx.totalLen -= existing.length
+	delete(idx.docs, id)
+}
+
+// Search returns the best matching documents for query, highest score first.
+func (idx *BM25Index) Search(ctx context.Context, query string, limit int, filter *vectorstores.QueryFilter) ([]LexicalResult, error) {
+	queryTerms := tokenize(query)
+	if len(queryTerms) == 0 {
+		return nil, nil
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	n := float64(len(idx.docs))
+	if n == 0 {
+		return nil, nil
+	}
+	avgLen := float64(idx.totalLen) / n
+
+	var results []LexicalResult
+	for id, d := range idx.docs {
+		if !lexicalFilterMatches(d.doc, filter) {
+			continue
+		}
+		var score float64
+		for _, t := range queryTerms {
+			tf := float64(d.terms[t])
+			if tf == 0 {
+				continue
+			}
+			df := float64(idx.docFreq[t])
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			norm := tf + idx.k1*(1-idx.b+idx.b*float64(d.length)/avgLen)
+			score += idf * tf * (idx.k1 + 1) / norm
+		}
+		if score > 0 {
+			results = append(results, LexicalResult{ID: id, Score: float32(score)})
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score == results[j].Score {
+			return results[i].ID < results[j].ID
+		}
+		return results[i].Score > results[j].Score
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// RebuildLexicalIndex indexes every point of the collection that has a text payload, so that
+// an index kept in memory, such as BM25Index, matches the vector store again after a restart.
+// It returns the number of documents indexed.
+func RebuildLexicalIndex(ctx context.Context, idx LexicalIndex, vs vectorstores.VectorStore, collectionName string) (int, error) {
+	const pageSize = 256
+	indexed := 0
+	for offset := uint64(0); ; offset += pageSize {
+		if err := ctx.Err(); err != nil {
+			return indexed, err
+		}
+		page, err := vs.ListVectors(collectionName, pageSize, offset, nil)
+		if err != nil {
+			return indexed, fmt.Errorf("failed to list points of %s: %w", collectionName, err)
+		}
+		for _, p := range page {
+			text, _ := p.Payload["text"].(string)
+			if text == "" {
+				continue
+			}
+			userID, _ := p.Payload["user_id"].(string)
+			if err := idx.Index(ctx, LexicalDocument{ID: p.ID, Text: text, UserID: userID, Metadata: p.Payload}); err != nil {
+				return indexed, fmt.Errorf("failed to index point %s: %w", p.ID, err)
+			}
+			indexed++
+		}
+		if len(page) < pageSize {
+			return indexed, nil
+		}
+	}
+}
+
+// lexicalFilterMatches applies the same scoping rules as a vector store filter.
+func lexicalFilterMatches(doc LexicalDocument, filter *vectorstores.QueryFilter) bool {
+	if filter == nil {
+		return true
+	}
+	if filter.UserID != "" && doc.UserID != filter.UserID {
+		return false
+	}
+	for k, v := range filter.Metadata {
+		dv, ok := doc.Metadata[k]
+		if !ok || fmt.Sprint(dv) != fmt.Sprint(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// tokenize lowercases text and splits it on anything that is not a letter or digit.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
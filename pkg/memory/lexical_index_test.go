@@ -0,0 +1,90 @@
+package memory
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/pnocera/gomem/pkg/vectorstores"
+)
+
+func newTestBM25Index(t *testing.T) *BM25Index {
+	t.Helper()
+	idx := NewBM25Index()
+	docs := []LexicalDocument{
+		{ID: "morning", Text: "I drink coffee every morning", UserID: "u1"},
+		{ID: "coffee", Text: "Coffee, coffee and more coffee!", UserID: "u1", Metadata: map[string]interface{}{"agent_id": "a1"}},
+		{ID: "tea", Text: "I drink tea", UserID: "u2", Metadata: map[string]interface{}{"agent_id": "a1", "run_id": 7}},
+	}
+	for _, doc := range docs {
+		if err := idx.Index(context.Background(), doc); err != nil {
+			t.Fatalf("Index(%s): %v", doc.ID, err)
+		}
+	}
+	return idx
+}
+
+func TestBM25IndexSearch(t *testing.T) {
+	idx := newTestBM25Index(t)
+
+	tests := []struct {
+		name   string
+		query  string
+		limit  int
+		filter *vectorstores.QueryFilter
+		want   []string
+	}{
+		{"term frequency ranks first", "coffee", 0, nil, []string{"coffee", "morning"}},
+		{"case and punctuation ignored", "COFFEE?!", 0, nil, []string{"coffee", "morning"}},
+		{"rare term outweighs common one", "drink morning", 0, nil, []string{"morning", "tea"}},
+		{"limit", "coffee", 1, nil, []string{"coffee"}},
+		{"no match", "juice", 0, nil, nil},
+		{"no terms", "?!", 0, nil, nil},
+		{"user filter", "drink", 0, &vectorstores.QueryFilter{UserID: "u2"}, []string{"tea"}},
+		{"metadata filter", "drink coffee", 0, &vectorstores.QueryFilter{Metadata: map[string]interface{}{"agent_id": "a1"}}, []string{"coffee", "tea"}},
+		{"metadata compared as text", "tea", 0, &vectorstores.QueryFilter{Metadata: map[string]interface{}{"run_id": "7"}}, []string{"tea"}},
+		{"missing metadata key", "coffee", 0, &vectorstores.QueryFilter{Metadata: map[string]interface{}{"run_id": "7"}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := idx.Search(context.Background(), tt.query, tt.limit, tt.filter)
+			if err != nil {
+				t.Fatalf("Search: %v", err)
+			}
+			var got []string
+			for _, r := range results {
+				got = append(got, r.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Search(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBM25IndexReplaceAndRemove(t *testing.T) {
+	ctx := context.Background()
+	idx := newTestBM25Index(t)
+
+	if err := idx.Index(ctx, LexicalDocument{ID: "coffee", Text: "green tea", UserID: "u1"}); err != nil {
+		t.Fatalf("Index: %v", err)
+	}
+	if err := idx.Remove(ctx, "morning"); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if err := idx.Remove(ctx, "unknown"); err != nil {
+		t.Errorf("Remove of an unknown ID: %v", err)
+	}
+
+	results, err := idx.Search(ctx, "coffee", 0, nil)
+	if err != nil || len(results) != 0 {
+		t.Errorf("Search(coffee) = %v, %v; want no hits after the replace and remove", results, err)
+	}
+	results, err = idx.Search(ctx, "tea", 0, nil)
+	if err != nil || len(results) != 2 {
+		t.Errorf("Search(tea) = %v, %v; want the replaced document and tea", results, err)
+	}
+	if err := idx.Index(ctx, LexicalDocument{Text: "no id"}); err == nil {
+		t.Error("Index accepted a document without an ID")
+	}
+}
@@ -0,0 +1,171 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationFiles holds the up-migrations of each history store dialect, one directory per
+// dialect. Files are named NNNN_description.sql and applied in version order.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// ErrSchemaTooNew is returned when a database was migrated by a newer binary.
+var ErrSchemaTooNew = errors.New("database schema is newer than this binary supports")
+
+// Migration is one embedded up-migration.
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// MigrationPlan describes the migrations between a database's schema version and the
+// latest one known to the binary.
+type MigrationPlan struct {
+	Current  int         // Version recorded in schema_version, 0 for an empty database
+	Target   int         // Latest embedded version
+	Baseline bool        // A history table predating schema_version is recorded as version 1
+	Pending  []Migration // Migrations to apply, in order
+}
+
+// loadMigrations reads the migrations of dialect, checking that versions run from 1 without gaps.
+func loadMigrations(dialect string) ([]Migration, error) {
+	dir := path.Join("migrations", dialect)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s migrations: %w", dialect, err)
+	}
+	var migrations []Migration
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".sql") {
+			continue
+		}
+		prefix, _, ok := strings.Cut(name, "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s/%s is not named NNNN_description.sql", dialect, name)
+		}
+		data, err := fs.ReadFile(migrationFiles, path.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", name, err)
+		}
+		migrations = append(migrations, Migration{Version: version, Name: strings.TrimSuffix(name, ".sql"), SQL: string(data)})
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("%s migrations are not numbered consecutively from 1 at %s", dialect, m.Name)
+		}
+	}
+	return migrations, nil
+}
+
+// migrator applies the migrations of one dialect to a database.
+type migrator struct {
+	db         *sql.DB
+	migrations []Migration
+	// placeholder returns the bind parameter for the n-th argument, starting at 1.
+	placeholder func(n int) string
+	// tableExists reports whether a table exists in the database.
+	tableExists func(ctx context.Context, db *sql.DB, table string) (bool, error)
+	// lock, when set, serializes migrations across processes sharing the database.
+	lock func(ctx context.Context, db *sql.DB) (unlock func(), err error)
+}
+
+// plan reads the database's schema version and returns the migrations it is missing. It
+// fails with ErrSchemaTooNew when the database is ahead of the embedded migrations.
+func (m *migrator) plan(ctx context.Context) (*MigrationPlan, error) {
+	plan := &MigrationPlan{Target: len(m.migrations)}
+	versioned, err := m.tableExists(ctx, m.db, "schema_version")
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up schema_version table: %w", err)
+	}
+	if versioned {
+		var current sql.NullInt64
+		if err := m.db.QueryRowContext(ctx, `SELECT MAX(version) FROM schema_version`).Scan(&current); err != nil {
+			return nil, fmt.Errorf("failed to read schema version: %w", err)
+		}
+		plan.Current = int(current.Int64)
+	}
+	if plan.Current == 0 {
+		legacy, err := m.tableExists(ctx, m.db, "history")
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up history table: %w", err)
+		}
+		if legacy {
+			plan.Baseline = true
+			plan.Current = 1
+		}
+	}
+	if plan.Current > plan.Target {
+		return nil, fmt.Errorf("%w: database is at version %d, binary supports up to %d", ErrSchemaTooNew, plan.Current, plan.Target)
+	}
+	plan.Pending = m.migrations[plan.Current:]
+	return plan, nil
+}
+
+// migrate brings the database to the latest version and returns the plan it followed. With
+// dryRun it only returns the plan. Each migration runs in its own transaction together with
+// its schema_version row.
+func (m *migrator) migrate(ctx context.Context, dryRun bool) (*MigrationPlan, error) {
+	if m.lock != nil && !dryRun {
+		unlock, err := m.lock(ctx, m.db)
+		if err != nil {
+			return nil, fmt.Errorf("failed to lock schema migrations: %w", err)
+		}
+		defer unlock()
+	}
+	plan, err := m.plan(ctx)
+	if err != nil || dryRun {
+		return plan, err
+	}
+	if len(plan.Pending) == 0 && !plan.Baseline {
+		return plan, nil
+	}
+
+	if _, err := m.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)`); err != nil {
+		return nil, fmt.Errorf("failed to create schema_version table: %w", err)
+	}
+	record := fmt.Sprintf(`INSERT INTO schema_version (version, name, applied_at) VALUES (%s, %s, %s)`,
+		m.placeholder(1), m.placeholder(2), m.placeholder(3))
+
+	if plan.Baseline {
+		if _, err := m.db.ExecContext(ctx, record, 1, m.migrations[0].Name, time.Now().UTC()); err != nil {
+			return nil, fmt.Errorf("failed to record baseline schema version: %w", err)
+		}
+	}
+	for _, migration := range plan.Pending {
+		tx, err := m.db.BeginTx(ctx, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to begin migration %s: %w", migration.Name, err)
+		}
+		if _, err := tx.ExecContext(ctx, migration.SQL); err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("failed to apply migration %s: %w", migration.Name, err)
+		}
+		if _, err := tx.ExecContext(ctx, record, migration.Version, migration.Name, time.Now().UTC()); err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("failed to record migration %s: %w", migration.Name, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, fmt.Errorf("failed to commit migration %s: %w", migration.Name, err)
+		}
+	}
+	return plan, nil
+}
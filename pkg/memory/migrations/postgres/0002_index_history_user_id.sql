@@ -0,0 +1,2 @@
+-- Serves QueryHistory filtered by user and time range.
+CREATE INDEX IF NOT EXISTS idx_history_user_id ON history (user_id, timestamp);
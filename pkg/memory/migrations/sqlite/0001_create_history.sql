@@ -0,0 +1,18 @@
+-- The history table as created before schema versioning.
+CREATE TABLE IF NOT EXISTS history (
+	event_id TEXT PRIMARY KEY,
+	memory_id TEXT,
+	event_type TEXT NOT NULL,
+	timestamp DATETIME NOT NULL,
+	user_id TEXT,
+	agent_id TEXT,
+	run_id TEXT,
+	actor_id TEXT,
+	old_memory TEXT,
+	new_memory TEXT,
+	search_query TEXT,
+	details TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_history_memory_id ON history (memory_id);
+CREATE INDEX IF NOT EXISTS idx_history_timestamp ON history (timestamp);
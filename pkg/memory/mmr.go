@@ -0,0 +1,61 @@
+package memory
+
+import "github.com/pnocera/gomem/internal/vecmath"
+
+const defaultMMRLambda = 0.5
+
+// selectMMR picks up to k candidates by maximal marginal relevance:
+// each step takes the candidate maximizing
+//
+//	lambda * relevance(d) - (1 - lambda) * max sim(d, selected)
+//
+// relevance is the candidate's RerankScore when the results were reranked, and its Score
+// otherwise, min-max normalized to [0, 1] so that lambda trades it off against the cosine
+// similarity on a comparable scale whether it came from vector similarity, rank fusion or a
+// reranker. vectors[i] is the embedding of candidates[i]; a nil vector is never penalized for
+// redundancy.
+func selectMMR(candidates []MemoryResult, vectors [][]float32, lambda float32, k int) []MemoryResult {
+	if k <= 0 || len(candidates) == 0 {
+		return nil
+	}
+
+	relevance := minMaxNormalize(len(candidates), func(i int) float32 {
+		if candidates[i].RerankScore != nil {
+			return *candidates[i].RerankScore
+		}
+		return candidates[i].Score
+	})
+
+	// maxSimilarity[i] tracks the highest similarity between candidate i and anything already selected.
+	maxSimilarity := make([]float32, len(candidates))
+	used := make([]bool, len(candidates))
+	selected := make([]MemoryResult, 0, k)
+	for len(selected) < k && len(selected) < len(candidates) {
+		best := -1
+		var bestScore float32
+		for i := range candidates {
+			if used[i] {
+				continue
+			}
+			score := lambda*relevance[i] - (1-lambda)*maxSimilarity[i]
+			if best < 0 || score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		used[best] = true
+		selected = append(selected, candidates[best])
+
+		if vectors[best] == nil {
+			continue
+		}
+		for i := range candidates {
+			if used[i] || vectors[i] == nil {
+				continue
+			}
+			if sim := vecmath.Cosine(vectors[i], vectors[best]); sim > maxSimilarity[i] {
+				maxSimilarity[i] = sim
+			}
+		}
+	}
+	return selected
+}
@@ -0,0 +1,83 @@
+package memory
+
+import (
+	"context"
+	"testing"
+)
+
+func resultIDs(results []MemoryResult) []string {
+	ids := make([]string, len(results))
+	for i, r := range results {
+		ids[i] = r.ID
+	}
+	return ids
+}
+
+func equalIDs(got []MemoryResult, want ...string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i, r := range got {
+		if r.ID != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSelectMMRKeepsRerankedOrder(t *testing.T) {
+	// Retrieval ranks a > b > c; the reranker reverses it.
+	candidates := []MemoryResult{
+		{ID: "a", Memory: "a", Score: 0.9},
+		{ID: "b", Memory: "b", Score: 0.8},
+		{ID: "c", Memory: "c", Score: 0.7},
+	}
+	reranked, err := rerankResults(context.Background(), scriptedReranker{"a": 0.1, "b": 0.5, "c": 0.9}, "q", candidates)
+	if err != nil {
+		t.Fatalf("rerankResults: %v", err)
+	}
+	embeddings := map[string][]float32{"a": {1, 0}, "b": {0, 1}, "c": {1, 1}}
+	vectors := make([][]float32, len(reranked))
+	for i, r := range reranked {
+		vectors[i] = embeddings[r.ID]
+	}
+	if got := selectMMR(reranked, vectors, 1, 3); !equalIDs(got, "c", "b", "a") {
+		t.Errorf("selectMMR with lambda 1 = %v, want the reranked order [c b a]", resultIDs(got))
+	}
+}
+
+func TestSelectMMR(t *testing.T) {
+	// a2 repeats a; b is less relevant but different.
+	candidates := []MemoryResult{
+		{ID: "a", Score: 1},
+		{ID: "a2", Score: 0.9},
+		{ID: "b", Score: 0.5},
+	}
+	vectors := [][]float32{{1, 0}, {1, 0}, {0, 1}}
+
+	tests := []struct {
+		name    string
+		lambda  float32
+		k       int
+		vectors [][]float32
+		want    []string
+	}{
+		{"lambda 1 keeps relevance order", 1, 3, vectors, []string{"a", "a2", "b"}},
+		{"lambda 0.5 demotes the duplicate", 0.5, 3, vectors, []string{"a", "b", "a2"}},
+		{"lambda 0 picks by diversity alone", 0, 3, vectors, []string{"a", "b", "a2"}},
+		{"k below the candidates", 0.5, 2, vectors, []string{"a", "b"}},
+		{"k above the candidates", 0.5, 5, vectors, []string{"a", "b", "a2"}},
+		{"k 0", 0.5, 0, vectors, nil},
+		{"nil vector is not penalized", 0.5, 3, [][]float32{{1, 0}, nil, {0, 1}}, []string{"a", "a2", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := selectMMR(candidates, tt.vectors, tt.lambda, tt.k); !equalIDs(got, tt.want...) {
+				t.Errorf("selectMMR = %v, want %v", resultIDs(got), tt.want)
+			}
+		})
+	}
+	if got := selectMMR(nil, nil, 0.5, 3); got != nil {
+		t.Errorf("selectMMR without candidates = %v, want nil", resultIDs(got))
+	}
+}
@@ -0,0 +1,194 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/pnocera/gomem/pkg/vectorstores"
+)
+
+const (
+	// VectorNameFact embeds the extracted facts, or the processed text when no facts were extracted.
+	VectorNameFact = "fact"
+	// VectorNameRawText embeds the original conversation snippet.
+	VectorNameRawText = "raw_text"
+)
+
+// namedVectorTexts returns the text each named vector is computed from.
+func namedVectorTexts(factText string, rawText string) map[string]string {
+	if rawText == "" {
+		rawText = factText
+	}
+	return map[string]string{
+		VectorNameFact:    factText,
+		VectorNameRawText: rawText,
+	}
+}
+
+// embedNamedVectors computes one embedding per configured vector name.
+func embedNamedVectors(ctx context.Context, client OpenAIClient, names []string, factText string, rawText string) (map[string][]float32, error) {
+	texts := namedVectorTexts(factText, rawText)
+	vectors := make(map[string][]float32, len(names))
+	for _, name := range names {
+		text, ok := texts[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown named vector %q", name)
+		}
+		embedding, err := client.GetEmbedding(ctx, text)
+		if err != nil {
+			return nil, fmt.Errorf("error embedding %s vector: %w", name, err)
+		}
+		vectors[name] = embedding
+	}
+	return vectors, nil
+}
+
+// rawConversationText renders messages as "role: content" lines.
+func rawConversationText(messages []Message) string {
+	lines := make([]string, 0, len(messages))
+	for _, m := range messages {
+		lines = append(lines, m.Role+": "+m.Content)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// configuredVectorNames returns the named vectors of the configured embedder, or nil for a single unnamed vector.
+func configuredVectorNames(cfg *Config) []string {
+	if cfg == nil || cfg.Embedder == nil {
+		return nil
+	}
+	return cfg.Embedder.NamedVectors
+}
+
+// targetVectorNames returns the named vectors a search targets: req.Vectors, defaulting to
+// the first configured name. It returns nil for collections with a single unnamed vector.
+func targetVectorNames(cfg *Config, req *SearchMemoryRequest) ([]string, error) {
+	configured := configuredVectorNames(cfg)
+	if len(configured) == 0 {
+		if len(req.Vectors) > 0 {
+			return nil, fmt.Errorf("request targets named vectors %v but the embedder has no named vectors configured", req.Vectors)
+		}
+		return nil, nil
+	}
+
+	names := req.Vectors
+	if len(names) == 0 {
+		names = configured[:1]
+	}
+	for _, name := range names {
+		found := false
+		for _, c := range configured {
+			if c == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("named vector %q is not configured (have %v)", name, configured)
+		}
+	}
+	return names, nil
+}
+
+// vectorWeight returns the weight of the named vector in req, default 1.
+func vectorWeight(req *SearchMemoryRequest, name string) float32 {
+	if w, ok := req.VectorWeights[name]; ok {
+		return w
+	}
+	return 1
+}
+
+// targetedVector returns the embedding of stored in the space a search compares against:
+// the unnamed vector, the single targeted named vector, or, when several names are targeted,
+// the concatenation of each unit-length named vector scaled by the square root of its share
+// of the weights. The cosine of two such concatenations is the weighted mean of the per-name
+// cosines, the same weighting searchVectors applies to scores. It returns nil when a targeted
+// vector is missing.
+func targetedVector(names []string, req *SearchMemoryRequest, stored *vectorstores.SearchResult) []float32 {
+	if len(names) == 0 {
+		return stored.Vector
+	}
+	if len(names) == 1 {
+		return stored.Vectors[names[0]]
+	}
+
+	var total float64
+	for _, name := range names {
+		if w := vectorWeight(req, name); w > 0 {
+			total += float64(w)
+		}
+	}
+	if total == 0 {
+		return nil
+	}
+	var combined []float32
+	for _, name := range names {
+		w := vectorWeight(req, name)
+		if w <= 0 {
+			continue
+		}
+		v := stored.Vectors[name]
+		var norm float64
+		for _, x := range v {
+			norm += float64(x) * float64(x)
+		}
+		if norm == 0 {
+			return nil
+		}
+		scale := math.Sqrt(float64(w)/total) / math.Sqrt(norm)
+		for _, x := range v {
+			combined = append(combined, float32(float64(x)*scale))
+		}
+	}
+	return combined
+}
+
+// searchVectors runs the vector part of a search. Collections with named vectors are
+// searched on req.Vectors (defaulting to the first configured name); when several names
+// are targeted their scores are combined with a weighted sum using req.VectorWeights.
+func searchVectors(vs vectorstores.VectorStore, cfg *Config, collectionName string, queryEmbedding []float32, req *SearchMemoryRequest, limit int, filter *vectorstores.QueryFilter) ([]vectorstores.SearchResult, error) {
+	names, err := targetVectorNames(cfg, req)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return vs.Search(collectionName, queryEmbedding, limit, filter)
+	}
+	if len(names) == 1 {
+		return vs.SearchNamed(collectionName, names[0], queryEmbedding, limit, filter)
+	}
+
+	combined := make(map[string]*vectorstores.SearchResult)
+	for _, name := range names {
+		weight := vectorWeight(req, name)
+		hits, err := vs.SearchNamed(collectionName, name, queryEmbedding, limit, filter)
+		if err != nil {
+			return nil, fmt.Errorf("error searching named vector %s: %w", name, err)
+		}
+		for _, hit := range hits {
+			c, ok := combined[hit.ID]
+			if !ok {
+				c = &vectorstores.SearchResult{ID: hit.ID, Payload: hit.Payload}
+				combined[hit.ID] = c
+			}
+			c.Score += weight * hit.Score
+		}
+	}
+	results := make([]vectorstores.SearchResult, 0, len(combined))
+	for _, c := range combined {
+		results = append(results, *c)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score == results[j].Score {
+			return results[i].ID < results[j].ID
+		}
+		return results[i].Score > results[j].Score
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
@@ -0,0 +1,354 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	_ "github.com/jackc/pgx/v5/stdlib" // Registers the default "pgx" driver
+)
+
+// Defaults of PostgresHistoryConfig.
+const (
+	defaultPostgresDriver       = "pgx"
+	defaultPostgresHistoryBatch = 100
+)
+
+// postgresMigrationLockKey is the advisory lock held while migrating.
+const postgresMigrationLockKey = 0x676f6d656d
+
+// historyInsertColumns is the number of columns written per event.
+const historyInsertColumns = 12
+
+// maxPostgresHistoryBatch keeps a batch INSERT within PostgreSQL's limit of 65535 bind
+// parameters per statement.
+const maxPostgresHistoryBatch = 65535 / historyInsertColumns
+
+// PostgresHistoryStore implements the HistoryStore interface on PostgreSQL, for workers on
+// several hosts sharing one history. It goes through database/sql with pgx's driver, which
+// this package registers; set DriverName to use another one, such as lib/pq, imported by
+// the binary.
+//
+// Concurrent LogEvent calls are written together: while one batch is being inserted the
+// next calls queue up and are flushed as a single multi-row INSERT. LogEvent still returns
+// only once its event is stored.
+type PostgresHistoryStore struct {
+	db        *sql.DB
+	batchSize int
+
+	mu     sync.RWMutex // Guards closed against concurrent LogEvent calls
+	closed bool
+	queue  chan *pendingHistoryEvent
+	done   chan struct{} // Closed by Close to stop the batch writer
+	wg     sync.WaitGroup
+}
+
+// pendingHistoryEvent is a LogEvent call waiting for its batch.
+type pendingHistoryEvent struct {
+	event  *MemoryEvent
+	ctx    context.Context
+	result chan error
+}
+
+// Compile-time check to ensure *PostgresHistoryStore satisfies the HistoryStore interface.
+var _ HistoryStore = (*PostgresHistoryStore)(nil)
+
+// NewPostgresHistoryStore connects to the database of cfg and migrates its history schema.
+func NewPostgresHistoryStore(ctx context.Context, cfg *PostgresHistoryConfig) (*PostgresHistoryStore, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid postgres history config: %w", err)
+	}
+	driver := cfg.DriverName
+	if driver == "" {
+		driver = defaultPostgresDriver
+	}
+	db, err := sql.Open(driver, cfg.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open postgres database with driver %q (is it imported?): %w", driver, err)
+	}
+	if cfg.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(cfg.MaxOpenConns)
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping postgres database: %w", err)
+	}
+	if _, err := newPostgresMigrator(db).migrate(ctx, false); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate history schema: %w", err)
+	}
+
+	batchSize := cfg.BatchSize
+	if batchSize == 0 {
+		batchSize = defaultPostgresHistoryBatch
+	}
+	s := &PostgresHistoryStore{
+		db:        db,
+		batchSize: batchSize,
+		queue:     make(chan *pendingHistoryEvent, batchSize),
+		done:      make(chan struct{}),
+	}
+	s.wg.Add(1)
+	go s.writeBatches()
+	return s, nil
+}
+
+// MigratePostgresHistoryStore brings the history schema of the database of cfg to the
+// latest version, as NewPostgresHistoryStore does on startup. With dryRun it only reports
+// the migrations that would run.
+func MigratePostgresHistoryStore(ctx context.Context, cfg *PostgresHistoryConfig, dryRun bool) (*MigrationPlan, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid postgres history config: %w", err)
+	}
+	driver := cfg.DriverName
+	if driver == "" {
+		driver = defaultPostgresDriver
+	}
+	db, err := sql.Open(driver, cfg.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open postgres database with driver %q (is it imported?): %w", driver, err)
+	}
+	defer db.Close()
+	return newPostgresMigrator(db).migrate(ctx, dryRun)
+}
+
+// newPostgresMigrator returns a migrator for the embedded PostgreSQL migrations. Hosts
+// starting together take turns through a session advisory lock.
+func newPostgresMigrator(db *sql.DB) *migrator {
+	migrations, err := loadMigrations("postgres")
+	if err != nil {
+		// The migrations are embedded, so this only fails for a broken build.
+		panic(err)
+	}
+	return &migrator{
+		db:          db,
+		migrations:  migrations,
+		placeholder: postgresPlaceholder,
+		tableExists: func(ctx context.Context, db *sql.DB, table string) (bool, error) {
+			var exists bool
+			err := db.QueryRowContext(ctx, `SELECT EXISTS (
+				SELECT 1 FROM information_schema.tables
+				WHERE table_schema = current_schema() AND table_name = $1
+			)`, table).Scan(&exists)
+			return exists, err
+		},
+		lock: func(ctx context.Context, db *sql.DB) (func(), error) {
+			conn, err := db.Conn(ctx)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, postgresMigrationLockKey); err != nil {
+				conn.Close()
+				return nil, err
+			}
+			return func() {
+				conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, postgresMigrationLockKey)
+				conn.Close()
+			}, nil
+		},
+	}
+}
+
+// postgresPlaceholder returns the n-th PostgreSQL bind parameter.
+func postgresPlaceholder(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
+
+// LogEvent records a memory event, returning once the batch holding it is stored.
+func (s *PostgresHistoryStore) LogEvent(ctx context.Context, event *MemoryEvent) error {
+	if event.EventID == "" {
+		event.EventID = uuid.New().String()
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+	event.Timestamp = event.Timestamp.UTC()
+
+	pending := &pendingHistoryEvent{event: event, ctx: ctx, result: make(chan error, 1)}
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		return fmt.Errorf("PostgresHistoryStore is closed")
+	}
+	select {
+	case <-ctx.Done():
+		s.mu.RUnlock()
+		return ctx.Err()
+	case s.queue <- pending:
+	}
+	s.mu.RUnlock()
+
+	select {
+	case err := <-pending.result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// writeBatches inserts queued events until the store is closed, taking every event queued
+// while the previous batch was written, up to batchSize. Events still queued at Close are
+// written before it returns.
+func (s *PostgresHistoryStore) writeBatches() {
+	defer s.wg.Done()
+	for {
+		var batch []*pendingHistoryEvent
+		select {
+		case first := <-s.queue:
+			batch = append(batch, first)
+		case <-s.done:
+			for {
+				batch = s.drainQueue(nil)
+				if len(batch) == 0 {
+					return
+				}
+				s.insertBatch(batch)
+			}
+		}
+		s.insertBatch(s.drainQueue(batch))
+	}
+}
+
+// drainQueue appends queued events to batch, without waiting, until it holds batchSize.
+func (s *PostgresHistoryStore) drainQueue(batch []*pendingHistoryEvent) []*pendingHistoryEvent {
+	for len(batch) < s.batchSize {
+		select {
+		case next := <-s.queue:
+			batch = append(batch, next)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+// insertBatch stores batch with one INSERT. When that fails, for instance on a duplicate
+// event ID, the events are retried one by one so that each caller gets its own error.
+func (s *PostgresHistoryStore) insertBatch(batch []*pendingHistoryEvent) {
+	var live []*pendingHistoryEvent
+	for _, p := range batch {
+		if err := p.ctx.Err(); err != nil {
+			p.result <- err
+			continue
+		}
+		live = append(live, p)
+	}
+	if len(live) == 0 {
+		return
+	}
+	if len(live) > 1 {
+		events := make([]*MemoryEvent, len(live))
+		for i, p := range live {
+			events[i] = p.event
+		}
+		if err := s.insertEvents(context.Background(), events); err == nil {
+			for _, p := range live {
+				p.result <- nil
+			}
+			return
+		}
+	}
+	for _, p := range live {
+		p.result <- s.insertEvents(p.ctx, []*MemoryEvent{p.event})
+	}
+}
+
+// insertEvents writes events with a single multi-row INSERT.
+func (s *PostgresHistoryStore) insertEvents(ctx context.Context, events []*MemoryEvent) error {
+	rows := make([]string, len(events))
+	args := make([]interface{}, 0, len(events)*historyInsertColumns)
+	for i, event := range events {
+		detailsJSON, err := json.Marshal(event.Details)
+		if err != nil {
+			return fmt.Errorf("failed to marshal event details to JSON: %w", err)
+		}
+		params := make([]string, historyInsertColumns)
+		for j := range params {
+			params[j] = postgresPlaceholder(len(args) + j + 1)
+		}
+		params[historyInsertColumns-1] += "::jsonb"
+		rows[i] = "(" + strings.Join(params, ", ") + ")"
+		args = append(args,
+			event.EventID,
+			sql.NullString{String: event.MemoryID, Valid: event.MemoryID != ""},
+			event.EventType,
+			event.Timestamp,
+			sql.NullString{String: event.UserID, Valid: event.UserID != ""},
+			sql.NullString{String: event.AgentID, Valid: event.AgentID != ""},
+			sql.NullString{String: event.RunID, Valid: event.RunID != ""},
+			sql.NullString{String: event.ActorID, Valid: event.ActorID != ""},
+			sql.NullString{String: event.OldMemory, Valid: event.OldMemory != ""},
+			sql.NullString{String: event.NewMemory, Valid: event.NewMemory != ""},
+			sql.NullString{String: event.SearchQuery, Valid: event.SearchQuery != ""},
+			string(detailsJSON),
+		)
+	}
+	stmt := `INSERT INTO history (
+			event_id, memory_id, event_type, timestamp, user_id, agent_id,
+			run_id, actor_id, old_memory, new_memory, search_query, details
+		) VALUES ` + strings.Join(rows, ", ")
+	if _, err := s.db.ExecContext(ctx, stmt, args...); err != nil {
+		return fmt.Errorf("failed to insert history events: %w", err)
+	}
+	return nil
+}
+
+// GetHistory retrieves all events for a specific memory ID, ordered by timestamp.
+func (s *PostgresHistoryStore) GetHistory(ctx context.Context, memoryID string) ([]*MemoryEvent, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+historyColumns+` FROM history WHERE memory_id = $1 ORDER BY timestamp ASC, event_id ASC`, memoryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query history for memory_id %s: %w", memoryID, err)
+	}
+	defer rows.Close()
+	return scanHistoryRows(rows)
+}
+
+// QueryHistory returns a page of the events matching query; see SQLiteHistoryStore.QueryHistory.
+func (s *PostgresHistoryStore) QueryHistory(ctx context.Context, query *HistoryQuery) (*HistoryPage, error) {
+	stmt, args, limit, err := historyQuerySQL(query, postgresPlaceholder)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.db.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query history: %w", err)
+	}
+	defer rows.Close()
+
+	events, err := scanHistoryRows(rows)
+	if err != nil {
+		return nil, err
+	}
+	return historyPage(events, limit), nil
+}
+
+// Reset clears all history.
+func (s *PostgresHistoryStore) Reset(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM history`); err != nil {
+		return fmt.Errorf("failed to clear history table: %w", err)
+	}
+	return nil
+}
+
+// Close writes the events still queued, stops the batch writer and closes the connection pool.
+func (s *PostgresHistoryStore) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil // Already closed
+	}
+	s.closed = true
+	s.mu.Unlock()
+
+	close(s.done)
+	s.wg.Wait()
+	if err := s.db.Close(); err != nil {
+		return fmt.Errorf("failed to close postgres database: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package memory_test
+
+import (
+	"context"
+	"testing"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+
+	"github.com/pnocera/gomem/pkg/memory"
+	"github.com/pnocera/gomem/pkg/memory/historytest"
+)
+
+// TestPostgresHistoryStore needs local PostgreSQL binaries and a non-root user; see
+// historytest.StartPostgres.
+func TestPostgresHistoryStore(t *testing.T) {
+	dsn := historytest.StartPostgres(t)
+	historytest.Run(t, func(t *testing.T) memory.HistoryStore {
+		store, err := memory.NewPostgresHistoryStore(context.Background(), &memory.PostgresHistoryConfig{DSN: dsn})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	})
+}
+
+func TestPostgresHistoryConfigBatchSize(t *testing.T) {
+	tests := []struct {
+		batchSize int
+		wantErr   bool
+	}{
+		{0, false},
+		{5461, false},
+		{5462, true},
+	}
+	for _, tt := range tests {
+		cfg := &memory.PostgresHistoryConfig{DSN: "postgres://localhost/gomem", BatchSize: tt.batchSize}
+		if err := cfg.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("Validate with BatchSize %d: err = %v, wantErr %v", tt.batchSize, err, tt.wantErr)
+		}
+	}
+}
@@ -80,6 +80,7 @@ func (w *ProcessingWorker) handleProcessMessage(payload []byte) error {
 	}
 
 	memoryID := uuid.New().String() // Or use an ID from AddMemoryRequest if it were to carry one
+	hash := ContentHash(processedText)
 
 	var extractedFacts []string
 	if w.cfg.EnableInfer && w.openai != nil {
@@ -108,6 +109,7 @@ func (w *ProcessingWorker) handleProcessMessage(payload []byte) error {
 		ProcessedText:    processedText,
 		MemoryID:         memoryID,
 		ExtractedFacts:   extractedFacts,
+		Hash:             hash,
 	}
 
 	jsonData, err := json.Marshal(processedData)
@@ -144,6 +146,7 @@ func (w *ProcessingWorker) handleProcessMessage(payload []byte) error {
 			"original_message_count": len(addReq.Messages),
 			"processed_text_length":  len(processedText),
 			"facts_extracted_count":  len(extractedFacts),
+			"hash":                   hash,
 		},
 	}
 	eventData, err := json.Marshal(historyEvent)
@@ -13,17 +13,20 @@ import (
 
 // QdrantWorker handles storing embeddings in Qdrant.
 type QdrantWorker struct {
-	nc  NATSClient
-	cfg *Config
-	vs  vectorstores.VectorStore
+	nc         NATSClient
+	cfg        *Config
+	vs         vectorstores.VectorStore
+	lexical    LexicalIndex // Optional keyword index used by hybrid search
+	vectorSize int          // Dimension of the bootstrapped collection, 0 until Start succeeds
 }
 
-// NewQdrantWorker creates a new QdrantWorker.
-func NewQdrantWorker(nc NATSClient, cfg *Config, vs vectorstores.VectorStore) *QdrantWorker {
+// NewQdrantWorker creates a new QdrantWorker. lexical may be nil when hybrid search is not used.
+func NewQdrantWorker(nc NATSClient, cfg *Config, vs vectorstores.VectorStore, lexical LexicalIndex) *QdrantWorker {
 	return &QdrantWorker{
-		nc:  nc,
-		cfg: cfg,
-		vs:  vs,
+		nc:      nc,
+		cfg:     cfg,
+		vs:      vs,
+		lexical: lexical,
 	}
 }
 
@@ -38,6 +41,29 @@ func (w *QdrantWorker) Start(ctx context.Context) error {
 		fmt.Println("QdrantWorker: VectorStore client (vs) is nil, worker will not start effectively.")
 		// Depending on requirements, may still start to listen but log errors in handler.
 		// For shell, let's proceed but note it.
+	} else {
+		// Bootstrap the collection before accepting writes so a fresh deployment works on first
+		// insert and a changed embedding model is caught at boot rather than on corrupt data.
+		info, err := BootstrapVectorStore(w.vs, w.cfg)
+		if err != nil {
+			return fmt.Errorf("QdrantWorker: collection bootstrap failed: %w", err)
+		}
+		w.vectorSize = info.VectorSize
+		fmt.Printf("QdrantWorker: Collection %s ready (%d dimensions, %d points)\n", info.Name, info.VectorSize, info.PointCount)
+
+		// The lexical index may live in memory only; reload it so hybrid search sees the
+		// memories stored before this start.
+		if w.lexical != nil {
+			collectionName, err := vectorCollectionName(w.cfg)
+			if err != nil {
+				return fmt.Errorf("QdrantWorker: %w", err)
+			}
+			indexed, err := RebuildLexicalIndex(ctx, w.lexical, w.vs, collectionName)
+			if err != nil {
+				return fmt.Errorf("QdrantWorker: lexical index rebuild failed: %w", err)
+			}
+			fmt.Printf("QdrantWorker: Lexical index rebuilt from %d points\n", indexed)
+		}
 	}
 
 	fmt.Printf("QdrantWorker started, listening on topic: %s\n", w.cfg.TopicMemoryVectorStoreAdd)
@@ -69,21 +95,34 @@ func (w *QdrantWorker) handleVectorStoreAddMessage(payload []byte) error {
 	}
 
 	// Prepare VectorInput for VectorStore
-	// Assuming Qdrant collection name is configured in w.cfg.VectorStoreConfig.Config.(*vectorstores.QdrantConfig).CollectionName
-	collectionName := "default_collection" // Fallback
-	if w.cfg.VectorStoreConfig != nil {
-		if qdrantCfg, ok := w.cfg.VectorStoreConfig.Config.(*vectorstores.QdrantConfig); ok {
-			collectionName = qdrantCfg.CollectionName
-		} else {
-			fmt.Println("QdrantWorker: VectorStoreConfig.Config is not *vectorstores.QdrantConfig")
+	collectionName, err := vectorCollectionName(w.cfg)
+	if err != nil {
+		fmt.Printf("QdrantWorker: %v\n", err)
+		return err
+	}
+	if err := w.checkDimensions(&embeddingData); err != nil {
+		fmt.Printf("QdrantWorker: Refusing to store MemoryID %s in collection %s: %v\n", embeddingData.MemoryID, collectionName, err)
+		return fmt.Errorf("refusing to store memory %s in collection %s: %w", embeddingData.MemoryID, collectionName, err)
+	}
+
+	hash := embeddingData.Hash
+	if hash == "" {
+		hash = ContentHash(embeddingData.ProcessedText)
+	}
+	if w.cfg.DuplicatePolicy != "allow" && !isEmptyScope(embeddingData.BaseRequestInfo) {
+		existing, err := w.findDuplicate(collectionName, embeddingData.BaseRequestInfo, hash)
+		if err != nil {
+			// Failing open keeps ingestion available; the worst case is a stored duplicate.
+			fmt.Printf("QdrantWorker: Error looking up duplicates for MemoryID %s: %v\n", embeddingData.MemoryID, err)
+		} else if existing != nil {
+			return w.handleDuplicate(collectionName, &embeddingData, hash, existing)
 		}
-	} else {
-		fmt.Println("QdrantWorker: VectorStoreConfig is nil in main Config")
 	}
 
 	vectorInput := vectorstores.VectorInput{
 		ID:        embeddingData.MemoryID, // Using MemoryID as the vector ID
 		Embedding: embeddingData.Embedding,
+		Vectors:   embeddingData.Embeddings,
 		Payload: map[string]interface{}{
 			"text":          embeddingData.ProcessedText, // Or TextToEmbed
 			"user_id":       embeddingData.UserID,
@@ -92,23 +131,41 @@ func (w *QdrantWorker) handleVectorStoreAddMessage(payload []byte) error {
 			"actor_id":      embeddingData.ActorID,                     // If ActorID was added to EmbeddingData from ProcessedMemoryData
 			"original_text": embeddingData.TextToEmbed,                 // Assuming ProcessedText is the one embedded
 			"timestamp":     time.Now().UTC().Format(time.RFC3339Nano), // Add a timestamp for the vector storage itself
+			"hash":          hash,
 			// Add any other relevant fields from embeddingData.BaseRequestInfo.Metadata
 		},
 	}
-	if embeddingData.BaseRequestInfo.Metadata != nil {
-		for k, v := range embeddingData.BaseRequestInfo.Metadata {
+	if embeddingData.RawText != "" {
+		vectorInput.Payload["raw_text"] = embeddingData.RawText
+	}
+	for k, v := range embeddingData.BaseRequestInfo.Metadata {
+		if !protectedPayloadKeys[k] {
 			vectorInput.Payload[k] = v
 		}
 	}
 
 	fmt.Printf("QdrantWorker: Simulating VectorStore InsertVectors call for MemoryID: %s into collection %s\n", embeddingData.MemoryID, collectionName)
-	err := w.vs.InsertVectors(collectionName, []vectorstores.VectorInput{vectorInput})
+	err = w.vs.InsertVectors(collectionName, []vectorstores.VectorInput{vectorInput})
 	if err != nil {
 		fmt.Printf("QdrantWorker: Error simulating VectorStore InsertVectors: %v\n", err)
 		return fmt.Errorf("error inserting vectors: %w", err)
 	}
 	fmt.Printf("QdrantWorker: Successfully simulated vector insertion for MemoryID: %s\n", embeddingData.MemoryID)
 
+	// Keep the lexical index in step with the vector store so hybrid search sees the same memories.
+	if w.lexical != nil {
+		doc := LexicalDocument{
+			ID:       embeddingData.MemoryID,
+			Text:     embeddingData.ProcessedText,
+			UserID:   embeddingData.UserID,
+			Metadata: vectorInput.Payload,
+		}
+		if err := w.lexical.Index(context.Background(), doc); err != nil {
+			// The vector write already succeeded; a missing lexical entry only degrades hybrid recall.
+			fmt.Printf("QdrantWorker: Error indexing MemoryID %s in lexical index: %v\n", embeddingData.MemoryID, err)
+		}
+	}
+
 	// Simulate publishing MemoryEvent to TopicMemoryHistoryLog
 	historyEvent := MemoryEvent{
 		EventID:   uuid.New().String(),
@@ -122,24 +179,137 @@ func (w *QdrantWorker) handleVectorStoreAddMessage(payload []byte) error {
 		Details: map[string]interface{}{
 			"collection_name": collectionName,
 			"vector_id":       embeddingData.MemoryID,
-			"embedding_dim":   len(embeddingData.Embedding),
+			"embedding_dim":   w.expectedVectorSize(),
+			"hash":            hash,
 		},
 	}
-	eventData, err := json.Marshal(historyEvent)
+	w.publishHistoryEvent(historyEvent)
+
+	return nil
+}
+
+// expectedVectorSize returns the dimension writes must match: the bootstrapped
+// collection's size when known, otherwise the configured embedder's.
+func (w *QdrantWorker) expectedVectorSize() int {
+	if w.vectorSize > 0 {
+		return w.vectorSize
+	}
+	if w.cfg.Embedder != nil {
+		return w.cfg.Embedder.Dimensions
+	}
+	return 0
+}
+
+// checkDimensions verifies the unnamed vector, or every configured named vector, has the expected size.
+func (w *QdrantWorker) checkDimensions(data *EmbeddingData) error {
+	names := configuredVectorNames(w.cfg)
+	if len(names) == 0 {
+		return checkEmbeddingDimension(data.Embedding, w.expectedVectorSize())
+	}
+	for _, name := range names {
+		vector, ok := data.Embeddings[name]
+		if !ok {
+			return fmt.Errorf("named vector %q is missing", name)
+		}
+		if err := checkEmbeddingDimension(vector, w.expectedVectorSize()); err != nil {
+			return fmt.Errorf("named vector %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// isEmptyScope reports whether info names no user, agent or run. Such memories are never
+// deduplicated, since they would match every unscoped memory with the same content.
+func isEmptyScope(info BaseRequestInfo) bool {
+	return info.UserID == "" && info.AgentID == "" && info.RunID == ""
+}
+
+// findDuplicate returns a stored memory with the same content hash and exactly the same
+// user, agent and run, or nil. An empty agent or run only matches memories stored without one.
+func (w *QdrantWorker) findDuplicate(collectionName string, info BaseRequestInfo, hash string) (*vectorstores.SearchResult, error) {
+	filter := &vectorstores.QueryFilter{
+		UserID: info.UserID,
+		Metadata: map[string]interface{}{
+			"hash":     hash,
+			"user_id":  info.UserID,
+			"agent_id": info.AgentID,
+			"run_id":   info.RunID,
+		},
+	}
+	matches, err := w.vs.ListVectors(collectionName, 1, 0, filter)
 	if err != nil {
-		fmt.Printf("QdrantWorker: Error marshalling MemoryEvent: %v\n", err)
-	} else {
-		if w.nc != nil {
-			err = w.nc.Publish(context.Background(), w.cfg.TopicMemoryHistoryLog, eventData)
-			if err != nil {
-				fmt.Printf("QdrantWorker: Error publishing MemoryEvent to NATS topic %s: %v\n", w.cfg.TopicMemoryHistoryLog, err)
-			} else {
-				fmt.Printf("QdrantWorker: Published MemoryEvent to %s for MemoryID: %s\n", w.cfg.TopicMemoryHistoryLog, embeddingData.MemoryID)
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return nil, nil
+	}
+	return &matches[0], nil
+}
+
+// handleDuplicate applies the configured DuplicatePolicy to a memory whose hash is already stored.
+func (w *QdrantWorker) handleDuplicate(collectionName string, data *EmbeddingData, hash string, existing *vectorstores.SearchResult) error {
+	eventType := "MEMORY_DUPLICATE_SKIPPED"
+	if w.cfg.DuplicatePolicy == "merge" {
+		eventType = "MEMORY_DUPLICATE_MERGED"
+		merged := make(map[string]interface{}, len(existing.Payload)+len(data.Metadata)+2)
+		for k, v := range existing.Payload {
+			merged[k] = v
+		}
+		for k, v := range data.Metadata {
+			if !protectedPayloadKeys[k] { // The duplicate's metadata cannot move the memory to another owner
+				merged[k] = v
 			}
-		} else {
-			fmt.Printf("NATS_PUBLISH (QdrantWorker - nc is nil): Topic=%s, Payload=%s\n", w.cfg.TopicMemoryHistoryLog, string(eventData))
+		}
+		count := 1
+		if n, ok := merged["duplicate_count"].(float64); ok { // JSON numbers decode as float64
+			count = int(n) + 1
+		} else if n, ok := merged["duplicate_count"].(int); ok {
+			count = n + 1
+		}
+		merged["duplicate_count"] = count
+		merged["updated_at"] = time.Now().UTC().Format(time.RFC3339Nano)
+
+		if err := w.vs.UpdateVectorPayload(collectionName, existing.ID, merged); err != nil {
+			fmt.Printf("QdrantWorker: Error merging MemoryID %s into duplicate %s: %v\n", data.MemoryID, existing.ID, err)
+			return fmt.Errorf("error merging duplicate memory: %w", err)
 		}
 	}
+	fmt.Printf("QdrantWorker: MemoryID %s duplicates %s (hash %s), policy %q\n", data.MemoryID, existing.ID, hash, w.cfg.DuplicatePolicy)
 
+	w.publishHistoryEvent(MemoryEvent{
+		EventID:   uuid.New().String(),
+		MemoryID:  existing.ID,
+		EventType: eventType,
+		Timestamp: time.Now().UTC(),
+		UserID:    data.UserID,
+		AgentID:   data.AgentID,
+		RunID:     data.RunID,
+		ActorID:   data.ActorID,
+		NewMemory: data.ProcessedText,
+		Details: map[string]interface{}{
+			"collection_name":     collectionName,
+			"duplicate_memory_id": data.MemoryID,
+			"hash":                hash,
+		},
+	})
 	return nil
 }
+
+// publishHistoryEvent sends a MemoryEvent to TopicMemoryHistoryLog. Failures are logged, not returned.
+func (w *QdrantWorker) publishHistoryEvent(historyEvent MemoryEvent) {
+	eventData, err := json.Marshal(historyEvent)
+	if err != nil {
+		fmt.Printf("QdrantWorker: Error marshalling MemoryEvent: %v\n", err)
+		return
+	}
+	if w.nc != nil {
+		err = w.nc.Publish(context.Background(), w.cfg.TopicMemoryHistoryLog, eventData)
+		if err != nil {
+			fmt.Printf("QdrantWorker: Error publishing MemoryEvent to NATS topic %s: %v\n", w.cfg.TopicMemoryHistoryLog, err)
+		} else {
+			fmt.Printf("QdrantWorker: Published MemoryEvent to %s for MemoryID: %s\n", w.cfg.TopicMemoryHistoryLog, historyEvent.MemoryID)
+		}
+	} else {
+		fmt.Printf("NATS_PUBLISH (QdrantWorker - nc is nil): Topic=%s, Payload=%s\n", w.cfg.TopicMemoryHistoryLog, string(eventData))
+	}
+}
@@ -0,0 +1,448 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pnocera/gomem/pkg/vectorstores"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultReembedBatchSize = 100
+	// maxReembedCatchUpPasses bounds the catch-up passes run while writes continue, before
+	// the final one under frozen writes.
+	maxReembedCatchUpPasses = 3
+
+	eventReembedStarted   = "REEMBED_MIGRATION_STARTED"
+	eventReembedProgress  = "REEMBED_MIGRATION_PROGRESS"
+	eventReembedCompleted = "REEMBED_MIGRATION_COMPLETED"
+	eventReembedFailed    = "REEMBED_MIGRATION_FAILED"
+)
+
+// ReembedProgress is the resumable state of a re-embedding migration.
+// It is persisted as history events whose MemoryID is the migration ID.
+type ReembedProgress struct {
+	MigrationID      string `json:"migration_id"`
+	SourceCollection string `json:"source_collection"`
+	ShadowCollection string `json:"shadow_collection"`
+	Model            string `json:"model"`
+	Offset           uint64 `json:"offset"`   // Next ListVectors offset in the source collection
+	Migrated         int    `json:"migrated"` // Points written to the shadow collection
+	Skipped          int    `json:"skipped"`  // Points without stored text
+	Completed        bool   `json:"completed"`
+}
+
+// ReembedMigration re-embeds every stored memory with a new embedding model into a shadow
+// collection and then atomically switches the configured alias to it. The service keeps
+// reading and writing through the alias while the migration runs; points written, edited
+// or deleted during the copy are caught up by comparing their text, hash and updated_at.
+// The final catch-up and the switch run with writes to the alias frozen, so the vector
+// store must be a vectorstores.WriteFreezer, such as a FencedStore shared with the workers.
+//
+// Once it completes, the workers must be restarted with the new EmbedderConfig: until then
+// the dimension guard rejects vectors from the old model. When both models have the same
+// dimension the guard cannot tell them apart, so the migration refuses to switch unless
+// the workers' EmbedderConfig already names the new model. The source collection is left
+// in place for rollback.
+type ReembedMigration struct {
+	cfg       *Config
+	vs        vectorstores.VectorStore
+	history   HistoryStore
+	embedder  OpenAIClient    // Client configured for the new model
+	target    *EmbedderConfig // The new model
+	BatchSize int
+}
+
+// NewReembedMigration creates a new ReembedMigration towards the target embedder.
+func NewReembedMigration(cfg *Config, vs vectorstores.VectorStore, history HistoryStore, embedder OpenAIClient, target *EmbedderConfig) *ReembedMigration {
+	return &ReembedMigration{
+		cfg:       cfg,
+		vs:        vs,
+		history:   history,
+		embedder:  embedder,
+		target:    target,
+		BatchSize: defaultReembedBatchSize,
+	}
+}
+
+// Run executes or resumes the migration identified by migrationID. Running a
+// completed migration again is a no-op that returns its final progress.
+func (m *ReembedMigration) Run(ctx context.Context, migrationID string) (*ReembedProgress, error) {
+	if migrationID == "" {
+		return nil, fmt.Errorf("migrationID cannot be empty")
+	}
+	if m.vs == nil || m.history == nil || m.embedder == nil {
+		return nil, fmt.Errorf("re-embedding migration requires a vector store, history store and embedder")
+	}
+	if m.target == nil {
+		return nil, fmt.Errorf("target embedder config is required")
+	}
+	if err := m.target.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid target embedder config: %w", err)
+	}
+	settings, err := vectorCollectionSettings(m.cfg)
+	if err != nil {
+		return nil, err
+	}
+	if settings.Alias == "" {
+		return nil, fmt.Errorf("vector_store_config.config.alias must be set to switch collections online")
+	}
+	freezer, ok := m.vs.(vectorstores.WriteFreezer)
+	if !ok {
+		return nil, fmt.Errorf("re-embedding migration needs a vector store that can freeze writes; wrap it with vectorstores.NewFencedStore and share it with the workers")
+	}
+
+	progress, err := m.loadProgress(ctx, migrationID)
+	if err != nil {
+		return nil, err
+	}
+	if progress != nil && progress.Completed {
+		return progress, nil
+	}
+	if progress == nil {
+		source, err := m.vs.ResolveAlias(settings.Alias)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve alias %s: %w", settings.Alias, err)
+		}
+		if source == "" {
+			return nil, fmt.Errorf("alias %s does not point at a collection", settings.Alias)
+		}
+		progress = &ReembedProgress{
+			MigrationID:      migrationID,
+			SourceCollection: source,
+			ShadowCollection: fmt.Sprintf("%s_reembed_%s", settings.CollectionName, migrationID),
+			Model:            m.target.Model,
+		}
+		if _, err := EnsureCollection(m.vs, progress.ShadowCollection, m.target); err != nil {
+			return nil, fmt.Errorf("failed to prepare shadow collection: %w", err)
+		}
+		if err := m.record(ctx, eventReembedStarted, progress); err != nil {
+			return nil, err
+		}
+	} else if progress.Model != m.target.Model {
+		return nil, fmt.Errorf("migration %s targets model %s, not %s", migrationID, progress.Model, m.target.Model)
+	}
+
+	// A run that stopped after the switch only missed its completion record. The source no
+	// longer receives writes, so reconciling against it would undo those made since.
+	current, err := m.vs.ResolveAlias(settings.Alias)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve alias %s: %w", settings.Alias, err)
+	}
+	if current != progress.ShadowCollection {
+		if err := m.checkSwitchable(progress); err != nil {
+			return nil, err
+		}
+		if err := m.copyAll(ctx, progress); err != nil {
+			m.fail(ctx, progress, err)
+			return progress, err
+		}
+		if err := m.switchAlias(ctx, freezer, settings.Alias, progress); err != nil {
+			m.fail(ctx, progress, err)
+			return progress, err
+		}
+	}
+	progress.Completed = true
+	if err := m.record(ctx, eventReembedCompleted, progress); err != nil {
+		return progress, err
+	}
+	fmt.Printf("ReembedMigration %s: alias %s now points at %s (%d migrated, %d skipped)\n",
+		migrationID, settings.Alias, progress.ShadowCollection, progress.Migrated, progress.Skipped)
+	return progress, nil
+}
+
+// checkSwitchable refuses a migration whose switch the dimension guard could not protect:
+// with models of the same dimension, workers still embedding with the old model would
+// write its vectors into the new collection unnoticed.
+func (m *ReembedMigration) checkSwitchable(progress *ReembedProgress) error {
+	info, err := m.vs.CollectionInfo(progress.SourceCollection)
+	if err != nil {
+		return fmt.Errorf("failed to get info for %s: %w", progress.SourceCollection, err)
+	}
+	size := info.VectorSize
+	for _, params := range info.NamedVectors {
+		size = params.Size
+	}
+	if size != m.target.Dimensions {
+		return nil
+	}
+	if m.cfg.Embedder == nil || m.cfg.Embedder.Model != m.target.Model {
+		return fmt.Errorf("models of collection %s and %s have the same dimension %d; restart the workers with an EmbedderConfig for %s before switching",
+			progress.SourceCollection, m.target.Model, size, m.target.Model)
+	}
+	return nil
+}
+
+// switchAlias catches up with the writes made to the source while the copy ran, then
+// freezes writes to the alias and the source for a final catch-up and the switch.
+func (m *ReembedMigration) switchAlias(ctx context.Context, freezer vectorstores.WriteFreezer, alias string, progress *ReembedProgress) error {
+	for pass := 0; pass < maxReembedCatchUpPasses; pass++ {
+		changed, err := m.reconcile(ctx, progress)
+		if err != nil {
+			return err
+		}
+		if changed == 0 {
+			break
+		}
+	}
+
+	release, err := freezer.FreezeWrites(ctx, alias, progress.SourceCollection)
+	if err != nil {
+		return fmt.Errorf("failed to freeze writes to %s: %w", alias, err)
+	}
+	defer release()
+	if _, err := m.reconcile(ctx, progress); err != nil {
+		return err
+	}
+	if err := m.vs.SwitchAlias(alias, progress.ShadowCollection); err != nil {
+		return fmt.Errorf("failed to switch alias %s to %s: %w", alias, progress.ShadowCollection, err)
+	}
+	return nil
+}
+
+// copyAll pages through the source collection from the saved offset, recording progress after each batch.
+func (m *ReembedMigration) copyAll(ctx context.Context, progress *ReembedProgress) error {
+	batchSize := m.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultReembedBatchSize
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		page, err := m.vs.ListVectors(progress.SourceCollection, batchSize, progress.Offset, nil)
+		if err != nil {
+			return fmt.Errorf("failed to list vectors at offset %d: %w", progress.Offset, err)
+		}
+		if err := m.migratePoints(ctx, progress, page); err != nil {
+			return err
+		}
+		progress.Offset += uint64(len(page))
+		if err := m.record(ctx, eventReembedProgress, progress); err != nil {
+			return err
+		}
+		if len(page) < batchSize {
+			return nil
+		}
+	}
+}
+
+// reconcile brings the shadow collection in line with the source and returns the number
+// of points it changed. Points added to the source or whose text changed since they were
+// copied are re-embedded, points whose payload alone changed get the new payload, and
+// points deleted from the source are removed. As it scans the whole source, it recounts
+// the migrated and skipped points rather than adjusting the counts of earlier passes.
+func (m *ReembedMigration) reconcile(ctx context.Context, progress *ReembedProgress) (int, error) {
+	batchSize := m.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultReembedBatchSize
+	}
+	changed, migrated, skipped := 0, 0, 0
+	for offset := uint64(0); ; offset += uint64(batchSize) {
+		if err := ctx.Err(); err != nil {
+			return changed, err
+		}
+		page, err := m.vs.ListVectors(progress.SourceCollection, batchSize, offset, nil)
+		if err != nil {
+			return changed, fmt.Errorf("failed to list source vectors for catch-up: %w", err)
+		}
+		var stale []vectorstores.SearchResult
+		for _, p := range page {
+			if text, _ := p.Payload["text"].(string); text == "" {
+				skipped++
+				continue
+			}
+			migrated++
+			copied, err := m.vs.GetVector(progress.ShadowCollection, p.ID)
+			if err != nil {
+				return changed, fmt.Errorf("failed to get shadow vector %s: %w", p.ID, err)
+			}
+			switch {
+			case copied == nil:
+				stale = append(stale, p)
+			case !samePayloadField(p.Payload, copied.Payload, "text") || !samePayloadField(p.Payload, copied.Payload, "hash"):
+				stale = append(stale, p)
+			case !samePayloadField(p.Payload, copied.Payload, "updated_at"):
+				payload := make(map[string]interface{}, len(p.Payload)+1)
+				for k, v := range p.Payload {
+					payload[k] = v
+				}
+				payload["embedding_model"] = m.target.Model
+				if err := m.vs.UpdateVectorPayload(progress.ShadowCollection, p.ID, payload); err != nil {
+					return changed, fmt.Errorf("failed to update shadow payload of %s: %w", p.ID, err)
+				}
+				changed++
+			}
+		}
+		if err := m.migratePoints(ctx, progress, stale); err != nil {
+			return changed, err
+		}
+		changed += len(stale)
+		if len(page) < batchSize {
+			break
+		}
+	}
+	progress.Migrated, progress.Skipped = migrated, skipped
+
+	// Points deleted from the source after they were copied.
+	for offset := uint64(0); ; {
+		page, err := m.vs.ListVectors(progress.ShadowCollection, batchSize, offset, nil)
+		if err != nil {
+			return changed, fmt.Errorf("failed to list shadow vectors for catch-up: %w", err)
+		}
+		var deleted []string
+		for _, p := range page {
+			existing, err := m.vs.GetVector(progress.SourceCollection, p.ID)
+			if err != nil {
+				return changed, fmt.Errorf("failed to get source vector %s: %w", p.ID, err)
+			}
+			if existing == nil {
+				deleted = append(deleted, p.ID)
+			}
+		}
+		if len(deleted) > 0 {
+			if err := m.vs.DeleteVectors(progress.ShadowCollection, deleted); err != nil {
+				return changed, fmt.Errorf("failed to delete stale shadow vectors: %w", err)
+			}
+			changed += len(deleted)
+		}
+		if len(page) < batchSize {
+			break
+		}
+		offset += uint64(len(page) - len(deleted))
+	}
+	return changed, m.record(ctx, eventReembedProgress, progress)
+}
+
+// samePayloadField reports whether key holds the same value in both payloads.
+func samePayloadField(a, b map[string]interface{}, key string) bool {
+	return fmt.Sprint(a[key]) == fmt.Sprint(b[key])
+}
+
+// migratePoints re-embeds the stored text of points and writes them to the shadow collection.
+func (m *ReembedMigration) migratePoints(ctx context.Context, progress *ReembedProgress, points []vectorstores.SearchResult) error {
+	vectors := make([]vectorstores.VectorInput, 0, len(points))
+	for _, p := range points {
+		text, _ := p.Payload["text"].(string)
+		if text == "" {
+			fmt.Printf("ReembedMigration %s: point %s has no stored text, skipping\n", progress.MigrationID, p.ID)
+			progress.Skipped++
+			continue
+		}
+		input := vectorstores.VectorInput{ID: p.ID}
+		if len(m.target.NamedVectors) > 0 {
+			rawText, _ := p.Payload["raw_text"].(string)
+			named, err := embedNamedVectors(ctx, m.embedder, m.target.NamedVectors, text, rawText)
+			if err != nil {
+				return fmt.Errorf("failed to embed point %s: %w", p.ID, err)
+			}
+			for name, v := range named {
+				if err := checkEmbeddingDimension(v, m.target.Dimensions); err != nil {
+					return fmt.Errorf("embedder returned wrong size for %s vector of point %s: %w", name, p.ID, err)
+				}
+			}
+			input.Vectors = named
+		} else {
+			embedding, err := m.embedder.GetEmbedding(ctx, text)
+			if err != nil {
+				return fmt.Errorf("failed to embed point %s: %w", p.ID, err)
+			}
+			if err := checkEmbeddingDimension(embedding, m.target.Dimensions); err != nil {
+				return fmt.Errorf("embedder returned wrong size for point %s: %w", p.ID, err)
+			}
+			input.Embedding = embedding
+		}
+		input.Payload = make(map[string]interface{}, len(p.Payload)+1)
+		for k, v := range p.Payload {
+			input.Payload[k] = v
+		}
+		input.Payload["embedding_model"] = m.target.Model
+		vectors = append(vectors, input)
+	}
+	if len(vectors) == 0 {
+		return nil
+	}
+	if err := m.vs.InsertVectors(progress.ShadowCollection, vectors); err != nil {
+		return fmt.Errorf("failed to insert into shadow collection %s: %w", progress.ShadowCollection, err)
+	}
+	progress.Migrated += len(vectors)
+	return nil
+}
+
+// loadProgress rebuilds progress from the migration's history events, or returns nil for a new migration.
+func (m *ReembedMigration) loadProgress(ctx context.Context, migrationID string) (*ReembedProgress, error) {
+	events, err := m.history.GetHistory(ctx, migrationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load migration history: %w", err)
+	}
+	var progress *ReembedProgress
+	for _, e := range events {
+		switch e.EventType {
+		case eventReembedStarted, eventReembedProgress, eventReembedCompleted:
+			progress = progressFromDetails(migrationID, e.Details)
+		}
+	}
+	return progress, nil
+}
+
+// record appends a migration event carrying the current progress to the history store.
+func (m *ReembedMigration) record(ctx context.Context, eventType string, progress *ReembedProgress) error {
+	event := &MemoryEvent{
+		EventID:   uuid.New().String(),
+		MemoryID:  progress.MigrationID,
+		EventType: eventType,
+		Timestamp: time.Now().UTC(),
+		Details: map[string]interface{}{
+			"source_collection": progress.SourceCollection,
+			"shadow_collection": progress.ShadowCollection,
+			"model":             progress.Model,
+			"offset":            progress.Offset,
+			"migrated":          progress.Migrated,
+			"skipped":           progress.Skipped,
+			"completed":         progress.Completed,
+		},
+	}
+	if err := m.history.LogEvent(ctx, event); err != nil {
+		return fmt.Errorf("failed to record %s: %w", eventType, err)
+	}
+	return nil
+}
+
+// fail records a failed run. The last progress event stays the resume point.
+func (m *ReembedMigration) fail(ctx context.Context, progress *ReembedProgress, cause error) {
+	event := &MemoryEvent{
+		EventID:   uuid.New().String(),
+		MemoryID:  progress.MigrationID,
+		EventType: eventReembedFailed,
+		Timestamp: time.Now().UTC(),
+		Details: map[string]interface{}{
+			"error":  cause.Error(),
+			"offset": progress.Offset,
+		},
+	}
+	if err := m.history.LogEvent(ctx, event); err != nil {
+		fmt.Printf("ReembedMigration %s: Error recording failure: %v\n", progress.MigrationID, err)
+	}
+}
+
+// progressFromDetails decodes progress stored by record. JSON numbers come back as float64.
+func progressFromDetails(migrationID string, details map[string]interface{}) *ReembedProgress {
+	p := &ReembedProgress{MigrationID: migrationID}
+	p.SourceCollection, _ = details["source_collection"].(string)
+	p.ShadowCollection, _ = details["shadow_collection"].(string)
+	p.Model, _ = details["model"].(string)
+	if v, ok := details["offset"].(float64); ok {
+		p.Offset = uint64(v)
+	}
+	if v, ok := details["migrated"].(float64); ok {
+		p.Migrated = int(v)
+	}
+	if v, ok := details["skipped"].(float64); ok {
+		p.Skipped = int(v)
+	}
+	p.Completed, _ = details["completed"].(bool)
+	return p
+}
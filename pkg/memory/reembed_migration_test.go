@@ -0,0 +1,259 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pnocera/gomem/pkg/vectorstores"
+)
+
+const (
+	testAlias  = "memories_live"
+	testSource = "memories_v1"
+	testShadow = "memories_reembed_m1"
+)
+
+var errCrash = errors.New("simulated crash")
+
+// lengthEmbedder embeds a text as a vector of the new model carrying its length.
+type lengthEmbedder struct {
+	OpenAIClient
+}
+
+func (lengthEmbedder) GetEmbedding(ctx context.Context, text string) ([]float32, error) {
+	return []float32{float32(len(text)), 1, 0}, nil
+}
+
+// crashingHistory fails its crashAt-th LogEvent call, as if the process stopped before
+// writing that checkpoint.
+type crashingHistory struct {
+	HistoryStore
+	calls   int
+	crashAt int
+}
+
+func (h *crashingHistory) LogEvent(ctx context.Context, event *MemoryEvent) error {
+	h.calls++
+	if h.calls == h.crashAt {
+		return errCrash
+	}
+	return h.HistoryStore.LogEvent(ctx, event)
+}
+
+// hookedStore calls its hooks before listing a collection and before switching an alias.
+type hookedStore struct {
+	vectorstores.VectorStore
+	onList   func(collectionName string, offset uint64)
+	onSwitch func()
+}
+
+func (s *hookedStore) ListVectors(collectionName string, limit int, offset uint64, filter *vectorstores.QueryFilter) ([]vectorstores.SearchResult, error) {
+	if s.onList != nil {
+		s.onList(collectionName, offset)
+	}
+	return s.VectorStore.ListVectors(collectionName, limit, offset, filter)
+}
+
+func (s *hookedStore) SwitchAlias(alias string, collectionName string) error {
+	if s.onSwitch != nil {
+		s.onSwitch()
+	}
+	return s.VectorStore.SwitchAlias(alias, collectionName)
+}
+
+type migrationFixture struct {
+	hooks   *hookedStore
+	vs      *vectorstores.FencedStore // Shared by the migration and the simulated workers
+	history HistoryStore
+	cfg     *Config
+}
+
+// newMigrationFixture stores memories a to d and a point e without text in a source
+// collection of the old model, behind testAlias.
+func newMigrationFixture(t *testing.T) *migrationFixture {
+	t.Helper()
+	store := vectorstores.NewInMemoryStore(nil)
+	if err := store.CreateCollection(testSource, 2, "cosine"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SwitchAlias(testAlias, testSource); err != nil {
+		t.Fatal(err)
+	}
+	history, err := NewSQLiteHistoryStore(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { history.Close() })
+
+	f := &migrationFixture{
+		hooks:   &hookedStore{VectorStore: store},
+		history: history,
+		cfg: &Config{VectorStoreConfig: &vectorstores.VectorStoreConfig{
+			Provider: "inmemory",
+			Config:   &vectorstores.InMemoryConfig{CollectionName: "memories", Alias: testAlias},
+		}},
+	}
+	f.vs = vectorstores.NewFencedStore(f.hooks)
+	for _, text := range []string{"a", "b", "c", "d"} {
+		f.write(t, text, text, []float32{1, 0})
+	}
+	f.write(t, "e", "", []float32{0, 1})
+	return f
+}
+
+// write stores a memory through the alias, as a worker does.
+func (f *migrationFixture) write(t *testing.T, id, text string, embedding []float32) {
+	t.Helper()
+	payload := map[string]interface{}{"text": text, "hash": ContentHash(text)}
+	if err := f.vs.InsertVectors(testAlias, []vectorstores.VectorInput{{ID: id, Embedding: embedding, Payload: payload}}); err != nil {
+		t.Fatalf("writing %s: %v", id, err)
+	}
+}
+
+func (f *migrationFixture) run(history HistoryStore) (*ReembedProgress, error) {
+	m := NewReembedMigration(f.cfg, f.vs, history, lengthEmbedder{}, &EmbedderConfig{Model: "new-model", Dimensions: 3})
+	m.BatchSize = 2
+	return m.Run(context.Background(), "m1")
+}
+
+// live returns the collection behind testAlias and the IDs it holds.
+func (f *migrationFixture) live(t *testing.T) (string, []string) {
+	t.Helper()
+	collection, err := f.vs.ResolveAlias(testAlias)
+	if err != nil {
+		t.Fatal(err)
+	}
+	points, err := f.vs.ListVectors(testAlias, 0, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]string, len(points))
+	for i, p := range points {
+		ids[i] = p.ID
+	}
+	return collection, ids
+}
+
+func TestReembedMigrationCatchesUpWrites(t *testing.T) {
+	f := newMigrationFixture(t)
+	wrote := false
+	f.hooks.onList = func(collectionName string, offset uint64) {
+		if wrote || collectionName != testSource || offset == 0 {
+			return
+		}
+		// Between two pages of the copy: add f, rewrite b, touch c and delete a, which
+		// shifts c before the next page.
+		wrote = true
+		f.write(t, "f", "f", []float32{1, 0})
+		f.write(t, "b", "b rewritten", []float32{1, 0})
+		if err := f.vs.UpdateVectorPayload(testAlias, "c", map[string]interface{}{"text": "c", "hash": ContentHash("c"), "updated_at": "later"}); err != nil {
+			t.Error(err)
+		}
+		if err := f.vs.DeleteVectors(testAlias, []string{"a"}); err != nil {
+			t.Error(err)
+		}
+	}
+	blocked := make(chan struct{})
+	f.hooks.onSwitch = func() {
+		done := make(chan struct{})
+		go func() {
+			f.write(t, "g", "g", []float32{1, 1, 1})
+			close(done)
+		}()
+		select {
+		case <-done:
+			t.Error("a write to the alias went through while writes were frozen")
+		case <-time.After(20 * time.Millisecond):
+		}
+		go func() {
+			<-done
+			close(blocked)
+		}()
+	}
+
+	progress, err := f.run(f.history)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	<-blocked
+
+	collection, ids := f.live(t)
+	if collection != testShadow {
+		t.Errorf("alias points at %s, want %s", collection, testShadow)
+	}
+	if want := []string{"b", "c", "d", "f", "g"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("live IDs = %v, want %v", ids, want)
+	}
+	b, err := f.vs.GetVector(testShadow, "b")
+	if err != nil || b == nil {
+		t.Fatalf("GetVector(b) = %v, %v", b, err)
+	}
+	if b.Payload["text"] != "b rewritten" || b.Payload["embedding_model"] != "new-model" {
+		t.Errorf("b payload = %v, want the rewritten text and the new model", b.Payload)
+	}
+	if want := []float32{float32(len("b rewritten")), 1, 0}; !reflect.DeepEqual(b.Vector, want) {
+		t.Errorf("b vector = %v, want %v", b.Vector, want)
+	}
+	c, err := f.vs.GetVector(testShadow, "c")
+	if err != nil || c == nil || c.Payload["updated_at"] != "later" {
+		t.Errorf("c = %v, %v; want the updated payload", c, err)
+	}
+	if progress.Migrated != 4 || progress.Skipped != 1 {
+		t.Errorf("progress counted %d migrated, %d skipped; want 4 and 1", progress.Migrated, progress.Skipped)
+	}
+}
+
+func TestReembedMigrationResumesAtEveryCheckpoint(t *testing.T) {
+	for crashAt := 1; ; crashAt++ {
+		f := newMigrationFixture(t)
+		crashing := &crashingHistory{HistoryStore: f.history, crashAt: crashAt}
+		_, err := f.run(crashing)
+		if crashing.calls < crashAt {
+			if err != nil {
+				t.Fatalf("Run without a crash: %v", err)
+			}
+			if crashAt < 4 {
+				t.Fatalf("a full run recorded only %d checkpoints", crashing.calls)
+			}
+			return
+		}
+		if !errors.Is(err, errCrash) {
+			t.Fatalf("crash at checkpoint %d: Run error = %v, want the crash", crashAt, err)
+		}
+
+		// A worker keeps writing through the alias before the migration is resumed.
+		switched, _ := f.live(t)
+		if switched == testShadow {
+			f.write(t, "late", "late", []float32{1, 1, 1})
+		} else {
+			f.write(t, "late", "late", []float32{1, 0})
+		}
+
+		progress, err := f.run(f.history)
+		if err != nil {
+			t.Fatalf("resume after crash at checkpoint %d: %v", crashAt, err)
+		}
+		collection, ids := f.live(t)
+		if collection != testShadow {
+			t.Errorf("crash at checkpoint %d: alias points at %s, want %s", crashAt, collection, testShadow)
+		}
+		if want := []string{"a", "b", "c", "d", "late"}; !reflect.DeepEqual(ids, want) {
+			t.Errorf("crash at checkpoint %d: live IDs = %v, want %v", crashAt, ids, want)
+		}
+		wantMigrated := 5 // late was copied from the source
+		if switched == testShadow {
+			wantMigrated = 4 // late was written to the new collection directly
+		}
+		if progress.Migrated != wantMigrated || progress.Skipped != 1 {
+			t.Errorf("crash at checkpoint %d: progress counted %d migrated, %d skipped; want %d and 1",
+				crashAt, progress.Migrated, progress.Skipped, wantMigrated)
+		}
+		if !progress.Completed {
+			t.Errorf("crash at checkpoint %d: resumed migration did not complete", crashAt)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Reranker defines the interface for rescoring search candidates against the query.
+type Reranker interface {
+	// Rerank returns one relevance score per document, in the order the documents were given.
+	// Higher scores mean more relevant; scores are only comparable within a single call.
+	Rerank(ctx context.Context, query string, documents []string) ([]float32, error)
+}
+
+// rerankResults scores results with r, stores the score in RerankScore and sorts by it.
+func rerankResults(ctx context.Context, r Reranker, query string, results []MemoryResult) ([]MemoryResult, error) {
+	if len(results) == 0 {
+		return results, nil
+	}
+	documents := make([]string, len(results))
+	for i, res := range results {
+		documents[i] = res.Memory
+	}
+	scores, err := r.Rerank(ctx, query, documents)
+	if err != nil {
+		return nil, fmt.Errorf("rerank failed: %w", err)
+	}
+	if len(scores) != len(results) {
+		return nil, fmt.Errorf("reranker returned %d scores for %d documents", len(scores), len(results))
+	}
+	for i := range results {
+		score := scores[i]
+		results[i].RerankScore = &score
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return *results[i].RerankScore > *results[j].RerankScore
+	})
+	return results, nil
+}
+
+// HTTPReranker calls a cross-encoder rerank endpoint over HTTP.
+// The request body is {"query": ..., "texts": [...]} as served by Hugging Face
+// text-embeddings-inference; both its [{"index", "score"}] reply and the
+// {"results": [{"index", "relevance_score"}]} reply used by Cohere/Jina style APIs are accepted.
+type HTTPReranker struct {
+	Endpoint string
+	APIKey   string
+	Model    string // Sent as "model" when set
+	Client   *http.Client
+}
+
+// Compile-time check to ensure *HTTPReranker satisfies the Reranker interface.
+var _ Reranker = (*HTTPReranker)(nil)
+
+// NewHTTPReranker creates an HTTPReranker with a 10 second client timeout.
+func NewHTTPReranker(endpoint string, apiKey string, model string) *HTTPReranker {
+	return &HTTPReranker{
+		Endpoint: endpoint,
+		APIKey:   apiKey,
+		Model:    model,
+		Client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Rerank sends the documents to the cross-encoder and returns its scores.
+func (r *HTTPReranker) Rerank(ctx context.Context, query string, documents []string) ([]float32, error) {
+	body := map[string]interface{}{
+		"query": query,
+		"texts": documents,
+	}
+	if r.Model != "" {
+		body["model"] = r.Model
+	}
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal rerank request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.Endpoint, bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create rerank request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+r.APIKey)
+	}
+
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("rerank request to %s failed: %w", r.Endpoint, err)
+	}
+	defer resp.Body.Close()
+
+	respData, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rerank response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("rerank endpoint returned %s: %s", resp.Status, strings.TrimSpace(string(respData)))
+	}
+
+	type rankedItem struct {
+		Index          int      `json:"index"`
+		Score          *float32 `json:"score"`
+		RelevanceScore *float32 `json:"relevance_score"`
+	}
+	var items []rankedItem
+	if trimmed := bytes.TrimSpace(respData); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(trimmed, &items)
+	} else {
+		var wrapped struct {
+			Results []rankedItem `json:"results"`
+		}
+		err = json.Unmarshal(respData, &wrapped)
+		items = wrapped.Results
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal rerank response: %w", err)
+	}
+
+	scores := make([]float32, len(documents))
+	seen := make([]bool, len(documents))
+	for _, item := range items {
+		if item.Index < 0 || item.Index >= len(documents) {
+			return nil, fmt.Errorf("rerank response index %d out of range", item.Index)
+		}
+		switch {
+		case item.Score != nil:
+			scores[item.Index] = *item.Score
+		case item.RelevanceScore != nil:
+			scores[item.Index] = *item.RelevanceScore
+		default:
+			return nil, fmt.Errorf("rerank response item %d has no score", item.Index)
+		}
+		seen[item.Index] = true
+	}
+	for i, ok := range seen {
+		if !ok {
+			return nil, fmt.Errorf("rerank response is missing document %d", i)
+		}
+	}
+	return scores, nil
+}
+
+// llmRerankSystemPrompt asks the model for one relevance grade per numbered document.
+const llmRerankSystemPrompt = `You are a relevance grader for a memory retrieval system.
+You will be given a query and a numbered list of memories.
+Rate how relevant each memory is to the query on a scale from 0 (unrelated) to 10 (directly answers the query).
+Respond with only a JSON array of numbers, one per memory, in the same order. For example: [7, 0, 10]`
+
+// LLMReranker asks an LLM to grade each candidate's relevance to the query.
+type LLMReranker struct {
+	llm LLMClient
+}
+
+// Compile-time check to ensure *LLMReranker satisfies the Reranker interface.
+var _ Reranker = (*LLMReranker)(nil)
+
+// NewLLMReranker creates a new LLMReranker.
+func NewLLMReranker(llm LLMClient) *LLMReranker {
+	return &LLMReranker{llm: llm}
+}
+
+// Rerank grades all documents in a single completion call.
+func (r *LLMReranker) Rerank(ctx context.Context, query string, documents []string) ([]float32, error) {
+	if r.llm == nil {
+		return nil, fmt.Errorf("LLM client is nil")
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Query: %s\n\nMemories:\n", query)
+	for i, doc := range documents {
+		fmt.Fprintf(&sb, "%d. %s\n", i+1, doc)
+	}
+
+	answer, err := r.llm.Complete(ctx, llmRerankSystemPrompt, sb.String())
+	if err != nil {
+		return nil, fmt.Errorf("LLM relevance grading failed: %w", err)
+	}
+	// Models sometimes wrap the array in prose or code fences; keep only the array.
+	start, end := strings.Index(answer, "["), strings.LastIndex(answer, "]")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("LLM relevance grading returned no JSON array: %q", answer)
+	}
+	var scores []float32
+	if err := json.Unmarshal([]byte(answer[start:end+1]), &scores); err != nil {
+		return nil, fmt.Errorf("failed to parse LLM relevance grades: %w", err)
+	}
+	if len(scores) != len(documents) {
+		return nil, fmt.Errorf("LLM returned %d grades for %d memories", len(scores), len(documents))
+	}
+	return scores, nil
+}
+
+// HeuristicReranker scores documents by query term coverage with a bonus for
+// containing the whole query as a phrase. It is deterministic and needs no
+// external service, which makes it suitable for tests and local development.
+type HeuristicReranker struct{}
+
+// Compile-time check to ensure HeuristicReranker satisfies the Reranker interface.
+var _ Reranker = HeuristicReranker{}
+
+// Rerank returns a score in [0, 1.5] for each document.
+func (HeuristicReranker) Rerank(ctx context.Context, query string, documents []string) ([]float32, error) {
+	queryTerms := make(map[string]struct{})
+	for _, t := range tokenize(query) {
+		queryTerms[t] = struct{}{}
+	}
+	phrase := strings.Join(tokenize(query), " ")
+
+	scores := make([]float32, len(documents))
+	if len(queryTerms) == 0 {
+		return scores, nil
+	}
+	for i, doc := range documents {
+		docTokens := tokenize(doc)
+		present := make(map[string]struct{}, len(docTokens))
+		for _, t := range docTokens {
+			present[t] = struct{}{}
+		}
+		matched := 0
+		for t := range queryTerms {
+			if _, ok := present[t]; ok {
+				matched++
+			}
+		}
+		score := float32(matched) / float32(len(queryTerms))
+		if phrase != "" && strings.Contains(" "+strings.Join(docTokens, " ")+" ", " "+phrase+" ") {
+			score += 0.5
+		}
+		scores[i] = score
+	}
+	return scores, nil
+}
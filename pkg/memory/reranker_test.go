@@ -0,0 +1,164 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// scriptedReranker scores each document from a fixed table.
+type scriptedReranker map[string]float32
+
+func (r scriptedReranker) Rerank(ctx context.Context, query string, documents []string) ([]float32, error) {
+	scores := make([]float32, len(documents))
+	for i, d := range documents {
+		scores[i] = r[d]
+	}
+	return scores, nil
+}
+
+// fixedScoresReranker returns its scores whatever the documents, or its error.
+type fixedScoresReranker struct {
+	scores []float32
+	err    error
+}
+
+func (r fixedScoresReranker) Rerank(ctx context.Context, query string, documents []string) ([]float32, error) {
+	return r.scores, r.err
+}
+
+// cannedLLM answers every completion with the same text.
+type cannedLLM string
+
+func (l cannedLLM) Complete(ctx context.Context, systemPrompt string, userPrompt string) (string, error) {
+	return string(l), nil
+}
+
+func TestRerankResults(t *testing.T) {
+	candidates := func() []MemoryResult {
+		return []MemoryResult{{ID: "a", Memory: "a", Score: 0.9}, {ID: "b", Memory: "b", Score: 0.8}, {ID: "c", Memory: "c", Score: 0.7}}
+	}
+
+	tests := []struct {
+		name     string
+		reranker Reranker
+		results  []MemoryResult
+		want     []string
+		wantErr  string
+	}{
+		{"sorts by rerank score", scriptedReranker{"a": 0.2, "b": 0.9, "c": 0.5}, candidates(), []string{"b", "c", "a"}, ""},
+		{"ties keep retrieval order", scriptedReranker{"a": 0.5, "b": 0.9, "c": 0.5}, candidates(), []string{"b", "a", "c"}, ""},
+		{"no candidates", fixedScoresReranker{err: errors.New("not called")}, nil, nil, ""},
+		{"reranker error", fixedScoresReranker{err: errors.New("boom")}, candidates(), nil, "rerank failed: boom"},
+		{"score count mismatch", fixedScoresReranker{scores: []float32{1}}, candidates(), nil, "reranker returned 1 scores for 3 documents"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rerankResults(context.Background(), tt.reranker, "q", tt.results)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("rerankResults error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("rerankResults: %v", err)
+			}
+			if !equalIDs(got, tt.want...) {
+				t.Errorf("rerankResults = %v, want %v", resultIDs(got), tt.want)
+			}
+			for _, r := range got {
+				if r.RerankScore == nil {
+					t.Errorf("result %s has no RerankScore", r.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestHeuristicReranker(t *testing.T) {
+	scores, err := HeuristicReranker{}.Rerank(context.Background(), "green tea", []string{
+		"I like green tea",
+		"Tea is green",
+		"I like tea",
+		"coffee",
+	})
+	if err != nil {
+		t.Fatalf("Rerank: %v", err)
+	}
+	if want := []float32{1.5, 1, 0.5, 0}; !reflect.DeepEqual(scores, want) {
+		t.Errorf("Rerank = %v, want %v", scores, want)
+	}
+}
+
+func TestHTTPReranker(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		reply   string
+		want    []float32
+		wantErr string
+	}{
+		{"text-embeddings-inference reply", http.StatusOK, `[{"index": 1, "score": 0.9}, {"index": 0, "score": 0.1}]`, []float32{0.1, 0.9}, ""},
+		{"results reply", http.StatusOK, `{"results": [{"index": 0, "relevance_score": 0.3}, {"index": 1, "relevance_score": 0.6}]}`, []float32{0.3, 0.6}, ""},
+		{"missing document", http.StatusOK, `[{"index": 0, "score": 0.1}]`, nil, "missing document 1"},
+		{"index out of range", http.StatusOK, `[{"index": 2, "score": 0.1}]`, nil, "index 2 out of range"},
+		{"error status", http.StatusBadGateway, "upstream down", nil, "502 Bad Gateway: upstream down"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if got := r.Header.Get("Authorization"); got != "Bearer key" {
+					t.Errorf("Authorization = %q, want the API key", got)
+				}
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.reply)
+			}))
+			defer server.Close()
+
+			scores, err := NewHTTPReranker(server.URL, "key", "").Rerank(context.Background(), "q", []string{"x", "y"})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Rerank error = %v, want it to mention %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Rerank: %v", err)
+			}
+			if !reflect.DeepEqual(scores, tt.want) {
+				t.Errorf("Rerank = %v, want %v", scores, tt.want)
+			}
+		})
+	}
+}
+
+func TestLLMReranker(t *testing.T) {
+	tests := []struct {
+		name    string
+		answer  string
+		want    []float32
+		wantErr bool
+	}{
+		{"bare array", "[7, 0]", []float32{7, 0}, false},
+		{"array in a code fence", "Here you go:\n```json\n[3, 10]\n```", []float32{3, 10}, false},
+		{"no array", "both are relevant", nil, true},
+		{"grade count mismatch", "[1]", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scores, err := NewLLMReranker(cannedLLM(tt.answer)).Rerank(context.Background(), "q", []string{"x", "y"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Rerank error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(scores, tt.want) {
+				t.Errorf("Rerank = %v, want %v", scores, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,347 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pnocera/gomem/pkg/graphs"
+	"github.com/pnocera/gomem/pkg/vectorstores"
+)
+
+const defaultSearchLimit = 100
+
+// SearchWorker answers search requests from the vector store and, optionally, the lexical index
+// and the graph store.
+type SearchWorker struct {
+	nc       NATSClient
+	cfg      *Config
+	openai   OpenAIClient
+	vs       vectorstores.VectorStore
+	lexical  LexicalIndex          // Optional, required only for hybrid requests
+	reranker Reranker              // Optional, required only for rerank requests
+	graph    graphs.GraphStore     // Optional, required only for graph context
+	llm      graphs.ToolCallingLLM // Optional, extracts query entities for graph context
+}
+
+// NewSearchWorker creates a new SearchWorker. lexical and reranker may be nil
+// when hybrid search or reranking are not used, and graph when results should not carry
+// graph relations. Without llm, query entities are matched by their words.
+func NewSearchWorker(nc NATSClient, cfg *Config, openai OpenAIClient, vs vectorstores.VectorStore, lexical LexicalIndex, reranker Reranker, graph graphs.GraphStore, llm graphs.ToolCallingLLM) *SearchWorker {
+	return &SearchWorker{
+		nc:       nc,
+		cfg:      cfg,
+		openai:   openai,
+		vs:       vs,
+		lexical:  lexical,
+		reranker: reranker,
+		graph:    graph,
+		llm:      llm,
+	}
+}
+
+// Start begins the worker's NATS subscription.
+func (w *SearchWorker) Start(ctx context.Context) error {
+	if w.nc == nil {
+		fmt.Println("SearchWorker: NATS client is nil, worker will not start.")
+		<-ctx.Done()
+		return nil
+	}
+	if w.vs == nil {
+		fmt.Println("SearchWorker: VectorStore client (vs) is nil, worker will not start effectively.")
+	}
+	if w.lexical == nil {
+		fmt.Println("SearchWorker: Lexical index is nil, hybrid requests will fall back to vector-only search.")
+	}
+	if w.reranker == nil {
+		fmt.Println("SearchWorker: Reranker is nil, rerank requests will keep the retrieval order.")
+	}
+	if w.graph == nil && w.cfg.EnableGraphStore {
+		fmt.Println("SearchWorker: Graph store is nil, results will not include relations.")
+	}
+
+	fmt.Printf("SearchWorker started, listening on topic: %s\n", w.cfg.TopicMemorySearch)
+	// In a real implementation, w.nc.Subscribe would be called here.
+	// The handler would be w.handleSearchMessage, with its return value sent as the reply.
+	go func() {
+		// Simulated subscription loop
+	}()
+
+	<-ctx.Done()
+	fmt.Println("SearchWorker shutting down.")
+	return nil
+}
+
+// handleSearchMessage processes a SearchMemoryRequest and returns the marshalled SearchMemoryResponse.
+// Search failures are reported inside the response so the requester always gets a reply.
+func (w *SearchWorker) handleSearchMessage(payload []byte) ([]byte, error) {
+	fmt.Printf("SearchWorker received payload: %s\n", string(payload))
+
+	var resp SearchMemoryResponse
+	var req SearchMemoryRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		fmt.Printf("SearchWorker: Error unmarshalling SearchMemoryRequest: %v\n", err)
+		resp.Error = fmt.Sprintf("error unmarshalling SearchMemoryRequest: %v", err)
+	} else if err := req.Validate(); err != nil {
+		resp.Error = fmt.Sprintf("invalid SearchMemoryRequest: %v", err)
+	} else {
+		results, err := w.search(context.Background(), &req)
+		if err != nil {
+			fmt.Printf("SearchWorker: Error searching memories: %v\n", err)
+			resp.Error = err.Error()
+		}
+		resp.Results = results
+	}
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling SearchMemoryResponse: %w", err)
+	}
+	return data, nil
+}
+
+// search retrieves candidates, filters, reranks and diversifies them as requested,
+// and truncates to the request limit.
+func (w *SearchWorker) search(ctx context.Context, req *SearchMemoryRequest) ([]MemoryResult, error) {
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+
+	rerank := req.Rerank && w.reranker != nil
+	fetchK := limit
+	if rerank {
+		topN := req.RerankTopN
+		if topN <= 0 {
+			topN = 3 * limit
+		}
+		if topN > fetchK {
+			fetchK = topN
+		}
+	}
+	if req.MMR != nil {
+		mmrK := req.MMR.FetchK
+		if mmrK <= 0 {
+			mmrK = 4 * limit
+		}
+		if mmrK > fetchK {
+			fetchK = mmrK
+		}
+	}
+
+	collectionName, err := vectorCollectionName(w.cfg)
+	if err != nil {
+		return nil, err
+	}
+	results, err := w.retrieve(ctx, collectionName, req, fetchK)
+	if err != nil {
+		return nil, err
+	}
+	if rerank {
+		results, err = rerankResults(ctx, w.reranker, req.Query, results)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if req.MMR != nil {
+		results, err = w.diversify(collectionName, req, results, limit)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	if w.includeRelations(req) {
+		relations, err := w.graphContext(ctx, req)
+		if err != nil {
+			// Graph context is supplementary; vector hits are still returned.
+			fmt.Printf("SearchWorker: Error retrieving graph context: %v\n", err)
+		}
+		attachRelations(results, relations)
+	}
+	return results, nil
+}
+
+// includeRelations reports whether results should carry graph relations.
+func (w *SearchWorker) includeRelations(req *SearchMemoryRequest) bool {
+	if w.graph == nil {
+		return false
+	}
+	if req.IncludeRelations != nil {
+		return *req.IncludeRelations
+	}
+	return w.cfg.EnableGraphStore
+}
+
+// diversify loads the candidates' embeddings in the space targeted by req.Vectors and applies
+// MMR selection.
+func (w *SearchWorker) diversify(collectionName string, req *SearchMemoryRequest, results []MemoryResult, limit int) ([]MemoryResult, error) {
+	names, err := targetVectorNames(w.cfg, req)
+	if err != nil {
+		return nil, err
+	}
+	lambda := float32(defaultMMRLambda)
+	if req.MMR.Lambda != nil {
+		lambda = *req.MMR.Lambda
+	}
+	vectors := make([][]float32, len(results))
+	for i, r := range results {
+		stored, err := w.vs.GetVector(collectionName, r.ID)
+		if err == nil && stored != nil {
+			vectors[i] = targetedVector(names, req, stored)
+		}
+		if len(vectors[i]) == 0 {
+			fmt.Printf("SearchWorker: No embedding for MemoryID %s, MMR will not penalize it for redundancy: %v\n", r.ID, err)
+			vectors[i] = nil
+		}
+	}
+	return selectMMR(results, vectors, lambda, limit), nil
+}
+
+// retrieve runs the vector search, the lexical search when requested, and fuses the two.
+// When req.MinScore is set, only candidates with a vector similarity of at least MinScore survive:
+// vector hits below it are dropped before fusion and lexical-only hits are dropped after it.
+func (w *SearchWorker) retrieve(ctx context.Context, collectionName string, req *SearchMemoryRequest, limit int) ([]MemoryResult, error) {
+	if w.vs == nil {
+		return nil, fmt.Errorf("VectorStore client is nil")
+	}
+	if w.openai == nil {
+		return nil, fmt.Errorf("OpenAI client is nil, cannot embed query")
+	}
+
+	filter := searchFilter(req.BaseRequestInfo)
+
+	queryEmbedding, err := w.openai.GetEmbedding(ctx, req.Query)
+	if err != nil {
+		return nil, fmt.Errorf("error embedding query: %w", err)
+	}
+	if w.cfg.Embedder != nil {
+		if err := checkEmbeddingDimension(queryEmbedding, w.cfg.Embedder.Dimensions); err != nil {
+			return nil, fmt.Errorf("query embedding does not match collection %s: %w", collectionName, err)
+		}
+	}
+	vectorHits, err := searchVectors(w.vs, w.cfg, collectionName, queryEmbedding, req, limit, filter)
+	if err != nil {
+		return nil, fmt.Errorf("error searching vectors: %w", err)
+	}
+	if req.MinScore > 0 {
+		kept := vectorHits[:0]
+		for _, hit := range vectorHits {
+			if hit.Score >= req.MinScore {
+				kept = append(kept, hit)
+			}
+		}
+		vectorHits = kept
+	}
+
+	if req.Hybrid == nil || w.lexical == nil {
+		results := make([]MemoryResult, 0, len(vectorHits))
+		for _, hit := range vectorHits {
+			results = append(results, memoryResultFromPayload(hit.ID, hit.Score, hit.Payload))
+		}
+		return results, nil
+	}
+
+	lexicalHits, err := w.lexical.Search(ctx, req.Query, limit, filter)
+	if err != nil {
+		return nil, fmt.Errorf("error searching lexical index: %w", err)
+	}
+
+	fused := fuseResults(vectorHits, lexicalHits, req.Hybrid)
+	if req.MinScore > 0 {
+		// A lexical-only hit has no vector similarity to compare against MinScore.
+		passed := make(map[string]bool, len(vectorHits))
+		for _, hit := range vectorHits {
+			passed[hit.ID] = true
+		}
+		kept := fused[:0]
+		for _, c := range fused {
+			if passed[c.ID] {
+				kept = append(kept, c)
+			}
+		}
+		fused = kept
+	}
+	if len(fused) > limit {
+		fused = fused[:limit]
+	}
+	results := make([]MemoryResult, 0, len(fused))
+	for _, c := range fused {
+		payload := c.Payload
+		if payload == nil {
+			// Lexical-only hit: load the stored memory from the vector store.
+			stored, err := w.vs.GetVector(collectionName, c.ID)
+			if err != nil || stored == nil {
+				fmt.Printf("SearchWorker: Skipping lexical hit %s missing from vector store: %v\n", c.ID, err)
+				continue
+			}
+			payload = stored.Payload
+		}
+		results = append(results, memoryResultFromPayload(c.ID, c.Score, payload))
+	}
+	return results, nil
+}
+
+// searchFilter scopes a search to the caller's user, agent and run.
+func searchFilter(info BaseRequestInfo) *vectorstores.QueryFilter {
+	filter := &vectorstores.QueryFilter{UserID: info.UserID}
+	if info.AgentID != "" || info.RunID != "" {
+		filter.Metadata = make(map[string]interface{})
+		if info.AgentID != "" {
+			filter.Metadata["agent_id"] = info.AgentID
+		}
+		if info.RunID != "" {
+			filter.Metadata["run_id"] = info.RunID
+		}
+	}
+	return filter
+}
+
+// memoryResultFromPayload converts a vector payload written by the QdrantWorker into a MemoryResult.
+func memoryResultFromPayload(id string, score float32, payload map[string]interface{}) MemoryResult {
+	result := MemoryResult{
+		ID:    id,
+		Score: score,
+	}
+	metadata := make(map[string]interface{})
+	for k, v := range payload {
+		s, _ := v.(string)
+		switch k {
+		case "text":
+			result.Memory = s
+		case "user_id":
+			result.UserID = s
+		case "agent_id":
+			result.AgentID = s
+		case "run_id":
+			result.RunID = s
+		case "actor_id":
+			result.ActorID = s
+		case "role":
+			result.Role = s
+		case "hash":
+			result.Hash = s
+		case "timestamp":
+			if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+				result.CreatedAt = t
+				if result.UpdatedAt.IsZero() {
+					result.UpdatedAt = t
+				}
+			}
+		case "updated_at":
+			if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+				result.UpdatedAt = t
+			}
+		case "original_text", "raw_text":
+			// Internal bookkeeping, not part of the returned memory.
+		default:
+			metadata[k] = v
+		}
+	}
+	if len(metadata) > 0 {
+		result.Metadata = metadata
+	}
+	return result
+}
@@ -0,0 +1,70 @@
+package memory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pnocera/gomem/pkg/vectorstores"
+)
+
+// fixedEmbedder embeds every text as the same vector.
+type fixedEmbedder struct {
+	OpenAIClient
+	embedding []float32
+}
+
+func (e fixedEmbedder) GetEmbedding(ctx context.Context, text string) ([]float32, error) {
+	return e.embedding, nil
+}
+
+func TestRetrieveAppliesMinScoreToLexicalHits(t *testing.T) {
+	ctx := context.Background()
+	vs := vectorstores.NewInMemoryStore(nil)
+	if err := vs.CreateCollection("memories", 2, "cosine"); err != nil {
+		t.Fatalf("CreateCollection: %v", err)
+	}
+	lexical := NewBM25Index()
+	docs := []struct {
+		id, text  string
+		embedding []float32
+	}{
+		{"near", "apple pie with apple", []float32{1, 0}},
+		{"far", "apple tart", []float32{0, 1}},
+	}
+	for _, d := range docs {
+		payload := map[string]interface{}{"text": d.text, "user_id": "u1"}
+		if err := vs.InsertVectors("memories", []vectorstores.VectorInput{{ID: d.id, Embedding: d.embedding, Payload: payload}}); err != nil {
+			t.Fatalf("InsertVectors: %v", err)
+		}
+		if err := lexical.Index(ctx, LexicalDocument{ID: d.id, Text: d.text, UserID: "u1"}); err != nil {
+			t.Fatalf("Index: %v", err)
+		}
+	}
+	w := &SearchWorker{cfg: &Config{}, openai: fixedEmbedder{embedding: []float32{1, 0}}, vs: vs, lexical: lexical}
+
+	tests := []struct {
+		name     string
+		minScore float32
+		want     []string
+	}{
+		{"disabled", 0, []string{"near", "far"}},
+		{"drops lexical-only hit", 0.5, []string{"near"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &SearchMemoryRequest{
+				BaseRequestInfo: BaseRequestInfo{UserID: "u1"},
+				Query:           "apple",
+				Hybrid:          &HybridSearchOptions{},
+				MinScore:        tt.minScore,
+			}
+			got, err := w.retrieve(ctx, "memories", req, 10)
+			if err != nil {
+				t.Fatalf("retrieve: %v", err)
+			}
+			if !equalIDs(got, tt.want...) {
+				t.Errorf("retrieve = %v, want %v", resultIDs(got), tt.want)
+			}
+		})
+	}
+}
@@ -1,11 +1,16 @@
 package memory
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"time"
 
+	"github.com/pnocera/gomem/pkg/graphs"
+
 	"github.com/google/uuid"
 )
 
@@ -17,6 +22,15 @@ type MemoryService interface {
 	Update(ctx context.Context, memoryID string, data map[string]interface{}, baseInfo BaseRequestInfo) error
 	Delete(ctx context.Context, memoryID string, baseInfo BaseRequestInfo) error
 	GetHistory(ctx context.Context, memoryID string, baseInfo BaseRequestInfo) ([]*MemoryEvent, error)
+	// QueryHistory returns a page of the memory events matching query, whose scope the
+	// caller baseInfo must cover; pass the page's NextCursor in the next query to continue.
+	QueryHistory(ctx context.Context, query *HistoryQuery, baseInfo BaseRequestInfo) (*HistoryPage, error)
+	// ExportGraph writes the knowledge graphs of scopes, each of which the caller baseInfo
+	// must cover, to w; see graphs.ExportGraph.
+	ExportGraph(ctx context.Context, w io.Writer, format graphs.ExportFormat, baseInfo BaseRequestInfo, scopes ...BaseRequestInfo) error
+	// ImportGraph validates graphs read from r and loads them into the graph store once the
+	// caller baseInfo is authorized for every target scope; see graphs.ImportGraph.
+	ImportGraph(ctx context.Context, r io.Reader, format graphs.ExportFormat, opts graphs.ImportOptions, baseInfo BaseRequestInfo) (*graphs.ImportResult, error)
 }
 
 // memoryServiceImpl implements the MemoryService interface.
@@ -24,18 +38,22 @@ type memoryServiceImpl struct {
 	nc      NATSClient
 	cfg     *Config
 	history HistoryStore
+	graph   graphs.GraphStore // Nil when the graph store is disabled
+	authz   Authorizer
 	// openai OpenAIClient // Placeholder
 }
 
 // Compile-time check to ensure *memoryServiceImpl satisfies the MemoryService interface.
 var _ MemoryService = (*memoryServiceImpl)(nil)
 
-// NewMemoryService creates a new instance of memoryServiceImpl.
-func NewMemoryService(nc NATSClient, cfg *Config, historyStore HistoryStore) MemoryService {
+// NewMemoryService creates a new instance of memoryServiceImpl. A nil authz uses ScopeAuthorizer.
+func NewMemoryService(nc NATSClient, cfg *Config, historyStore HistoryStore, graphStore graphs.GraphStore, authz Authorizer) MemoryService {
 	return &memoryServiceImpl{
 		nc:      nc,
 		cfg:     cfg,
 		history: historyStore,
+		graph:   graphStore,
+		authz:   authorizerOrDefault(authz),
 	}
 }
 
@@ -89,18 +107,41 @@ func (s *memoryServiceImpl) Search(ctx context.Context, req *SearchMemoryRequest
 	if s.nc != nil {
 		// Define a reasonable timeout for NATS request-reply
 		timeout := 5 * time.Second // Example timeout
-		_, err = s.nc.Request(ctx, s.cfg.TopicMemorySearch, jsonData, timeout)
+		responseData, err := s.nc.Request(ctx, s.cfg.TopicMemorySearch, jsonData, timeout)
 		if err != nil {
 			return nil, fmt.Errorf("NATS request to %s failed: %w", s.cfg.TopicMemorySearch, err)
 		}
-		// TODO: Unmarshal responseData into []MemoryResult
-		return nil, fmt.Errorf("Search via NATS not fully implemented (response handling pending)")
+		var resp SearchMemoryResponse
+		if err := json.Unmarshal(responseData, &resp); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal SearchMemoryResponse: %w", err)
+		}
+		if resp.Error != "" {
+			return nil, fmt.Errorf("search failed: %s", resp.Error)
+		}
+		return s.authorizedResults(ctx, req.BaseRequestInfo, resp.Results)
 	}
 
 	fmt.Printf("NATS_REQUEST (nc is nil): Topic=%s, Payload=%s\n", s.cfg.TopicMemorySearch, string(jsonData))
 	return nil, fmt.Errorf("Search via NATS not fully implemented (NATS client is nil)")
 }
 
+// authorizedResults drops the search results whose owner the caller may not read. The
+// search worker filters on the caller's scope, so this only removes results that a
+// broader filter let through.
+func (s *memoryServiceImpl) authorizedResults(ctx context.Context, caller BaseRequestInfo, results []MemoryResult) ([]MemoryResult, error) {
+	allowed := results[:0]
+	for _, result := range results {
+		owner := BaseRequestInfo{UserID: result.UserID, AgentID: result.AgentID, RunID: result.RunID}
+		err := s.authz.Authorize(ctx, caller, owner, ActionRead)
+		if err == nil {
+			allowed = append(allowed, result)
+		} else if !errors.Is(err, ErrForbidden) {
+			return nil, err
+		}
+	}
+	return allowed, nil
+}
+
 // GetRequestData is a helper struct for Get, Update, Delete operations
 type GetRequestData struct {
 	BaseRequestInfo
@@ -131,12 +172,18 @@ func (s *memoryServiceImpl) Get(ctx context.Context, memoryID string, baseInfo B
 
 	if s.nc != nil {
 		timeout := 5 * time.Second // Example timeout
-		_, err = s.nc.Request(ctx, s.cfg.TopicMemoryGet, jsonData, timeout)
+		responseData, err := s.nc.Request(ctx, s.cfg.TopicMemoryGet, jsonData, timeout)
 		if err != nil {
 			return nil, fmt.Errorf("NATS request to %s failed: %w", s.cfg.TopicMemoryGet, err)
 		}
-		// TODO: Unmarshal responseData into *MemoryResult
-		return nil, fmt.Errorf("Get via NATS not fully implemented (response handling pending)")
+		var resp GetMemoryResponse
+		if err := json.Unmarshal(responseData, &resp); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal GetMemoryResponse: %w", err)
+		}
+		if resp.Error != "" {
+			return nil, responseError("get", resp.Error, resp.Code)
+		}
+		return resp.Result, nil
 	}
 
 	fmt.Printf("NATS_REQUEST (nc is nil): Topic=%s, Payload=%s\n", s.cfg.TopicMemoryGet, string(jsonData))
@@ -168,14 +215,10 @@ func (s *memoryServiceImpl) Update(ctx context.Context, memoryID string, data ma
 	}
 
 	if s.nc != nil {
-		err = s.nc.Publish(ctx, topic, jsonData)
-		if err != nil {
-			return fmt.Errorf("failed to publish to NATS topic %s: %w", topic, err)
-		}
-		return nil // Or handle response if it's a request-reply
+		return s.requestWrite(ctx, "update", topic, jsonData)
 	}
 
-	fmt.Printf("NATS_PUBLISH (nc is nil): Topic=%s, Payload=%s\n", topic, string(jsonData))
+	fmt.Printf("NATS_REQUEST (nc is nil): Topic=%s, Payload=%s\n", topic, string(jsonData))
 	return fmt.Errorf("Update via NATS not fully implemented (NATS client is nil)")
 }
 
@@ -201,34 +244,142 @@ func (s *memoryServiceImpl) Delete(ctx context.Context, memoryID string, baseInf
 	}
 
 	if s.nc != nil {
-		err = s.nc.Publish(ctx, topic, jsonData)
-		if err != nil {
-			return fmt.Errorf("failed to publish to NATS topic %s: %w", topic, err)
-		}
-		return nil // Or handle response if it's a request-reply
+		return s.requestWrite(ctx, "delete", topic, jsonData)
 	}
 
-	fmt.Printf("NATS_PUBLISH (nc is nil): Topic=%s, Payload=%s\n", topic, string(jsonData))
+	fmt.Printf("NATS_REQUEST (nc is nil): Topic=%s, Payload=%s\n", topic, string(jsonData))
 	return fmt.Errorf("Delete via NATS not fully implemented (NATS client is nil)")
 }
 
-// GetHistory retrieves memory events directly from the history store.
+// requestWrite sends an update or delete request to topic and decodes the worker's MemoryWriteResponse.
+func (s *memoryServiceImpl) requestWrite(ctx context.Context, op string, topic string, jsonData []byte) error {
+	timeout := 5 * time.Second // Example timeout
+	responseData, err := s.nc.Request(ctx, topic, jsonData, timeout)
+	if err != nil {
+		return fmt.Errorf("NATS request to %s failed: %w", topic, err)
+	}
+	var resp MemoryWriteResponse
+	if err := json.Unmarshal(responseData, &resp); err != nil {
+		return fmt.Errorf("failed to unmarshal MemoryWriteResponse: %w", err)
+	}
+	if resp.Error != "" {
+		return responseError(op, resp.Error, resp.Code)
+	}
+	return nil
+}
+
+// GetHistory retrieves memory events directly from the history store. The caller's scope
+// must cover every owner recorded by the memory's events; events without a user, such as
+// re-embedding records, name no owner.
 func (s *memoryServiceImpl) GetHistory(ctx context.Context, memoryID string, baseInfo BaseRequestInfo) ([]*MemoryEvent, error) {
-	// Here baseInfo might be used for authorization/filtering in a more complex setup,
-	// but the current HistoryStore interface doesn't use it for GetHistory.
 	if memoryID == "" {
 		return nil, fmt.Errorf("memoryID cannot be empty")
 	}
 	if s.history == nil {
 		return nil, fmt.Errorf("history store is not initialized")
 	}
-	// The current HistoryStore GetHistory only takes memoryID.
-	// If BaseRequestInfo is needed for filtering at history store level, the interface would need an update.
-	// For now, we pass only memoryID.
 	events, err := s.history.GetHistory(ctx, memoryID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get history from store: %w", err)
 	}
-	// The interface expects []*MemoryEvent, which s.history.GetHistory returns.
-	return events, err
+	var owners []BaseRequestInfo
+	seen := make(map[[3]string]bool)
+	for _, event := range events {
+		key := [3]string{event.UserID, event.AgentID, event.RunID}
+		if event.UserID == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		owners = append(owners, BaseRequestInfo{UserID: event.UserID, AgentID: event.AgentID, RunID: event.RunID})
+	}
+	if len(owners) == 0 && len(events) > 0 {
+		// No event names an owner, so only an Authorizer that allows unowned data grants access.
+		owners = append(owners, BaseRequestInfo{})
+	}
+	for _, owner := range owners {
+		if err := s.authz.Authorize(ctx, baseInfo, owner, ActionRead); err != nil {
+			return nil, err
+		}
+	}
+	return events, nil
+}
+
+// QueryHistory returns a page of the memory events matching query from the history store.
+// The caller must be authorized for the scope the query filters on.
+func (s *memoryServiceImpl) QueryHistory(ctx context.Context, query *HistoryQuery, baseInfo BaseRequestInfo) (*HistoryPage, error) {
+	if query == nil {
+		return nil, fmt.Errorf("history query cannot be nil")
+	}
+	if s.history == nil {
+		return nil, fmt.Errorf("history store is not initialized")
+	}
+	scope := BaseRequestInfo{UserID: query.UserID, AgentID: query.AgentID, RunID: query.RunID}
+	if err := s.authz.Authorize(ctx, baseInfo, scope, ActionRead); err != nil {
+		return nil, err
+	}
+	page, err := s.history.QueryHistory(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query history: %w", err)
+	}
+	return page, nil
+}
+
+// ExportGraph writes the knowledge graphs of scopes to w in format, once the caller is
+// authorized to read each of them. Cypher scripts target the configured graph store's schema.
+func (s *memoryServiceImpl) ExportGraph(ctx context.Context, w io.Writer, format graphs.ExportFormat, baseInfo BaseRequestInfo, scopes ...BaseRequestInfo) error {
+	if s.graph == nil {
+		return fmt.Errorf("graph store is not initialized")
+	}
+	filters := make([]graphs.Filter, len(scopes))
+	for i, scope := range scopes {
+		if err := s.authz.Authorize(ctx, baseInfo, scope, ActionRead); err != nil {
+			return err
+		}
+		filters[i] = graphs.Filter{UserID: scope.UserID, AgentID: scope.AgentID, RunID: scope.RunID}
+	}
+	opts := graphs.ExportOptions{BaseLabel: s.cfg.GraphConfig.UsesBaseLabel()}
+	if err := graphs.ExportGraph(ctx, s.graph, w, format, opts, filters...); err != nil {
+		return fmt.Errorf("failed to export graph: %w", err)
+	}
+	return nil
+}
+
+// ImportGraph validates the graphs read from r and loads them into the graph store. The
+// input is decoded once without writing to learn its target scopes, after opts.Scope is
+// applied; the caller must be authorized to update each of them, and to delete them when
+// opts.Replace is set, before the store is touched.
+func (s *memoryServiceImpl) ImportGraph(ctx context.Context, r io.Reader, format graphs.ExportFormat, opts graphs.ImportOptions, baseInfo BaseRequestInfo) (*graphs.ImportResult, error) {
+	if s.graph == nil {
+		return nil, fmt.Errorf("graph store is not initialized")
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read graph: %w", err)
+	}
+	dryRun := opts
+	dryRun.DryRun = true
+	plan, err := graphs.ImportGraph(ctx, s.graph, bytes.NewReader(data), format, dryRun)
+	if err != nil {
+		return nil, fmt.Errorf("failed to import graph: %w", err)
+	}
+	actions := []Action{ActionUpdate}
+	if opts.Replace {
+		actions = append(actions, ActionDelete)
+	}
+	for _, scope := range plan.Scopes {
+		owner := BaseRequestInfo{UserID: scope.UserID, AgentID: scope.AgentID, RunID: scope.RunID}
+		for _, action := range actions {
+			if err := s.authz.Authorize(ctx, baseInfo, owner, action); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if opts.DryRun {
+		return plan, nil
+	}
+	result, err := graphs.ImportGraph(ctx, s.graph, bytes.NewReader(data), format, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to import graph: %w", err)
+	}
+	return result, nil
 }
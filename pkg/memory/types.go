@@ -1,8 +1,11 @@
 package memory
 
 import (
+	"fmt"
 	"time"
 
+	"github.com/pnocera/gomem/pkg/graphs"
+
 	"github.com/go-playground/validator/v10"
 )
 
@@ -50,15 +53,19 @@ type ProcessedMemoryData struct {
 	ProcessedText    string    `json:"processed_text"`
 	MemoryID         string    `json:"memory_id"`
 	ExtractedFacts   []string  `json:"extracted_facts,omitempty"`
+	Hash             string    `json:"hash,omitempty"` // ContentHash of ProcessedText
 }
 
 // EmbeddingData contains text and its embedding.
 type EmbeddingData struct {
 	BaseRequestInfo
-	MemoryID      string    `json:"memory_id"`
-	TextToEmbed   string    `json:"text_to_embed"`
-	Embedding     []float32 `json:"embedding"`
-	ProcessedText string    `json:"processed_text"`
+	MemoryID      string               `json:"memory_id"`
+	TextToEmbed   string               `json:"text_to_embed"`
+	Embedding     []float32            `json:"embedding"`
+	Embeddings    map[string][]float32 `json:"embeddings,omitempty"` // Named vectors, set instead of Embedding when configured
+	ProcessedText string               `json:"processed_text"`
+	RawText       string               `json:"raw_text,omitempty"` // Original conversation snippet
+	Hash          string               `json:"hash,omitempty"`     // ContentHash of ProcessedText
 }
 
 // VectorStoreStorageData is for the Qdrant worker.
@@ -78,13 +85,15 @@ type Entity struct {
 	ID   string `json:"id"`
 	Type string `json:"type"`
 	Name string `json:"name"`
+	graphs.Attributes
 }
 
-// Relation for GraphStoreStorageData - minimal for now.
+// Relation for GraphStoreStorageData.
 type Relation struct {
 	SourceID         string `json:"source_id"`
 	TargetID         string `json:"target_id"`
 	RelationshipType string `json:"relationship_type"`
+	graphs.Attributes
 }
 
 // GraphStoreStorageData is for the Dgraph worker.
@@ -118,40 +127,141 @@ func (e *MemoryEvent) Validate() error {
 	return validate.Struct(e)
 }
 
-// GraphRelation for MemoryResult - minimal for now.
+// Default and maximum page sizes of HistoryQuery.
+const (
+	DefaultHistoryPageSize = 100
+	MaxHistoryPageSize     = 1000
+)
+
+// HistoryQuery selects memory events. Empty fields match every event; Since is
+// inclusive and Until exclusive. Events are ordered by timestamp, then event ID.
+type HistoryQuery struct {
+	MemoryID   string    `json:"memory_id,omitempty"`
+	UserID     string    `json:"user_id,omitempty"`
+	AgentID    string    `json:"agent_id,omitempty"`
+	RunID      string    `json:"run_id,omitempty"`
+	ActorID    string    `json:"actor_id,omitempty"`
+	EventTypes []string  `json:"event_types,omitempty" validate:"dive,required"`
+	Since      time.Time `json:"since,omitempty"`
+	Until      time.Time `json:"until,omitempty"`
+	Order      string    `json:"order,omitempty" validate:"omitempty,oneof=asc desc"` // Defaults to asc
+	Limit      int       `json:"limit,omitempty" validate:"gte=0,lte=1000"`           // Defaults to DefaultHistoryPageSize
+	Cursor     string    `json:"cursor,omitempty"`                                    // NextCursor of the previous page
+}
+
+// Validate validates the HistoryQuery struct.
+func (q *HistoryQuery) Validate() error {
+	validate := validator.New()
+	if err := validate.Struct(q); err != nil {
+		return err
+	}
+	if !q.Since.IsZero() && !q.Until.IsZero() && !q.Until.After(q.Since) {
+		return fmt.Errorf("until must be after since")
+	}
+	return nil
+}
+
+// HistoryPage is a page of QueryHistory results. NextCursor is empty on the last page.
+type HistoryPage struct {
+	Events     []*MemoryEvent `json:"events"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// GraphRelation is a graph store relation returned with search results. The embedded
+// Attributes are the edge's properties and provenance.
 type GraphRelation struct {
-	SourceNodeID string `json:"source_node_id"`
-	TargetNodeID string `json:"target_node_id"`
-	Type         string `json:"type"`
-	// Add other properties if needed
+	SourceNodeID string  `json:"source_node_id"` // Normalized entity name
+	SourceType   string  `json:"source_type,omitempty"`
+	TargetNodeID string  `json:"target_node_id"` // Normalized entity name
+	TargetType   string  `json:"target_type,omitempty"`
+	Type         string  `json:"type"`
+	Score        float32 `json:"score"` // BM25 score of the triple against the query, 0 when no term matched
+	graphs.Attributes
 }
 
 // MemoryResult is the structure for returning memories.
 type MemoryResult struct {
-	ID        string                 `json:"id"`
-	Memory    string                 `json:"memory"`
-	Score     float32                `json:"score,omitempty"`
-	Hash      string                 `json:"hash,omitempty"`
-	CreatedAt time.Time              `json:"created_at,omitempty"`
-	UpdatedAt time.Time              `json:"updated_at,omitempty"`
-	UserID    string                 `json:"user_id,omitempty"` // Explicit fields for common query/filter needs
-	AgentID   string                 `json:"agent_id,omitempty"`
-	RunID     string                 `json:"run_id,omitempty"`
-	ActorID   string                 `json:"actor_id,omitempty"`
-	Role      string                 `json:"role,omitempty"`
-	Metadata  map[string]interface{} `json:"metadata,omitempty"`
-	Relations []GraphRelation        `json:"relations,omitempty"`
+	ID          string                 `json:"id"`
+	Memory      string                 `json:"memory"`
+	Score       float32                `json:"score,omitempty"`
+	RerankScore *float32               `json:"rerank_score,omitempty"` // Set only when the results were reranked
+	Hash        string                 `json:"hash,omitempty"`
+	CreatedAt   time.Time              `json:"created_at,omitempty"`
+	UpdatedAt   time.Time              `json:"updated_at,omitempty"`
+	UserID      string                 `json:"user_id,omitempty"` // Explicit fields for common query/filter needs
+	AgentID     string                 `json:"agent_id,omitempty"`
+	RunID       string                 `json:"run_id,omitempty"`
+	ActorID     string                 `json:"actor_id,omitempty"`
+	Role        string                 `json:"role,omitempty"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+	Relations   []GraphRelation        `json:"relations,omitempty"`
+}
+
+// HybridSearchOptions enables lexical (BM25) retrieval alongside vector search
+// and controls how the two ranked lists are fused.
+type HybridSearchOptions struct {
+	Fusion        string   `json:"fusion,omitempty" validate:"omitempty,oneof=rrf weighted"` // Defaults to "rrf"
+	VectorWeight  *float32 `json:"vector_weight,omitempty" validate:"omitempty,gte=0"`       // Defaults to 1; 0 ignores the vector ranking
+	LexicalWeight *float32 `json:"lexical_weight,omitempty" validate:"omitempty,gte=0"`      // Defaults to 1; 0 ignores the lexical ranking
+	RRFK          int      `json:"rrf_k,omitempty" validate:"omitempty,gt=0"`                // Defaults to 60, only used by "rrf"
 }
 
 // SearchMemoryRequest
 type SearchMemoryRequest struct {
 	BaseRequestInfo
-	Query string `json:"query" validate:"required"`
-	Limit int    `json:"limit" validate:"omitempty,gt=0"` // Default handling (e.g., 100) done in processing logic
+	Query  string               `json:"query" validate:"required"`
+	Limit  int                  `json:"limit" validate:"omitempty,gt=0"` // Default handling (e.g., 100) done in processing logic
+	Hybrid *HybridSearchOptions `json:"hybrid,omitempty"`                // Nil means vector-only search
+
+	Rerank     bool `json:"rerank,omitempty"`                                 // Apply the worker's Reranker before truncating to Limit
+	RerankTopN int  `json:"rerank_top_n,omitempty" validate:"omitempty,gt=0"` // Candidates to rerank, defaults to 3 * Limit
+
+	Vectors       []string           `json:"vectors,omitempty"`        // Named vectors to search, defaults to the first configured one
+	VectorWeights map[string]float32 `json:"vector_weights,omitempty"` // Per-name weights when several vectors are searched, default 1
+
+	MMR      *MMROptions `json:"mmr,omitempty"`       // Nil disables maximal marginal relevance selection
+	MinScore float32     `json:"min_score,omitempty"` // Drop results whose vector similarity (weighted sum for several named vectors) is missing or below this; 0 disables
+
+	IncludeRelations *bool      `json:"include_relations,omitempty"`                          // Fill Relations from the graph store; defaults to true when the graph store is enabled
+	GraphHops        int        `json:"graph_hops,omitempty" validate:"omitempty,gt=0,lte=5"` // Traversal depth from the query entities, defaults to 1
+	GraphLimit       int        `json:"graph_limit,omitempty" validate:"omitempty,gt=0"`      // Relations returned across all results, defaults to 10
+	GraphAsOf        *time.Time `json:"graph_as_of,omitempty"`                                // Relations valid at this time; defaults to now
+}
+
+// MMROptions configures maximal marginal relevance selection of search results.
+type MMROptions struct {
+	Lambda *float32 `json:"lambda,omitempty" validate:"omitempty,gte=0,lte=1"` // 1 is pure relevance, 0 is pure diversity; defaults to 0.5
+	FetchK int      `json:"fetch_k,omitempty" validate:"omitempty,gt=0"`       // Candidates to select from, defaults to 4 * Limit
+}
+
+// GetMemoryResponse is the reply sent by the GetWorker.
+type GetMemoryResponse struct {
+	Result *MemoryResult `json:"result,omitempty"`
+	Error  string        `json:"error,omitempty"`
+	Code   string        `json:"code,omitempty"` // "forbidden" when Error is an ErrForbidden
+}
+
+// MemoryWriteResponse is the reply sent by the UpdateWorker and the DeleteWorker.
+type MemoryWriteResponse struct {
+	Error string `json:"error,omitempty"`
+	Code  string `json:"code,omitempty"` // "forbidden" when Error is an ErrForbidden
 }
 
-// Validate validates the SearchMemoryRequest struct.
+// SearchMemoryResponse is the reply sent by the SearchWorker.
+type SearchMemoryResponse struct {
+	Results []MemoryResult `json:"results"`
+	Error   string         `json:"error,omitempty"`
+}
+
+// Validate validates the SearchMemoryRequest struct, and that hybrid fusion keeps a ranking
+// with a positive weight.
 func (r *SearchMemoryRequest) Validate() error {
 	validate := validator.New()
-	return validate.Struct(r)
+	if err := validate.Struct(r); err != nil {
+		return err
+	}
+	if h := r.Hybrid; h != nil && h.VectorWeight != nil && h.LexicalWeight != nil && *h.VectorWeight == 0 && *h.LexicalWeight == 0 {
+		return fmt.Errorf("hybrid vector_weight and lexical_weight cannot both be 0")
+	}
+	return nil
 }
@@ -0,0 +1,217 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pnocera/gomem/pkg/vectorstores"
+
+	"github.com/google/uuid"
+)
+
+// protectedPayloadKeys are payload fields an update may not set: the owner scope, which
+// authorization relies on, and the fields the worker derives itself.
+var protectedPayloadKeys = map[string]bool{
+	"user_id":    true,
+	"agent_id":   true,
+	"run_id":     true,
+	"hash":       true,
+	"timestamp":  true,
+	"updated_at": true,
+}
+
+// UpdateWorker answers update requests for a single memory. A "text" entry in the
+// update data replaces the memory's text and is re-embedded; other entries are merged
+// into its payload.
+type UpdateWorker struct {
+	nc      NATSClient
+	cfg     *Config
+	openai  OpenAIClient
+	vs      vectorstores.VectorStore
+	lexical LexicalIndex // Optional keyword index kept in step with the vector store
+	authz   Authorizer
+}
+
+// NewUpdateWorker creates a new UpdateWorker. lexical may be nil when hybrid search is
+// not used; a nil authz uses ScopeAuthorizer.
+func NewUpdateWorker(nc NATSClient, cfg *Config, openai OpenAIClient, vs vectorstores.VectorStore, lexical LexicalIndex, authz Authorizer) *UpdateWorker {
+	return &UpdateWorker{
+		nc:      nc,
+		cfg:     cfg,
+		openai:  openai,
+		vs:      vs,
+		lexical: lexical,
+		authz:   authorizerOrDefault(authz),
+	}
+}
+
+// Start begins the worker's NATS subscription.
+func (w *UpdateWorker) Start(ctx context.Context) error {
+	if w.nc == nil {
+		fmt.Println("UpdateWorker: NATS client is nil, worker will not start.")
+		<-ctx.Done()
+		return nil
+	}
+	if w.vs == nil {
+		fmt.Println("UpdateWorker: VectorStore client (vs) is nil, worker will not start effectively.")
+	}
+
+	fmt.Printf("UpdateWorker started, listening on topic: %s\n", w.cfg.TopicMemoryUpdate)
+	// In a real implementation, w.nc.Subscribe would be called here.
+	// The handler would be w.handleUpdateMessage, with its return value sent as the reply.
+	go func() {
+		// Simulated subscription loop
+	}()
+
+	<-ctx.Done()
+	fmt.Println("UpdateWorker shutting down.")
+	return nil
+}
+
+// handleUpdateMessage processes an UpdateRequestData and returns the marshalled MemoryWriteResponse.
+func (w *UpdateWorker) handleUpdateMessage(payload []byte) ([]byte, error) {
+	fmt.Printf("UpdateWorker received payload: %s\n", string(payload))
+
+	var resp MemoryWriteResponse
+	var req UpdateRequestData
+	if err := json.Unmarshal(payload, &req); err != nil {
+		fmt.Printf("UpdateWorker: Error unmarshalling UpdateRequestData: %v\n", err)
+		resp.Error = fmt.Sprintf("error unmarshalling UpdateRequestData: %v", err)
+	} else if err := w.update(context.Background(), &req); err != nil {
+		fmt.Printf("UpdateWorker: Error updating MemoryID %s: %v\n", req.MemoryID, err)
+		resp.Error, resp.Code = replyError(err)
+	}
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling MemoryWriteResponse: %w", err)
+	}
+	return data, nil
+}
+
+// update authorizes and applies req.
+func (w *UpdateWorker) update(ctx context.Context, req *UpdateRequestData) error {
+	if w.vs == nil {
+		return fmt.Errorf("VectorStore client is nil")
+	}
+	for k := range req.Data {
+		if protectedPayloadKeys[k] {
+			return fmt.Errorf("field %s cannot be updated", k)
+		}
+	}
+	newText, hasText := req.Data["text"].(string)
+	if _, ok := req.Data["text"]; ok && (!hasText || newText == "") {
+		return fmt.Errorf("text must be a non-empty string")
+	}
+
+	collectionName, err := vectorCollectionName(w.cfg)
+	if err != nil {
+		return err
+	}
+	stored, err := w.vs.GetVector(collectionName, req.MemoryID)
+	if err != nil {
+		return fmt.Errorf("error getting memory %s: %w", req.MemoryID, err)
+	}
+	if stored == nil {
+		return fmt.Errorf("memory %s not found", req.MemoryID)
+	}
+	owner := payloadOwner(stored.Payload)
+	if err := w.authz.Authorize(ctx, req.BaseRequestInfo, owner, ActionUpdate); err != nil {
+		return err
+	}
+
+	oldText, _ := stored.Payload["text"].(string)
+	merged := make(map[string]interface{}, len(stored.Payload)+len(req.Data)+1)
+	for k, v := range stored.Payload {
+		merged[k] = v
+	}
+	for k, v := range req.Data {
+		merged[k] = v
+	}
+	merged["updated_at"] = time.Now().UTC().Format(time.RFC3339Nano)
+
+	if hasText && newText != oldText {
+		merged["hash"] = ContentHash(newText)
+		input := vectorstores.VectorInput{ID: req.MemoryID, Payload: merged}
+		if w.openai == nil {
+			return fmt.Errorf("OpenAI client is nil, cannot embed the new text")
+		}
+		if names := configuredVectorNames(w.cfg); len(names) > 0 {
+			rawText, _ := merged["raw_text"].(string)
+			input.Vectors, err = embedNamedVectors(ctx, w.openai, names, newText, rawText)
+		} else {
+			input.Embedding, err = w.openai.GetEmbedding(ctx, newText)
+		}
+		if err != nil {
+			return fmt.Errorf("error embedding the new text: %w", err)
+		}
+		if w.cfg.Embedder != nil {
+			if input.Vectors == nil {
+				if err := checkEmbeddingDimension(input.Embedding, w.cfg.Embedder.Dimensions); err != nil {
+					return fmt.Errorf("new embedding does not match collection %s: %w", collectionName, err)
+				}
+			}
+			for name, v := range input.Vectors {
+				if err := checkEmbeddingDimension(v, w.cfg.Embedder.Dimensions); err != nil {
+					return fmt.Errorf("new %s vector does not match collection %s: %w", name, collectionName, err)
+				}
+			}
+		}
+		if err := w.vs.InsertVectors(collectionName, []vectorstores.VectorInput{input}); err != nil {
+			return fmt.Errorf("error storing updated memory: %w", err)
+		}
+	} else if err := w.vs.UpdateVectorPayload(collectionName, req.MemoryID, merged); err != nil {
+		return fmt.Errorf("error updating memory payload: %w", err)
+	}
+
+	if w.lexical != nil {
+		text, _ := merged["text"].(string)
+		doc := LexicalDocument{ID: req.MemoryID, Text: text, UserID: owner.UserID, Metadata: merged}
+		if err := w.lexical.Index(ctx, doc); err != nil {
+			fmt.Printf("UpdateWorker: Error indexing MemoryID %s in lexical index: %v\n", req.MemoryID, err)
+		}
+	}
+
+	newMemory := oldText
+	if hasText {
+		newMemory = newText
+	}
+	publishMemoryHistoryEvent(w.nc, w.cfg, "UpdateWorker", MemoryEvent{
+		EventID:   uuid.New().String(),
+		MemoryID:  req.MemoryID,
+		EventType: "MEMORY_UPDATED",
+		Timestamp: time.Now().UTC(),
+		UserID:    owner.UserID,
+		AgentID:   owner.AgentID,
+		RunID:     owner.RunID,
+		ActorID:   req.ActorID,
+		OldMemory: oldText,
+		NewMemory: newMemory,
+		Details: map[string]interface{}{
+			"collection_name": collectionName,
+			"hash":            merged["hash"],
+		},
+	})
+	return nil
+}
+
+// publishMemoryHistoryEvent sends event to TopicMemoryHistoryLog on behalf of worker.
+// Failures are logged, not returned.
+func publishMemoryHistoryEvent(nc NATSClient, cfg *Config, worker string, event MemoryEvent) {
+	eventData, err := json.Marshal(event)
+	if err != nil {
+		fmt.Printf("%s: Error marshalling MemoryEvent: %v\n", worker, err)
+		return
+	}
+	if nc == nil {
+		fmt.Printf("NATS_PUBLISH (%s - nc is nil): Topic=%s, Payload=%s\n", worker, cfg.TopicMemoryHistoryLog, string(eventData))
+		return
+	}
+	if err := nc.Publish(context.Background(), cfg.TopicMemoryHistoryLog, eventData); err != nil {
+		fmt.Printf("%s: Error publishing MemoryEvent to NATS topic %s: %v\n", worker, cfg.TopicMemoryHistoryLog, err)
+		return
+	}
+	fmt.Printf("%s: Published %s MemoryEvent to %s for MemoryID: %s\n", worker, event.EventType, cfg.TopicMemoryHistoryLog, event.MemoryID)
+}
@@ -3,17 +3,28 @@
 package vectorstores
 
 // VectorInput represents a single data point to be inserted into the vector store.
+// Collections created with CreateNamedCollection take their vectors from Vectors
+// and ignore Embedding; other collections use Embedding.
 type VectorInput struct {
 	ID        string                 `json:"id"`
 	Embedding []float32              `json:"embedding"`
+	Vectors   map[string][]float32   `json:"vectors,omitempty"` // Named vectors, e.g. "fact" and "raw_text"
 	Payload   map[string]interface{} `json:"payload"`
 }
 
+// VectorParams describes one named vector of a collection.
+type VectorParams struct {
+	Size           int    `json:"size"`
+	DistanceMetric string `json:"distance_metric"`
+}
+
 // SearchResult represents a single search result from the vector store.
 type SearchResult struct {
 	ID      string                 `json:"id"`
 	Score   float32                `json:"score"`
 	Payload map[string]interface{} `json:"payload"`
+	Vector  []float32              `json:"vector,omitempty"`  // Populated by GetVector; Search and ListVectors may omit it
+	Vectors map[string][]float32   `json:"vectors,omitempty"` // Named vectors, populated by GetVector for named collections
 }
 
 // QueryFilter defines filters to be applied during a search operation.
@@ -24,23 +35,34 @@ type QueryFilter struct {
 
 // CollectionInfo holds information about a vector store collection.
 type CollectionInfo struct {
-	Name       string `json:"name"`
-	VectorSize int    `json:"vector_size"`
-	PointCount uint64 `json:"point_count"`
+	Name           string                  `json:"name"`
+	VectorSize     int                     `json:"vector_size"`
+	DistanceMetric string                  `json:"distance_metric,omitempty"`
+	NamedVectors   map[string]VectorParams `json:"named_vectors,omitempty"` // Set instead of VectorSize for named collections
+	PointCount     uint64                  `json:"point_count"`
 }
 
 // VectorStore defines the common interface for interacting with a vector database.
 type VectorStore interface {
 	CreateCollection(name string, vectorSize int, distanceMetric string) error
+	// CreateNamedCollection creates a collection whose points carry one vector per name.
+	CreateNamedCollection(name string, vectors map[string]VectorParams) error
 	DeleteCollection(name string) error
 	ListCollections() ([]string, error)
 	CollectionInfo(name string) (*CollectionInfo, error)
 	ResetCollection(name string, vectorSize int, distanceMetric string) error
 
+	// SwitchAlias atomically points alias at collectionName, creating the alias if needed.
+	SwitchAlias(alias string, collectionName string) error
+	// ResolveAlias returns the collection alias points at, or "" if the alias does not exist.
+	ResolveAlias(alias string) (string, error)
+
 	InsertVectors(collectionName string, vectors []VectorInput) error
 	UpdateVectorPayload(collectionName string, vectorID string, payload map[string]interface{}) error
 	GetVector(collectionName string, vectorID string) (*SearchResult, error)
 	DeleteVectors(collectionName string, vectorIDs []string) error
 	Search(collectionName string, queryEmbedding []float32, limit int, filter *QueryFilter) ([]SearchResult, error)
+	// SearchNamed searches a single named vector of a named collection.
+	SearchNamed(collectionName string, vectorName string, queryEmbedding []float32, limit int, filter *QueryFilter) ([]SearchResult, error)
 	ListVectors(collectionName string, limit int, offset uint64, filter *QueryFilter) ([]SearchResult, error)
 }
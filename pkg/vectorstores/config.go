@@ -12,6 +12,9 @@ type QdrantConfig struct {
 	Address        string `json:"address" validate:"required,url|hostname_port"`
 	APIKey         string `json:"api_key,omitempty"`
 	CollectionName string `json:"collection_name" validate:"required"`
+	// Alias, when set, is the name workers read and write through. It is pointed at
+	// CollectionName on first boot and can be switched atomically, e.g. by a re-embedding migration.
+	Alias string `json:"alias,omitempty"`
 }
 
 // Validate validates the QdrantConfig struct.
@@ -20,9 +23,73 @@ func (c *QdrantConfig) Validate() error {
 	return validate.Struct(c)
 }
 
+// QuantizationConfig controls how an in-process collection stores its vectors.
+type QuantizationConfig struct {
+	Type              string `json:"type,omitempty" validate:"omitempty,oneof=none scalar binary"`      // Defaults to "none"
+	Storage           string `json:"storage,omitempty" validate:"omitempty,oneof=float32 float16 none"` // Full-precision copy, defaults to "float32"; "none" needs a quantized Type
+	RescoreMultiplier int    `json:"rescore_multiplier,omitempty" validate:"omitempty,gte=1"`           // Candidates rescored per result, defaults to 4
+	DisableRescore    bool   `json:"disable_rescore,omitempty"`                                         // Return quantized scores as-is
+}
+
+// InMemoryConfig holds configuration for the in-process InMemoryStore.
+type InMemoryConfig struct {
+	CollectionName string                         `json:"collection_name" validate:"required"`
+	Alias          string                         `json:"alias,omitempty"`
+	Quantization   *QuantizationConfig            `json:"quantization,omitempty"`                // Default for every collection
+	Collections    map[string]*QuantizationConfig `json:"collections,omitempty" validate:"dive"` // Per-collection overrides
+}
+
+// Validate validates the InMemoryConfig struct.
+func (c *InMemoryConfig) Validate() error {
+	validate := validator.New()
+	if err := validate.Struct(c); err != nil {
+		return err
+	}
+	if err := c.Quantization.validateStorage("quantization"); err != nil {
+		return err
+	}
+	for name, q := range c.Collections {
+		if err := q.validateStorage("collection " + name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateStorage rejects dropping the full-precision vectors of an unquantized collection.
+func (q *QuantizationConfig) validateStorage(scope string) error {
+	if q != nil && q.Storage == StorageNone && (q.Type == "" || q.Type == QuantizationNone) {
+		return fmt.Errorf("%s: storage %q requires a scalar or binary quantization type", scope, StorageNone)
+	}
+	return nil
+}
+
+// quantizationFor returns the quantization settings for a collection.
+func (c *InMemoryConfig) quantizationFor(collectionName string) QuantizationConfig {
+	var q QuantizationConfig
+	if c != nil {
+		if c.Quantization != nil {
+			q = *c.Quantization
+		}
+		if override, ok := c.Collections[collectionName]; ok && override != nil {
+			q = *override
+		}
+	}
+	if q.Type == "" {
+		q.Type = QuantizationNone
+	}
+	if q.Storage == "" {
+		q.Storage = StorageFloat32
+	}
+	if q.RescoreMultiplier <= 0 {
+		q.RescoreMultiplier = defaultRescoreMultiplier
+	}
+	return q
+}
+
 // VectorStoreConfig holds the configuration for the vector store.
 type VectorStoreConfig struct {
-	Provider string      `json:"provider" validate:"required,oneof=qdrant"`
+	Provider string      `json:"provider" validate:"required,oneof=qdrant inmemory"`
 	Config   interface{} `json:"config" validate:"required"`
 }
 
@@ -58,8 +125,14 @@ func (vsc *VectorStoreConfig) UnmarshalJSON(data []byte) error {
 			return fmt.Errorf("error unmarshalling qdrant config: %w", err)
 		}
 		vsc.Config = &qConfig
+	case "inmemory":
+		var mConfig InMemoryConfig
+		if err := json.Unmarshal(temp.Config, &mConfig); err != nil {
+			return fmt.Errorf("error unmarshalling inmemory config: %w", err)
+		}
+		vsc.Config = &mConfig
 	default:
-		// If provider is specified but not "qdrant" (or other supported types in future)
+		// If provider is specified but not a supported type
 		if vsc.Provider != "" {
 			return fmt.Errorf("unsupported vector store provider: %s", vsc.Provider)
 		}
@@ -73,7 +146,7 @@ func (vsc *VectorStoreConfig) UnmarshalJSON(data []byte) error {
 // Validate validates the VectorStoreConfig struct.
 func (vsc *VectorStoreConfig) Validate() error {
 	validate := validator.New()
-	// Validates vsc.Provider ("required", "oneof=qdrant")
+	// Validates vsc.Provider ("required", "oneof=qdrant inmemory")
 	// Validates vsc.Config ("required" - i.e., not nil)
 	if err := validate.Struct(vsc); err != nil {
 		return err
@@ -89,13 +162,18 @@ func (vsc *VectorStoreConfig) Validate() error {
 			return fmt.Errorf("provider is '%s' but config type is *QdrantConfig", vsc.Provider)
 		}
 		return c.Validate() // Validate the QdrantConfig fields
+	case *InMemoryConfig:
+		if vsc.Provider != "inmemory" {
+			return fmt.Errorf("provider is '%s' but config type is *InMemoryConfig", vsc.Provider)
+		}
+		return c.Validate()
 	default:
-		// This case means vsc.Config is not *QdrantConfig.
-		// If vsc.Provider is "qdrant", then this is a type mismatch.
-		if vsc.Provider == "qdrant" {
+		// This case means vsc.Config is not a known config type.
+		// If vsc.Provider is a supported provider, then this is a type mismatch.
+		if vsc.Provider == "qdrant" || vsc.Provider == "inmemory" {
 			return fmt.Errorf("config for provider '%s' is of unexpected type %T", vsc.Provider, vsc.Config)
 		}
-		// If vsc.Provider is not "qdrant", it should have been caught by the 'oneof' tag
+		// Otherwise it should have been caught by the 'oneof' tag
 		// in validate.Struct(vsc). If it somehow wasn't (e.g. provider is empty string),
 		// this indicates an unknown config type for an unspecified or unsupported provider.
 		return fmt.Errorf("unknown config type (%T) for provider '%s'", vsc.Config, vsc.Provider)
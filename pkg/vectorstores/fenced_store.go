@@ -0,0 +1,136 @@
+package vectorstores
+
+import (
+	"context"
+	"sync"
+)
+
+// WriteFreezer is implemented by vector stores that can hold back writes to some
+// collections, for instance while a re-embedding migration switches an alias.
+type WriteFreezer interface {
+	// FreezeWrites blocks new writes to the collections or aliases in names and waits for
+	// the writes in flight to finish. Writes resume once release is called.
+	FreezeWrites(ctx context.Context, names ...string) (release func(), err error)
+}
+
+// FencedStore wraps a VectorStore so that writes to chosen collections can be frozen.
+// InsertVectors, UpdateVectorPayload and DeleteVectors wait while the collection name they
+// are called with is frozen; every other method goes straight to the wrapped store. The
+// fence only holds for writers sharing the FencedStore, so workers in other processes must
+// be stopped while writes are frozen.
+type FencedStore struct {
+	VectorStore
+
+	mu       sync.Mutex
+	changed  *sync.Cond     // Signalled when a freeze is released or a write ends
+	frozen   map[string]int // Active freezes per name
+	inFlight map[string]int // Writes in progress per name
+}
+
+// Compile-time checks to ensure *FencedStore satisfies the VectorStore and WriteFreezer interfaces.
+var (
+	_ VectorStore  = (*FencedStore)(nil)
+	_ WriteFreezer = (*FencedStore)(nil)
+)
+
+// NewFencedStore wraps vs.
+func NewFencedStore(vs VectorStore) *FencedStore {
+	s := &FencedStore{
+		VectorStore: vs,
+		frozen:      make(map[string]int),
+		inFlight:    make(map[string]int),
+	}
+	s.changed = sync.NewCond(&s.mu)
+	return s
+}
+
+// FreezeWrites implements WriteFreezer.
+func (s *FencedStore) FreezeWrites(ctx context.Context, names ...string) (func(), error) {
+	stop := context.AfterFunc(ctx, func() {
+		s.mu.Lock()
+		s.changed.Broadcast()
+		s.mu.Unlock()
+	})
+	defer stop()
+
+	s.mu.Lock()
+	for _, name := range names {
+		s.frozen[name]++
+	}
+	for s.writing(names) {
+		if err := ctx.Err(); err != nil {
+			s.thaw(names)
+			s.mu.Unlock()
+			return nil, err
+		}
+		s.changed.Wait()
+	}
+	s.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			s.thaw(names)
+			s.mu.Unlock()
+		})
+	}, nil
+}
+
+// thaw releases one freeze of names. Callers must hold s.mu.
+func (s *FencedStore) thaw(names []string) {
+	for _, name := range names {
+		if s.frozen[name]--; s.frozen[name] == 0 {
+			delete(s.frozen, name)
+		}
+	}
+	s.changed.Broadcast()
+}
+
+// writing reports whether a write to one of names is in flight. Callers must hold s.mu.
+func (s *FencedStore) writing(names []string) bool {
+	for _, name := range names {
+		if s.inFlight[name] > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// enter waits until name is not frozen and registers a write to it.
+func (s *FencedStore) enter(name string) {
+	s.mu.Lock()
+	for s.frozen[name] > 0 {
+		s.changed.Wait()
+	}
+	s.inFlight[name]++
+	s.mu.Unlock()
+}
+
+// leave ends a write registered by enter.
+func (s *FencedStore) leave(name string) {
+	s.mu.Lock()
+	if s.inFlight[name]--; s.inFlight[name] == 0 {
+		delete(s.inFlight, name)
+	}
+	s.changed.Broadcast()
+	s.mu.Unlock()
+}
+
+func (s *FencedStore) InsertVectors(collectionName string, vectors []VectorInput) error {
+	s.enter(collectionName)
+	defer s.leave(collectionName)
+	return s.VectorStore.InsertVectors(collectionName, vectors)
+}
+
+func (s *FencedStore) UpdateVectorPayload(collectionName string, vectorID string, payload map[string]interface{}) error {
+	s.enter(collectionName)
+	defer s.leave(collectionName)
+	return s.VectorStore.UpdateVectorPayload(collectionName, vectorID, payload)
+}
+
+func (s *FencedStore) DeleteVectors(collectionName string, vectorIDs []string) error {
+	s.enter(collectionName)
+	defer s.leave(collectionName)
+	return s.VectorStore.DeleteVectors(collectionName, vectorIDs)
+}
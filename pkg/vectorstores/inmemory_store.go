@@ -0,0 +1,512 @@
+package vectorstores
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// unnamedVector is the key used for the single vector of collections created with CreateCollection.
+const unnamedVector = ""
+
+// InMemoryStore implements the VectorStore interface in process memory. It is meant for
+// single-node deployments and tests. Collections can keep int8 or binary quantized copies
+// of their vectors for fast candidate selection, rescoring the best candidates against the
+// full-precision vectors, which may themselves be stored as float16 or dropped to save
+// memory.
+type InMemoryStore struct {
+	mu          sync.RWMutex
+	cfg         *InMemoryConfig
+	collections map[string]*memCollection
+	aliases     map[string]string
+}
+
+type memCollection struct {
+	name    string
+	named   bool
+	params  map[string]VectorParams // Keyed by vector name, unnamedVector for single-vector collections
+	quant   QuantizationConfig
+	points  map[string]*memPoint
+	ordered []string // Sorted point IDs, rebuilt lazily for ListVectors
+}
+
+type memPoint struct {
+	payload map[string]interface{}
+	vectors map[string]*memVector
+}
+
+// memVector holds the full-precision vector and its optional quantized copy. With
+// StorageNone only the quantized copy is set.
+type memVector struct {
+	full32 []float32 // Set for StorageFloat32
+	full16 []uint16  // Set for StorageFloat16
+	scalar *scalarVector
+	binary []uint64
+}
+
+// Compile-time check to ensure *InMemoryStore satisfies the VectorStore interface.
+var _ VectorStore = (*InMemoryStore)(nil)
+
+// NewInMemoryStore creates a new InMemoryStore. cfg may be nil for defaults.
+func NewInMemoryStore(cfg *InMemoryConfig) *InMemoryStore {
+	return &InMemoryStore{
+		cfg:         cfg,
+		collections: make(map[string]*memCollection),
+		aliases:     make(map[string]string),
+	}
+}
+
+// resolve returns the collection for a name or alias. Callers must hold s.mu.
+func (s *InMemoryStore) resolve(name string) (*memCollection, error) {
+	if target, ok := s.aliases[name]; ok {
+		name = target
+	}
+	c, ok := s.collections[name]
+	if !ok {
+		return nil, fmt.Errorf("collection %s not found", name)
+	}
+	return c, nil
+}
+
+func (s *InMemoryStore) CreateCollection(name string, vectorSize int, distanceMetric string) error {
+	return s.createCollection(name, false, map[string]VectorParams{
+		unnamedVector: {Size: vectorSize, DistanceMetric: distanceMetric},
+	})
+}
+
+func (s *InMemoryStore) CreateNamedCollection(name string, vectors map[string]VectorParams) error {
+	if len(vectors) == 0 {
+		return fmt.Errorf("named collection %s needs at least one vector", name)
+	}
+	for n := range vectors {
+		if n == unnamedVector {
+			return fmt.Errorf("vector names cannot be empty")
+		}
+	}
+	return s.createCollection(name, true, vectors)
+}
+
+func (s *InMemoryStore) createCollection(name string, named bool, vectors map[string]VectorParams) error {
+	for n, p := range vectors {
+		if p.Size <= 0 {
+			return fmt.Errorf("vector %q of collection %s must have a positive size", n, name)
+		}
+		switch p.DistanceMetric {
+		case "", "cosine", "dot", "euclid":
+		default:
+			return fmt.Errorf("unsupported distance metric %q", p.DistanceMetric)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.collections[name]; exists {
+		return fmt.Errorf("collection %s already exists", name)
+	}
+	if _, exists := s.aliases[name]; exists {
+		return fmt.Errorf("%s is already an alias", name)
+	}
+	params := make(map[string]VectorParams, len(vectors))
+	for n, p := range vectors {
+		if p.DistanceMetric == "" {
+			p.DistanceMetric = "cosine"
+		}
+		params[n] = p
+	}
+	s.collections[name] = &memCollection{
+		name:   name,
+		named:  named,
+		params: params,
+		quant:  s.cfg.quantizationFor(name),
+		points: make(map[string]*memPoint),
+	}
+	return nil
+}
+
+func (s *InMemoryStore) DeleteCollection(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.collections[name]; !ok {
+		return fmt.Errorf("collection %s not found", name)
+	}
+	delete(s.collections, name)
+	for alias, target := range s.aliases {
+		if target == name {
+			delete(s.aliases, alias)
+		}
+	}
+	return nil
+}
+
+func (s *InMemoryStore) ListCollections() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := make([]string, 0, len(s.collections))
+	for name := range s.collections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *InMemoryStore) CollectionInfo(name string) (*CollectionInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	c, err := s.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	info := &CollectionInfo{Name: c.name, PointCount: uint64(len(c.points))}
+	if c.named {
+		info.NamedVectors = make(map[string]VectorParams, len(c.params))
+		for n, p := range c.params {
+			info.NamedVectors[n] = p
+		}
+	} else {
+		info.VectorSize = c.params[unnamedVector].Size
+		info.DistanceMetric = c.params[unnamedVector].DistanceMetric
+	}
+	return info, nil
+}
+
+func (s *InMemoryStore) ResetCollection(name string, vectorSize int, distanceMetric string) error {
+	s.mu.Lock()
+	delete(s.collections, name)
+	s.mu.Unlock()
+	return s.CreateCollection(name, vectorSize, distanceMetric)
+}
+
+func (s *InMemoryStore) SwitchAlias(alias string, collectionName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.collections[collectionName]; !ok {
+		return fmt.Errorf("collection %s not found", collectionName)
+	}
+	if _, ok := s.collections[alias]; ok {
+		return fmt.Errorf("%s is a collection, not an alias", alias)
+	}
+	s.aliases[alias] = collectionName
+	return nil
+}
+
+func (s *InMemoryStore) ResolveAlias(alias string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.aliases[alias], nil
+}
+
+func (s *InMemoryStore) InsertVectors(collectionName string, vectors []VectorInput) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, err := s.resolve(collectionName)
+	if err != nil {
+		return err
+	}
+
+	// Validate the whole batch before writing so a bad point does not leave a partial insert.
+	points := make(map[string]*memPoint, len(vectors))
+	for _, in := range vectors {
+		if in.ID == "" {
+			return fmt.Errorf("vector ID cannot be empty")
+		}
+		raw := in.Vectors
+		if !c.named {
+			raw = map[string][]float32{unnamedVector: in.Embedding}
+		}
+		p := &memPoint{payload: copyPayload(in.Payload), vectors: make(map[string]*memVector, len(c.params))}
+		for n, params := range c.params {
+			v, ok := raw[n]
+			if !ok {
+				return fmt.Errorf("point %s is missing vector %q", in.ID, n)
+			}
+			if len(v) != params.Size {
+				return fmt.Errorf("point %s vector %q has %d dimensions, collection %s expects %d", in.ID, n, len(v), c.name, params.Size)
+			}
+			p.vectors[n] = c.encode(v)
+		}
+		points[in.ID] = p
+	}
+	for id, p := range points {
+		c.points[id] = p
+	}
+	c.ordered = nil
+	return nil
+}
+
+func (s *InMemoryStore) UpdateVectorPayload(collectionName string, vectorID string, payload map[string]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, err := s.resolve(collectionName)
+	if err != nil {
+		return err
+	}
+	p, ok := c.points[vectorID]
+	if !ok {
+		return fmt.Errorf("point %s not found in collection %s", vectorID, c.name)
+	}
+	// Keys are merged into the existing payload, like Qdrant's set_payload.
+	if p.payload == nil {
+		p.payload = make(map[string]interface{}, len(payload))
+	}
+	for k, v := range payload {
+		p.payload[k] = v
+	}
+	return nil
+}
+
+// GetVector returns the point with its full-precision vectors, or nil if it does not exist.
+func (s *InMemoryStore) GetVector(collectionName string, vectorID string) (*SearchResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	c, err := s.resolve(collectionName)
+	if err != nil {
+		return nil, err
+	}
+	p, ok := c.points[vectorID]
+	if !ok {
+		return nil, nil
+	}
+	result := &SearchResult{ID: vectorID, Payload: copyPayload(p.payload)}
+	if c.named {
+		result.Vectors = make(map[string][]float32, len(p.vectors))
+		for n, v := range p.vectors {
+			result.Vectors[n] = v.fullPrecision(c.params[n].Size)
+		}
+	} else {
+		result.Vector = p.vectors[unnamedVector].fullPrecision(c.params[unnamedVector].Size)
+	}
+	return result, nil
+}
+
+func (s *InMemoryStore) DeleteVectors(collectionName string, vectorIDs []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, err := s.resolve(collectionName)
+	if err != nil {
+		return err
+	}
+	for _, id := range vectorIDs {
+		delete(c.points, id)
+	}
+	c.ordered = nil
+	return nil
+}
+
+func (s *InMemoryStore) Search(collectionName string, queryEmbedding []float32, limit int, filter *QueryFilter) ([]SearchResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	c, err := s.resolve(collectionName)
+	if err != nil {
+		return nil, err
+	}
+	if c.named {
+		return nil, fmt.Errorf("collection %s has named vectors, use SearchNamed", c.name)
+	}
+	return c.search(unnamedVector, queryEmbedding, limit, filter)
+}
+
+func (s *InMemoryStore) SearchNamed(collectionName string, vectorName string, queryEmbedding []float32, limit int, filter *QueryFilter) ([]SearchResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	c, err := s.resolve(collectionName)
+	if err != nil {
+		return nil, err
+	}
+	if !c.named {
+		return nil, fmt.Errorf("collection %s has a single unnamed vector, use Search", c.name)
+	}
+	if _, ok := c.params[vectorName]; !ok {
+		return nil, fmt.Errorf("collection %s has no vector named %q", c.name, vectorName)
+	}
+	return c.search(vectorName, queryEmbedding, limit, filter)
+}
+
+// ListVectors returns points in ID order without their vectors.
+func (s *InMemoryStore) ListVectors(collectionName string, limit int, offset uint64, filter *QueryFilter) ([]SearchResult, error) {
+	s.mu.Lock() // Lazily rebuilding c.ordered writes to the collection
+	defer s.mu.Unlock()
+	c, err := s.resolve(collectionName)
+	if err != nil {
+		return nil, err
+	}
+	if c.ordered == nil {
+		c.ordered = make([]string, 0, len(c.points))
+		for id := range c.points {
+			c.ordered = append(c.ordered, id)
+		}
+		sort.Strings(c.ordered)
+	}
+
+	var results []SearchResult
+	var skipped uint64
+	for _, id := range c.ordered {
+		p := c.points[id]
+		if !filterMatches(p.payload, filter) {
+			continue
+		}
+		if skipped < offset {
+			skipped++
+			continue
+		}
+		results = append(results, SearchResult{ID: id, Payload: copyPayload(p.payload)})
+		if limit > 0 && len(results) >= limit {
+			break
+		}
+	}
+	return results, nil
+}
+
+// encode stores v according to the collection's quantization settings.
+func (c *memCollection) encode(v []float32) *memVector {
+	mv := &memVector{}
+	switch c.quant.Storage {
+	case StorageFloat16:
+		mv.full16 = encodeFloat16(v)
+	case StorageNone:
+	default:
+		mv.full32 = append([]float32(nil), v...)
+	}
+	switch c.quant.Type {
+	case QuantizationScalar:
+		q := quantizeScalar(v)
+		mv.scalar = &q
+	case QuantizationBinary:
+		mv.binary = quantizeBinary(v)
+	}
+	return mv
+}
+
+// fullPrecision returns a copy of the stored full-precision vector, or the dequantized
+// vector of dims dimensions when only the quantized copy is kept.
+func (v *memVector) fullPrecision(dims int) []float32 {
+	if v.full32 != nil {
+		return append([]float32(nil), v.full32...)
+	}
+	return v.view(make([]float32, dims))
+}
+
+type scoredID struct {
+	id    string
+	score float32
+}
+
+// search scores every matching point on one vector. With quantization enabled, the
+// quantized copies select limit * RescoreMultiplier candidates which are then rescored
+// against the full-precision vectors. Scalar codes are scored against the int8 quantized
+// query without decoding them.
+func (c *memCollection) search(vectorName string, query []float32, limit int, filter *QueryFilter) ([]SearchResult, error) {
+	params := c.params[vectorName]
+	if len(query) != params.Size {
+		return nil, fmt.Errorf("query has %d dimensions, collection %s expects %d", len(query), c.name, params.Size)
+	}
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	quantized := c.quant.Type != QuantizationNone
+	var queryBits []uint64
+	var queryCodes scalarVector
+	switch c.quant.Type {
+	case QuantizationBinary:
+		queryBits = quantizeBinary(query)
+	case QuantizationScalar:
+		queryCodes = quantizeScalar(query)
+	}
+	buf := make([]float32, params.Size)
+
+	scored := make([]scoredID, 0, len(c.points))
+	for id, p := range c.points {
+		if !filterMatches(p.payload, filter) {
+			continue
+		}
+		v := p.vectors[vectorName]
+		var score float32
+		switch {
+		case v.scalar != nil:
+			score = scalarSimilarity(params.DistanceMetric, queryCodes, *v.scalar)
+		case v.binary != nil:
+			score = binarySimilarity(queryBits, v.binary, params.Size)
+		default:
+			score = similarity(params.DistanceMetric, query, v.view(buf))
+		}
+		scored = append(scored, scoredID{id: id, score: score})
+	}
+	sortScored(scored)
+
+	if quantized && !c.quant.DisableRescore && c.quant.Storage != StorageNone {
+		candidates := limit * c.quant.RescoreMultiplier
+		if len(scored) > candidates {
+			scored = scored[:candidates]
+		}
+		for i := range scored {
+			v := c.points[scored[i].id].vectors[vectorName]
+			scored[i].score = similarity(params.DistanceMetric, query, v.view(buf))
+		}
+		sortScored(scored)
+	}
+
+	if len(scored) > limit {
+		scored = scored[:limit]
+	}
+	results := make([]SearchResult, len(scored))
+	for i, s := range scored {
+		results[i] = SearchResult{ID: s.id, Score: s.score, Payload: copyPayload(c.points[s.id].payload)}
+	}
+	return results, nil
+}
+
+// view returns the full-precision vector, decoding float16 storage, or the quantized copy
+// when no full-precision vector is kept, into buf.
+func (v *memVector) view(buf []float32) []float32 {
+	switch {
+	case v.full32 != nil:
+		return v.full32
+	case v.full16 != nil:
+		decodeFloat16(buf, v.full16)
+	case v.scalar != nil:
+		v.scalar.decode(buf)
+	case v.binary != nil:
+		decodeBinary(buf, v.binary)
+	}
+	return buf
+}
+
+func sortScored(scored []scoredID) {
+	sort.Slice(scored, func(i, j int) bool {
+		if scored[i].score == scored[j].score {
+			return scored[i].id < scored[j].id
+		}
+		return scored[i].score > scored[j].score
+	})
+}
+
+// filterMatches reports whether a payload satisfies filter. UserID is compared with the
+// "user_id" payload key and every Metadata entry must equal the payload value of the same key.
+func filterMatches(payload map[string]interface{}, filter *QueryFilter) bool {
+	if filter == nil {
+		return true
+	}
+	if filter.UserID != "" {
+		if uid, _ := payload["user_id"].(string); uid != filter.UserID {
+			return false
+		}
+	}
+	for k, want := range filter.Metadata {
+		got, ok := payload[k]
+		if !ok || fmt.Sprint(got) != fmt.Sprint(want) {
+			return false
+		}
+	}
+	return true
+}
+
+func copyPayload(payload map[string]interface{}) map[string]interface{} {
+	if payload == nil {
+		return nil
+	}
+	out := make(map[string]interface{}, len(payload))
+	for k, v := range payload {
+		out[k] = v
+	}
+	return out
+}
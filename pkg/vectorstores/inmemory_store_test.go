@@ -0,0 +1,174 @@
+package vectorstores
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+const (
+	recallDims    = 128
+	recallPoints  = 2000
+	recallQueries = 50
+	recallK       = 10
+)
+
+// randomVectors returns n vectors around a few shared centers, like embeddings of related texts.
+func randomVectors(rng *rand.Rand, n, dims int) [][]float32 {
+	centers := make([][]float32, 8)
+	for i := range centers {
+		centers[i] = make([]float32, dims)
+		for j := range centers[i] {
+			centers[i][j] = float32(rng.NormFloat64())
+		}
+	}
+	vectors := make([][]float32, n)
+	for i := range vectors {
+		center := centers[rng.Intn(len(centers))]
+		vectors[i] = make([]float32, dims)
+		for j := range vectors[i] {
+			vectors[i][j] = center[j] + float32(rng.NormFloat64())
+		}
+	}
+	return vectors
+}
+
+// newRecallStore returns a store holding points under quant, and the queries to search it with.
+func newRecallStore(t testing.TB, quant *QuantizationConfig) (*InMemoryStore, [][]float32) {
+	rng := rand.New(rand.NewSource(1))
+	points := randomVectors(rng, recallPoints+recallQueries, recallDims)
+	store := NewInMemoryStore(&InMemoryConfig{CollectionName: "recall", Quantization: quant})
+	if err := store.CreateCollection("recall", recallDims, "cosine"); err != nil {
+		t.Fatal(err)
+	}
+	inputs := make([]VectorInput, recallPoints)
+	for i := range inputs {
+		inputs[i] = VectorInput{ID: fmt.Sprintf("p%04d", i), Embedding: points[i]}
+	}
+	if err := store.InsertVectors("recall", inputs); err != nil {
+		t.Fatal(err)
+	}
+	return store, points[recallPoints:]
+}
+
+// recallAtK returns the mean fraction of the exact top k found by store's top k.
+func recallAtK(t testing.TB, exact, store *InMemoryStore, queries [][]float32) float64 {
+	var found, total int
+	for _, q := range queries {
+		want, err := exact.Search("recall", q, recallK, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := store.Search("recall", q, recallK, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := make(map[string]bool, len(got))
+		for _, r := range got {
+			ids[r.ID] = true
+		}
+		for _, r := range want {
+			if ids[r.ID] {
+				found++
+			}
+		}
+		total += len(want)
+	}
+	return float64(found) / float64(total)
+}
+
+var recallModes = []struct {
+	name      string
+	quant     *QuantizationConfig
+	minRecall float64
+}{
+	{"scalar", &QuantizationConfig{Type: QuantizationScalar, DisableRescore: true}, 0.9},
+	{"scalar_rescored", &QuantizationConfig{Type: QuantizationScalar}, 0.99},
+	{"scalar_no_storage", &QuantizationConfig{Type: QuantizationScalar, Storage: StorageNone}, 0.9},
+	{"binary", &QuantizationConfig{Type: QuantizationBinary, DisableRescore: true}, 0.15},
+	{"binary_rescored", &QuantizationConfig{Type: QuantizationBinary}, 0.5},
+	{"binary_rescored_x16", &QuantizationConfig{Type: QuantizationBinary, RescoreMultiplier: 16}, 0.85},
+}
+
+func TestInMemoryQuantizedRecall(t *testing.T) {
+	exact, queries := newRecallStore(t, nil)
+	for _, mode := range recallModes {
+		t.Run(mode.name, func(t *testing.T) {
+			store, _ := newRecallStore(t, mode.quant)
+			recall := recallAtK(t, exact, store, queries)
+			t.Logf("recall@%d = %.3f", recallK, recall)
+			if recall < mode.minRecall {
+				t.Errorf("recall@%d = %.3f, want at least %.2f", recallK, recall, mode.minRecall)
+			}
+		})
+	}
+}
+
+func BenchmarkInMemoryQuantizedSearch(b *testing.B) {
+	exact, queries := newRecallStore(b, nil)
+	modes := append([]struct {
+		name      string
+		quant     *QuantizationConfig
+		minRecall float64
+	}{{"exact", nil, 1}}, recallModes...)
+	for _, mode := range modes {
+		b.Run(mode.name, func(b *testing.B) {
+			store, _ := newRecallStore(b, mode.quant)
+			recall := recallAtK(b, exact, store, queries)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := store.Search("recall", queries[i%len(queries)], recallK, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(recall, fmt.Sprintf("recall@%d", recallK))
+		})
+	}
+}
+
+func TestScalarSimilarityMatchesDecoded(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	vectors := randomVectors(rng, 20, 64)
+	for _, metric := range []string{"cosine", "dot", "euclid"} {
+		for i := 1; i < len(vectors); i++ {
+			a, b := quantizeScalar(vectors[0]), quantizeScalar(vectors[i])
+			da, db := make([]float32, 64), make([]float32, 64)
+			a.decode(da)
+			b.decode(db)
+			want := similarity(metric, da, db)
+			got := scalarSimilarity(metric, a, b)
+			if math.Abs(float64(got-want)) > 1e-3*math.Max(1, math.Abs(float64(want))) {
+				t.Errorf("%s similarity of vector %d = %v, decoded vectors give %v", metric, i, got, want)
+			}
+		}
+	}
+}
+
+func TestInMemoryStorageNone(t *testing.T) {
+	store, _ := newRecallStore(t, &QuantizationConfig{Type: QuantizationScalar, Storage: StorageNone})
+	c := store.collections["recall"]
+	for id, p := range c.points {
+		if v := p.vectors[unnamedVector]; v.full32 != nil || v.full16 != nil {
+			t.Fatalf("point %s keeps a full-precision vector with storage %q", id, StorageNone)
+		}
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	original := randomVectors(rng, 1, recallDims)[0]
+	if err := store.InsertVectors("recall", []VectorInput{{ID: "approx", Embedding: original}}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.GetVector("recall", "approx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sim := similarity("cosine", original, got.Vector); sim < 0.999 {
+		t.Errorf("dequantized vector has cosine %v to the original", sim)
+	}
+
+	invalid := &InMemoryConfig{CollectionName: "recall", Quantization: &QuantizationConfig{Storage: StorageNone}}
+	if err := invalid.Validate(); err == nil {
+		t.Error("Validate accepted storage none without quantization")
+	}
+}
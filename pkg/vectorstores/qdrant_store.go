@@ -21,6 +21,10 @@ func (s *QdrantStore) CreateCollection(name string, vectorSize int, distanceMetr
 	return fmt.Errorf("CreateCollection not implemented")
 }
 
+func (s *QdrantStore) CreateNamedCollection(name string, vectors map[string]VectorParams) error {
+	return fmt.Errorf("CreateNamedCollection not implemented")
+}
+
 func (s *QdrantStore) DeleteCollection(name string) error {
 	return fmt.Errorf("DeleteCollection not implemented")
 }
@@ -37,6 +41,14 @@ func (s *QdrantStore) ResetCollection(name string, vectorSize int, distanceMetri
 	return fmt.Errorf("ResetCollection not implemented")
 }
 
+func (s *QdrantStore) SwitchAlias(alias string, collectionName string) error {
+	return fmt.Errorf("SwitchAlias not implemented")
+}
+
+func (s *QdrantStore) ResolveAlias(alias string) (string, error) {
+	return "", fmt.Errorf("ResolveAlias not implemented")
+}
+
 func (s *QdrantStore) InsertVectors(collectionName string, vectors []VectorInput) error {
 	return fmt.Errorf("InsertVectors not implemented")
 }
@@ -57,6 +69,10 @@ func (s *QdrantStore) Search(collectionName string, queryEmbedding []float32, li
 	return nil, fmt.Errorf("Search not implemented")
 }
 
+func (s *QdrantStore) SearchNamed(collectionName string, vectorName string, queryEmbedding []float32, limit int, filter *QueryFilter) ([]SearchResult, error) {
+	return nil, fmt.Errorf("SearchNamed not implemented")
+}
+
 func (s *QdrantStore) ListVectors(collectionName string, limit int, offset uint64, filter *QueryFilter) ([]SearchResult, error) {
 	return nil, fmt.Errorf("ListVectors not implemented")
 }
@@ -0,0 +1,264 @@
+package vectorstores
+
+import (
+	"math"
+	"math/bits"
+
+	"github.com/pnocera/gomem/internal/vecmath"
+)
+
+const (
+	// QuantizationNone keeps only the full-precision vectors.
+	QuantizationNone = "none"
+	// QuantizationScalar stores an int8 copy of each vector with a per-vector offset and scale.
+	QuantizationScalar = "scalar"
+	// QuantizationBinary stores one sign bit per dimension.
+	QuantizationBinary = "binary"
+
+	// StorageFloat32 keeps full-precision vectors as float32.
+	StorageFloat32 = "float32"
+	// StorageFloat16 keeps full-precision vectors as IEEE 754 half floats, halving their memory.
+	StorageFloat16 = "float16"
+	// StorageNone keeps only the quantized vectors. Results cannot be rescored and GetVector
+	// returns the dequantized approximation.
+	StorageNone = "none"
+
+	defaultRescoreMultiplier = 4
+)
+
+// float32ToFloat16 converts f to IEEE 754 binary16 bits, rounding to nearest even.
+// Values too large for half precision become infinity; values too small become zero.
+func float32ToFloat16(f float32) uint16 {
+	b := math.Float32bits(f)
+	sign := uint16(b>>16) & 0x8000
+	rawExp := (b >> 23) & 0xff
+	mant := b & 0x7fffff
+
+	if rawExp == 0xff { // Inf or NaN
+		if mant != 0 {
+			return sign | 0x7e00
+		}
+		return sign | 0x7c00
+	}
+	exp := int(rawExp) - 127 + 15
+	if exp >= 0x1f {
+		return sign | 0x7c00
+	}
+	if exp <= 0 {
+		if exp < -10 {
+			return sign
+		}
+		// Subnormal half: shift the mantissa, implicit bit included, into place.
+		mant |= 0x800000
+		shift := uint(14 - exp)
+		half := uint16(mant >> shift)
+		rem := mant & (1<<shift - 1)
+		halfway := uint32(1) << (shift - 1)
+		if rem > halfway || (rem == halfway && half&1 == 1) {
+			half++
+		}
+		return sign | half
+	}
+
+	half := sign | uint16(exp)<<10 | uint16(mant>>13)
+	rem := mant & 0x1fff
+	if rem > 0x1000 || (rem == 0x1000 && half&1 == 1) {
+		half++ // A carry into the exponent is the correct rounding, up to infinity.
+	}
+	return half
+}
+
+// float16ToFloat32 converts IEEE 754 binary16 bits to a float32.
+func float16ToFloat32(h uint16) float32 {
+	sign := uint32(h&0x8000) << 16
+	exp := uint32(h>>10) & 0x1f
+	mant := uint32(h & 0x3ff)
+	switch exp {
+	case 0:
+		if mant == 0 {
+			return math.Float32frombits(sign)
+		}
+		// Subnormal: normalize the mantissa.
+		e := uint32(127 - 15 + 1)
+		for mant&0x400 == 0 {
+			mant <<= 1
+			e--
+		}
+		mant &= 0x3ff
+		return math.Float32frombits(sign | e<<23 | mant<<13)
+	case 0x1f:
+		return math.Float32frombits(sign | 0x7f800000 | mant<<13)
+	default:
+		return math.Float32frombits(sign | (exp-15+127)<<23 | mant<<13)
+	}
+}
+
+// encodeFloat16 converts a vector to half precision.
+func encodeFloat16(v []float32) []uint16 {
+	out := make([]uint16, len(v))
+	for i, f := range v {
+		out[i] = float32ToFloat16(f)
+	}
+	return out
+}
+
+// decodeFloat16 converts a half precision vector into dst, which must have the same length.
+func decodeFloat16(dst []float32, h []uint16) {
+	for i, x := range h {
+		dst[i] = float16ToFloat32(x)
+	}
+}
+
+// scalarVector is an int8 quantized vector: value[i] ~= min + (codes[i]+128) * scale.
+type scalarVector struct {
+	codes []int8
+	min   float32
+	scale float32
+	sum   int32   // Sum of codes
+	norm2 float32 // Squared norm of the dequantized vector
+}
+
+// quantizeScalar maps each component of v onto 256 levels between the vector's min and max.
+func quantizeScalar(v []float32) scalarVector {
+	q := scalarVector{codes: make([]int8, len(v))}
+	if len(v) == 0 {
+		return q
+	}
+	lo, hi := v[0], v[0]
+	for _, f := range v[1:] {
+		if f < lo {
+			lo = f
+		}
+		if f > hi {
+			hi = f
+		}
+	}
+	q.min = lo
+	if hi > lo {
+		q.scale = (hi - lo) / 255
+	}
+	for i, f := range v {
+		level := 0
+		if q.scale > 0 {
+			level = int(math.Round(float64((f - lo) / q.scale)))
+		}
+		if level > 255 {
+			level = 255
+		}
+		q.codes[i] = int8(level - 128)
+		q.sum += int32(q.codes[i])
+	}
+	q.norm2 = q.dot(q)
+	return q
+}
+
+// offset returns the value of code 0, so that value[i] ~= offset + codes[i] * scale.
+func (q scalarVector) offset() float32 {
+	return q.min + 128*q.scale
+}
+
+// dot returns the dot product of the dequantized vectors of q and o, which must have the
+// same length. The codes are multiplied as integers and the offsets and scales applied
+// to the sums afterwards, so that neither vector is decoded.
+func (q scalarVector) dot(o scalarVector) float32 {
+	var codes int32
+	for i, c := range q.codes {
+		codes += int32(c) * int32(o.codes[i])
+	}
+	qo, oo := float64(q.offset()), float64(o.offset())
+	qs, os := float64(q.scale), float64(o.scale)
+	return float32(float64(len(q.codes))*qo*oo + qo*os*float64(o.sum) + oo*qs*float64(q.sum) + qs*os*float64(codes))
+}
+
+// scalarSimilarity scores two int8 quantized vectors like similarity scores their
+// dequantized values.
+func scalarSimilarity(metric string, a, b scalarVector) float32 {
+	if len(a.codes) != len(b.codes) {
+		return float32(math.Inf(-1))
+	}
+	dot := float64(a.dot(b))
+	switch metric {
+	case "dot":
+		return float32(dot)
+	case "euclid":
+		sum := float64(a.norm2) + float64(b.norm2) - 2*dot
+		if sum < 0 {
+			sum = 0 // Rounding of nearly identical vectors
+		}
+		return float32(1 / (1 + math.Sqrt(sum)))
+	default: // cosine
+		if a.norm2 <= 0 || b.norm2 <= 0 {
+			return 0
+		}
+		return float32(dot / math.Sqrt(float64(a.norm2)*float64(b.norm2)))
+	}
+}
+
+// decode writes the approximate vector into dst, which must have the same length.
+func (q scalarVector) decode(dst []float32) {
+	for i, c := range q.codes {
+		dst[i] = q.min + float32(int(c)+128)*q.scale
+	}
+}
+
+// decodeBinary writes the unit vector with the signs of bits into dst, which holds its
+// dimensions.
+func decodeBinary(dst []float32, bits []uint64) {
+	value := float32(1 / math.Sqrt(float64(len(dst))))
+	for i := range dst {
+		if bits[i/64]&(1<<(uint(i)%64)) != 0 {
+			dst[i] = value
+		} else {
+			dst[i] = -value
+		}
+	}
+}
+
+// quantizeBinary packs the sign of each component of v into bits.
+func quantizeBinary(v []float32) []uint64 {
+	out := make([]uint64, (len(v)+63)/64)
+	for i, f := range v {
+		if f > 0 {
+			out[i/64] |= 1 << (uint(i) % 64)
+		}
+	}
+	return out
+}
+
+// binarySimilarity estimates the cosine of two sign-quantized vectors of dims dimensions as
+// the fraction of agreeing signs mapped onto [-1, 1].
+func binarySimilarity(a, b []uint64, dims int) float32 {
+	if dims == 0 {
+		return 0
+	}
+	hamming := 0
+	for i := range a {
+		hamming += bits.OnesCount64(a[i] ^ b[i])
+	}
+	return float32(dims-2*hamming) / float32(dims)
+}
+
+// similarity scores a against b with the given distance metric, higher meaning closer.
+// Euclidean distance d is reported as 1 / (1 + d) so that every metric sorts descending.
+func similarity(metric string, a, b []float32) float32 {
+	if len(a) != len(b) {
+		return float32(math.Inf(-1))
+	}
+	switch metric {
+	case "dot":
+		var dot float64
+		for i := range a {
+			dot += float64(a[i]) * float64(b[i])
+		}
+		return float32(dot)
+	case "euclid":
+		var sum float64
+		for i := range a {
+			d := float64(a[i]) - float64(b[i])
+			sum += d * d
+		}
+		return float32(1 / (1 + math.Sqrt(sum)))
+	default: // cosine
+		return vecmath.Cosine(a, b)
+	}
+}